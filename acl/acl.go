@@ -0,0 +1,209 @@
+// 访问控制列表
+// 保存所有用户，default 用户总是存在，没有认证的连接以 default 用户的身份执行指令
+
+package acl
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 默认用户
+const DefaultUser = "default"
+
+// 用户列表
+type Registry struct {
+	users map[string]*User
+	mu    sync.RWMutex
+
+	// 检查指令是否存在，用于 +cmd -cmd 规则
+	isCommand func(string) bool
+
+	// 权限检查失败的记录
+	Log *Log
+}
+
+// 创建用户列表
+// 只有 default 用户，requirePass 不为空时需要密码，否则不需要密码
+func MakeRegistry(requirePass string, isCommand func(string) bool) *Registry {
+	registry := &Registry{
+		users:     make(map[string]*User),
+		isCommand: isCommand,
+		Log:       MakeLog(),
+	}
+	registry.users[DefaultUser] = makeDefaultUser(requirePass)
+	return registry
+}
+
+// default 用户拥有所有权限
+func makeDefaultUser(requirePass string) *User {
+	user := newUser(DefaultUser)
+	rules := []string{"on", "allkeys", "allchannels", "allcommands"}
+	if requirePass == "" {
+		rules = append(rules, "nopass")
+	} else {
+		rules = append(rules, ">"+requirePass)
+	}
+	for _, rule := range rules {
+		_ = user.applyRule(rule, nil)
+	}
+	return user
+}
+
+// 获取用户，不存在时返回 nil
+func (registry *Registry) Get(name string) *User {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return registry.users[name]
+}
+
+// 认证，用户不存在、被禁用或者密码错误时返回 false
+func (registry *Registry) Authenticate(name string, password string) bool {
+	user := registry.Get(name)
+	if user == nil || !user.enabled {
+		return false
+	}
+	return user.checkPassword(password)
+}
+
+// 规则解析失败
+type RuleError struct {
+	Rule string
+	Err  error
+}
+
+func (e *RuleError) Error() string {
+	return "Error in ACL SETUSER modifier '" + e.Rule + "': " + e.Err.Error()
+}
+
+// 创建或修改用户，规则全部解析成功后才会生效
+func (registry *Registry) SetUser(name string, rules []string) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	var user *User
+	if old, ok := registry.users[name]; ok {
+		user = old.clone()
+	} else {
+		user = newUser(name)
+	}
+	for _, rule := range rules {
+		if err := user.applyRule(rule, registry.isCommand); err != nil {
+			return &RuleError{Rule: rule, Err: err}
+		}
+	}
+	registry.users[name] = user
+	return nil
+}
+
+// 删除用户，返回删除的个数，不能删除 default 用户
+func (registry *Registry) DelUser(names ...string) (int, error) {
+	for _, name := range names {
+		if name == DefaultUser {
+			return 0, errors.New("The 'default' user cannot be removed")
+		}
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	deleted := 0
+	for _, name := range names {
+		if _, ok := registry.users[name]; ok {
+			delete(registry.users, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// 所有用户，按名称排序
+func (registry *Registry) Users() []*User {
+	registry.mu.RLock()
+	users := make([]*User, 0, len(registry.users))
+	for _, user := range registry.users {
+		users = append(users, user)
+	}
+	registry.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].name < users[j].name
+	})
+	return users
+}
+
+/* ---------- aclfile ---------- */
+
+// 从文件加载用户，每行格式为 user <name> [rules ...]
+// 文件中所有用户都解析成功后才替换现有用户，没有 default 用户时创建不需要密码的 default 用户
+func (registry *Registry) Load(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	users := make(map[string]*User)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 {
+			return errors.New(filename + ":" + strconv.Itoa(lineNum) + ": should start with user keyword")
+		}
+		name := fields[1]
+		if _, ok := users[name]; ok {
+			return errors.New(filename + ":" + strconv.Itoa(lineNum) + ": duplicate user '" + name + "' found")
+		}
+		user := newUser(name)
+		for _, rule := range fields[2:] {
+			if err := user.applyRule(rule, registry.isCommand); err != nil {
+				return errors.New(filename + ":" + strconv.Itoa(lineNum) + ": " + (&RuleError{Rule: rule, Err: err}).Error())
+			}
+		}
+		users[name] = user
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if _, ok := users[DefaultUser]; !ok {
+		users[DefaultUser] = makeDefaultUser("")
+	}
+
+	registry.mu.Lock()
+	registry.users = users
+	registry.mu.Unlock()
+	return nil
+}
+
+// 将所有用户保存到文件，先写入临时文件再替换
+func (registry *Registry) Save(filename string) error {
+	tmpFile := filename + ".tmp"
+	file, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, user := range registry.Users() {
+		_, _ = writer.WriteString(user.Describe() + "\n")
+	}
+	if err = writer.Flush(); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, filename)
+}
@@ -0,0 +1,110 @@
+// 测试用户规则和权限检查
+
+package acl
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestUserRules(t *testing.T) {
+	registry := MakeRegistry("", nil)
+	err := registry.SetUser("alice", []string{"on", ">pw", "~cache:*", "%R~readonly:*", "&news.*", "+@read", "-keys", "+set"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := registry.Get("alice")
+
+	if !registry.Authenticate("alice", "pw") || registry.Authenticate("alice", "wrong") {
+		t.Error("wrong password check")
+	}
+	if !user.CanRunCommand("get", CatRead|CatString|CatFast) || !user.CanRunCommand("set", CatWrite|CatString) {
+		t.Error("expected command allowed")
+	}
+	if user.CanRunCommand("keys", CatRead|CatKeyspace) || user.CanRunCommand("del", CatWrite|CatKeyspace) {
+		t.Error("expected command denied")
+	}
+	if !user.CanAccessKey("cache:1", true) || !user.CanAccessKey("readonly:1", false) {
+		t.Error("expected key allowed")
+	}
+	if user.CanAccessKey("readonly:1", true) || user.CanAccessKey("other", false) {
+		t.Error("expected key denied")
+	}
+	if !user.CanAccessChannel("news.tech", false) || !user.CanAccessChannel("news.*", true) {
+		t.Error("expected channel allowed")
+	}
+	if user.CanAccessChannel("sports", false) || user.CanAccessChannel("news.t*", true) {
+		t.Error("expected channel denied")
+	}
+
+	// 规则错误时不修改用户
+	err = registry.SetUser("alice", []string{"off", "+@nothing"})
+	if err == nil || err.Error() != "Error in ACL SETUSER modifier '+@nothing': Unknown command or category name in ACL" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if !registry.Get("alice").Enabled() {
+		t.Error("user should not be modified")
+	}
+
+	if _, err = registry.DelUser(DefaultUser); err == nil {
+		t.Error("default user should not be removed")
+	}
+	if n, _ := registry.DelUser("alice", "bob"); n != 1 {
+		t.Errorf("expected 1 deleted, actually %d", n)
+	}
+}
+
+func TestDefaultUser(t *testing.T) {
+	registry := MakeRegistry("secret", nil)
+	if registry.Authenticate(DefaultUser, "") || !registry.Authenticate(DefaultUser, "secret") {
+		t.Error("wrong password check")
+	}
+	user := registry.Get(DefaultUser)
+	if !user.CanRunCommand("flushdb", CatWrite|CatDangerous) || !user.CanAccessKey("any", true) {
+		t.Error("default user should have all permissions")
+	}
+}
+
+func TestLoadSave(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "users.acl")
+	registry := MakeRegistry("", nil)
+	if err := registry.SetUser("alice", []string{"on", ">pw", "%W~log:*", "resetchannels", "+@all", "-@dangerous"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := MakeRegistry("", nil)
+	if err := loaded.Load(filename); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{DefaultUser, "alice"} {
+		expected := registry.Get(name).Describe()
+		actual := loaded.Get(name).Describe()
+		if expected != actual {
+			t.Errorf("expected %s, actually %s", expected, actual)
+		}
+	}
+	if !loaded.Authenticate("alice", "pw") {
+		t.Error("password should be loaded")
+	}
+}
+
+func TestLog(t *testing.T) {
+	log := MakeLog()
+	log.Add(ReasonCommand, "toplevel", "get", "alice", "")
+	log.Add(ReasonCommand, "toplevel", "get", "alice", "")
+	log.Add(ReasonKey, "multi", "secret", "alice", "")
+	entries := log.Entries(10)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, actually %d", len(entries))
+	}
+	if entries[0].Reason != ReasonKey || entries[1].Count != 2 {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+	log.Reset()
+	if len(log.Entries(10)) != 0 {
+		t.Error("log should be empty")
+	}
+}
@@ -0,0 +1,88 @@
+// 指令类别
+// 与 redis 一致，用户可以按类别授权，例如 +@read -@dangerous
+
+package acl
+
+import "sort"
+
+// 指令所属的类别，一个指令可以属于多个类别
+type Category uint32
+
+const (
+	CatKeyspace Category = 1 << iota
+	CatRead
+	CatWrite
+	CatSet
+	CatSortedSet
+	CatList
+	CatHash
+	CatString
+	CatBitmap
+	CatHyperLogLog
+	CatGeo
+	CatStream
+	CatPubSub
+	CatAdmin
+	CatFast
+	CatSlow
+	CatBlocking
+	CatDangerous
+	CatConnection
+	CatTransaction
+	CatScripting
+
+	// @all 匹配所有指令
+	CatAll Category = 1<<iota - 1
+)
+
+var categoryNames = map[string]Category{
+	"keyspace":    CatKeyspace,
+	"read":        CatRead,
+	"write":       CatWrite,
+	"set":         CatSet,
+	"sortedset":   CatSortedSet,
+	"list":        CatList,
+	"hash":        CatHash,
+	"string":      CatString,
+	"bitmap":      CatBitmap,
+	"hyperloglog": CatHyperLogLog,
+	"geo":         CatGeo,
+	"stream":      CatStream,
+	"pubsub":      CatPubSub,
+	"admin":       CatAdmin,
+	"fast":        CatFast,
+	"slow":        CatSlow,
+	"blocking":    CatBlocking,
+	"dangerous":   CatDangerous,
+	"connection":  CatConnection,
+	"transaction": CatTransaction,
+	"scripting":   CatScripting,
+}
+
+// 按名称查找类别，不包括 all
+func ParseCategory(name string) (Category, bool) {
+	category, ok := categoryNames[name]
+	return category, ok
+}
+
+// 所有类别的名称，按字母排序
+func CategoryNames() []string {
+	names := make([]string, 0, len(categoryNames))
+	for name := range categoryNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 类别的名称列表，按字母排序
+func (category Category) Names() []string {
+	names := make([]string, 0)
+	for name, c := range categoryNames {
+		if category&c != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,103 @@
+// ACL LOG
+// 记录被拒绝的指令和失败的认证，相同的记录在一段时间内合并计数
+
+package acl
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// 最多保留的记录数
+	maxLogEntries = 128
+	// 相同的记录在这段时间内合并
+	logGroupInterval = 60 * time.Second
+)
+
+// 拒绝的原因
+const (
+	ReasonCommand = "command"
+	ReasonKey     = "key"
+	ReasonChannel = "channel"
+	ReasonAuth    = "auth"
+)
+
+// 一条记录
+type LogEntry struct {
+	ID         int64
+	Count      int
+	Reason     string
+	Context    string // toplevel multi
+	Object     string // 指令名、key 或 channel
+	Username   string
+	ClientInfo string
+	Created    time.Time
+	Updated    time.Time
+}
+
+// 记录列表，最新的记录在前
+type Log struct {
+	entries []*LogEntry
+	nextID  int64
+	mu      sync.Mutex
+}
+
+func MakeLog() *Log {
+	return &Log{}
+}
+
+// 添加记录，与最近的相同记录合并
+func (l *Log) Add(reason string, context string, object string, username string, clientInfo string) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, entry := range l.entries {
+		if entry.Reason == reason && entry.Context == context && entry.Object == object &&
+			entry.Username == username && now.Sub(entry.Updated) < logGroupInterval {
+			entry.Count++
+			entry.Updated = now
+			entry.ClientInfo = clientInfo
+			return
+		}
+	}
+
+	entry := &LogEntry{
+		ID:         l.nextID,
+		Count:      1,
+		Reason:     reason,
+		Context:    context,
+		Object:     object,
+		Username:   username,
+		ClientInfo: clientInfo,
+		Created:    now,
+		Updated:    now,
+	}
+	l.nextID++
+	l.entries = append([]*LogEntry{entry}, l.entries...)
+	if len(l.entries) > maxLogEntries {
+		l.entries = l.entries[:maxLogEntries]
+	}
+}
+
+// 最新的 count 条记录的副本
+func (l *Log) Entries(count int) []LogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if count > len(l.entries) {
+		count = len(l.entries)
+	}
+	entries := make([]LogEntry, count)
+	for i := 0; i < count; i++ {
+		entries[i] = *l.entries[i]
+	}
+	return entries
+}
+
+// 清空记录
+func (l *Log) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = nil
+}
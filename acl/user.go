@@ -0,0 +1,429 @@
+// 用户和权限规则
+// 用户创建后不再修改，ACL SETUSER 复制一份修改后替换，检查权限时不需要加锁
+
+package acl
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"ljr-redis/lib/wildcard"
+)
+
+// 规则错误
+var (
+	errSyntax          = errors.New("Syntax error")
+	errUnknownCategory = errors.New("Unknown command or category name in ACL")
+	errUnknownCommand  = errors.New("Unknown command")
+	errInvalidHash     = errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+	errPassNotFound    = errors.New("no such password")
+)
+
+// 用户
+type User struct {
+	name      string
+	enabled   bool
+	nopass    bool
+	passwords []string // 密码的 sha256 摘要
+
+	commands []commandRule // 按顺序生效，后面的规则覆盖前面的
+	keys     []keyPattern
+	channels []channelPattern
+}
+
+// 指令规则 +cmd -cmd +@category -@category
+type commandRule struct {
+	allow    bool
+	command  string
+	category Category
+}
+
+// key 模式 ~pattern %R~pattern %W~pattern
+type keyPattern struct {
+	raw     string
+	matcher *wildcard.Pattern // 为 nil 表示匹配所有 key
+	read    bool
+	write   bool
+}
+
+// channel 模式 &pattern
+type channelPattern struct {
+	raw     string
+	matcher *wildcard.Pattern // 为 nil 表示匹配所有 channel
+}
+
+// 创建用户，新用户默认禁用，没有密码和任何权限
+func newUser(name string) *User {
+	return &User{name: name}
+}
+
+// 用户名
+func (u *User) Name() string {
+	return u.name
+}
+
+// 是否启用
+func (u *User) Enabled() bool {
+	return u.enabled
+}
+
+// 是否不需要密码
+func (u *User) NoPass() bool {
+	return u.nopass
+}
+
+// 复制用户，规则解析失败时不影响原来的用户
+func (u *User) clone() *User {
+	return &User{
+		name:      u.name,
+		enabled:   u.enabled,
+		nopass:    u.nopass,
+		passwords: append([]string(nil), u.passwords...),
+		commands:  append([]commandRule(nil), u.commands...),
+		keys:      append([]keyPattern(nil), u.keys...),
+		channels:  append([]channelPattern(nil), u.channels...),
+	}
+}
+
+// 密码的摘要
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// 检查密码，与每个摘要都比较一次，比较时间与匹配的位置无关
+func (u *User) checkPassword(password string) bool {
+	if u.nopass {
+		return true
+	}
+	actual := []byte(hashPassword(password))
+	matched := 0
+	for _, expected := range u.passwords {
+		matched |= subtle.ConstantTimeCompare([]byte(expected), actual)
+	}
+	return matched == 1
+}
+
+/* ---------- 规则 ---------- */
+
+// 按顺序应用规则
+// isCommand 用于检查指令是否存在，为 nil 时不检查
+func (u *User) applyRule(rule string, isCommand func(string) bool) error {
+	switch strings.ToLower(rule) {
+	case "on":
+		u.enabled = true
+		return nil
+	case "off":
+		u.enabled = false
+		return nil
+	case "nopass":
+		u.nopass = true
+		u.passwords = nil
+		return nil
+	case "resetpass":
+		u.nopass = false
+		u.passwords = nil
+		return nil
+	case "allkeys":
+		u.keys = []keyPattern{{raw: "*", read: true, write: true}}
+		return nil
+	case "resetkeys":
+		u.keys = nil
+		return nil
+	case "allchannels":
+		u.channels = []channelPattern{{raw: "*"}}
+		return nil
+	case "resetchannels":
+		u.channels = nil
+		return nil
+	case "allcommands":
+		u.commands = []commandRule{{allow: true, category: CatAll}}
+		return nil
+	case "nocommands":
+		u.commands = nil
+		return nil
+	case "reset":
+		u.enabled = false
+		u.nopass = false
+		u.passwords = nil
+		u.commands = nil
+		u.keys = nil
+		u.channels = nil
+		return nil
+	}
+
+	if rule == "" {
+		return errSyntax
+	}
+	switch rule[0] {
+	case '>':
+		u.addPasswordHash(hashPassword(rule[1:]))
+	case '<':
+		return u.removePasswordHash(hashPassword(rule[1:]))
+	case '#':
+		if !isValidHash(rule[1:]) {
+			return errInvalidHash
+		}
+		u.addPasswordHash(rule[1:])
+	case '!':
+		if !isValidHash(rule[1:]) {
+			return errInvalidHash
+		}
+		return u.removePasswordHash(rule[1:])
+	case '~':
+		u.addKeyPattern(rule[1:], true, true)
+	case '%':
+		return u.applyKeyPermission(rule[1:])
+	case '&':
+		u.addChannelPattern(rule[1:])
+	case '+', '-':
+		return u.applyCommandRule(rule[0] == '+', rule[1:], isCommand)
+	default:
+		return errSyntax
+	}
+	return nil
+}
+
+func isValidHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for _, ch := range hash {
+		if !(ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (u *User) addPasswordHash(hash string) {
+	u.nopass = false
+	for _, h := range u.passwords {
+		if h == hash {
+			return
+		}
+	}
+	u.passwords = append(u.passwords, hash)
+}
+
+func (u *User) removePasswordHash(hash string) error {
+	for i, h := range u.passwords {
+		if h == hash {
+			u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+			return nil
+		}
+	}
+	return errPassNotFound
+}
+
+// %R~pattern %W~pattern %RW~pattern
+func (u *User) applyKeyPermission(rule string) error {
+	sep := strings.IndexByte(rule, '~')
+	if sep <= 0 {
+		return errSyntax
+	}
+	read, write := false, false
+	for _, ch := range strings.ToUpper(rule[:sep]) {
+		switch ch {
+		case 'R':
+			read = true
+		case 'W':
+			write = true
+		default:
+			return errSyntax
+		}
+	}
+	u.addKeyPattern(rule[sep+1:], read, write)
+	return nil
+}
+
+func (u *User) addKeyPattern(pattern string, read bool, write bool) {
+	for i, p := range u.keys {
+		if p.raw == pattern {
+			u.keys[i].read = p.read || read
+			u.keys[i].write = p.write || write
+			return
+		}
+	}
+	p := keyPattern{raw: pattern, read: read, write: write}
+	if pattern != "*" {
+		p.matcher = wildcard.CompilePattern(pattern)
+	}
+	u.keys = append(u.keys, p)
+}
+
+func (u *User) addChannelPattern(pattern string) {
+	for _, p := range u.channels {
+		if p.raw == pattern {
+			return
+		}
+	}
+	p := channelPattern{raw: pattern}
+	if pattern != "*" {
+		p.matcher = wildcard.CompilePattern(pattern)
+	}
+	u.channels = append(u.channels, p)
+}
+
+// +cmd -cmd +@category -@category
+func (u *User) applyCommandRule(allow bool, name string, isCommand func(string) bool) error {
+	name = strings.ToLower(name)
+	if strings.HasPrefix(name, "@") {
+		if name == "@all" {
+			if allow {
+				u.commands = []commandRule{{allow: true, category: CatAll}}
+			} else {
+				u.commands = nil
+			}
+			return nil
+		}
+		category, ok := ParseCategory(name[1:])
+		if !ok {
+			return errUnknownCategory
+		}
+		u.commands = append(u.commands, commandRule{allow: allow, category: category})
+		return nil
+	}
+	if name == "" || (isCommand != nil && !isCommand(name)) {
+		return errUnknownCommand
+	}
+	u.commands = append(u.commands, commandRule{allow: allow, command: name})
+	return nil
+}
+
+/* ---------- 权限检查 ---------- */
+
+// 是否可以执行指令，categories 为指令所属的类别
+func (u *User) CanRunCommand(name string, categories Category) bool {
+	allowed := false
+	for _, rule := range u.commands {
+		if rule.command == name || rule.category == CatAll || rule.category&categories != 0 {
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
+
+// 是否可以访问 key，write 为 true 时检查写权限，否则检查读权限
+func (u *User) CanAccessKey(key string, write bool) bool {
+	for _, p := range u.keys {
+		if (write && !p.write) || (!write && !p.read) {
+			continue
+		}
+		if p.matcher == nil || p.matcher.IsMatch(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否可以访问 channel
+// isPattern 为 true 时 channel 是 PSUBSCRIBE 的模式，只有完全相同的模式才允许订阅
+func (u *User) CanAccessChannel(channel string, isPattern bool) bool {
+	for _, p := range u.channels {
+		if p.matcher == nil {
+			return true
+		}
+		if isPattern {
+			if p.raw == channel {
+				return true
+			}
+		} else if p.matcher.IsMatch(channel) {
+			return true
+		}
+	}
+	return false
+}
+
+/* ---------- 描述 ---------- */
+
+// 用户状态的标志
+func (u *User) Flags() []string {
+	flags := make([]string, 0, 2)
+	if u.enabled {
+		flags = append(flags, "on")
+	} else {
+		flags = append(flags, "off")
+	}
+	if u.nopass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+// 密码的摘要
+func (u *User) PasswordHashes() []string {
+	return append([]string(nil), u.passwords...)
+}
+
+// 指令规则，没有规则时为 -@all
+func (u *User) CommandRules() string {
+	if len(u.commands) == 0 {
+		return "-@all"
+	}
+	rules := make([]string, len(u.commands))
+	for i, rule := range u.commands {
+		var b strings.Builder
+		if rule.allow {
+			b.WriteByte('+')
+		} else {
+			b.WriteByte('-')
+		}
+		if rule.command != "" {
+			b.WriteString(rule.command)
+		} else if rule.category == CatAll {
+			b.WriteString("@all")
+		} else {
+			b.WriteString("@" + rule.category.Names()[0])
+		}
+		rules[i] = b.String()
+	}
+	return strings.Join(rules, " ")
+}
+
+// key 模式规则
+func (u *User) KeyRules() string {
+	rules := make([]string, len(u.keys))
+	for i, p := range u.keys {
+		switch {
+		case p.read && p.write:
+			rules[i] = "~" + p.raw
+		case p.read:
+			rules[i] = "%R~" + p.raw
+		default:
+			rules[i] = "%W~" + p.raw
+		}
+	}
+	return strings.Join(rules, " ")
+}
+
+// channel 模式规则
+func (u *User) ChannelRules() string {
+	rules := make([]string, len(u.channels))
+	for i, p := range u.channels {
+		rules[i] = "&" + p.raw
+	}
+	return strings.Join(rules, " ")
+}
+
+// 用于 ACL LIST 和 aclfile 的描述，可以重新解析为相同的用户
+func (u *User) Describe() string {
+	parts := []string{"user", u.name}
+	parts = append(parts, u.Flags()...)
+	for _, hash := range u.passwords {
+		parts = append(parts, "#"+hash)
+	}
+	if keys := u.KeyRules(); keys != "" {
+		parts = append(parts, keys)
+	}
+	if channels := u.ChannelRules(); channels != "" {
+		parts = append(parts, channels)
+	} else {
+		parts = append(parts, "resetchannels")
+	}
+	parts = append(parts, u.CommandRules())
+	return strings.Join(parts, " ")
+}
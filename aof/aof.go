@@ -0,0 +1,265 @@
+// AOF 持久化
+// 写指令通过缓冲 channel 交给后台协程，以 RESP 格式追加到文件
+// 启动时重放 AOF 文件恢复数据
+
+package aof
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ljr-redis/interface/database"
+	"ljr-redis/lib/logger"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/connection"
+	"ljr-redis/redis/parser"
+	"ljr-redis/redis/reply"
+)
+
+// 指令
+type CmdLine = [][]byte
+
+const (
+	// 写指令缓冲 channel 的大小
+	aofQueueSize = 1 << 16
+	// 未配置时的默认文件名
+	defaultFilename = "appendonly.aof"
+)
+
+// appendfsync 刷盘策略
+const (
+	FsyncAlways   = "always"   // 每条指令写入后立即刷盘
+	FsyncEverySec = "everysec" // 每秒刷盘一次
+	FsyncNo       = "no"       // 由操作系统决定刷盘时机
+)
+
+// 待写入的指令
+type payload struct {
+	cmdLine CmdLine
+	dbIndex int
+}
+
+// AOF 处理器
+type Handler struct {
+	loadFunc    LoadFunc      // 启动时读取 AOF 恢复数据
+	aofChan     chan *payload // 写指令缓冲
+	aofFile     *os.File
+	aofFilename string
+	aofFsync    string
+	aofFinished chan struct{} // 后台协程写完缓冲中的指令后关闭
+	closed      chan struct{} // 关闭处理器时关闭，用于停止定时刷盘
+
+	mu        sync.Mutex // 保护文件写入和刷盘
+	currentDB int        // 文件中最后一次 SELECT 的数据库
+
+	// AOF 重写
+	rewriteFunc RewriteFunc
+	rewriting   bool           // 是否正在重写，由 mu 保护
+	rewriteBuf  []*payload     // 重写期间收到的指令，重写完成后追加到新文件
+	rewriteWg   sync.WaitGroup // 关闭处理器时等待重写完成
+}
+
+// 读取 AOF 内容恢复数据，返回最后选择的数据库和完整内容的字节数
+// 返回错误时数据不完整，不能继续追加
+type LoadFunc func(src io.Reader) (int, int64, error)
+
+// 创建 AOF 处理器，先通过 loadFunc 加载已有的 AOF 文件再开始追加
+// rewriteFunc 用于重写时生成新文件的内容
+func NewAOFHandler(filename string, fsync string, loadFunc LoadFunc, rewriteFunc RewriteFunc) (*Handler, error) {
+	if filename == "" {
+		filename = defaultFilename
+	}
+	fsync = strings.ToLower(fsync)
+	switch fsync {
+	case "":
+		fsync = FsyncEverySec
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+	default:
+		return nil, errors.New("invalid appendfsync: " + fsync)
+	}
+
+	h := &Handler{
+		loadFunc:    loadFunc,
+		aofFilename: filename,
+		aofFsync:    fsync,
+		rewriteFunc: rewriteFunc,
+	}
+	if err := h.LoadAof(); err != nil {
+		// 数据没有完整加载，不打开文件追加
+		return nil, err
+	}
+
+	aofFile, err := os.OpenFile(h.aofFilename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	h.aofFile = aofFile
+	h.aofChan = make(chan *payload, aofQueueSize)
+	h.aofFinished = make(chan struct{})
+	h.closed = make(chan struct{})
+
+	go h.handleAof()
+	if h.aofFsync == FsyncEverySec {
+		go h.fsyncEverySecond()
+	}
+	return h, nil
+}
+
+// 追加写指令，always 策略下同步写入并刷盘，否则交给后台协程
+func (h *Handler) AddAof(dbIndex int, cmdLine CmdLine) {
+	p := &payload{
+		cmdLine: cmdLine,
+		dbIndex: dbIndex,
+	}
+	if h.aofFsync == FsyncAlways {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.writeAof(p)
+		return
+	}
+	h.aofChan <- p
+}
+
+// 后台协程，从缓冲中取出指令写入文件
+func (h *Handler) handleAof() {
+	for p := range h.aofChan {
+		h.mu.Lock()
+		h.writeAof(p)
+		h.mu.Unlock()
+	}
+	close(h.aofFinished)
+}
+
+// 写入一条指令，数据库变化时先写入 SELECT，调用者需要持有锁
+func (h *Handler) writeAof(p *payload) {
+	if h.rewriting {
+		h.rewriteBuf = append(h.rewriteBuf, p)
+	}
+	if p.dbIndex != h.currentDB {
+		selectCmd := utils.ToCmdLine("SELECT", strconv.Itoa(p.dbIndex))
+		_, err := h.aofFile.Write(reply.MakeMultiBulkReply(selectCmd).ToBytes())
+		if err != nil {
+			logger.Warn(err)
+			return
+		}
+		h.currentDB = p.dbIndex
+	}
+
+	_, err := h.aofFile.Write(reply.MakeMultiBulkReply(p.cmdLine).ToBytes())
+	if err != nil {
+		logger.Warn(err)
+		return
+	}
+	if h.aofFsync == FsyncAlways {
+		if err := h.aofFile.Sync(); err != nil {
+			logger.Warn(err)
+		}
+	}
+}
+
+// everysec 策略下每秒刷盘
+func (h *Handler) fsyncEverySecond() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.Fsync()
+		case <-h.closed:
+			return
+		}
+	}
+}
+
+// 将文件内容刷到磁盘
+func (h *Handler) Fsync() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.aofFile.Sync(); err != nil {
+		logger.Warn(err)
+	}
+}
+
+// 读取 AOF 文件恢复数据
+func (h *Handler) LoadAof() error {
+	file, err := os.Open(h.aofFilename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn(err)
+		}
+		return nil
+	}
+	defer file.Close()
+
+	// 之后追加的指令需要接着文件中最后选择的数据库
+	currentDB, size, err := h.loadFunc(file)
+	if err != nil {
+		return err
+	}
+	h.currentDB = currentDB
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if size < info.Size() {
+		// 文件末尾的指令不完整，截断后再追加，否则之后追加的指令会被当作它的一部分
+		logger.Warn("aof file is truncated, remove the incomplete command at offset " + strconv.FormatInt(size, 10))
+		if err := os.Truncate(h.aofFilename, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 通过伪造连接重放 reader 中的指令，返回最后选择的数据库和完整指令的字节数
+// 文件末尾不完整的指令被丢弃，不计入字节数
+func Replay(db database.DB, reader io.Reader) (int, int64) {
+	fakeConn := connection.NewFakeConn()
+	ch := parser.ParseStream(reader)
+	var size int64
+	for p := range ch {
+		size = p.Offset
+		if p.Err != nil {
+			if p.Err == io.EOF || p.Err == io.ErrUnexpectedEOF {
+				break
+			}
+			logger.Error("parse aof error: " + p.Err.Error())
+			continue
+		}
+		if p.Data == nil {
+			logger.Error("empty payload")
+			continue
+		}
+		r, ok := p.Data.(*reply.MultiBulkReply)
+		if !ok {
+			logger.Error("require multi bulk reply")
+			continue
+		}
+		ret := db.Exec(fakeConn, r.Args)
+		if reply.IsErrorReply(ret) {
+			logger.Error("exec aof error: " + string(ret.ToBytes()))
+		}
+	}
+	return fakeConn.GetDBIndex(), size
+}
+
+// 写完缓冲中的指令，刷盘并关闭文件
+func (h *Handler) Close() {
+	h.rewriteWg.Wait()
+	if h.aofFile == nil {
+		return
+	}
+	close(h.aofChan)
+	<-h.aofFinished
+	close(h.closed)
+	h.Fsync()
+	if err := h.aofFile.Close(); err != nil {
+		logger.Warn(err)
+	}
+}
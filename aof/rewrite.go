@@ -0,0 +1,176 @@
+// AOF 重写
+// 以重写开始时的 AOF 文件为起点生成新文件，重写期间收到的指令缓存起来追加到新文件末尾，最后替换旧文件
+
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"ljr-redis/lib/logger"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+// 生成新 AOF 文件的内容，src 为重写起点之前的 AOF 内容，结果写入 dst
+type RewriteFunc func(src io.Reader, dst io.Writer) error
+
+var errRewriteInProgress = errors.New("Background append only file rewriting already in progress")
+
+// 重写上下文
+type rewriteCtx struct {
+	tmpFile  *os.File // 新内容写入的临时文件
+	fileSize int64    // 重写开始时 AOF 文件的大小
+}
+
+// 重写 AOF 文件，同一时间只能有一个重写在进行
+func (h *Handler) Rewrite() error {
+	ctx, err := h.startRewrite()
+	if err != nil {
+		return err
+	}
+	return h.rewrite(ctx)
+}
+
+// 在后台重写 AOF 文件，只返回开始重写时的错误
+func (h *Handler) BackgroundRewrite() error {
+	ctx, err := h.startRewrite()
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := h.rewrite(ctx); err != nil {
+			logger.Error("rewrite aof failed: " + err.Error())
+			return
+		}
+		logger.Info("background append only file rewriting finished")
+	}()
+	return nil
+}
+
+func (h *Handler) rewrite(ctx *rewriteCtx) error {
+	defer h.rewriteWg.Done()
+
+	if err := h.doRewrite(ctx); err != nil {
+		h.abortRewrite(ctx)
+		return err
+	}
+	return h.finishRewrite(ctx)
+}
+
+// 记录重写起点，之后写入的指令同时缓存到 rewriteBuf
+func (h *Handler) startRewrite() (*rewriteCtx, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.rewriting {
+		return nil, errRewriteInProgress
+	}
+	// 重写起点之前的内容需要先刷到文件
+	if err := h.aofFile.Sync(); err != nil {
+		return nil, err
+	}
+	info, err := h.aofFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(h.aofFilename), "temp-rewriteaof-*.aof")
+	if err != nil {
+		return nil, err
+	}
+
+	h.rewriting = true
+	h.rewriteBuf = nil
+	h.rewriteWg.Add(1)
+	return &rewriteCtx{
+		tmpFile:  tmpFile,
+		fileSize: info.Size(),
+	}, nil
+}
+
+// 读取起点之前的内容生成新文件，不持有锁，不影响指令写入
+func (h *Handler) doRewrite(ctx *rewriteCtx) error {
+	src, err := os.Open(h.aofFilename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	writer := bufio.NewWriter(ctx.tmpFile)
+	if err := h.rewriteFunc(io.LimitReader(src, ctx.fileSize), writer); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// 追加重写期间缓存的指令，用新文件替换旧文件
+func (h *Handler) finishRewrite(ctx *rewriteCtx) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// 新文件末尾选择的数据库未知，第一条缓存的指令前总是写入 SELECT
+	currentDB := -1
+	for _, p := range h.rewriteBuf {
+		if p.dbIndex != currentDB {
+			selectCmd := utils.ToCmdLine("SELECT", strconv.Itoa(p.dbIndex))
+			if _, err := ctx.tmpFile.Write(reply.MakeMultiBulkReply(selectCmd).ToBytes()); err != nil {
+				h.abortRewriteLocked(ctx)
+				return err
+			}
+			currentDB = p.dbIndex
+		}
+		if _, err := ctx.tmpFile.Write(reply.MakeMultiBulkReply(p.cmdLine).ToBytes()); err != nil {
+			h.abortRewriteLocked(ctx)
+			return err
+		}
+	}
+	if err := ctx.tmpFile.Sync(); err != nil {
+		h.abortRewriteLocked(ctx)
+		return err
+	}
+	if err := ctx.tmpFile.Close(); err != nil {
+		h.abortRewriteLocked(ctx)
+		return err
+	}
+
+	// 替换前先打开新文件，打开失败时放弃重写，继续写入旧文件
+	aofFile, err := os.OpenFile(ctx.tmpFile.Name(), os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		h.abortRewriteLocked(ctx)
+		return err
+	}
+	// rename 是原子的，打开的文件在 rename 后就是新的 AOF 文件
+	if err := os.Rename(ctx.tmpFile.Name(), h.aofFilename); err != nil {
+		_ = aofFile.Close()
+		h.abortRewriteLocked(ctx)
+		return err
+	}
+	h.rewriting = false
+	h.rewriteBuf = nil
+
+	if err := h.aofFile.Close(); err != nil {
+		logger.Warn(err)
+	}
+	h.aofFile = aofFile
+	h.currentDB = currentDB
+	return nil
+}
+
+// 放弃重写，删除临时文件
+func (h *Handler) abortRewrite(ctx *rewriteCtx) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.abortRewriteLocked(ctx)
+}
+
+// 放弃重写，调用者需要持有锁
+func (h *Handler) abortRewriteLocked(ctx *rewriteCtx) {
+	h.rewriting = false
+	h.rewriteBuf = nil
+	_ = ctx.tmpFile.Close()
+	_ = os.Remove(ctx.tmpFile.Name())
+}
@@ -0,0 +1,129 @@
+// 测试 AOF 重写
+
+package aof
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+// 记录重放的指令
+type recordDB struct {
+	mu   sync.Mutex
+	cmds []string
+}
+
+func (db *recordDB) Exec(c redis.Connection, args [][]byte) redis.Reply {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	cmd := string(args[0])
+	for _, arg := range args[1:] {
+		cmd += " " + string(arg)
+	}
+	db.cmds = append(db.cmds, cmd)
+	if strings.EqualFold(string(args[0]), "select") {
+		c.SelectDB(int(args[1][0] - '0'))
+	}
+	return reply.MakeOkReply()
+}
+
+func (db *recordDB) AfterClientClose(c redis.Connection) {}
+
+func (db *recordDB) Close() {}
+
+func (db *recordDB) load(src io.Reader) (int, int64, error) {
+	dbIndex, size := Replay(db, src)
+	return dbIndex, size, nil
+}
+
+func TestRewriteBuffer(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	started := make(chan struct{})
+	resume := make(chan struct{})
+	rewriteFunc := func(src io.Reader, dst io.Writer) error {
+		// 只保留重写起点之前内容中的最后一条指令
+		db := &recordDB{}
+		Replay(db, src)
+		close(started)
+		<-resume
+		last := strings.Split(db.cmds[len(db.cmds)-1], " ")
+		_, err := dst.Write(reply.MakeMultiBulkReply(utils.ToCmdLine(last...)).ToBytes())
+		return err
+	}
+
+	h, err := NewAOFHandler(filename, FsyncAlways, (&recordDB{}).load, rewriteFunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.AddAof(0, utils.ToCmdLine("set", "a", "1"))
+	h.AddAof(0, utils.ToCmdLine("set", "a", "2"))
+
+	if err := h.BackgroundRewrite(); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := h.BackgroundRewrite(); err != errRewriteInProgress {
+		t.Errorf("expected rewrite in progress, actually %v", err)
+	}
+	// 重写期间的指令缓存后追加到新文件
+	h.AddAof(1, utils.ToCmdLine("set", "b", "1"))
+	close(resume)
+	h.Close()
+
+	db := &recordDB{}
+	h, err = NewAOFHandler(filename, FsyncNo, db.load, rewriteFunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"set a 2", "SELECT 1", "set b 1"}
+	if !reflect.DeepEqual(db.cmds, expected) {
+		t.Errorf("expected %v, actually %v", expected, db.cmds)
+	}
+	if h.currentDB != 1 {
+		t.Errorf("expected current db 1, actually %d", h.currentDB)
+	}
+	h.Close()
+}
+
+func TestRewriteRenameFailed(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	rewriteFunc := func(src io.Reader, dst io.Writer) error {
+		// 旧文件移走后在原位置放一个非空目录，替换文件会失败
+		if err := os.Rename(filename, filename+".old"); err != nil {
+			return err
+		}
+		return os.MkdirAll(filepath.Join(filename, "dir"), 0700)
+	}
+	h, err := NewAOFHandler(filename, FsyncAlways, (&recordDB{}).load, rewriteFunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.AddAof(0, utils.ToCmdLine("set", "a", "1"))
+	if err := h.Rewrite(); err == nil {
+		t.Fatal("expected rewrite error")
+	}
+	// 继续写入旧文件
+	h.AddAof(0, utils.ToCmdLine("set", "b", "1"))
+	h.Close()
+
+	db := &recordDB{}
+	file, err := os.Open(filename + ".old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	Replay(db, file)
+	expected := []string{"set a 1", "set b 1"}
+	if !reflect.DeepEqual(db.cmds, expected) {
+		t.Errorf("expected %v, actually %v", expected, db.cmds)
+	}
+}
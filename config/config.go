@@ -16,13 +16,21 @@ import (
 
 // 全局配置属性
 type ServerProperties struct {
-	Bind           string `cfg:"bind"`
-	Port           int    `cfg:"port"`
-	AppendOnly     bool   `cfg:"appendOnly"`
-	AppendFileName string `cfg:"appendFileName"`
-	MaxClients     int    `cfg:"maxclients"`
-	RequirePass    string `cfg:"requirepass"`
-	Databases      int    `cfg:"databases"`
+	Bind              string `cfg:"bind"`
+	Port              int    `cfg:"port"`
+	AppendOnly        bool   `cfg:"appendOnly"`
+	AppendFileName    string `cfg:"appendFileName"`
+	AppendFsync       string `cfg:"appendfsync"`
+	AofUseRdbPreamble bool   `cfg:"aof-use-rdb-preamble"`
+	DbFilename        string `cfg:"dbfilename"`
+	Dir               string `cfg:"dir"`
+	Save              string `cfg:"save"`
+	MaxClients        int    `cfg:"maxclients"`
+	RequirePass       string `cfg:"requirepass"`
+	AclFile           string `cfg:"aclfile"`
+	Databases         int    `cfg:"databases"`
+
+	NotifyKeyspaceEvents string `cfg:"notify-keyspace-events"`
 
 	Peers []string `cfg:"peers"`
 	Self  string   `cfg:"self"`
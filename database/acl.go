@@ -0,0 +1,328 @@
+// 访问控制
+// 在 MultiDB.Exec 分发指令前检查当前用户是否可以执行指令、访问 key 和 channel
+
+package database
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ljr-redis/acl"
+	"ljr-redis/config"
+	"ljr-redis/interface/redis"
+	"ljr-redis/redis/reply"
+)
+
+// 创建用户列表，+cmd -cmd 规则只能使用已注册的指令
+func makeACLRegistry() *acl.Registry {
+	return acl.MakeRegistry(config.Properties.RequirePass, func(name string) bool {
+		_, ok := cmdTable[name]
+		return ok
+	})
+}
+
+// 连接当前的用户，用户被删除或禁用时返回 nil
+func (mdb *MultiDB) currentUser(c redis.Connection) *acl.User {
+	user := mdb.acl.Get(c.GetUser())
+	if user == nil || !user.Enabled() {
+		return nil
+	}
+	return user
+}
+
+// ACL LOG 中的上下文
+func aclContext(c redis.Connection) string {
+	if c != nil && c.InMultiState() {
+		return "multi"
+	}
+	return "toplevel"
+}
+
+// ACL LOG 中的客户端信息
+func aclClientInfo(c redis.Connection) string {
+	if c == nil {
+		return ""
+	}
+	return "user=" + c.GetUser() + " db=" + strconv.Itoa(c.GetDBIndex())
+}
+
+// 检查权限，没有权限时返回错误
+// key 列表由指令的 key specs 给出，参数个数错误时交给指令自己处理
+func (mdb *MultiDB) checkPermission(c redis.Connection, cmdName string, cmdLine [][]byte) reply.ErrorReply {
+	if isInternalConn(c) {
+		return nil
+	}
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		return nil
+	}
+	user := mdb.currentUser(c)
+	if user == nil {
+		return reply.MakeErrReply("NOAUTH Authentication required.")
+	}
+
+	if !user.CanRunCommand(cmdName, cmd.categories) {
+		mdb.acl.Log.Add(acl.ReasonCommand, aclContext(c), cmdName, user.Name(), aclClientInfo(c))
+		return reply.MakeErrReply("NOPERM User " + user.Name() + " has no permissions to run the '" + cmdName + "' command")
+	}
+
+	if validateArity(cmd.arity, cmdLine) {
+		for _, key := range cmd.getKeys(cmdLine) {
+			if !user.CanAccessKey(key, cmd.writesKey(cmdLine, key)) {
+				mdb.acl.Log.Add(acl.ReasonKey, aclContext(c), key, user.Name(), aclClientInfo(c))
+				return reply.MakeErrReply("NOPERM No permissions to access a key")
+			}
+		}
+	}
+
+	channels, isPattern := commandChannels(cmdName, cmdLine[1:])
+	for _, channel := range channels {
+		if !user.CanAccessChannel(channel, isPattern) {
+			mdb.acl.Log.Add(acl.ReasonChannel, aclContext(c), channel, user.Name(), aclClientInfo(c))
+			return reply.MakeErrReply("NOPERM No permissions to access a channel")
+		}
+	}
+	return nil
+}
+
+// 指令是否修改 key，有 prepare 的指令按它给出的写 key 判断，否则按 write 标志判断
+func (cmd *command) writesKey(cmdLine [][]byte, key string) bool {
+	if cmd.prepare == nil {
+		return cmd.flags&flagWrite != 0
+	}
+	write, _ := cmd.prepare(cmdLine[1:])
+	for _, k := range write {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// 发布订阅指令访问的 channel，退订不需要检查
+func commandChannels(cmdName string, args [][]byte) ([]string, bool) {
+	var channels []string
+	switch cmdName {
+	case "subscribe", "ssubscribe", "psubscribe":
+		channels = make([]string, len(args))
+		for i, arg := range args {
+			channels[i] = string(arg)
+		}
+	case "publish", "spublish":
+		if len(args) > 0 {
+			channels = []string{string(args[0])}
+		}
+	}
+	return channels, cmdName == "psubscribe"
+}
+
+/* ---------- ACL 指令 ---------- */
+
+// ACL <subcommand> [args ...]
+func execACL(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("acl")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch subCmd {
+	case "setuser":
+		if len(args) < 1 {
+			return reply.MakeArgNumErrReply("acl|setuser")
+		}
+		rules := make([]string, len(args)-1)
+		for i, arg := range args[1:] {
+			rules[i] = string(arg)
+		}
+		if err := mdb.acl.SetUser(string(args[0]), rules); err != nil {
+			return reply.MakeErrReply("ERR " + err.Error())
+		}
+		return reply.MakeOkReply()
+
+	case "getuser":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("acl|getuser")
+		}
+		return aclGetUser(mdb, string(args[0]))
+
+	case "deluser":
+		if len(args) < 1 {
+			return reply.MakeArgNumErrReply("acl|deluser")
+		}
+		names := make([]string, len(args))
+		for i, arg := range args {
+			names[i] = string(arg)
+		}
+		deleted, err := mdb.acl.DelUser(names...)
+		if err != nil {
+			return reply.MakeErrReply("ERR " + err.Error())
+		}
+		return reply.MakeIntReply(int64(deleted))
+
+	case "list":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("acl|list")
+		}
+		users := mdb.acl.Users()
+		lines := make([][]byte, len(users))
+		for i, user := range users {
+			lines[i] = []byte(user.Describe())
+		}
+		return reply.MakeMultiBulkReply(lines)
+
+	case "users":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("acl|users")
+		}
+		users := mdb.acl.Users()
+		names := make([][]byte, len(users))
+		for i, user := range users {
+			names[i] = []byte(user.Name())
+		}
+		return reply.MakeMultiBulkReply(names)
+
+	case "whoami":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("acl|whoami")
+		}
+		if isInternalConn(c) {
+			return reply.MakeBulkReply([]byte(acl.DefaultUser))
+		}
+		return reply.MakeBulkReply([]byte(c.GetUser()))
+
+	case "cat":
+		if len(args) > 1 {
+			return reply.MakeArgNumErrReply("acl|cat")
+		}
+		return aclCat(args)
+
+	case "log":
+		if len(args) > 1 {
+			return reply.MakeArgNumErrReply("acl|log")
+		}
+		return aclLog(mdb, args)
+
+	case "load":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("acl|load")
+		}
+		if config.Properties.AclFile == "" {
+			return reply.MakeErrReply("ERR This Redis instance is not configured to use an ACL file. " +
+				"You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE")
+		}
+		if err := mdb.acl.Load(config.Properties.AclFile); err != nil {
+			return reply.MakeErrReply("ERR " + err.Error())
+		}
+		return reply.MakeOkReply()
+
+	case "save":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("acl|save")
+		}
+		if config.Properties.AclFile == "" {
+			return reply.MakeErrReply("ERR This Redis instance is not configured to use an ACL file. " +
+				"You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE")
+		}
+		if err := mdb.acl.Save(config.Properties.AclFile); err != nil {
+			return reply.MakeErrReply("ERR There was an error trying to save the ACLs. Please check the server logs for more information")
+		}
+		return reply.MakeOkReply()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try ACL HELP.")
+}
+
+// ACL GETUSER username
+func aclGetUser(mdb *MultiDB, name string) redis.Reply {
+	user := mdb.acl.Get(name)
+	if user == nil {
+		return reply.MakeNullBulkReply()
+	}
+	flags := user.Flags()
+	flagReplies := make([][]byte, len(flags))
+	for i, flag := range flags {
+		flagReplies[i] = []byte(flag)
+	}
+	hashes := user.PasswordHashes()
+	hashReplies := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		hashReplies[i] = []byte(hash)
+	}
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkReply([]byte("flags")), reply.MakeMultiBulkReply(flagReplies),
+		reply.MakeBulkReply([]byte("passwords")), reply.MakeMultiBulkReply(hashReplies),
+		reply.MakeBulkReply([]byte("commands")), reply.MakeBulkReply([]byte(user.CommandRules())),
+		reply.MakeBulkReply([]byte("keys")), reply.MakeBulkReply([]byte(user.KeyRules())),
+		reply.MakeBulkReply([]byte("channels")), reply.MakeBulkReply([]byte(user.ChannelRules())),
+		reply.MakeBulkReply([]byte("selectors")), reply.MakeEmptyMultiBulkReply(),
+	})
+}
+
+// ACL CAT [category]
+func aclCat(args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		names := acl.CategoryNames()
+		result := make([][]byte, len(names))
+		for i, name := range names {
+			result[i] = []byte(name)
+		}
+		return reply.MakeMultiBulkReply(result)
+	}
+	category, ok := acl.ParseCategory(strings.ToLower(string(args[0])))
+	if !ok {
+		return reply.MakeErrReply("ERR Unknown category '" + string(args[0]) + "'")
+	}
+	names := make([]string, 0)
+	for name, cmd := range cmdTable {
+		if cmd.categories&category != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	result := make([][]byte, len(names))
+	for i, name := range names {
+		result[i] = []byte(name)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// ACL LOG [count | RESET]
+func aclLog(mdb *MultiDB, args [][]byte) redis.Reply {
+	count := 10
+	if len(args) == 1 {
+		if strings.ToLower(string(args[0])) == "reset" {
+			mdb.acl.Log.Reset()
+			return reply.MakeOkReply()
+		}
+		n, err := strconv.Atoi(string(args[0]))
+		if err != nil || n < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	now := time.Now()
+	entries := mdb.acl.Log.Entries(count)
+	result := make([]redis.Reply, len(entries))
+	for i, entry := range entries {
+		age := now.Sub(entry.Created).Seconds()
+		result[i] = reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkReply([]byte("count")), reply.MakeIntReply(int64(entry.Count)),
+			reply.MakeBulkReply([]byte("reason")), reply.MakeBulkReply([]byte(entry.Reason)),
+			reply.MakeBulkReply([]byte("context")), reply.MakeBulkReply([]byte(entry.Context)),
+			reply.MakeBulkReply([]byte("object")), reply.MakeBulkReply([]byte(entry.Object)),
+			reply.MakeBulkReply([]byte("username")), reply.MakeBulkReply([]byte(entry.Username)),
+			reply.MakeBulkReply([]byte("age-seconds")), reply.MakeBulkReply([]byte(strconv.FormatFloat(age, 'f', 3, 64))),
+			reply.MakeBulkReply([]byte("client-info")), reply.MakeBulkReply([]byte(entry.ClientInfo)),
+			reply.MakeBulkReply([]byte("entry-id")), reply.MakeIntReply(entry.ID),
+			reply.MakeBulkReply([]byte("timestamp-created")), reply.MakeIntReply(entry.Created.UnixNano() / int64(time.Millisecond)),
+			reply.MakeBulkReply([]byte("timestamp-last-updated")), reply.MakeIntReply(entry.Updated.UnixNano() / int64(time.Millisecond)),
+		})
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+func init() {
+	registerSpecialCommand("acl", -2, flagAdmin|flagNoScript|flagLoading|flagStale, 0, 0, 0, acl.CatAdmin|acl.CatSlow|acl.CatDangerous)
+}
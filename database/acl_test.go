@@ -0,0 +1,93 @@
+// 测试 ACL 指令和权限检查
+
+package database
+
+import (
+	"testing"
+
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/connection"
+	"ljr-redis/redis/reply"
+)
+
+func TestACLPermission(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	admin := &connection.Connection{}
+	assertReply(t, mdb.Exec(admin, utils.ToCmdLine("acl", "whoami")), reply.MakeBulkReply([]byte("default")))
+	assertReply(t, mdb.Exec(admin, utils.ToCmdLine("acl", "setuser", "alice", "on", ">pw",
+		"~cache:*", "%R~config:*", "&news.*", "+@read", "+@write", "+@pubsub", "+@transaction", "-del")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(admin, utils.ToCmdLine("acl", "setuser", "alice", "+bad")),
+		reply.MakeErrReply("ERR Error in ACL SETUSER modifier '+bad': Unknown command"))
+
+	conn := &connection.Connection{}
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("auth", "alice", "pw")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("acl", "whoami")),
+		reply.MakeErrReply("NOPERM User alice has no permissions to run the 'acl' command"))
+
+	// key
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("set", "cache:1", "v")), reply.MakeOkReply())
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "cache:1")), "v")
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "config:1")), reply.MakeNullBulkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("set", "config:1", "v")),
+		reply.MakeErrReply("NOPERM No permissions to access a key"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("mset", "cache:2", "v", "other", "v")),
+		reply.MakeErrReply("NOPERM No permissions to access a key"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("del", "cache:1")),
+		reply.MakeErrReply("NOPERM User alice has no permissions to run the 'del' command"))
+
+	// channel
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("publish", "news.tech", "hi")), 0)
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("publish", "sports", "hi")),
+		reply.MakeErrReply("NOPERM No permissions to access a channel"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("psubscribe", "news*")),
+		reply.MakeErrReply("NOPERM No permissions to access a channel"))
+
+	// 没有 prepare 的指令也按 key specs 检查
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("watch", "cache:1", "other")),
+		reply.MakeErrReply("NOPERM No permissions to access a key"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("watch", "cache:1", "config:1")), reply.MakeOkReply())
+
+	// 事务中拒绝的指令也会记录
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("set", "other", "v")),
+		reply.MakeErrReply("NOPERM No permissions to access a key"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("discard")), reply.MakeOkReply())
+
+	result := mdb.Exec(admin, utils.ToCmdLine("acl", "log"))
+	entries, ok := result.(*reply.MultiRawReply)
+	if !ok || len(entries.Replies) != 7 {
+		t.Fatalf("unexpected acl log %q", result.ToBytes())
+	}
+	assertReply(t, mdb.Exec(admin, utils.ToCmdLine("acl", "log", "reset")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(admin, utils.ToCmdLine("acl", "log")), reply.MakeMultiRawReply(nil))
+
+	// 禁用后需要重新认证
+	assertReply(t, mdb.Exec(admin, utils.ToCmdLine("acl", "setuser", "alice", "off")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "cache:1")), reply.MakeErrReply("NOAUTH Authentication required."))
+}
+
+func TestACLCommands(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	conn := &connection.Connection{}
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("acl", "setuser", "bob", "on", "nopass", "~*", "+get")), reply.MakeOkReply())
+	assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("acl", "users")), "bob", "default")
+	assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("acl", "list")),
+		"user bob on nopass ~* resetchannels +get",
+		"user default on nopass ~* &* +@all")
+
+	result := mdb.Exec(conn, utils.ToCmdLine("acl", "getuser", "bob"))
+	user, ok := result.(*reply.MultiRawReply)
+	if !ok || len(user.Replies) != 12 {
+		t.Fatalf("unexpected acl getuser %q", result.ToBytes())
+	}
+	assertBulk(t, user.Replies[5], "+get")
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("acl", "getuser", "nobody")), reply.MakeNullBulkReply())
+
+	assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("acl", "cat", "transaction")), "discard", "exec", "multi", "watch")
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("acl", "cat", "nothing")))
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("acl", "save")))
+
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("acl", "deluser", "default")),
+		reply.MakeErrReply("ERR The 'default' user cannot be removed"))
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("acl", "deluser", "bob", "nobody")), 1)
+}
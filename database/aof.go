@@ -0,0 +1,123 @@
+// AOF 重写指令
+
+package database
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"ljr-redis/acl"
+	"ljr-redis/aof"
+	"ljr-redis/config"
+	"ljr-redis/interface/database"
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/rdb"
+	"ljr-redis/redis/reply"
+)
+
+// 记录读取的字节数
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// 读取 AOF 恢复数据，返回最后选择的数据库和完整内容的字节数
+// 以 RDB 文件头开始时先加载 RDB 前导部分，再重放之后的增量指令
+// RDB 前导部分损坏时无法得到完整的数据，返回错误
+func (mdb *MultiDB) loadAof(src io.Reader) (int, int64, error) {
+	counter := &countingReader{reader: src}
+	reader := bufio.NewReader(counter)
+	var preambleSize int64
+	if rdb.HasPreamble(reader) {
+		if err := mdb.loadRDBFrom(reader); err != nil {
+			return 0, 0, errors.New("load aof rdb preamble failed: " + err.Error())
+		}
+		// 读入缓冲但没有解析的部分不属于 RDB 前导部分
+		preambleSize = counter.count - int64(reader.Buffered())
+	}
+	dbIndex, size := aof.Replay(mdb, reader)
+	return dbIndex, preambleSize + size, nil
+}
+
+// 生成新的 AOF 内容
+// 将重写起点之前的 AOF 加载到临时数据库，开启 aof-use-rdb-preamble 时写入 RDB 快照
+// 否则每个 key 只生成重建它所需的指令和过期时间
+func rewriteAof(src io.Reader, dst io.Writer) error {
+	tmpDB := MakeBasicMultiDB()
+	if _, _, err := tmpDB.loadAof(src); err != nil {
+		return err
+	}
+	if config.Properties.AofUseRdbPreamble {
+		return tmpDB.dumpRDB(dst, true)
+	}
+
+	var err error
+	writeCmd := func(cmdLine CmdLine) bool {
+		_, err = dst.Write(reply.MakeMultiBulkReply(cmdLine).ToBytes())
+		return err == nil
+	}
+	for i := range tmpDB.dbSet {
+		selected := false
+		tmpDB.ForEach(i, func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+			cmdLine := entityToCmd(key, entity)
+			if cmdLine == nil {
+				return true
+			}
+			// 只为有数据的数据库写入 SELECT
+			if !selected {
+				if !writeCmd(utils.ToCmdLine("SELECT", strconv.Itoa(i))) {
+					return false
+				}
+				selected = true
+			}
+			if !writeCmd(cmdLine) {
+				return false
+			}
+			if expiration != nil {
+				return writeCmd(makeExpireCmd(key, *expiration))
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 同步重写 AOF
+func RewriteAOF(mdb *MultiDB, args [][]byte) redis.Reply {
+	if mdb.aofHandler == nil {
+		return reply.MakeErrReply("ERR AOF is not enabled")
+	}
+	if err := mdb.aofHandler.Rewrite(); err != nil {
+		return reply.MakeErrReply("ERR " + err.Error())
+	}
+	return reply.MakeOkReply()
+}
+
+// 后台重写 AOF
+func BGRewriteAOF(mdb *MultiDB, args [][]byte) redis.Reply {
+	if mdb.aofHandler == nil {
+		return reply.MakeErrReply("ERR AOF is not enabled")
+	}
+	if err := mdb.aofHandler.BackgroundRewrite(); err != nil {
+		return reply.MakeErrReply("ERR " + err.Error())
+	}
+	return reply.MakeStatusReply("Background append only file rewriting started")
+}
+
+func init() {
+	registerSpecialCommand("bgrewriteaof", 1, flagAdmin|flagNoScript, 0, 0, 0, acl.CatAdmin|acl.CatSlow|acl.CatDangerous)
+	registerSpecialCommand("rewriteaof", 1, flagAdmin|flagNoScript, 0, 0, 0, acl.CatAdmin|acl.CatSlow|acl.CatDangerous)
+}
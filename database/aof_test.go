@@ -0,0 +1,294 @@
+// 测试 AOF 持久化
+
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ljr-redis/aof"
+	"ljr-redis/config"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/connection"
+	"ljr-redis/redis/reply"
+)
+
+// 开启 AOF 后创建服务器，测试结束时恢复配置
+func setupAofConfig(t *testing.T, filename string, fsync string) {
+	old := config.Properties
+	config.Properties = &config.ServerProperties{
+		AppendOnly:     true,
+		AppendFileName: filename,
+		AppendFsync:    fsync,
+	}
+	t.Cleanup(func() {
+		config.Properties = old
+	})
+}
+
+func TestAofReload(t *testing.T) {
+	for _, fsync := range []string{aof.FsyncAlways, aof.FsyncEverySec, aof.FsyncNo} {
+		filename := filepath.Join(t.TempDir(), "appendonly.aof")
+		setupAofConfig(t, filename, fsync)
+
+		mdb := NewStandaloneServer()
+		conn := connection.NewFakeConn()
+		mdb.Exec(conn, utils.ToCmdLine("set", "str", "v"))
+		mdb.Exec(conn, utils.ToCmdLine("rpush", "list", "a", "b", "c"))
+		mdb.Exec(conn, utils.ToCmdLine("lpop", "list"))
+		mdb.Exec(conn, utils.ToCmdLine("select", "1"))
+		mdb.Exec(conn, utils.ToCmdLine("hset", "hash", "f", "v"))
+		mdb.Exec(conn, utils.ToCmdLine("zadd", "zset", "1", "a", "2", "b"))
+		mdb.Exec(conn, utils.ToCmdLine("get", "none"))
+		mdb.Exec(conn, utils.ToCmdLine("select", "0"))
+		mdb.Exec(conn, utils.ToCmdLine("sadd", "set", "a"))
+		mdb.Exec(conn, utils.ToCmdLine("move", "set", "2"))
+		mdb.Close()
+
+		mdb = NewStandaloneServer()
+		conn = connection.NewFakeConn()
+		assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "str")), "v")
+		assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("lrange", "list", "0", "-1")), "b", "c")
+		assertInt(t, mdb.Exec(conn, utils.ToCmdLine("exists", "hash", "set")), 0)
+		// 追加的指令需要接着文件中最后选择的数据库
+		mdb.Exec(conn, utils.ToCmdLine("set", "after", "1"))
+		mdb.Exec(conn, utils.ToCmdLine("select", "1"))
+		assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("hget", "hash", "f")), "v")
+		assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("zscore", "zset", "b")), "2")
+		mdb.Exec(conn, utils.ToCmdLine("select", "2"))
+		assertInt(t, mdb.Exec(conn, utils.ToCmdLine("sismember", "set", "a")), 1)
+		mdb.Close()
+
+		mdb = NewStandaloneServer()
+		conn = connection.NewFakeConn()
+		assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "after")), "1")
+		mdb.Close()
+	}
+}
+
+func TestAofExpire(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	setupAofConfig(t, filename, aof.FsyncEverySec)
+
+	mdb := NewStandaloneServer()
+	conn := connection.NewFakeConn()
+	mdb.Exec(conn, utils.ToCmdLine("set", "a", "1", "EX", "1000"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "b", "1"))
+	mdb.Exec(conn, utils.ToCmdLine("expire", "b", "1000"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "c", "1"))
+	mdb.Exec(conn, utils.ToCmdLine("pexpire", "c", "10"))
+	mdb.Close()
+	time.Sleep(20 * time.Millisecond)
+
+	// 过期时间以绝对时间写入，重放时不会延长
+	mdb = NewStandaloneServer()
+	conn = connection.NewFakeConn()
+	for _, key := range []string{"a", "b"} {
+		if r, ok := mdb.Exec(conn, utils.ToCmdLine("ttl", key)).(*reply.IntReply); !ok || r.Code <= 0 || r.Code > 1000 {
+			t.Errorf("expected ttl of %s to be kept", key)
+		}
+	}
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("exists", "c")), 0)
+	mdb.Close()
+}
+
+func TestAofTruncated(t *testing.T) {
+	for _, preamble := range []bool{false, true} {
+		filename := filepath.Join(t.TempDir(), "appendonly.aof")
+		setupAofConfig(t, filename, aof.FsyncAlways)
+		config.Properties.AofUseRdbPreamble = preamble
+
+		mdb := NewStandaloneServer()
+		conn := connection.NewFakeConn()
+		mdb.Exec(conn, utils.ToCmdLine("set", "a", "1"))
+		if preamble {
+			// 截断位置在 RDB 前导部分之后
+			assertReply(t, mdb.Exec(conn, utils.ToCmdLine("rewriteaof")), reply.MakeOkReply())
+			mdb.Exec(conn, utils.ToCmdLine("set", "e", "5"))
+		}
+		mdb.Close()
+
+		// 模拟写入过程中宕机，文件末尾的指令不完整
+		file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = file.WriteString("*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$5\r\nva")
+		_ = file.Close()
+
+		mdb = NewStandaloneServer()
+		conn = connection.NewFakeConn()
+		assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), "1")
+		assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "b")), reply.MakeNullBulkReply())
+		// 不完整的指令被截断，之后追加的指令不会被当作它的一部分
+		mdb.Exec(conn, utils.ToCmdLine("set", "c", "3"))
+		mdb.Exec(conn, utils.ToCmdLine("set", "d", "4"))
+		mdb.Close()
+
+		mdb = NewStandaloneServer()
+		conn = connection.NewFakeConn()
+		assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), "1")
+		assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "b")), reply.MakeNullBulkReply())
+		assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "c")), "3")
+		assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "d")), "4")
+		if preamble {
+			assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "e")), "5")
+		}
+		mdb.Close()
+	}
+}
+
+func TestAofInvalidFsync(t *testing.T) {
+	if _, err := aof.NewAOFHandler(filepath.Join(t.TempDir(), "a.aof"), "sometimes", NewStandaloneServer().loadAof, rewriteAof); err == nil {
+		t.Error("expected error for invalid appendfsync")
+	}
+}
+
+func TestAofRewrite(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	setupAofConfig(t, filename, aof.FsyncEverySec)
+
+	mdb := NewStandaloneServer()
+	conn := connection.NewFakeConn()
+	for i := 0; i < 100; i++ {
+		mdb.Exec(conn, utils.ToCmdLine("set", "str", strconv.Itoa(i)))
+	}
+	mdb.Exec(conn, utils.ToCmdLine("rpush", "list", "a", "b", "c"))
+	mdb.Exec(conn, utils.ToCmdLine("lpop", "list"))
+	mdb.Exec(conn, utils.ToCmdLine("hset", "hash", "f", "v"))
+	mdb.Exec(conn, utils.ToCmdLine("sadd", "set", "a", "b"))
+	mdb.Exec(conn, utils.ToCmdLine("zadd", "zset", "1.5", "a", "inf", "b"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "deleted", "1"))
+	mdb.Exec(conn, utils.ToCmdLine("del", "deleted"))
+	mdb.Exec(conn, utils.ToCmdLine("select", "1"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "ttl", "1", "EX", "1000"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "expired", "1", "PX", "10"))
+	time.Sleep(20 * time.Millisecond)
+
+	mdb.aofHandler.Fsync()
+	before, _ := os.Stat(filename)
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("rewriteaof")), reply.MakeOkReply())
+	after, _ := os.Stat(filename)
+	if after.Size() >= before.Size() {
+		t.Errorf("expected aof to shrink, before %d after %d", before.Size(), after.Size())
+	}
+	// 重写后追加的指令
+	mdb.Exec(conn, utils.ToCmdLine("set", "after", "1"))
+	mdb.Close()
+
+	mdb = NewStandaloneServer()
+	conn = connection.NewFakeConn()
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "str")), "99")
+	assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("lrange", "list", "0", "-1")), "b", "c")
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("hget", "hash", "f")), "v")
+	assertMembers(t, mdb.Exec(conn, utils.ToCmdLine("smembers", "set")), "a", "b")
+	assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("zrange", "zset", "0", "-1", "WITHSCORES")), "a", "1.5", "b", "inf")
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("exists", "deleted", "ttl", "after")), 0)
+	mdb.Exec(conn, utils.ToCmdLine("select", "1"))
+	if r, ok := mdb.Exec(conn, utils.ToCmdLine("ttl", "ttl")).(*reply.IntReply); !ok || r.Code <= 0 {
+		t.Error("expected ttl to be kept after rewrite")
+	}
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("exists", "expired")), 0)
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "after")), "1")
+	mdb.Close()
+}
+
+func TestAofRdbPreamble(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	setupAofConfig(t, filename, aof.FsyncEverySec)
+	config.Properties.AofUseRdbPreamble = true
+
+	mdb := NewStandaloneServer()
+	conn := connection.NewFakeConn()
+	mdb.Exec(conn, utils.ToCmdLine("set", "str", "v"))
+	mdb.Exec(conn, utils.ToCmdLine("rpush", "list", "a", "b", "c"))
+	mdb.Exec(conn, utils.ToCmdLine("select", "2"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "ttl", "1", "EX", "1000"))
+	mdb.Exec(conn, utils.ToCmdLine("zadd", "zset", "1", "a"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("rewriteaof")), reply.MakeOkReply())
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), "REDIS") {
+		t.Fatal("expected aof to start with rdb preamble")
+	}
+	// 重写后追加的指令以 RESP 格式写在 RDB 之后
+	mdb.Exec(conn, utils.ToCmdLine("zadd", "zset", "2", "b"))
+	mdb.Exec(conn, utils.ToCmdLine("select", "0"))
+	mdb.Exec(conn, utils.ToCmdLine("lpop", "list"))
+	mdb.Close()
+
+	check := func(mdb *MultiDB) {
+		conn := connection.NewFakeConn()
+		assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "str")), "v")
+		assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("lrange", "list", "0", "-1")), "b", "c")
+		mdb.Exec(conn, utils.ToCmdLine("select", "2"))
+		if r, ok := mdb.Exec(conn, utils.ToCmdLine("ttl", "ttl")).(*reply.IntReply); !ok || r.Code <= 0 {
+			t.Error("expected ttl to be kept")
+		}
+		assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("zrange", "zset", "0", "-1")), "a", "b")
+	}
+
+	mdb = NewStandaloneServer()
+	check(mdb)
+	// 对混合格式的文件再次重写
+	assertReply(t, mdb.Exec(connection.NewFakeConn(), utils.ToCmdLine("rewriteaof")), reply.MakeOkReply())
+	mdb.Close()
+
+	mdb = NewStandaloneServer()
+	check(mdb)
+	mdb.Close()
+}
+
+func TestAofRdbPreambleTruncated(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	setupAofConfig(t, filename, aof.FsyncAlways)
+	config.Properties.AofUseRdbPreamble = true
+
+	mdb := NewStandaloneServer()
+	conn := connection.NewFakeConn()
+	mdb.Exec(conn, utils.ToCmdLine("set", "str", "v"))
+	mdb.Exec(conn, utils.ToCmdLine("rpush", "list", "a", "b", "c"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("rewriteaof")), reply.MakeOkReply())
+	mdb.Close()
+
+	// RDB 前导部分不完整
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), "REDIS") {
+		t.Fatal("expected aof to start with rdb preamble")
+	}
+	truncated := content[:len(content)/2]
+	if err := os.WriteFile(filename, truncated, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := aof.NewAOFHandler(filename, aof.FsyncEverySec, MakeBasicMultiDB().loadAof, rewriteAof); err == nil {
+		t.Error("expected error for truncated rdb preamble")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected server not to start")
+		}
+		// 文件没有被追加
+		if content, _ := os.ReadFile(filename); string(content) != string(truncated) {
+			t.Error("expected aof file not to be modified")
+		}
+	}()
+	NewStandaloneServer()
+}
+
+func TestRewriteAofDisabled(t *testing.T) {
+	mdb := NewStandaloneServer()
+	conn := connection.NewFakeConn()
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("bgrewriteaof")))
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("rewriteaof")))
+}
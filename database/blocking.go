@@ -0,0 +1,413 @@
+// 阻塞列表指令 BLPOP BRPOP BLMOVE BRPOPLPUSH
+// 列表为空时挂起客户端连接，有数据写入时按 FIFO 顺序唤醒
+
+package database
+
+import (
+	"container/list"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ljr-redis/acl"
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/timewheel"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+// 阻塞指令
+type blockingCommand struct {
+	// 获取等待的 keys
+	waitKeys func(args [][]byte) []string
+	// 尝试从 key 获取数据，返回 nil 表示 key 中没有数据需要继续等待
+	try func(db *DB, args [][]byte, key string) redis.Reply
+	// 超时响应
+	timeoutReply redis.Reply
+}
+
+// 阻塞指令列表
+var blockingTable = make(map[string]*blockingCommand)
+
+// 注册阻塞指令，指令本身仍需通过 RegisterCommand 注册，在事务中以非阻塞方式执行
+func registerBlockingCommand(name string, waitKeys func(args [][]byte) []string,
+	try func(db *DB, args [][]byte, key string) redis.Reply, timeoutReply redis.Reply) {
+	name = strings.ToLower(name)
+	blockingTable[name] = &blockingCommand{
+		waitKeys:     waitKeys,
+		try:          try,
+		timeoutReply: timeoutReply,
+	}
+}
+
+// 被挂起的客户端
+type blockedClient struct {
+	conn     redis.Connection
+	cmd      *blockingCommand
+	args     [][]byte
+	keys     []string                 // 等待的 keys
+	lockKeys []string                 // 唤醒时需要上写锁的 keys
+	elements map[string]*list.Element // 在每个 key 等待队列中的位置
+	taskKey  string                   // 超时任务
+	done     bool                     // 已经被唤醒、超时或断开连接
+}
+
+var blockedClientID uint64
+
+/* ---------- 等待队列 ------------ */
+
+// 挂起客户端，调用者需要持有 lockKeys 的写锁
+func (db *DB) addBlockedClient(c redis.Connection, cmd *blockingCommand, args [][]byte,
+	lockKeys []string, timeout time.Duration) {
+	bc := &blockedClient{
+		conn:     c,
+		cmd:      cmd,
+		args:     args,
+		keys:     cmd.waitKeys(args),
+		lockKeys: lockKeys,
+		elements: make(map[string]*list.Element),
+	}
+
+	db.waitersMu.Lock()
+	for _, key := range bc.keys {
+		if _, ok := bc.elements[key]; ok {
+			// 重复的 key
+			continue
+		}
+		waiters, ok := db.waiters[key]
+		if !ok {
+			waiters = list.New()
+			db.waiters[key] = waiters
+		}
+		bc.elements[key] = waiters.PushBack(bc)
+	}
+	db.blockedConns[c] = bc
+	db.waitersMu.Unlock()
+
+	c.SetBlocked(true)
+	if timeout > 0 {
+		bc.taskKey = "blocking:" + strconv.FormatUint(atomic.AddUint64(&blockedClientID, 1), 10)
+		timewheel.Delay(timeout, bc.taskKey, func() {
+			db.finishBlockedClient(bc, bc.cmd.timeoutReply)
+		})
+	}
+}
+
+// 从等待队列中移除，调用者需要持有 waitersMu
+func (db *DB) removeBlockedClient(bc *blockedClient) {
+	bc.done = true
+	for key, e := range bc.elements {
+		waiters := db.waiters[key]
+		waiters.Remove(e)
+		if waiters.Len() == 0 {
+			delete(db.waiters, key)
+		}
+	}
+	if db.blockedConns[bc.conn] == bc {
+		delete(db.blockedConns, bc.conn)
+	}
+}
+
+// 结束挂起并返回响应，reply 为 nil 时不返回响应
+func (db *DB) finishBlockedClient(bc *blockedClient, result redis.Reply) {
+	db.RWLocks(bc.lockKeys, nil)
+	defer db.RWUnLocks(bc.lockKeys, nil)
+
+	db.waitersMu.Lock()
+	if bc.done {
+		db.waitersMu.Unlock()
+		return
+	}
+	db.removeBlockedClient(bc)
+	db.waitersMu.Unlock()
+
+	if result != nil {
+		_ = bc.conn.Write(result.ToBytes())
+	}
+	bc.conn.SetBlocked(false)
+}
+
+// 客户端断开连接时移除挂起的指令
+func (db *DB) removeBlockedConn(c redis.Connection) {
+	db.waitersMu.Lock()
+	bc, ok := db.blockedConns[c]
+	db.waitersMu.Unlock()
+	if !ok {
+		return
+	}
+	timewheel.Cancel(bc.taskKey)
+	db.finishBlockedClient(bc, nil)
+}
+
+// 唤醒等待 keys 的客户端，调用者不能持有 keys 的锁
+func (db *DB) wakeBlockedClients(keys ...string) {
+	db.waitersMu.Lock()
+	empty := len(db.waiters) == 0
+	db.waitersMu.Unlock()
+	if empty {
+		return
+	}
+	for _, key := range keys {
+		db.serveBlockedClients(key)
+	}
+}
+
+// 唤醒所有挂起的客户端，用于 SWAPDB 等整体改变数据的指令，调用者不能持有锁
+func (db *DB) wakeAllBlockedClients() {
+	db.waitersMu.Lock()
+	keys := make([]string, 0, len(db.waiters))
+	for key := range db.waiters {
+		keys = append(keys, key)
+	}
+	db.waitersMu.Unlock()
+	db.wakeBlockedClients(keys...)
+}
+
+// 按 FIFO 顺序服务等待 key 的客户端
+// 不能服务的客户端继续等待，不影响排在后面的客户端
+func (db *DB) serveBlockedClients(key string) {
+	db.waitersMu.Lock()
+	waiters, ok := db.waiters[key]
+	if !ok {
+		db.waitersMu.Unlock()
+		return
+	}
+	clients := make([]*blockedClient, 0, waiters.Len())
+	for e := waiters.Front(); e != nil; e = e.Next() {
+		clients = append(clients, e.Value.(*blockedClient))
+	}
+	db.waitersMu.Unlock()
+
+	for _, bc := range clients {
+		if !db.tryServeBlockedClient(bc, key) {
+			continue
+		}
+		// 数据可能被写入其它 key，例如 BLMOVE
+		for _, k := range bc.lockKeys {
+			if k != key {
+				db.serveBlockedClients(k)
+			}
+		}
+	}
+}
+
+// 尝试服务客户端，返回是否修改了数据
+// 执行出错时向客户端返回错误并结束阻塞，例如 BLMOVE 的目标 key 类型错误
+func (db *DB) tryServeBlockedClient(bc *blockedClient, key string) bool {
+	db.RWLocks(bc.lockKeys, nil)
+	defer db.RWUnLocks(bc.lockKeys, nil)
+
+	db.waitersMu.Lock()
+	done := bc.done
+	db.waitersMu.Unlock()
+	if done {
+		// 客户端已经被其它协程处理
+		return false
+	}
+
+	result := bc.cmd.try(db, bc.args, key)
+	if result == nil {
+		// 没有数据，继续等待
+		return false
+	}
+	if reply.IsErrorReply(result) {
+		db.unblockClient(bc, result)
+		return false
+	}
+
+	db.addVersion(bc.lockKeys...)
+	db.unblockClient(bc, result)
+	return true
+}
+
+// 结束客户端的阻塞并发送响应，调用者需要持有 key 的锁
+func (db *DB) unblockClient(bc *blockedClient, result redis.Reply) {
+	db.waitersMu.Lock()
+	db.removeBlockedClient(bc)
+	db.waitersMu.Unlock()
+	timewheel.Cancel(bc.taskKey)
+
+	_ = bc.conn.Write(result.ToBytes())
+	bc.conn.SetBlocked(false)
+}
+
+/* ---------- 执行阻塞指令 ------------ */
+
+// 解析超时时间，单位为秒，0 表示永久等待
+func parseBlockingTimeout(raw []byte) (time.Duration, redis.Reply) {
+	timeout, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil || math.IsNaN(timeout) || math.IsInf(timeout, 0) {
+		return 0, reply.MakeErrReply("ERR timeout is not a float or out of range")
+	}
+	if timeout < 0 {
+		return 0, reply.MakeErrReply("ERR timeout is negative")
+	}
+	if timeout > float64(math.MaxInt64/int64(time.Second)) {
+		return 0, reply.MakeErrReply("ERR timeout is out of range")
+	}
+	return time.Duration(timeout * float64(time.Second)), nil
+}
+
+// 依次尝试所有 key，都没有数据时返回 nil
+func tryAllKeys(cmd *blockingCommand, db *DB, args [][]byte) redis.Reply {
+	for _, key := range cmd.waitKeys(args) {
+		if result := cmd.try(db, args, key); result != nil {
+			return result
+		}
+	}
+	return nil
+}
+
+// 执行阻塞指令，没有数据时挂起客户端
+func (db *DB) execBlockingCommand(c redis.Connection, cmdLine [][]byte) redis.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd := cmdTable[cmdName]
+	blockingCmd := blockingTable[cmdName]
+	if !validateArity(cmd.arity, cmdLine) {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	args := cmdLine[1:]
+	timeout, errReply := parseBlockingTimeout(args[len(args)-1])
+	if errReply != nil {
+		return errReply
+	}
+
+	write, read := cmd.prepare(args)
+	db.RWLocks(write, read)
+	defer db.wakeBlockedClients(write...)
+	defer db.RWUnLocks(write, read)
+
+	if result := tryAllKeys(blockingCmd, db, args); result != nil {
+		if !reply.IsErrorReply(result) {
+			db.addVersion(write...)
+		}
+		return result
+	}
+	db.addBlockedClient(c, blockingCmd, args, write, timeout)
+	return reply.MakeNoReply()
+}
+
+// 事务中以非阻塞方式执行
+func makeNonBlockingExecutor(name string) ExecFunc {
+	return func(db *DB, args [][]byte) redis.Reply {
+		cmd := blockingTable[name]
+		if _, errReply := parseBlockingTimeout(args[len(args)-1]); errReply != nil {
+			return errReply
+		}
+		if result := tryAllKeys(cmd, db, args); result != nil {
+			return result
+		}
+		return cmd.timeoutReply
+	}
+}
+
+/* ---------- BLPOP BRPOP ------------ */
+
+// 除最后一个 timeout 参数外都是 key
+func blockingPopKeys(args [][]byte) []string {
+	keys := make([]string, len(args)-1)
+	for i := range keys {
+		keys[i] = string(args[i])
+	}
+	return keys
+}
+
+func prepareBlockingPop(args [][]byte) ([]string, []string) {
+	return blockingPopKeys(args), nil
+}
+
+func undoBlockingPop(db *DB, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, blockingPopKeys(args)...)
+}
+
+// 从 key 头部或尾部弹出一个元素
+func tryBlockingPop(db *DB, key string, fromLeft bool) redis.Reply {
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return nil
+	}
+
+	var val interface{}
+	cmdName := "lpop"
+	if fromLeft {
+		val = list.Remove(0)
+	} else {
+		val = list.RemoveLast()
+		cmdName = "rpop"
+	}
+
+	db.addAof(utils.ToCmdLine(cmdName, key))
+	db.notify(notifyList, cmdName, key)
+	if list.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return reply.MakeMultiBulkReply([][]byte{[]byte(key), val.([]byte)})
+}
+
+func tryBLPop(db *DB, args [][]byte, key string) redis.Reply {
+	return tryBlockingPop(db, key, true)
+}
+
+func tryBRPop(db *DB, args [][]byte, key string) redis.Reply {
+	return tryBlockingPop(db, key, false)
+}
+
+/* ---------- BLMOVE BRPOPLPUSH ------------ */
+
+// 只等待 source
+func blockingMoveKeys(args [][]byte) []string {
+	return []string{string(args[0])}
+}
+
+// BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func tryBLMove(db *DB, args [][]byte, key string) redis.Reply {
+	fromLeft, ok := parseDirection(args[2])
+	if !ok {
+		return reply.MakeSyntaxErrReply()
+	}
+	toLeft, ok := parseDirection(args[3])
+	if !ok {
+		return reply.MakeSyntaxErrReply()
+	}
+
+	val, errReply := lmove(db, string(args[0]), string(args[1]), fromLeft, toLeft)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return nil
+	}
+	db.addAof(utils.ToCmdLine3("lmove", args[:4]...))
+	return reply.MakeBulkReply(val)
+}
+
+// BRPOPLPUSH source destination timeout
+func tryBRPopLPush(db *DB, args [][]byte, key string) redis.Reply {
+	val, errReply := lmove(db, string(args[0]), string(args[1]), false, true)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return nil
+	}
+	db.addAof(utils.ToCmdLine3("rpoplpush", args[:2]...))
+	return reply.MakeBulkReply(val)
+}
+
+func init() {
+	registerBlockingCommand("BLPop", blockingPopKeys, tryBLPop, reply.MakeNullMultiBulkReply())
+	registerBlockingCommand("BRPop", blockingPopKeys, tryBRPop, reply.MakeNullMultiBulkReply())
+	registerBlockingCommand("BLMove", blockingMoveKeys, tryBLMove, reply.MakeNullBulkReply())
+	registerBlockingCommand("BRPopLPush", blockingMoveKeys, tryBRPopLPush, reply.MakeNullBulkReply())
+
+	RegisterCommand("BLPop", makeNonBlockingExecutor("blpop"), prepareBlockingPop, undoBlockingPop, -3, flagWrite|flagBlocking, 1, -2, 1, acl.CatWrite|acl.CatList|acl.CatSlow|acl.CatBlocking)
+	RegisterCommand("BRPop", makeNonBlockingExecutor("brpop"), prepareBlockingPop, undoBlockingPop, -3, flagWrite|flagBlocking, 1, -2, 1, acl.CatWrite|acl.CatList|acl.CatSlow|acl.CatBlocking)
+	RegisterCommand("BLMove", makeNonBlockingExecutor("blmove"), prepareLMove, undoLMove, 6, flagWrite|flagDenyOOM|flagBlocking, 1, 2, 1, acl.CatWrite|acl.CatList|acl.CatSlow|acl.CatBlocking)
+	RegisterCommand("BRPopLPush", makeNonBlockingExecutor("brpoplpush"), prepareLMove, undoLMove, 4, flagWrite|flagDenyOOM|flagBlocking, 1, 2, 1, acl.CatWrite|acl.CatList|acl.CatSlow|acl.CatBlocking)
+}
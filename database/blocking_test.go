@@ -0,0 +1,127 @@
+// 测试阻塞列表指令
+
+package database
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/connection"
+	"ljr-redis/redis/reply"
+)
+
+// 创建客户端连接，返回读取服务端响应的 reader
+func makeTestConn(t *testing.T) (*connection.Connection, *bufio.Reader) {
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = client.Close()
+	})
+	return connection.NewConn(server), bufio.NewReader(client)
+}
+
+// 读取指定长度的响应
+func readReply(t *testing.T, r *bufio.Reader, expected []byte) {
+	t.Helper()
+	buf := make([]byte, len(expected))
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(r, buf)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("wait reply timeout")
+	}
+	if string(buf) != string(expected) {
+		t.Errorf("expected %q, actually %q", expected, buf)
+	}
+}
+
+func TestBLPopImmediately(t *testing.T) {
+	db := MakeDB()
+	conn, _ := makeTestConn(t)
+	db.Exec(nil, utils.ToCmdLine("rpush", "b", "1"))
+	result := db.Exec(conn, utils.ToCmdLine("blpop", "a", "b", "0"))
+	assertMultiBulk(t, result, "b", "1")
+	if conn.IsBlocked() {
+		t.Error("connection should not be blocked")
+	}
+}
+
+func TestBLPopWakeUpInOrder(t *testing.T) {
+	db := MakeDB()
+	conn1, r1 := makeTestConn(t)
+	conn2, r2 := makeTestConn(t)
+
+	assertReply(t, db.Exec(conn1, utils.ToCmdLine("blpop", "a", "0")), reply.MakeNoReply())
+	assertReply(t, db.Exec(conn2, utils.ToCmdLine("brpop", "b", "a", "0")), reply.MakeNoReply())
+	if !conn1.IsBlocked() || !conn2.IsBlocked() {
+		t.Fatal("connection should be blocked")
+	}
+
+	pushed := make(chan struct{})
+	go func() {
+		db.Exec(nil, utils.ToCmdLine("rpush", "a", "x", "y"))
+		close(pushed)
+	}()
+	readReply(t, r1, reply.MakeMultiBulkReply(utils.ToCmdLine("a", "x")).ToBytes())
+	readReply(t, r2, reply.MakeMultiBulkReply(utils.ToCmdLine("a", "y")).ToBytes())
+	<-pushed
+	if conn1.IsBlocked() || conn2.IsBlocked() {
+		t.Error("connection should be unblocked")
+	}
+	if len(db.waiters) != 0 || len(db.blockedConns) != 0 {
+		t.Error("waiters should be removed")
+	}
+}
+
+func TestBLMoveAndDisconnect(t *testing.T) {
+	db := MakeDB()
+	conn1, _ := makeTestConn(t)
+	conn2, r2 := makeTestConn(t)
+
+	db.Exec(conn1, utils.ToCmdLine("blmove", "src", "dst", "LEFT", "LEFT", "0"))
+	db.Exec(conn2, utils.ToCmdLine("brpoplpush", "src", "dst", "0"))
+	// 第一个客户端断开连接，数据应该交给第二个客户端
+	db.removeBlockedConn(conn1)
+
+	go db.Exec(nil, utils.ToCmdLine("lpush", "src", "v"))
+	readReply(t, r2, reply.MakeBulkReply([]byte("v")).ToBytes())
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("lrange", "dst", "0", "-1")), "v")
+}
+
+func TestBlockingTimeoutAndMulti(t *testing.T) {
+	db := MakeDB()
+	conn, r := makeTestConn(t)
+	assertErr(t, db.Exec(conn, utils.ToCmdLine("blpop", "a", "-1")))
+	db.Exec(conn, utils.ToCmdLine("blpop", "a", "0.1"))
+	readReply(t, r, reply.MakeNullMultiBulkReply().ToBytes())
+
+	// 事务中不阻塞
+	assertReply(t, db.execWithLock(utils.ToCmdLine("blpop", "a", "0")), reply.MakeNullMultiBulkReply())
+}
+
+func TestBlockedClientWithError(t *testing.T) {
+	db := MakeDB()
+	conn1, r1 := makeTestConn(t)
+	conn2, r2 := makeTestConn(t)
+
+	db.Exec(nil, utils.ToCmdLine("set", "dst", "v"))
+	db.Exec(conn1, utils.ToCmdLine("blmove", "src", "dst", "LEFT", "LEFT", "0"))
+	db.Exec(conn2, utils.ToCmdLine("blpop", "src", "0"))
+
+	// 第一个客户端的目标 key 类型错误，不影响后面的客户端
+	go db.Exec(nil, utils.ToCmdLine("rpush", "src", "x"))
+	readReply(t, r1, (&reply.WrongTypeErrReply{}).ToBytes())
+	readReply(t, r2, reply.MakeMultiBulkReply(utils.ToCmdLine("src", "x")).ToBytes())
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("get", "dst")), "v")
+}
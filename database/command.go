@@ -0,0 +1,171 @@
+// COMMAND 指令
+// 根据注册时的元数据返回指令信息，客户端连接时通过 COMMAND 获取 key 的位置
+
+package database
+
+import (
+	"sort"
+	"strings"
+
+	"ljr-redis/acl"
+	"ljr-redis/interface/redis"
+	"ljr-redis/redis/reply"
+)
+
+// COMMAND [COUNT | INFO [name ...] | DOCS [name ...] | GETKEYS command [arg ...]]
+func execCommand(db *DB, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return commandInfos(sortedCommandNames())
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch subCmd {
+	case "count":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("command|count")
+		}
+		return reply.MakeIntReply(int64(len(cmdTable)))
+	case "info":
+		if len(args) == 0 {
+			return commandInfos(sortedCommandNames())
+		}
+		return commandInfos(toStrings(args))
+	case "docs":
+		if len(args) == 0 {
+			return commandDocs(sortedCommandNames())
+		}
+		return commandDocs(toStrings(args))
+	case "getkeys":
+		if len(args) == 0 {
+			return reply.MakeArgNumErrReply("command|getkeys")
+		}
+		return commandGetKeys(args)
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try COMMAND HELP.")
+}
+
+func sortedCommandNames() []string {
+	names := make([]string, 0, len(cmdTable))
+	for name := range cmdTable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func toStrings(args [][]byte) []string {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		result[i] = string(arg)
+	}
+	return result
+}
+
+// 指令信息列表，不存在的指令返回 nil
+func commandInfos(names []string) redis.Reply {
+	infos := make([]redis.Reply, len(names))
+	for i, name := range names {
+		cmd, ok := cmdTable[strings.ToLower(name)]
+		if !ok {
+			infos[i] = reply.MakeNullMultiBulkReply()
+			continue
+		}
+		infos[i] = cmd.info()
+	}
+	return reply.MakeMultiRawReply(infos)
+}
+
+// 与 redis 7 的格式一致：名称、参数个数、标志、第一个 key、最后一个 key、步长、ACL 类别、tips、key specs、子指令
+// 没有 tips 和子指令，key 的位置只通过 first/last/step 描述，key specs 为空
+func (cmd *command) info() redis.Reply {
+	flagNames := cmd.flagNames()
+	flags := make([]redis.Reply, len(flagNames))
+	for i, name := range flagNames {
+		flags[i] = reply.MakeStatusReply(name)
+	}
+	categoryNames := cmd.categories.Names()
+	categories := make([]redis.Reply, len(categoryNames))
+	for i, name := range categoryNames {
+		categories[i] = reply.MakeStatusReply("@" + name)
+	}
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkReply([]byte(cmd.name)),
+		reply.MakeIntReply(int64(cmd.arity)),
+		reply.MakeMultiRawReply(flags),
+		reply.MakeIntReply(int64(cmd.firstKey)),
+		reply.MakeIntReply(int64(cmd.lastKey)),
+		reply.MakeIntReply(int64(cmd.keyStep)),
+		reply.MakeMultiRawReply(categories),
+		reply.MakeEmptyMultiBulkReply(),
+		reply.MakeEmptyMultiBulkReply(),
+		reply.MakeEmptyMultiBulkReply(),
+	})
+}
+
+// 指令文档，以 名称-文档 的形式返回，不存在的指令会被忽略
+// 没有记录指令的说明，文档中只有根据 ACL 类别得到的分组
+func commandDocs(names []string) redis.Reply {
+	docs := make([]redis.Reply, 0, len(names)*2)
+	for _, name := range names {
+		cmd, ok := cmdTable[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		docs = append(docs,
+			reply.MakeBulkReply([]byte(cmd.name)),
+			reply.MakeMultiRawReply([]redis.Reply{
+				reply.MakeBulkReply([]byte("group")), reply.MakeBulkReply([]byte(cmd.group())),
+			}),
+		)
+	}
+	return reply.MakeMultiRawReply(docs)
+}
+
+// 指令所属的分组
+func (cmd *command) group() string {
+	switch {
+	case cmd.categories&acl.CatString != 0:
+		return "string"
+	case cmd.categories&acl.CatList != 0:
+		return "list"
+	case cmd.categories&acl.CatSet != 0:
+		return "set"
+	case cmd.categories&acl.CatSortedSet != 0:
+		return "sorted-set"
+	case cmd.categories&acl.CatHash != 0:
+		return "hash"
+	case cmd.categories&acl.CatPubSub != 0:
+		return "pubsub"
+	case cmd.categories&acl.CatTransaction != 0:
+		return "transactions"
+	case cmd.categories&acl.CatKeyspace != 0:
+		return "generic"
+	case cmd.categories&acl.CatConnection != 0:
+		return "connection"
+	}
+	return "server"
+}
+
+// COMMAND GETKEYS command [arg ...]
+func commandGetKeys(cmdLine [][]byte) redis.Reply {
+	cmd, ok := cmdTable[strings.ToLower(string(cmdLine[0]))]
+	if !ok {
+		return reply.MakeErrReply("ERR Invalid command specified")
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		return reply.MakeErrReply("ERR Invalid number of arguments specified for command")
+	}
+	keys := cmd.getKeys(cmdLine)
+	if len(keys) == 0 {
+		return reply.MakeErrReply("ERR The command has no key arguments")
+	}
+	result := make([][]byte, len(keys))
+	for i, key := range keys {
+		result[i] = []byte(key)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+func init() {
+	RegisterCommand("Command", execCommand, noPrepare, nil, -1, flagLoading|flagStale, 0, 0, 0, acl.CatSlow|acl.CatConnection)
+}
@@ -0,0 +1,53 @@
+// 测试 COMMAND
+
+package database
+
+import (
+	"testing"
+
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/connection"
+	"ljr-redis/redis/reply"
+)
+
+func TestCommandInfo(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	conn := connection.NewFakeConn()
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("command", "count")), int64(len(cmdTable)))
+
+	result := mdb.Exec(conn, utils.ToCmdLine("command"))
+	all, ok := result.(*reply.MultiRawReply)
+	if !ok || len(all.Replies) != len(cmdTable) {
+		t.Fatalf("unexpected command reply %q", result.ToBytes())
+	}
+
+	expected := "*2\r\n" +
+		"*10\r\n$3\r\nset\r\n:-3\r\n*2\r\n+write\r\n+denyoom\r\n:1\r\n:1\r\n:1\r\n*3\r\n+@slow\r\n+@string\r\n+@write\r\n*0\r\n*0\r\n*0\r\n" +
+		"*-1\r\n"
+	actual := string(mdb.Exec(conn, utils.ToCmdLine("command", "info", "SET", "nothing")).ToBytes())
+	if actual != expected {
+		t.Errorf("expected %q, actually %q", expected, actual)
+	}
+
+	expected = "*2\r\n$4\r\nlpop\r\n*2\r\n$5\r\ngroup\r\n$4\r\nlist\r\n"
+	actual = string(mdb.Exec(conn, utils.ToCmdLine("command", "docs", "lpop", "nothing")).ToBytes())
+	if actual != expected {
+		t.Errorf("expected %q, actually %q", expected, actual)
+	}
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("command", "nothing")))
+}
+
+func TestCommandGetKeys(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	conn := connection.NewFakeConn()
+	assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("command", "getkeys", "get", "a")), "a")
+	assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("command", "getkeys", "mset", "a", "1", "b", "2")), "a", "b")
+	assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("command", "getkeys", "blpop", "a", "b", "0")), "a", "b")
+	assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("command", "getkeys", "zunionstore", "dst", "2", "a", "b", "weights", "1", "2")), "dst", "a", "b")
+	assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("command", "getkeys", "watch", "a", "b")), "a", "b")
+
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("command", "getkeys", "nothing")), reply.MakeErrReply("ERR Invalid command specified"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("command", "getkeys", "get")),
+		reply.MakeErrReply("ERR Invalid number of arguments specified for command"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("command", "getkeys", "ping")), reply.MakeErrReply("ERR The command has no key arguments"))
+}
@@ -4,6 +4,8 @@
 package database
 
 import (
+	"container/list"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -39,6 +41,17 @@ type DB struct {
 
 	// AOF
 	addAof func(CmdLine)
+
+	// 键空间通知，class 为事件所属的类别
+	notify func(class int, event string, key string)
+
+	// 只有基础功能，不设置过期定时任务，用于 AOF 重写等场景
+	basic bool
+
+	// 阻塞指令的等待队列 key -> *blockedClient 链表
+	waiters      map[string]*list.List
+	blockedConns map[redis.Connection]*blockedClient
+	waitersMu    sync.Mutex
 }
 
 // executor ExecFunc
@@ -64,48 +77,42 @@ func MakeDB() *DB {
 		versionMap: dict.MakeConcurrent(dataDictSize),
 		locker:     lockmap.Make(lockerSize),
 		addAof:     func(line CmdLine) {},
+		notify:     func(class int, event string, key string) {},
+
+		waiters:      make(map[string]*list.List),
+		blockedConns: make(map[redis.Connection]*blockedClient),
 	}
 	return db
 }
 
+// 创建只有基础功能的数据库
+// 过期定时任务的 key 全局共享，临时数据库不能设置或取消它们
+func makeBasicDB() *DB {
+	db := MakeDB()
+	db.basic = true
+	return db
+}
+
 // 执行指令
 func (db *DB) Exec(c redis.Connection, cmdLine [][]byte) redis.Reply {
 	cmdName := strings.ToLower(string(cmdLine[0]))
-	if cmdName == "multi" {
-		if len(cmdLine) != 1 {
-			return reply.MakeArgNumErrReply(cmdName)
-		}
-		// 开始执行复杂指令
-		return StartMulti(c)
-
-	} else if cmdName == "discard" {
-		if len(cmdLine) != 1 {
-			return reply.MakeArgNumErrReply(cmdName)
-		}
-		// 取消执行复杂指令
-		return DiscardMulti(c)
-
-	} else if cmdName == "exec" {
-		if len(cmdLine) != 1 {
-			return reply.MakeArgNumErrReply(cmdName)
-		}
-		// 执行复杂指令
-		return execMulti(db, c)
+	if c != nil && c.InMultiState() {
+		// 要执行复杂指令，将指令加入队列，不能在事务中执行的指令会被拒绝
+		return EnqueueCmd(c, db.index, cmdLine)
+	}
 
-	} else if cmdName == "watch" {
+	if cmdName == "watch" {
 		// 参数个数不少于 2
 		if !validateArity(-2, cmdLine) {
 			return reply.MakeArgNumErrReply(cmdName)
 		}
 		// watch
 		return Watch(db, c, cmdLine[1:])
-
 	}
 
-	if c != nil && c.InMultiState() {
-		// 要执行复杂指令，将指令加入队列
-		EnqueueCmd(c, cmdLine)
-		return reply.MakeQueuedReply()
+	if _, ok := blockingTable[cmdName]; ok && c != nil {
+		// 阻塞指令
+		return db.execBlockingCommand(c, cmdLine)
 	}
 
 	// 执行普通指令
@@ -116,7 +123,7 @@ func (db *DB) Exec(c redis.Connection, cmdLine [][]byte) redis.Reply {
 func (db *DB) execNormalCommand(cmdLine [][]byte) redis.Reply {
 	cmdName := strings.ToLower(string(cmdLine[0]))
 	cmd, ok := cmdTable[cmdName]
-	if !ok {
+	if !ok || cmd.executor == nil {
 		// return reply.MakeErrReply("ERR unkonwn command '" + cmdName + "'")
 		return reply.MakeErrReply("爷还没写 '" + cmdName + "' 这个指令")
 	}
@@ -130,6 +137,8 @@ func (db *DB) execNormalCommand(cmdLine [][]byte) redis.Reply {
 	db.addVersion(write...)
 	db.RWLocks(write, read)
 
+	// 解锁后唤醒等待这些 key 的阻塞指令
+	defer db.wakeBlockedClients(write...)
 	defer db.RWUnLocks(write, read)
 	fun := cmd.executor
 	return fun(db, cmdLine[1:])
@@ -154,6 +163,24 @@ func (db *DB) RWUnLocks(writeKeys []string, readKeys []string) {
 	db.locker.RWUnLocks(writeKeys, readKeys)
 }
 
+// 对数据库中所有 key 上写锁，用于 SWAPDB 等修改整个数据库的指令
+func (db *DB) LockAll() {
+	db.locker.LockAll()
+}
+
+func (db *DB) UnLockAll() {
+	db.locker.UnLockAll()
+}
+
+// 对数据库中所有 key 上读锁，冻结整个数据库
+func (db *DB) RLockAll() {
+	db.locker.RLockAll()
+}
+
+func (db *DB) RUnLockAll() {
+	db.locker.RUnLockAll()
+}
+
 /* ---------- version ------------ */
 
 func (db *DB) addVersion(keys ...string) {
@@ -173,8 +200,9 @@ func (db *DB) GetVersion(key string) uint32 {
 
 /* ------------ Time To Live 过期时间 ------------ */
 
-func genExpireTask(key string) string {
-	return "expire:" + key
+// 不同数据库中的同名 key 使用不同的定时任务
+func genExpireTask(index int, key string) string {
+	return "expire:" + strconv.Itoa(index) + ":" + key
 }
 
 // 设置 key 的 ttlCmd
@@ -182,10 +210,15 @@ func (db *DB) Expire(key string, expireTime time.Time) {
 	db.stopWorld.Wait()
 	// 记录过期时间
 	db.ttlMap.Put(key, expireTime)
-	taskKey := genExpireTask(key)
+	if db.basic {
+		return
+	}
+	db.addExpireTask(key, expireTime)
+}
 
-	// 设置定时任务 key 过期后自动删除
-	timewheel.At(expireTime, taskKey, func() {
+// 设置定时任务 key 过期后自动删除
+func (db *DB) addExpireTask(key string, expireTime time.Time) {
+	timewheel.At(expireTime, genExpireTask(db.index, key), func() {
 		keys := []string{key}
 		db.RWLocks(keys, nil)
 		defer db.RWUnLocks(keys, nil)
@@ -198,10 +231,13 @@ func (db *DB) Expire(key string, expireTime time.Time) {
 			return
 		}
 		expireTime, _ := rawExpireTime.(time.Time)
-		expired := time.Now().After(expireTime)
-		if expired {
-			db.Remove(key)
+		if !time.Now().After(expireTime) {
+			// 时间轮按秒计算位置，任务可能提前执行
+			db.addExpireTask(key, expireTime)
+			return
 		}
+		db.Remove(key)
+		db.notify(notifyExpired, "expired", key)
 	})
 }
 
@@ -209,8 +245,15 @@ func (db *DB) Expire(key string, expireTime time.Time) {
 func (db *DB) Persist(key string) {
 	db.stopWorld.Wait()
 	db.ttlMap.Remove(key)
-	taskKey := genExpireTask(key)
-	timewheel.Cancel(taskKey)
+	db.cancelExpireTask(key)
+}
+
+// 取消 key 的过期定时任务
+func (db *DB) cancelExpireTask(key string) {
+	if db.basic {
+		return
+	}
+	timewheel.Cancel(genExpireTask(db.index, key))
 }
 
 // 检查是否在 ttl 内
@@ -225,6 +268,7 @@ func (db *DB) IsExpired(key string) bool {
 	if expired {
 		// 到期删除
 		db.Remove(key)
+		db.notify(notifyExpired, "expired", key)
 	}
 	return expired
 }
@@ -271,8 +315,7 @@ func (db *DB) Remove(key string) {
 	db.stopWorld.Wait()
 	db.data.Remove(key)
 	db.ttlMap.Remove(key)
-	taskKey := genExpireTask(key)
-	timewheel.Cancel(taskKey)
+	db.cancelExpireTask(key)
 }
 
 // 从 db 中删除 keys 返回成功删除的个数
@@ -280,7 +323,8 @@ func (db *DB) Removes(keys ...string) (deleted int) {
 	db.stopWorld.Wait()
 	deleted = 0
 	for _, key := range keys {
-		_, exists := db.data.Get(key)
+		// 已经过期的 key 不计入删除个数
+		_, exists := db.GetEntity(key)
 		if exists {
 			db.Remove(key)
 			deleted++
@@ -289,6 +333,23 @@ func (db *DB) Removes(keys ...string) (deleted int) {
 	return
 }
 
+// 遍历数据库中未过期的 key，回调返回 false 时停止遍历
+func (db *DB) ForEach(cb func(key string, data *database.DataEntity, expiration *time.Time) bool) {
+	now := time.Now()
+	db.data.ForEach(func(key string, raw interface{}) bool {
+		entity, _ := raw.(*database.DataEntity)
+		var expiration *time.Time
+		if rawExpireTime, ok := db.ttlMap.Get(key); ok {
+			expireTime, _ := rawExpireTime.(time.Time)
+			if now.After(expireTime) {
+				return true
+			}
+			expiration = &expireTime
+		}
+		return cb(key, entity, expiration)
+	})
+}
+
 // 清空数据库
 func (db *DB) Flush() {
 	db.stopWorld.Add(1)
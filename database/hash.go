@@ -0,0 +1,494 @@
+// 哈希指令
+
+package database
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"ljr-redis/acl"
+	Hash "ljr-redis/datastruct/hash"
+	"ljr-redis/interface/database"
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+// 获取哈希数据，key 不存在时返回 nil
+func (db *DB) getAsHash(key string) (*Hash.Hash, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	hash, ok := entity.Data.(*Hash.Hash)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return hash, nil
+}
+
+// 获取哈希数据，key 不存在时创建新哈希
+func (db *DB) getOrInitHash(key string) (hash *Hash.Hash, inited bool, errReply reply.ErrorReply) {
+	hash, errReply = db.getAsHash(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	inited = false
+	if hash == nil {
+		hash = Hash.Make()
+		db.PutEntity(key, &database.DataEntity{Data: hash})
+		inited = true
+	}
+	return hash, inited, nil
+}
+
+// 回滚哈希中的指定 fields
+func rollbackHashFields(db *DB, key string, fields ...string) []CmdLine {
+	var undoCmdLines []CmdLine
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return nil
+	}
+	if hash == nil {
+		undoCmdLines = append(undoCmdLines, utils.ToCmdLine("DEL", key))
+		return undoCmdLines
+	}
+	for _, field := range fields {
+		value, ok := hash.Get(field)
+		if !ok {
+			undoCmdLines = append(undoCmdLines, utils.ToCmdLine("HDEL", key, field))
+		} else {
+			undoCmdLines = append(undoCmdLines, utils.ToCmdLine3("HSET", []byte(key), []byte(field), value))
+		}
+	}
+	return appendTTLCmd(db, key, undoCmdLines)
+}
+
+/* ---------- HSET HGET ------------ */
+
+// HSET key field value [field value ...] 返回新增的 field 个数
+func execHSet(db *DB, args [][]byte) redis.Reply {
+	if len(args)%2 != 1 {
+		return reply.MakeArgNumErrReply("hset")
+	}
+	key := string(args[0])
+
+	hash, _, errReply := db.getOrInitHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	result := 0
+	for i := 1; i < len(args); i += 2 {
+		result += hash.Set(string(args[i]), args[i+1])
+	}
+
+	db.addAof(utils.ToCmdLine3("hset", args...))
+	db.notify(notifyHash, "hset", key)
+	return reply.MakeIntReply(int64(result))
+}
+
+// HMSET key field value [field value ...]
+func execHMSet(db *DB, args [][]byte) redis.Reply {
+	if len(args)%2 != 1 {
+		return reply.MakeArgNumErrReply("hmset")
+	}
+	result := execHSet(db, args)
+	if reply.IsErrorReply(result) {
+		return result
+	}
+	return reply.MakeOkReply()
+}
+
+func undoHSet(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	fields := make([]string, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		fields = append(fields, string(args[i]))
+	}
+	return rollbackHashFields(db, key, fields...)
+}
+
+// field 不存在时设置
+func execHSetNX(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	field := string(args[1])
+
+	hash, _, errReply := db.getOrInitHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if _, exists := hash.Get(field); exists {
+		return reply.MakeIntReply(0)
+	}
+	hash.Set(field, args[2])
+
+	db.addAof(utils.ToCmdLine3("hsetnx", args...))
+	db.notify(notifyHash, "hset", key)
+	return reply.MakeIntReply(1)
+}
+
+// 获取 field 的 value
+func execHGet(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	field := string(args[1])
+
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeNullBulkReply()
+	}
+	value, exists := hash.Get(field)
+	if !exists {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply(value)
+}
+
+// 批量获取 field 的 value
+func execHMGet(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	result := make([][]byte, len(args)-1)
+
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeMultiBulkReply(result)
+	}
+	for i, field := range args[1:] {
+		value, _ := hash.Get(string(field))
+		result[i] = value
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+/* ---------- HDEL HLEN HEXISTS HSTRLEN ------------ */
+
+// 删除 fields，返回删除的个数
+func execHDel(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	deleted := 0
+	for _, field := range args[1:] {
+		deleted += hash.Remove(string(field))
+	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine3("hdel", args...))
+		db.notify(notifyHash, "hdel", key)
+	}
+	if hash.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return reply.MakeIntReply(int64(deleted))
+}
+
+func undoHDel(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	fields := make([]string, len(args)-1)
+	for i, field := range args[1:] {
+		fields[i] = string(field)
+	}
+	return rollbackHashFields(db, key, fields...)
+}
+
+// field 个数
+func execHLen(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(hash.Len()))
+}
+
+// field 是否存在
+func execHExists(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeIntReply(0)
+	}
+	if _, exists := hash.Get(string(args[1])); exists {
+		return reply.MakeIntReply(1)
+	}
+	return reply.MakeIntReply(0)
+}
+
+// value 的长度
+func execHStrLen(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeIntReply(0)
+	}
+	value, _ := hash.Get(string(args[1]))
+	return reply.MakeIntReply(int64(len(value)))
+}
+
+/* ---------- HGETALL HKEYS HVALS ------------ */
+
+// 获取所有 field 和 value
+func execHGetAll(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+
+	result := make([][]byte, 0, hash.Len()*2)
+	hash.ForEach(func(field string, value []byte) bool {
+		result = append(result, []byte(field), value)
+		return true
+	})
+	return reply.MakeMultiBulkReply(result)
+}
+
+// 获取所有 field
+func execHKeys(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+
+	result := make([][]byte, 0, hash.Len())
+	hash.ForEach(func(field string, value []byte) bool {
+		result = append(result, []byte(field))
+		return true
+	})
+	return reply.MakeMultiBulkReply(result)
+}
+
+// 获取所有 value
+func execHVals(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+
+	result := make([][]byte, 0, hash.Len())
+	hash.ForEach(func(field string, value []byte) bool {
+		result = append(result, value)
+		return true
+	})
+	return reply.MakeMultiBulkReply(result)
+}
+
+/* ---------- HINCRBY HINCRBYFLOAT ------------ */
+
+// HINCRBY key field increment
+func execHIncrBy(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+
+	hash, _, errReply := db.getOrInitHash(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	var val int64
+	if value, exists := hash.Get(field); exists {
+		val, err = strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR hash value is not an integer")
+		}
+	}
+	if (delta > 0 && val > math.MaxInt64-delta) || (delta < 0 && val < math.MinInt64-delta) {
+		return reply.MakeErrReply("ERR increment or decrement would overflow")
+	}
+
+	val += delta
+	hash.Set(field, []byte(strconv.FormatInt(val, 10)))
+	db.addAof(utils.ToCmdLine3("hincrby", args...))
+	db.notify(notifyHash, "hincrby", key)
+	return reply.MakeIntReply(val)
+}
+
+// HINCRBYFLOAT key field increment
+func execHIncrByFloat(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return reply.MakeErrReply("ERR value is not a valid float")
+	}
+
+	hash, _, errReply := db.getOrInitHash(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	var val float64
+	if value, exists := hash.Get(field); exists {
+		val, err = strconv.ParseFloat(string(value), 64)
+		if err != nil || math.IsNaN(val) || math.IsInf(val, 0) {
+			return reply.MakeErrReply("ERR hash value is not a float")
+		}
+	}
+
+	val += delta
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return reply.MakeErrReply("ERR increment would produce NaN or Infinity")
+	}
+
+	result := []byte(strconv.FormatFloat(val, 'f', -1, 64))
+	hash.Set(field, result)
+	// 浮点数运算结果与平台相关，aof 中直接记录结果
+	db.addAof(utils.ToCmdLine3("hset", args[0], args[1], result))
+	db.notify(notifyHash, "hincrbyfloat", key)
+	return reply.MakeBulkReply(result)
+}
+
+func undoHIncr(db *DB, args [][]byte) []CmdLine {
+	return rollbackHashFields(db, string(args[0]), string(args[1]))
+}
+
+/* ---------- HRANDFIELD ------------ */
+
+// HRANDFIELD key [count [WITHVALUES]]
+// count > 0 返回不重复的 field，count < 0 返回的 field 可能重复
+func execHRandField(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	if len(args) > 3 {
+		return reply.MakeSyntaxErrReply()
+	}
+	withCount := len(args) >= 2
+	withValues := false
+	count := int64(1)
+	if withCount {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+	}
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHVALUES" {
+			return reply.MakeSyntaxErrReply()
+		}
+		withValues = true
+	}
+
+	hash, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		if withCount {
+			return reply.MakeEmptyMultiBulkReply()
+		}
+		return reply.MakeNullBulkReply()
+	}
+
+	var fields []string
+	if count >= 0 {
+		fields = hash.RandomDistinctFields(int(count))
+	} else {
+		if count < -math.MaxInt32 {
+			return reply.MakeErrReply("ERR value is out of range")
+		}
+		fields = hash.RandomFields(int(-count))
+	}
+
+	if !withCount {
+		return reply.MakeBulkReply([]byte(fields[0]))
+	}
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		result = append(result, []byte(field))
+		if withValues {
+			value, _ := hash.Get(field)
+			result = append(result, value)
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+/* ---------- HSCAN ------------ */
+
+// HSCAN key cursor [MATCH pattern] [COUNT count]
+func execHScan(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	cursor, errReply := parseCursor(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+
+	hash, err := db.getAsHash(key)
+	if err != nil {
+		return err
+	}
+	if hash == nil {
+		return makeScanReply(0, [][]byte{})
+	}
+	fields, next := hash.Scan(cursor, opts.count)
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		if !opts.match(field) {
+			continue
+		}
+		if value, exists := hash.Get(field); exists {
+			result = append(result, []byte(field), value)
+		}
+	}
+	return makeScanReply(next, result)
+}
+
+func init() {
+	RegisterCommand("HSet", execHSet, writeFirstKey, undoHSet, -4, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatHash|acl.CatFast)
+	RegisterCommand("HMSet", execHMSet, writeFirstKey, undoHSet, -4, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatHash|acl.CatFast)
+	RegisterCommand("HSetNX", execHSetNX, writeFirstKey, undoHSet, 4, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatHash|acl.CatFast)
+	RegisterCommand("HGet", execHGet, readFirstKey, nil, 3, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatHash|acl.CatFast)
+	RegisterCommand("HMGet", execHMGet, readFirstKey, nil, -3, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatHash|acl.CatFast)
+	RegisterCommand("HGetAll", execHGetAll, readFirstKey, nil, 2, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatHash|acl.CatSlow)
+	RegisterCommand("HDel", execHDel, writeFirstKey, undoHDel, -3, flagWrite|flagFast, 1, 1, 1, acl.CatWrite|acl.CatHash|acl.CatFast)
+	RegisterCommand("HLen", execHLen, readFirstKey, nil, 2, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatHash|acl.CatFast)
+	RegisterCommand("HExists", execHExists, readFirstKey, nil, 3, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatHash|acl.CatFast)
+	RegisterCommand("HKeys", execHKeys, readFirstKey, nil, 2, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatHash|acl.CatSlow)
+	RegisterCommand("HVals", execHVals, readFirstKey, nil, 2, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatHash|acl.CatSlow)
+	RegisterCommand("HIncrBy", execHIncrBy, writeFirstKey, undoHIncr, 4, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatHash|acl.CatFast)
+	RegisterCommand("HIncrByFloat", execHIncrByFloat, writeFirstKey, undoHIncr, 4, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatHash|acl.CatFast)
+	RegisterCommand("HStrLen", execHStrLen, readFirstKey, nil, 3, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatHash|acl.CatFast)
+	RegisterCommand("HRandField", execHRandField, readFirstKey, nil, -2, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatHash|acl.CatSlow)
+	RegisterCommand("HScan", execHScan, readFirstKey, nil, -3, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatHash|acl.CatSlow)
+}
@@ -0,0 +1,84 @@
+// 测试哈希指令
+
+package database
+
+import (
+	"strconv"
+	"testing"
+
+	Hash "ljr-redis/datastruct/hash"
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+func TestHSetAndGet(t *testing.T) {
+	db := MakeDB()
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("hset", "h", "a", "1", "b", "2")), 2)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("hset", "h", "a", "3", "c", "4")), 1)
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("hget", "h", "a")), "3")
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("hmget", "h", "a", "x")),
+		reply.MakeMultiBulkReply([][]byte{[]byte("3"), nil}))
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("hsetnx", "h", "a", "9")), 0)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("hlen", "h")), 3)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("hexists", "h", "c")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("hstrlen", "h", "c")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("hdel", "h", "a", "b", "c", "x")), 3)
+	if _, ok := db.GetEntity("h"); ok {
+		t.Error("empty hash should be removed")
+	}
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("hset", "h", "a")))
+}
+
+func TestHashEncodingConvert(t *testing.T) {
+	db := MakeDB()
+	for i := 0; i < 200; i++ {
+		db.Exec(nil, utils.ToCmdLine("hset", "h", strconv.Itoa(i), strconv.Itoa(i)))
+	}
+	hash, _ := db.getAsHash("h")
+	if hash.Encoding() != Hash.EncodingHashtable {
+		t.Errorf("expected hashtable encoding, actually %s", hash.Encoding())
+	}
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("hlen", "h")), 200)
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("hget", "h", "150")), "150")
+}
+
+func TestHIncr(t *testing.T) {
+	db := MakeDB()
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("hincrby", "h", "a", "5")), 5)
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("hincrbyfloat", "h", "a", "1.5")), "6.5")
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("hincrby", "h", "a", "1")))
+}
+
+func TestHRandFieldAndScan(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("hset", "h", "a", "1", "b", "2", "c", "3"))
+	result := db.Exec(nil, utils.ToCmdLine("hrandfield", "h", "5")).(*reply.MultiBulkReply)
+	if len(result.Args) != 3 {
+		t.Errorf("expected 3 fields, actually %d", len(result.Args))
+	}
+	result = db.Exec(nil, utils.ToCmdLine("hrandfield", "h", "-5", "WITHVALUES")).(*reply.MultiBulkReply)
+	if len(result.Args) != 10 {
+		t.Errorf("expected 10 items, actually %d", len(result.Args))
+	}
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("hscan", "h", "0", "MATCH", "[ab]")), reply.MakeMultiRawReply(
+		[]redis.Reply{reply.MakeBulkReply([]byte("0")), reply.MakeMultiBulkReply(utils.ToCmdLine("a", "1", "b", "2"))},
+	))
+}
+
+func TestHashUndo(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("hset", "h", "a", "1"))
+	for _, cmdLine := range []CmdLine{
+		utils.ToCmdLine("hset", "h", "a", "2", "b", "3"),
+		utils.ToCmdLine("hdel", "h", "a"),
+		utils.ToCmdLine("hincrby", "h", "a", "2"),
+	} {
+		undo := db.GetUndoLogs(cmdLine)
+		db.Exec(nil, cmdLine)
+		for _, undoCmdLine := range undo {
+			db.execWithLock(undoCmdLine)
+		}
+		assertReply(t, db.Exec(nil, utils.ToCmdLine("hgetall", "h")), reply.MakeMultiBulkReply(utils.ToCmdLine("a", "1")))
+	}
+}
@@ -0,0 +1,672 @@
+// key 相关指令
+
+package database
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"ljr-redis/acl"
+	Hash "ljr-redis/datastruct/hash"
+	List "ljr-redis/datastruct/list"
+	HashSet "ljr-redis/datastruct/set"
+	SortedSet "ljr-redis/datastruct/sortedset"
+	"ljr-redis/interface/database"
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+/* ---------- DEL UNLINK EXISTS TOUCH ------------ */
+
+// 删除 keys
+func execDel(db *DB, args [][]byte) redis.Reply {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+
+	deleted := 0
+	for _, key := range keys {
+		if db.Removes(key) > 0 {
+			deleted++
+			db.notify(notifyGeneric, "del", key)
+		}
+	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine3("del", args...))
+	}
+	return reply.MakeIntReply(int64(deleted))
+}
+
+func undoDel(db *DB, args [][]byte) []CmdLine {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return rollbackGivenKeys(db, keys...)
+}
+
+// 统计存在的 key 的个数，重复的 key 重复计数
+func execExists(db *DB, args [][]byte) redis.Reply {
+	var result int64
+	for _, arg := range args {
+		if _, exists := db.GetEntity(string(arg)); exists {
+			result++
+		}
+	}
+	return reply.MakeIntReply(result)
+}
+
+/* ---------- TYPE ------------ */
+
+// 数据类型的名称
+func typeOf(entity *database.DataEntity) string {
+	switch entity.Data.(type) {
+	case []byte:
+		return "string"
+	case List.List:
+		return "list"
+	case *Hash.Hash:
+		return "hash"
+	case *HashSet.Set:
+		return "set"
+	case *SortedSet.SortedSet:
+		return "zset"
+	}
+	return ""
+}
+
+// 获取 key 的数据类型
+func execType(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeStatusReply("none")
+	}
+	typeName := typeOf(entity)
+	if typeName == "" {
+		return &reply.UnknownErrReply{}
+	}
+	return reply.MakeStatusReply(typeName)
+}
+
+/* ---------- RENAME RENAMENX ------------ */
+
+func prepareRename(args [][]byte) ([]string, []string) {
+	src := string(args[0])
+	dest := string(args[1])
+	return []string{src, dest}, nil
+}
+
+func undoRename(db *DB, args [][]byte) []CmdLine {
+	src := string(args[0])
+	dest := string(args[1])
+	return rollbackGivenKeys(db, src, dest)
+}
+
+// 将 src 重命名为 dest，过期时间随数据一起转移
+func (db *DB) rename(src string, dest string, entity *database.DataEntity) {
+	rawExpireTime, hasTTL := db.ttlMap.Get(src)
+	db.PutEntity(dest, entity)
+	db.Remove(src)
+	if hasTTL {
+		db.Expire(dest, rawExpireTime.(time.Time))
+	} else {
+		db.Persist(dest)
+	}
+	db.notify(notifyGeneric, "rename_from", src)
+	db.notify(notifyGeneric, "rename_to", dest)
+}
+
+// 重命名 key，目标 key 存在时覆盖
+func execRename(db *DB, args [][]byte) redis.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+
+	entity, exists := db.GetEntity(src)
+	if !exists {
+		return reply.MakeErrReply("ERR no such key")
+	}
+	if src != dest {
+		db.rename(src, dest, entity)
+	}
+	db.addAof(utils.ToCmdLine3("rename", args...))
+	return reply.MakeOkReply()
+}
+
+// 重命名 key，目标 key 存在时不做任何操作
+func execRenameNx(db *DB, args [][]byte) redis.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+
+	entity, exists := db.GetEntity(src)
+	if !exists {
+		return reply.MakeErrReply("ERR no such key")
+	}
+	if _, exists = db.GetEntity(dest); exists {
+		return reply.MakeIntReply(0)
+	}
+	db.rename(src, dest, entity)
+	db.addAof(utils.ToCmdLine3("renamenx", args...))
+	return reply.MakeIntReply(1)
+}
+
+/* ---------- COPY MOVE ------------ */
+
+// 深拷贝数据实例
+func deepCopyEntity(entity *database.DataEntity) *database.DataEntity {
+	var data interface{}
+	switch val := entity.Data.(type) {
+	case []byte:
+		bytes := make([]byte, len(val))
+		copy(bytes, val)
+		data = bytes
+	case List.List:
+		list := List.NewQuickList()
+		val.ForEach(func(i int, v interface{}) bool {
+			list.Add(v)
+			return true
+		})
+		data = list
+	case *Hash.Hash:
+		hash := Hash.Make()
+		val.ForEach(func(field string, value []byte) bool {
+			hash.Set(field, value)
+			return true
+		})
+		data = hash
+	case *HashSet.Set:
+		data = val.Union(HashSet.Make())
+	case *SortedSet.SortedSet:
+		sortedSet := SortedSet.Make()
+		val.ForEachByRank(0, val.Len(), false, func(element *SortedSet.Element) bool {
+			sortedSet.Add(element.Member, element.Score)
+			return true
+		})
+		data = sortedSet
+	}
+	return &database.DataEntity{Data: data}
+}
+
+// 将 src 中的 srcKey 复制到 dest 中的 destKey，过期时间一起复制，调用者需要持有锁
+func copyToDB(src *DB, dest *DB, srcKey string, destKey string, replace bool) bool {
+	entity, exists := src.GetEntity(srcKey)
+	if !exists {
+		return false
+	}
+	if _, exists = dest.GetEntity(destKey); exists && !replace {
+		return false
+	}
+	dest.PutEntity(destKey, deepCopyEntity(entity))
+	if rawExpireTime, hasTTL := src.ttlMap.Get(srcKey); hasTTL {
+		dest.Expire(destKey, rawExpireTime.(time.Time))
+	} else {
+		dest.Persist(destKey)
+	}
+	return true
+}
+
+// 解析 COPY source destination [DB destination-db] [REPLACE]，没有 DB 参数时 dbIndex 为 -1
+func parseCopyArgs(args [][]byte) (dbIndex int, replace bool, errReply redis.Reply) {
+	dbIndex = -1
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "DB":
+			if i+1 >= len(args) {
+				return 0, false, reply.MakeSyntaxErrReply()
+			}
+			index, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return 0, false, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if index < 0 {
+				return 0, false, reply.MakeErrReply("ERR DB index is out of range")
+			}
+			dbIndex = index
+			i++
+		case "REPLACE":
+			replace = true
+		default:
+			return 0, false, reply.MakeSyntaxErrReply()
+		}
+	}
+	return dbIndex, replace, nil
+}
+
+func prepareCopy(args [][]byte) ([]string, []string) {
+	src := string(args[0])
+	dest := string(args[1])
+	return []string{dest}, []string{src}
+}
+
+func undoCopy(db *DB, args [][]byte) []CmdLine {
+	dest := string(args[1])
+	return rollbackGivenKeys(db, dest)
+}
+
+// 在当前数据库中复制 key，跨数据库复制由 MultiDB 处理
+func execCopy(db *DB, args [][]byte) redis.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	dbIndex, replace, errReply := parseCopyArgs(args)
+	if errReply != nil {
+		return errReply
+	}
+	if dbIndex >= 0 && dbIndex != db.index {
+		return reply.MakeErrReply("ERR COPY with DB option is not supported in MULTI")
+	}
+	if src == dest {
+		return reply.MakeErrReply("ERR source and destination objects are the same")
+	}
+
+	if !copyToDB(db, db, src, dest, replace) {
+		return reply.MakeIntReply(0)
+	}
+	db.addAof(utils.ToCmdLine3("copy", args...))
+	db.notify(notifyGeneric, "copy_to", dest)
+	return reply.MakeIntReply(1)
+}
+
+// MOVE 由 MultiDB 执行，单个数据库无法执行
+func execMoveInDB(db *DB, args [][]byte) redis.Reply {
+	return reply.MakeErrReply("ERR MOVE must be executed across databases")
+}
+
+// 对两个数据库中的 key 上锁，总是先锁编号小的数据库，避免死锁
+func rwLocksTwoDBs(src *DB, srcWrite []string, srcRead []string, dest *DB, destWrite []string, destRead []string) {
+	if src.index < dest.index {
+		src.RWLocks(srcWrite, srcRead)
+		dest.RWLocks(destWrite, destRead)
+	} else {
+		dest.RWLocks(destWrite, destRead)
+		src.RWLocks(srcWrite, srcRead)
+	}
+}
+
+func rwUnLocksTwoDBs(src *DB, srcWrite []string, srcRead []string, dest *DB, destWrite []string, destRead []string) {
+	src.RWUnLocks(srcWrite, srcRead)
+	dest.RWUnLocks(destWrite, destRead)
+}
+
+// 复制 key，COPY source destination [DB destination-db] [REPLACE]
+func execCopyToDB(c redis.Connection, mdb *MultiDB, args [][]byte) redis.Reply {
+	dbIndex, _, errReply := parseCopyArgs(args)
+	if errReply != nil {
+		return errReply
+	}
+	srcDB, errReply := mdb.selectDB(c.GetDBIndex())
+	if errReply != nil {
+		return errReply
+	}
+	if dbIndex < 0 || dbIndex == srcDB.index {
+		// 同一个数据库中复制
+		return srcDB.Exec(c, utils.ToCmdLine3("copy", args...))
+	}
+	destDB, errReply := mdb.selectDB(dbIndex)
+	if errReply != nil {
+		return errReply
+	}
+
+	src := string(args[0])
+	dest := string(args[1])
+	destDB.addVersion(dest)
+	rwLocksTwoDBs(srcDB, nil, []string{src}, destDB, []string{dest}, nil)
+	defer destDB.wakeBlockedClients(dest)
+	defer rwUnLocksTwoDBs(srcDB, nil, []string{src}, destDB, []string{dest}, nil)
+	return execCopyToDBWithLock(mdb, srcDB, args)
+}
+
+// 复制 key 到另一个数据库，调用者需要持有两个 key 的锁
+func execCopyToDBWithLock(mdb *MultiDB, srcDB *DB, args [][]byte) redis.Reply {
+	dbIndex, replace, errReply := parseCopyArgs(args)
+	if errReply != nil {
+		return errReply
+	}
+	destDB, errReply := mdb.selectDB(dbIndex)
+	if errReply != nil {
+		return errReply
+	}
+	src := string(args[0])
+	dest := string(args[1])
+	if !copyToDB(srcDB, destDB, src, dest, replace) {
+		return reply.MakeIntReply(0)
+	}
+	srcDB.addAof(utils.ToCmdLine3("copy", args...))
+	destDB.notify(notifyGeneric, "copy_to", dest)
+	return reply.MakeIntReply(1)
+}
+
+// 将 key 移动到另一个数据库，MOVE key db
+func execMove(c redis.Connection, mdb *MultiDB, args [][]byte) redis.Reply {
+	srcDB, errReply := mdb.selectDB(c.GetDBIndex())
+	if errReply != nil {
+		return errReply
+	}
+	destDB, errReply := parseMoveDest(mdb, srcDB, args)
+	if errReply != nil {
+		return errReply
+	}
+
+	key := string(args[0])
+	keys := []string{key}
+	srcDB.addVersion(key)
+	destDB.addVersion(key)
+	rwLocksTwoDBs(srcDB, keys, nil, destDB, keys, nil)
+	defer destDB.wakeBlockedClients(key)
+	defer rwUnLocksTwoDBs(srcDB, keys, nil, destDB, keys, nil)
+	return execMoveWithLock(mdb, srcDB, args)
+}
+
+// 解析 MOVE 的目标数据库
+func parseMoveDest(mdb *MultiDB, srcDB *DB, args [][]byte) (*DB, reply.ErrorReply) {
+	dbIndex, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	destDB, errReply := mdb.selectDB(dbIndex)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if srcDB == destDB {
+		return nil, reply.MakeErrReply("ERR source and destination objects are the same")
+	}
+	return destDB, nil
+}
+
+// 移动 key 到另一个数据库，调用者需要持有两个数据库中 key 的锁
+func execMoveWithLock(mdb *MultiDB, srcDB *DB, args [][]byte) redis.Reply {
+	destDB, errReply := parseMoveDest(mdb, srcDB, args)
+	if errReply != nil {
+		return errReply
+	}
+	key := string(args[0])
+	if !copyToDB(srcDB, destDB, key, key, false) {
+		return reply.MakeIntReply(0)
+	}
+	srcDB.Remove(key)
+	srcDB.addAof(utils.ToCmdLine3("move", args...))
+	srcDB.notify(notifyGeneric, "move_from", key)
+	destDB.notify(notifyGeneric, "move_to", key)
+	return reply.MakeIntReply(1)
+}
+
+/* ---------- EXPIRE PEXPIRE EXPIREAT PEXPIREAT ------------ */
+
+// 设置过期时间的条件 NX XX GT LT
+type expireOptions struct {
+	nx bool
+	xx bool
+	gt bool
+	lt bool
+}
+
+func parseExpireOptions(args [][]byte) (*expireOptions, redis.Reply) {
+	opts := &expireOptions{}
+	for _, arg := range args {
+		switch strings.ToUpper(string(arg)) {
+		case "NX":
+			opts.nx = true
+		case "XX":
+			opts.xx = true
+		case "GT":
+			opts.gt = true
+		case "LT":
+			opts.lt = true
+		default:
+			return nil, reply.MakeErrReply("ERR Unsupported option " + string(arg))
+		}
+	}
+	if opts.nx && (opts.xx || opts.gt || opts.lt) {
+		return nil, reply.MakeErrReply("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if opts.gt && opts.lt {
+		return nil, reply.MakeErrReply("ERR GT and LT options at the same time are not compatible")
+	}
+	return opts, nil
+}
+
+// 计算过期时间点，absolute 为 true 时参数为 unix 时间戳
+func parseExpireAt(cmdName string, raw []byte, unit time.Duration, absolute bool) (time.Time, redis.Reply) {
+	n, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return time.Time{}, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	perMilli := int64(unit / time.Millisecond)
+	if n > math.MaxInt64/perMilli || n < math.MinInt64/perMilli {
+		return time.Time{}, reply.MakeErrReply("ERR invalid expire time in '" + cmdName + "' command")
+	}
+	ms := n * perMilli
+	if !absolute {
+		now := time.Now().UnixMilli()
+		if (ms > 0 && now > math.MaxInt64-ms) || (ms < 0 && now < math.MinInt64-ms) {
+			return time.Time{}, reply.MakeErrReply("ERR invalid expire time in '" + cmdName + "' command")
+		}
+		ms += now
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// 设置过期时间，设置成功返回 1，key 不存在或者不满足条件时返回 0
+func execExpireGeneric(db *DB, args [][]byte, cmdName string, unit time.Duration, absolute bool) redis.Reply {
+	key := string(args[0])
+	expireAt, errReply := parseExpireAt(cmdName, args[1], unit, absolute)
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseExpireOptions(args[2:])
+	if errReply != nil {
+		return errReply
+	}
+
+	if _, exists := db.GetEntity(key); !exists {
+		return reply.MakeIntReply(0)
+	}
+	// 没有过期时间视为永不过期
+	rawExpireTime, hasTTL := db.ttlMap.Get(key)
+	var current time.Time
+	if hasTTL {
+		current = rawExpireTime.(time.Time)
+	}
+	if (opts.nx && hasTTL) ||
+		(opts.xx && !hasTTL) ||
+		(opts.gt && (!hasTTL || !expireAt.After(current))) ||
+		(opts.lt && hasTTL && !expireAt.Before(current)) {
+		return reply.MakeIntReply(0)
+	}
+
+	if !expireAt.After(time.Now()) {
+		// 过期时间已经过去，直接删除
+		db.Remove(key)
+		db.addAof(utils.ToCmdLine("del", key))
+		db.notify(notifyGeneric, "del", key)
+		return reply.MakeIntReply(1)
+	}
+	db.Expire(key, expireAt)
+	db.addAof(makeExpireCmd(key, expireAt))
+	db.notify(notifyGeneric, "expire", key)
+	return reply.MakeIntReply(1)
+}
+
+// EXPIRE key seconds [NX|XX|GT|LT]
+func execExpire(db *DB, args [][]byte) redis.Reply {
+	return execExpireGeneric(db, args, "expire", time.Second, false)
+}
+
+// PEXPIRE key milliseconds [NX|XX|GT|LT]
+func execPExpire(db *DB, args [][]byte) redis.Reply {
+	return execExpireGeneric(db, args, "pexpire", time.Millisecond, false)
+}
+
+// EXPIREAT key unix-time-seconds [NX|XX|GT|LT]
+func execExpireAt(db *DB, args [][]byte) redis.Reply {
+	return execExpireGeneric(db, args, "expireat", time.Second, true)
+}
+
+// PEXPIREAT key unix-time-milliseconds [NX|XX|GT|LT]
+func execPExpireAt(db *DB, args [][]byte) redis.Reply {
+	return execExpireGeneric(db, args, "pexpireat", time.Millisecond, true)
+}
+
+/* ---------- TTL PTTL EXPIRETIME PEXPIRETIME PERSIST ------------ */
+
+// 获取过期时间，key 不存在时返回 -2，没有过期时间时返回 -1
+func execTTLGeneric(db *DB, args [][]byte, convert func(expireAt time.Time) int64) redis.Reply {
+	key := string(args[0])
+	if _, exists := db.GetEntity(key); !exists {
+		return reply.MakeIntReply(-2)
+	}
+	rawExpireTime, hasTTL := db.ttlMap.Get(key)
+	if !hasTTL {
+		return reply.MakeIntReply(-1)
+	}
+	return reply.MakeIntReply(convert(rawExpireTime.(time.Time)))
+}
+
+// 剩余的秒数
+func execTTL(db *DB, args [][]byte) redis.Reply {
+	return execTTLGeneric(db, args, func(expireAt time.Time) int64 {
+		return int64((time.Until(expireAt) + 500*time.Millisecond) / time.Second)
+	})
+}
+
+// 剩余的毫秒数
+func execPTTL(db *DB, args [][]byte) redis.Reply {
+	return execTTLGeneric(db, args, func(expireAt time.Time) int64 {
+		return time.Until(expireAt).Milliseconds()
+	})
+}
+
+// 过期时间的 unix 时间戳，单位秒
+func execExpireTime(db *DB, args [][]byte) redis.Reply {
+	return execTTLGeneric(db, args, func(expireAt time.Time) int64 {
+		return expireAt.Unix()
+	})
+}
+
+// 过期时间的 unix 时间戳，单位毫秒
+func execPExpireTime(db *DB, args [][]byte) redis.Reply {
+	return execTTLGeneric(db, args, func(expireAt time.Time) int64 {
+		return expireAt.UnixMilli()
+	})
+}
+
+// 取消过期时间
+func execPersist(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	if _, exists := db.GetEntity(key); !exists {
+		return reply.MakeIntReply(0)
+	}
+	if _, hasTTL := db.ttlMap.Get(key); !hasTTL {
+		return reply.MakeIntReply(0)
+	}
+	db.Persist(key)
+	db.addAof(utils.ToCmdLine("persist", key))
+	db.notify(notifyGeneric, "persist", key)
+	return reply.MakeIntReply(1)
+}
+
+/* ---------- KEYS SCAN RANDOMKEY ------------ */
+
+// 获取匹配模式的所有 key
+func execKeys(db *DB, args [][]byte) redis.Reply {
+	pattern := compileMatchPattern(string(args[0]))
+	matched := make([]string, 0)
+	db.data.ForEach(func(key string, val interface{}) bool {
+		if pattern == nil || pattern.IsMatch(key) {
+			matched = append(matched, key)
+		}
+		return true
+	})
+
+	// 检查过期时可能删除 key，需要上锁
+	db.RWLocks(nil, matched)
+	defer db.RWUnLocks(nil, matched)
+	result := make([][]byte, 0, len(matched))
+	for _, key := range matched {
+		if _, exists := db.GetEntity(key); exists {
+			result = append(result, []byte(key))
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func execScan(db *DB, args [][]byte) redis.Reply {
+	cursor, errReply := parseCursor(args[0])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[1:], true)
+	if errReply != nil {
+		return errReply
+	}
+
+	keys, next := db.data.Scan(cursor, opts.count)
+	matched := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if opts.match(key) {
+			matched = append(matched, key)
+		}
+	}
+
+	// 检查过期时可能删除 key，需要上锁
+	db.RWLocks(nil, matched)
+	defer db.RWUnLocks(nil, matched)
+	result := make([][]byte, 0, len(matched))
+	for _, key := range matched {
+		entity, exists := db.GetEntity(key)
+		if !exists {
+			continue
+		}
+		if opts.typeName != "" && typeOf(entity) != opts.typeName {
+			continue
+		}
+		result = append(result, []byte(key))
+	}
+	return makeScanReply(next, result)
+}
+
+// 随机返回一个 key
+func execRandomKey(db *DB, args [][]byte) redis.Reply {
+	// 随机到的 key 可能已经过期，多尝试几次
+	for i := 0; i < 10; i++ {
+		keys := db.data.RandomKeys(1)
+		if len(keys) == 0 {
+			return reply.MakeNullBulkReply()
+		}
+		db.RWLocks(nil, keys)
+		_, exists := db.GetEntity(keys[0])
+		db.RWUnLocks(nil, keys)
+		if exists {
+			return reply.MakeBulkReply([]byte(keys[0]))
+		}
+	}
+	return reply.MakeNullBulkReply()
+}
+
+func init() {
+	RegisterCommand("Del", execDel, writeAllKeys, undoDel, -2, flagWrite, 1, -1, 1, acl.CatKeyspace|acl.CatWrite|acl.CatSlow)
+	RegisterCommand("Unlink", execDel, writeAllKeys, undoDel, -2, flagWrite|flagFast, 1, -1, 1, acl.CatKeyspace|acl.CatWrite|acl.CatFast)
+	RegisterCommand("Exists", execExists, readAllKeys, nil, -2, flagReadOnly|flagFast, 1, -1, 1, acl.CatKeyspace|acl.CatRead|acl.CatFast)
+	RegisterCommand("Touch", execExists, readAllKeys, nil, -2, flagReadOnly|flagFast, 1, -1, 1, acl.CatKeyspace|acl.CatRead|acl.CatFast)
+	RegisterCommand("Type", execType, readFirstKey, nil, 2, flagReadOnly|flagFast, 1, 1, 1, acl.CatKeyspace|acl.CatRead|acl.CatFast)
+	RegisterCommand("Rename", execRename, prepareRename, undoRename, 3, flagWrite, 1, 2, 1, acl.CatKeyspace|acl.CatWrite|acl.CatSlow)
+	RegisterCommand("RenameNx", execRenameNx, prepareRename, undoRename, 3, flagWrite|flagFast, 1, 2, 1, acl.CatKeyspace|acl.CatWrite|acl.CatFast)
+	RegisterCommand("Copy", execCopy, prepareCopy, undoCopy, -3, flagWrite|flagDenyOOM, 1, 2, 1, acl.CatKeyspace|acl.CatWrite|acl.CatSlow)
+	RegisterCommand("Move", execMoveInDB, writeFirstKey, nil, 3, flagWrite|flagFast, 1, 1, 1, acl.CatKeyspace|acl.CatWrite|acl.CatFast)
+	RegisterCommand("Expire", execExpire, writeFirstKey, rollbackFirstKey, -3, flagWrite|flagFast, 1, 1, 1, acl.CatKeyspace|acl.CatWrite|acl.CatFast)
+	RegisterCommand("PExpire", execPExpire, writeFirstKey, rollbackFirstKey, -3, flagWrite|flagFast, 1, 1, 1, acl.CatKeyspace|acl.CatWrite|acl.CatFast)
+	RegisterCommand("ExpireAt", execExpireAt, writeFirstKey, rollbackFirstKey, -3, flagWrite|flagFast, 1, 1, 1, acl.CatKeyspace|acl.CatWrite|acl.CatFast)
+	RegisterCommand("PExpireAt", execPExpireAt, writeFirstKey, rollbackFirstKey, -3, flagWrite|flagFast, 1, 1, 1, acl.CatKeyspace|acl.CatWrite|acl.CatFast)
+	RegisterCommand("TTL", execTTL, readFirstKey, nil, 2, flagReadOnly|flagFast, 1, 1, 1, acl.CatKeyspace|acl.CatRead|acl.CatFast)
+	RegisterCommand("PTTL", execPTTL, readFirstKey, nil, 2, flagReadOnly|flagFast, 1, 1, 1, acl.CatKeyspace|acl.CatRead|acl.CatFast)
+	RegisterCommand("ExpireTime", execExpireTime, readFirstKey, nil, 2, flagReadOnly|flagFast, 1, 1, 1, acl.CatKeyspace|acl.CatRead|acl.CatFast)
+	RegisterCommand("PExpireTime", execPExpireTime, readFirstKey, nil, 2, flagReadOnly|flagFast, 1, 1, 1, acl.CatKeyspace|acl.CatRead|acl.CatFast)
+	RegisterCommand("Persist", execPersist, writeFirstKey, rollbackFirstKey, 2, flagWrite|flagFast, 1, 1, 1, acl.CatKeyspace|acl.CatWrite|acl.CatFast)
+	RegisterCommand("Keys", execKeys, noPrepare, nil, 2, flagReadOnly, 0, 0, 0, acl.CatKeyspace|acl.CatRead|acl.CatSlow|acl.CatDangerous)
+	RegisterCommand("Scan", execScan, noPrepare, nil, -2, flagReadOnly, 0, 0, 0, acl.CatKeyspace|acl.CatRead|acl.CatSlow)
+	RegisterCommand("RandomKey", execRandomKey, noPrepare, nil, 1, flagReadOnly, 0, 0, 0, acl.CatKeyspace|acl.CatRead|acl.CatSlow)
+}
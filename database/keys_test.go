@@ -0,0 +1,276 @@
+// 测试 key 相关指令
+
+package database
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+func TestExistsAndType(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("set", "str", "v"))
+	db.Exec(nil, utils.ToCmdLine("rpush", "list", "v"))
+	db.Exec(nil, utils.ToCmdLine("hset", "hash", "f", "v"))
+	db.Exec(nil, utils.ToCmdLine("sadd", "set", "v"))
+	db.Exec(nil, utils.ToCmdLine("zadd", "zset", "1", "v"))
+
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("exists", "str", "str", "none")), 2)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("touch", "list", "none")), 1)
+	for key, typ := range map[string]string{
+		"str": "string", "list": "list", "hash": "hash", "set": "set", "zset": "zset", "none": "none",
+	} {
+		assertReply(t, db.Exec(nil, utils.ToCmdLine("type", key)), reply.MakeStatusReply(typ))
+	}
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("unlink", "str", "list", "none")), 2)
+
+	// 已经过期的 key 不计入删除个数
+	db.Exec(nil, utils.ToCmdLine("set", "expired", "v", "PX", "1"))
+	time.Sleep(5 * time.Millisecond)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("del", "expired")), 0)
+}
+
+func TestRename(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("set", "a", "1", "EX", "100"))
+	db.Exec(nil, utils.ToCmdLine("set", "b", "2"))
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("rename", "a", "b")), reply.MakeOkReply())
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("get", "b")), "1")
+	if _, ok := db.ttlMap.Get("b"); !ok {
+		t.Error("ttl should be moved with the key")
+	}
+	if _, ok := db.ttlMap.Get("a"); ok {
+		t.Error("ttl of the source key should be removed")
+	}
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("rename", "a", "b")))
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("rename", "b", "b")), reply.MakeOkReply())
+
+	db.Exec(nil, utils.ToCmdLine("set", "c", "3"))
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("renamenx", "b", "c")), 0)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("renamenx", "b", "d")), 1)
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("get", "d")), "1")
+
+	undo := db.GetUndoLogs(utils.ToCmdLine("rename", "d", "c"))
+	db.Exec(nil, utils.ToCmdLine("rename", "d", "c"))
+	for _, undoCmdLine := range undo {
+		db.execWithLock(undoCmdLine)
+	}
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("get", "c")), "3")
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("get", "d")), "1")
+}
+
+func TestCopyAndMove(t *testing.T) {
+	mdb := NewStandaloneServer()
+	conn, _ := makeTestConn(t)
+	mdb.Exec(conn, utils.ToCmdLine("rpush", "list", "a", "b"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "str", "v", "EX", "100"))
+
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("copy", "list", "copy")), 1)
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("copy", "list", "copy")), 0)
+	mdb.Exec(conn, utils.ToCmdLine("rpush", "copy", "c"))
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("llen", "list")), 2)
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("copy", "copy", "list", "REPLACE")), 1)
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("llen", "list")), 3)
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("copy", "list", "list")))
+
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("copy", "str", "str", "DB", "1")), 1)
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("move", "list", "1")), 1)
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("move", "list", "1")), 0)
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("move", "str", "1")), 0)
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("move", "copy", "0")))
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("move", "copy", "16")))
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("exists", "list")), 0)
+
+	mdb.Exec(conn, utils.ToCmdLine("select", "1"))
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("llen", "list")), 3)
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "str")), "v")
+	if _, ok := mdb.dbSet[1].ttlMap.Get("str"); !ok {
+		t.Error("ttl should be copied with the key")
+	}
+}
+
+func TestMoveWithTTL(t *testing.T) {
+	mdb := NewStandaloneServer()
+	conn, _ := makeTestConn(t)
+	mdb.Exec(conn, utils.ToCmdLine("set", "k", "v", "EX", "100"))
+	mdb.Exec(conn, utils.ToCmdLine("pexpire", "k", "1500"))
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("move", "k", "1")), 1)
+	// 源数据库中删除同名 key 不能取消目标数据库的定时任务
+	mdb.Exec(conn, utils.ToCmdLine("set", "k", "v", "PX", "1500"))
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("del", "k")), 1)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := mdb.dbSet[1].data.Get("k"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("key should be expired actively")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestRandomKey(t *testing.T) {
+	db := MakeDB()
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("randomkey")), reply.MakeNullBulkReply())
+	db.Exec(nil, utils.ToCmdLine("set", "a", "1"))
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("randomkey")), "a")
+}
+
+func TestExpire(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("set", "a", "1"))
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("ttl", "none")), -2)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("ttl", "a")), -1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("expire", "none", "100")), 0)
+
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("expire", "a", "100", "XX")), 0)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("expire", "a", "100", "GT")), 0)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("expire", "a", "100", "NX")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("ttl", "a")), 100)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("expire", "a", "200", "NX")), 0)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("pexpire", "a", "200000", "LT")), 0)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("pexpire", "a", "200000", "GT")), 1)
+	if pttl := db.Exec(nil, utils.ToCmdLine("pttl", "a")).(*reply.IntReply).Code; pttl <= 199000 || pttl > 200000 {
+		t.Errorf("unexpected pttl %d", pttl)
+	}
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("expire", "a", "100", "NX", "XX")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("expire", "a", "100", "GT", "LT")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("expire", "a", "abc")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("expire", "a", "9223372036854775807")))
+
+	at := time.Now().Add(time.Hour).Unix()
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("expireat", "a", strconv.FormatInt(at, 10))), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("expiretime", "a")), at)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("pexpiretime", "a")), at*1000)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("persist", "a")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("persist", "a")), 0)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("expiretime", "a")), -1)
+
+	// 过期时间已经过去时直接删除
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("pexpireat", "a", "1")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("exists", "a")), 0)
+}
+
+func TestExpireUndo(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("set", "a", "1", "EX", "100"))
+	db.Exec(nil, utils.ToCmdLine("set", "b", "2"))
+	for _, cmdLine := range []CmdLine{
+		utils.ToCmdLine("expire", "a", "1000"),
+		utils.ToCmdLine("persist", "a"),
+		utils.ToCmdLine("expire", "b", "1000"),
+		utils.ToCmdLine("pexpire", "a", "-1"),
+		utils.ToCmdLine("set", "a", "3"),
+		utils.ToCmdLine("del", "a", "b"),
+	} {
+		undo := db.GetUndoLogs(cmdLine)
+		db.Exec(nil, cmdLine)
+		for _, undoCmdLine := range undo {
+			db.execWithLock(undoCmdLine)
+		}
+		assertBulk(t, db.Exec(nil, utils.ToCmdLine("get", "a")), "1")
+		assertInt(t, db.Exec(nil, utils.ToCmdLine("ttl", "a")), 100)
+		assertInt(t, db.Exec(nil, utils.ToCmdLine("ttl", "b")), -1)
+	}
+}
+
+// 按游标遍历直到结束，返回全部结果
+func scanAllReply(t *testing.T, db *DB, cmdLine ...string) []string {
+	t.Helper()
+	var result []string
+	cursor := "0"
+	for {
+		// 将 CURSOR 占位符替换为当前游标
+		args := append([]string{}, cmdLine...)
+		for i, arg := range args {
+			if arg == "CURSOR" {
+				args[i] = cursor
+			}
+		}
+		r, ok := db.Exec(nil, utils.ToCmdLine(args...)).(*reply.MultiRawReply)
+		if !ok {
+			t.Fatal("expected multi raw reply")
+		}
+		for _, arg := range r.Replies[1].(*reply.MultiBulkReply).Args {
+			result = append(result, string(arg))
+		}
+		cursor = string(r.Replies[0].(*reply.BulkReply).Arg)
+		if cursor == "0" {
+			return result
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	db := MakeDB()
+	for i := 0; i < 100; i++ {
+		db.Exec(nil, utils.ToCmdLine("set", "str"+strconv.Itoa(i), "v"))
+	}
+	db.Exec(nil, utils.ToCmdLine("rpush", "list", "v"))
+	db.Exec(nil, utils.ToCmdLine("set", "expired", "v", "PX", "1"))
+	time.Sleep(5 * time.Millisecond)
+
+	if keys := scanAllReply(t, db, "scan", "CURSOR", "COUNT", "7"); len(keys) != 101 {
+		t.Errorf("expected 101 keys, actually %d", len(keys))
+	}
+	if keys := scanAllReply(t, db, "scan", "CURSOR", "MATCH", "str1?"); len(keys) != 10 {
+		t.Errorf("expected 10 keys, actually %d", len(keys))
+	}
+	if keys := scanAllReply(t, db, "scan", "CURSOR", "TYPE", "list"); len(keys) != 1 || keys[0] != "list" {
+		t.Errorf("expected [list], actually %v", keys)
+	}
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("scan", "abc")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("scan", "0", "COUNT", "0")))
+	// 巨大的 COUNT 不能用来预分配内存
+	if keys := scanAllReply(t, db, "scan", "CURSOR", "COUNT", "1099511627776"); len(keys) != 101 {
+		t.Errorf("expected 101 keys, actually %d", len(keys))
+	}
+}
+
+func TestCollectionScan(t *testing.T) {
+	db := MakeDB()
+	for i := 0; i < 200; i++ {
+		member := "m" + strconv.Itoa(i)
+		db.Exec(nil, utils.ToCmdLine("hset", "hash", member, "v"))
+		db.Exec(nil, utils.ToCmdLine("sadd", "set", member))
+		db.Exec(nil, utils.ToCmdLine("zadd", "zset", strconv.Itoa(i), member))
+	}
+	if result := scanAllReply(t, db, "hscan", "hash", "CURSOR", "COUNT", "20"); len(result) != 400 {
+		t.Errorf("expected 400 elements, actually %d", len(result))
+	}
+	if result := scanAllReply(t, db, "sscan", "set", "CURSOR", "MATCH", "m1*"); len(result) != 111 {
+		t.Errorf("expected 111 members, actually %d", len(result))
+	}
+	if result := scanAllReply(t, db, "zscan", "zset", "CURSOR", "MATCH", "m199"); len(result) != 2 || result[1] != "199" {
+		t.Errorf("expected [m199 199], actually %v", result)
+	}
+	if result := scanAllReply(t, db, "sscan", "set", "CURSOR", "COUNT", "1099511627776"); len(result) != 200 {
+		t.Errorf("expected 200 members, actually %d", len(result))
+	}
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("sscan", "set", "0", "TYPE", "set")))
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("zscan", "none", "0")),
+		reply.MakeMultiRawReply([]redis.Reply{reply.MakeBulkReply([]byte("0")), reply.MakeMultiBulkReply([][]byte{})}))
+}
+
+func TestKeys(t *testing.T) {
+	db := MakeDB()
+	for _, key := range []string{"hello", "hallo", "hxllo", "h*llo", "world"} {
+		db.Exec(nil, utils.ToCmdLine("set", key, "v"))
+	}
+	db.Exec(nil, utils.ToCmdLine("set", "hillo", "v", "PX", "1"))
+	time.Sleep(5 * time.Millisecond)
+
+	assertMembers(t, db.Exec(nil, utils.ToCmdLine("keys", "*")), "hello", "hallo", "hxllo", "h*llo", "world")
+	assertMembers(t, db.Exec(nil, utils.ToCmdLine("keys", "h?llo")), "hello", "hallo", "hxllo", "h*llo")
+	assertMembers(t, db.Exec(nil, utils.ToCmdLine("keys", "h[^e]llo")), "hallo", "hxllo", "h*llo")
+	assertMembers(t, db.Exec(nil, utils.ToCmdLine("keys", "h[a-f]llo")), "hello", "hallo")
+	assertMembers(t, db.Exec(nil, utils.ToCmdLine("keys", "h\\*llo")), "h*llo")
+	assertMembers(t, db.Exec(nil, utils.ToCmdLine("keys", "none*")))
+}
@@ -0,0 +1,739 @@
+// 列表指令
+
+package database
+
+import (
+	"strconv"
+	"strings"
+
+	"ljr-redis/acl"
+	List "ljr-redis/datastruct/list"
+	"ljr-redis/interface/database"
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/byteutil"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+// 获取列表数据，key 不存在时返回 nil
+func (db *DB) getAsList(key string) (List.List, reply.ErrorReply) {
+	entity, ok := db.GetEntity(key)
+	if !ok {
+		return nil, nil
+	}
+	list, ok := entity.Data.(List.List)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return list, nil
+}
+
+// 获取列表数据，key 不存在时创建新列表
+func (db *DB) getOrInitList(key string) (list List.List, isNew bool, errReply reply.ErrorReply) {
+	list, errReply = db.getAsList(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	isNew = false
+	if list == nil {
+		list = List.NewQuickList()
+		db.PutEntity(key, &database.DataEntity{Data: list})
+		isNew = true
+	}
+	return list, isNew, nil
+}
+
+// 解析整数参数
+func parseInt(raw []byte) (int64, redis.Reply) {
+	n, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	return n, nil
+}
+
+// 将 redis 风格的闭区间 [start, stop] 转换为 [start, stop) 不合法时返回 -1, -1
+func convertRange(start int64, stop int64, size int64) (int, int) {
+	if start < 0 {
+		start = size + start
+		if start < 0 {
+			start = 0
+		}
+	}
+	if stop < 0 {
+		stop = size + stop
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start >= size || stop < start {
+		return -1, -1
+	}
+	return int(start), int(stop) + 1
+}
+
+// 列表元素转换为字节数组
+func listToBytes(vals []interface{}) [][]byte {
+	result := make([][]byte, len(vals))
+	for i, v := range vals {
+		result[i] = v.([]byte)
+	}
+	return result
+}
+
+/* ---------- PUSH ------------ */
+
+// 在头部插入元素
+func execLPush(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	values := args[1:]
+
+	list, _, errReply := db.getOrInitList(key)
+	if errReply != nil {
+		return errReply
+	}
+	for _, value := range values {
+		list.Insert(0, value)
+	}
+
+	db.addAof(utils.ToCmdLine3("lpush", args...))
+	db.notify(notifyList, "lpush", key)
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+func undoLPush(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	count := len(args) - 1
+	cmdLines := make([]CmdLine, 0, count)
+	for i := 0; i < count; i++ {
+		cmdLines = append(cmdLines, utils.ToCmdLine("LPOP", key))
+	}
+	return cmdLines
+}
+
+// key 存在时在头部插入元素
+func execLPushX(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	values := args[1:]
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+	for _, value := range values {
+		list.Insert(0, value)
+	}
+
+	db.addAof(utils.ToCmdLine3("lpushx", args...))
+	db.notify(notifyList, "lpush", key)
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+// 在尾部插入元素
+func execRPush(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	values := args[1:]
+
+	list, _, errReply := db.getOrInitList(key)
+	if errReply != nil {
+		return errReply
+	}
+	for _, value := range values {
+		list.Add(value)
+	}
+
+	db.addAof(utils.ToCmdLine3("rpush", args...))
+	db.notify(notifyList, "rpush", key)
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+func undoRPush(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	count := len(args) - 1
+	cmdLines := make([]CmdLine, 0, count)
+	for i := 0; i < count; i++ {
+		cmdLines = append(cmdLines, utils.ToCmdLine("RPOP", key))
+	}
+	return cmdLines
+}
+
+// key 存在时在尾部插入元素
+func execRPushX(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	values := args[1:]
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+	for _, value := range values {
+		list.Add(value)
+	}
+
+	db.addAof(utils.ToCmdLine3("rpushx", args...))
+	db.notify(notifyList, "rpush", key)
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+/* ---------- POP ------------ */
+
+// LPOP key [count] / RPOP key [count]
+func execPop(db *DB, cmdName string, args [][]byte, fromLeft bool) redis.Reply {
+	if len(args) > 2 {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	key := string(args[0])
+	withCount := len(args) == 2
+	count := int64(1)
+	if withCount {
+		var errReply redis.Reply
+		count, errReply = parseInt(args[1])
+		if errReply != nil {
+			return errReply
+		}
+		if count < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive")
+		}
+	}
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		if withCount {
+			return reply.MakeNullMultiBulkReply()
+		}
+		return reply.MakeNullBulkReply()
+	}
+
+	if int64(list.Len()) < count {
+		count = int64(list.Len())
+	}
+	result := make([][]byte, 0, count)
+	for i := int64(0); i < count; i++ {
+		var val interface{}
+		if fromLeft {
+			val = list.Remove(0)
+		} else {
+			val = list.RemoveLast()
+		}
+		result = append(result, val.([]byte))
+	}
+
+	if count > 0 {
+		db.addAof(utils.ToCmdLine3(cmdName, args...))
+		db.notify(notifyList, cmdName, key)
+	}
+	if list.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	if !withCount {
+		return reply.MakeBulkReply(result[0])
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// 删除并返回头部元素
+func execLPop(db *DB, args [][]byte) redis.Reply {
+	return execPop(db, "lpop", args, true)
+}
+
+// 删除并返回尾部元素
+func execRPop(db *DB, args [][]byte) redis.Reply {
+	return execPop(db, "rpop", args, false)
+}
+
+// 不带 count 时只需要重新插入被弹出的元素
+func undoLPop(db *DB, args [][]byte) []CmdLine {
+	if len(args) > 1 {
+		return rollbackFirstKey(db, args)
+	}
+	key := string(args[0])
+	list, errReply := db.getAsList(key)
+	if errReply != nil || list == nil || list.Len() == 0 {
+		return nil
+	}
+	element := list.Get(0).([]byte)
+	return appendTTLCmd(db, key, []CmdLine{utils.ToCmdLine3("LPUSH", args[0], element)})
+}
+
+func undoRPop(db *DB, args [][]byte) []CmdLine {
+	if len(args) > 1 {
+		return rollbackFirstKey(db, args)
+	}
+	key := string(args[0])
+	list, errReply := db.getAsList(key)
+	if errReply != nil || list == nil || list.Len() == 0 {
+		return nil
+	}
+	element := list.Get(list.Len() - 1).([]byte)
+	return appendTTLCmd(db, key, []CmdLine{utils.ToCmdLine3("RPUSH", args[0], element)})
+}
+
+/* ---------- LRANGE LLEN LINDEX LSET ------------ */
+
+// LRANGE key start stop
+func execLRange(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	start, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	stop, errReply := parseInt(args[2])
+	if errReply != nil {
+		return errReply
+	}
+
+	list, err := db.getAsList(key)
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+
+	begin, end := convertRange(start, stop, int64(list.Len()))
+	if begin < 0 {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	return reply.MakeMultiBulkReply(listToBytes(list.Range(begin, end)))
+}
+
+// 列表长度
+func execLLen(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+// LINDEX key index 支持负数索引
+func execLIndex(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	index, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+
+	list, err := db.getAsList(key)
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		return reply.MakeNullBulkReply()
+	}
+
+	size := int64(list.Len())
+	if index < 0 {
+		index = size + index
+	}
+	if index < 0 || index >= size {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply(list.Get(int(index)).([]byte))
+}
+
+// LSET key index element
+func execLSet(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	index, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	value := args[2]
+
+	list, err := db.getAsList(key)
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		return reply.MakeErrReply("ERR no such key")
+	}
+
+	size := int64(list.Len())
+	if index < 0 {
+		index = size + index
+	}
+	if index < 0 || index >= size {
+		return reply.MakeErrReply("ERR index out of range")
+	}
+
+	list.Set(int(index), value)
+	db.addAof(utils.ToCmdLine3("lset", args...))
+	db.notify(notifyList, "lset", key)
+	return reply.MakeOkReply()
+}
+
+func undoLSet(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	index, errReply := parseInt(args[1])
+	if errReply != nil {
+		return nil
+	}
+	list, err := db.getAsList(key)
+	if err != nil || list == nil {
+		return nil
+	}
+	size := int64(list.Len())
+	if index < 0 {
+		index = size + index
+	}
+	if index < 0 || index >= size {
+		return nil
+	}
+	value := list.Get(int(index)).([]byte)
+	return []CmdLine{
+		utils.ToCmdLine3("LSET", args[0], []byte(strconv.FormatInt(index, 10)), value),
+	}
+}
+
+/* ---------- LREM LINSERT LTRIM ------------ */
+
+// LREM key count element
+// count > 0 从头部开始删除 count 个，count < 0 从尾部开始删除，count == 0 删除全部
+func execLRem(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	count, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	value := args[2]
+
+	list, err := db.getAsList(key)
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	expected := func(a interface{}) bool {
+		return byteutil.BytesEquals(a.([]byte), value)
+	}
+	var removed int
+	if count == 0 {
+		removed = list.RemoveAllByVal(expected)
+	} else if count > 0 {
+		removed = list.RemoveByVal(expected, int(count))
+	} else {
+		removed = list.ReverseRemoveByVal(expected, int(-count))
+	}
+
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine3("lrem", args...))
+		db.notify(notifyList, "lrem", key)
+	}
+	if list.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return reply.MakeIntReply(int64(removed))
+}
+
+// LINSERT key BEFORE|AFTER pivot element
+func execLInsert(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	where := strings.ToUpper(string(args[1]))
+	if where != "BEFORE" && where != "AFTER" {
+		return reply.MakeSyntaxErrReply()
+	}
+	pivot := args[2]
+	value := args[3]
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	index := -1
+	list.ForEach(func(i int, v interface{}) bool {
+		if byteutil.BytesEquals(v.([]byte), pivot) {
+			index = i
+			return false
+		}
+		return true
+	})
+	if index < 0 {
+		return reply.MakeIntReply(-1)
+	}
+
+	if where == "AFTER" {
+		index++
+	}
+	list.Insert(index, value)
+	db.addAof(utils.ToCmdLine3("linsert", args...))
+	db.notify(notifyList, "linsert", key)
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+// LTRIM key start stop 只保留 [start, stop] 范围内的元素
+func execLTrim(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	start, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	stop, errReply := parseInt(args[2])
+	if errReply != nil {
+		return errReply
+	}
+
+	list, err := db.getAsList(key)
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		return reply.MakeOkReply()
+	}
+
+	begin, end := convertRange(start, stop, int64(list.Len()))
+	if begin >= 0 {
+		for list.Len() > end {
+			list.RemoveLast()
+		}
+		for i := 0; i < begin; i++ {
+			list.Remove(0)
+		}
+	}
+
+	db.addAof(utils.ToCmdLine3("ltrim", args...))
+	db.notify(notifyList, "ltrim", key)
+	if begin < 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return reply.MakeOkReply()
+}
+
+/* ---------- LPOS ------------ */
+
+// LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func execLPos(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	value := args[1]
+	rank := int64(1)
+	count := int64(-1) // -1 表示没有 COUNT 参数
+	maxLen := int64(0)
+
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return reply.MakeSyntaxErrReply()
+		}
+		n, errReply := parseInt(args[i+1])
+		if errReply != nil {
+			return errReply
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "RANK":
+			if n == 0 {
+				return reply.MakeErrReply("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return reply.MakeErrReply("ERR COUNT can't be negative")
+			}
+			count = n
+		case "MAXLEN":
+			if n < 0 {
+				return reply.MakeErrReply("ERR MAXLEN can't be negative")
+			}
+			maxLen = n
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		if count >= 0 {
+			return reply.MakeEmptyMultiBulkReply()
+		}
+		return reply.MakeNullBulkReply()
+	}
+
+	// 需要跳过的匹配个数
+	skip := rank - 1
+	if rank < 0 {
+		skip = -rank - 1
+	}
+	limit := count
+	if limit <= 0 {
+		// 没有 COUNT 时只取一个，COUNT 0 时取全部
+		limit = 1
+		if count == 0 {
+			limit = int64(list.Len())
+		}
+	}
+
+	positions := make([]int64, 0)
+	scanned := int64(0)
+	consumer := func(i int, v interface{}) bool {
+		if maxLen > 0 && scanned >= maxLen {
+			return false
+		}
+		scanned++
+		if byteutil.BytesEquals(v.([]byte), value) {
+			if skip > 0 {
+				skip--
+				return true
+			}
+			positions = append(positions, int64(i))
+			if int64(len(positions)) >= limit {
+				return false
+			}
+		}
+		return true
+	}
+	if rank > 0 {
+		list.ForEach(consumer)
+	} else {
+		list.ReverseForEach(consumer)
+	}
+
+	if count < 0 {
+		if len(positions) == 0 {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeIntReply(positions[0])
+	}
+	replies := make([]redis.Reply, len(positions))
+	for i, pos := range positions {
+		replies[i] = reply.MakeIntReply(pos)
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+/* ---------- LMOVE RPOPLPUSH ------------ */
+
+func prepareLMove(args [][]byte) ([]string, []string) {
+	return []string{string(args[0]), string(args[1])}, nil
+}
+
+func undoLMove(db *DB, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, string(args[0]), string(args[1]))
+}
+
+// 从 src 弹出元素并插入到 dst
+func lmove(db *DB, srcKey string, dstKey string, fromLeft bool, toLeft bool) ([]byte, redis.Reply) {
+	srcList, errReply := db.getAsList(srcKey)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if srcList == nil {
+		return nil, nil
+	}
+	// 先检查 dst 的类型，避免弹出后无法插入
+	if _, errReply = db.getAsList(dstKey); errReply != nil {
+		return nil, errReply
+	}
+
+	var val []byte
+	popEvent := "lpop"
+	if fromLeft {
+		val = srcList.Remove(0).([]byte)
+	} else {
+		val = srcList.RemoveLast().([]byte)
+		popEvent = "rpop"
+	}
+	db.notify(notifyList, popEvent, srcKey)
+	if srcList.Len() == 0 {
+		db.Remove(srcKey)
+		db.notify(notifyGeneric, "del", srcKey)
+	}
+
+	dstList, _, _ := db.getOrInitList(dstKey)
+	pushEvent := "lpush"
+	if toLeft {
+		dstList.Insert(0, val)
+	} else {
+		dstList.Add(val)
+		pushEvent = "rpush"
+	}
+	db.notify(notifyList, pushEvent, dstKey)
+	return val, nil
+}
+
+// 解析方向参数 LEFT RIGHT
+func parseDirection(raw []byte) (isLeft bool, ok bool) {
+	switch strings.ToUpper(string(raw)) {
+	case "LEFT":
+		return true, true
+	case "RIGHT":
+		return false, true
+	}
+	return false, false
+}
+
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func execLMove(db *DB, args [][]byte) redis.Reply {
+	fromLeft, ok := parseDirection(args[2])
+	if !ok {
+		return reply.MakeSyntaxErrReply()
+	}
+	toLeft, ok := parseDirection(args[3])
+	if !ok {
+		return reply.MakeSyntaxErrReply()
+	}
+
+	val, errReply := lmove(db, string(args[0]), string(args[1]), fromLeft, toLeft)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return reply.MakeNullBulkReply()
+	}
+	db.addAof(utils.ToCmdLine3("lmove", args...))
+	return reply.MakeBulkReply(val)
+}
+
+// RPOPLPUSH source destination
+func execRPopLPush(db *DB, args [][]byte) redis.Reply {
+	val, errReply := lmove(db, string(args[0]), string(args[1]), false, true)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return reply.MakeNullBulkReply()
+	}
+	db.addAof(utils.ToCmdLine3("rpoplpush", args...))
+	return reply.MakeBulkReply(val)
+}
+
+func init() {
+	RegisterCommand("LPush", execLPush, writeFirstKey, undoLPush, -3, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatList|acl.CatFast)
+	RegisterCommand("LPushX", execLPushX, writeFirstKey, undoLPush, -3, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatList|acl.CatFast)
+	RegisterCommand("RPush", execRPush, writeFirstKey, undoRPush, -3, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatList|acl.CatFast)
+	RegisterCommand("RPushX", execRPushX, writeFirstKey, undoRPush, -3, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatList|acl.CatFast)
+	RegisterCommand("LPop", execLPop, writeFirstKey, undoLPop, -2, flagWrite|flagFast, 1, 1, 1, acl.CatWrite|acl.CatList|acl.CatFast)
+	RegisterCommand("RPop", execRPop, writeFirstKey, undoRPop, -2, flagWrite|flagFast, 1, 1, 1, acl.CatWrite|acl.CatList|acl.CatFast)
+	RegisterCommand("LRange", execLRange, readFirstKey, nil, 4, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatList|acl.CatSlow)
+	RegisterCommand("LLen", execLLen, readFirstKey, nil, 2, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatList|acl.CatFast)
+	RegisterCommand("LIndex", execLIndex, readFirstKey, nil, 3, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatList|acl.CatSlow)
+	RegisterCommand("LSet", execLSet, writeFirstKey, undoLSet, 4, flagWrite|flagDenyOOM, 1, 1, 1, acl.CatWrite|acl.CatList|acl.CatSlow)
+	RegisterCommand("LRem", execLRem, writeFirstKey, rollbackFirstKey, 4, flagWrite, 1, 1, 1, acl.CatWrite|acl.CatList|acl.CatSlow)
+	RegisterCommand("LInsert", execLInsert, writeFirstKey, rollbackFirstKey, 5, flagWrite|flagDenyOOM, 1, 1, 1, acl.CatWrite|acl.CatList|acl.CatSlow)
+	RegisterCommand("LTrim", execLTrim, writeFirstKey, rollbackFirstKey, 4, flagWrite, 1, 1, 1, acl.CatWrite|acl.CatList|acl.CatSlow)
+	RegisterCommand("LPos", execLPos, readFirstKey, nil, -3, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatList|acl.CatSlow)
+	RegisterCommand("LMove", execLMove, prepareLMove, undoLMove, 5, flagWrite|flagDenyOOM, 1, 2, 1, acl.CatWrite|acl.CatList|acl.CatSlow)
+	RegisterCommand("RPopLPush", execRPopLPush, prepareLMove, undoLMove, 3, flagWrite|flagDenyOOM, 1, 2, 1, acl.CatWrite|acl.CatList|acl.CatSlow)
+}
@@ -0,0 +1,96 @@
+// 测试列表指令
+
+package database
+
+import (
+	"testing"
+
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+func assertMultiBulk(t *testing.T, actual redis.Reply, expected ...string) {
+	t.Helper()
+	args := make([][]byte, len(expected))
+	for i, v := range expected {
+		args[i] = []byte(v)
+	}
+	assertReply(t, actual, reply.MakeMultiBulkReply(args))
+}
+
+func TestPushPop(t *testing.T) {
+	db := MakeDB()
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("rpush", "l", "a", "b", "c")), 3)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("lpush", "l", "x", "y")), 5)
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("lrange", "l", "0", "-1")), "y", "x", "a", "b", "c")
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("lpop", "l")), "y")
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("rpop", "l", "2")), "c", "b")
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("llen", "l")), 2)
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("lpop", "l", "10")), "x", "a")
+	if _, ok := db.GetEntity("l"); ok {
+		t.Error("empty list should be removed")
+	}
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("lpop", "l", "1")), reply.MakeNullMultiBulkReply())
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("lpushx", "l", "a")), 0)
+
+	db.Exec(nil, utils.ToCmdLine("set", "s", "1"))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("lpush", "s", "1")))
+}
+
+func TestListModify(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("rpush", "l", "a", "b", "a", "c", "a"))
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("lindex", "l", "-2")), "c")
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("lrem", "l", "-2", "a")), 2)
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("lrange", "l", "0", "-1")), "a", "b", "c")
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("linsert", "l", "BEFORE", "b", "x")), 4)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("linsert", "l", "AFTER", "none", "x")), -1)
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("lset", "l", "0", "z")), reply.MakeOkReply())
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("lset", "l", "10", "z")))
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("ltrim", "l", "1", "-2")), reply.MakeOkReply())
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("lrange", "l", "0", "-1")), "x", "b")
+}
+
+func TestLPos(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("rpush", "l", "a", "b", "c", "1", "2", "3", "c", "c"))
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("lpos", "l", "c")), 2)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("lpos", "l", "c", "RANK", "2")), 6)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("lpos", "l", "c", "RANK", "-1")), 7)
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("lpos", "l", "c", "COUNT", "0")), reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeIntReply(2), reply.MakeIntReply(6), reply.MakeIntReply(7),
+	}))
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("lpos", "l", "c", "MAXLEN", "2")), reply.MakeNullBulkReply())
+}
+
+func TestLMove(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("rpush", "src", "a", "b"))
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("lmove", "src", "dst", "LEFT", "RIGHT")), "a")
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("rpoplpush", "src", "dst")), "b")
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("lrange", "dst", "0", "-1")), "b", "a")
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("rpoplpush", "src", "dst")), reply.MakeNullBulkReply())
+	// 同一个列表旋转
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("lmove", "dst", "dst", "LEFT", "RIGHT")), "b")
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("lrange", "dst", "0", "-1")), "a", "b")
+}
+
+func TestListUndo(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("rpush", "l", "a", "b", "c"))
+	for _, cmdLine := range []CmdLine{
+		utils.ToCmdLine("lpush", "l", "x", "y"),
+		utils.ToCmdLine("rpop", "l"),
+		utils.ToCmdLine("lpop", "l", "2"),
+		utils.ToCmdLine("lrem", "l", "0", "b"),
+		utils.ToCmdLine("lset", "l", "1", "z"),
+	} {
+		undo := db.GetUndoLogs(cmdLine)
+		db.Exec(nil, cmdLine)
+		for _, undoCmdLine := range undo {
+			db.execWithLock(undoCmdLine)
+		}
+		assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("lrange", "l", "0", "-1")), "a", "b", "c")
+	}
+}
@@ -0,0 +1,89 @@
+// 数据实例序列化为指令
+
+package database
+
+import (
+	"strconv"
+	"time"
+
+	Hash "ljr-redis/datastruct/hash"
+	List "ljr-redis/datastruct/list"
+	HashSet "ljr-redis/datastruct/set"
+	SortedSet "ljr-redis/datastruct/sortedset"
+	"ljr-redis/interface/database"
+	"ljr-redis/lib/utils"
+)
+
+// 将数据实例转换为能够重建它的指令
+func entityToCmd(key string, entity *database.DataEntity) CmdLine {
+	if entity == nil {
+		return nil
+	}
+	switch val := entity.Data.(type) {
+	case []byte:
+		return utils.ToCmdLine3("SET", []byte(key), val)
+	case List.List:
+		return listToCmd(key, val)
+	case *Hash.Hash:
+		return hashToCmd(key, val)
+	case *HashSet.Set:
+		return setToCmd(key, val)
+	case *SortedSet.SortedSet:
+		return zSetToCmd(key, val)
+	}
+	return nil
+}
+
+// 生成设置过期时间的指令
+func makeExpireCmd(key string, expireAt time.Time) CmdLine {
+	return utils.ToCmdLine("PEXPIREAT", key, strconv.FormatInt(expireAt.UnixMilli(), 10))
+}
+
+// 生成恢复 key 过期时间的指令，没有过期时间时返回 nil
+func toTTLCmd(db *DB, key string) CmdLine {
+	raw, exists := db.ttlMap.Get(key)
+	if !exists {
+		return nil
+	}
+	return makeExpireCmd(key, raw.(time.Time))
+}
+
+func listToCmd(key string, list List.List) CmdLine {
+	args := make([][]byte, 1, 1+list.Len())
+	args[0] = []byte(key)
+	list.ForEach(func(i int, val interface{}) bool {
+		args = append(args, val.([]byte))
+		return true
+	})
+	return utils.ToCmdLine3("RPUSH", args...)
+}
+
+func hashToCmd(key string, hash *Hash.Hash) CmdLine {
+	args := make([][]byte, 1, 1+hash.Len()*2)
+	args[0] = []byte(key)
+	hash.ForEach(func(field string, value []byte) bool {
+		args = append(args, []byte(field), value)
+		return true
+	})
+	return utils.ToCmdLine3("HSET", args...)
+}
+
+func setToCmd(key string, set *HashSet.Set) CmdLine {
+	args := make([][]byte, 1, 1+set.Len())
+	args[0] = []byte(key)
+	set.ForEach(func(member string) bool {
+		args = append(args, []byte(member))
+		return true
+	})
+	return utils.ToCmdLine3("SADD", args...)
+}
+
+func zSetToCmd(key string, sortedSet *SortedSet.SortedSet) CmdLine {
+	args := make([][]byte, 1, 1+sortedSet.Len()*2)
+	args[0] = []byte(key)
+	sortedSet.ForEachByRank(0, sortedSet.Len(), false, func(element *SortedSet.Element) bool {
+		args = append(args, []byte(formatScore(element.Score)), []byte(element.Member))
+		return true
+	})
+	return utils.ToCmdLine3("ZADD", args...)
+}
@@ -0,0 +1,83 @@
+// 键空间通知
+// notify-keyspace-events 中的每个字母对应一类事件，K E 决定发送到哪种 channel
+
+package database
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"ljr-redis/lib/utils"
+	"ljr-redis/pubsub"
+)
+
+const (
+	notifyKeyspace = 1 << iota // K __keyspace@<db>__:<key> 消息内容为事件名
+	notifyKeyevent             // E __keyevent@<db>__:<event> 消息内容为 key
+	notifyGeneric              // g DEL EXPIRE RENAME 等与类型无关的指令
+	notifyString               // $ 字符串指令
+	notifyList                 // l 列表指令
+	notifySet                  // s 集合指令
+	notifyHash                 // h 哈希表指令
+	notifyZSet                 // z 有序集合指令
+	notifyExpired              // x 过期事件
+	notifyEvicted              // e 淘汰事件，目前没有内存淘汰
+	notifyStream               // t 流指令，目前没有流类型
+	notifyKeyMiss              // m 访问不存在的 key，目前不产生该事件
+
+	// A g$lshzxet 的别名，不包括 m
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash |
+		notifyZSet | notifyExpired | notifyEvicted | notifyStream
+)
+
+var notifyFlagTable = map[rune]int{
+	'K': notifyKeyspace,
+	'E': notifyKeyevent,
+	'g': notifyGeneric,
+	'$': notifyString,
+	'l': notifyList,
+	's': notifySet,
+	'h': notifyHash,
+	'z': notifyZSet,
+	'x': notifyExpired,
+	'e': notifyEvicted,
+	't': notifyStream,
+	'm': notifyKeyMiss,
+	'A': notifyAll,
+}
+
+// 解析 notify-keyspace-events 配置，空字符串表示关闭通知
+func parseNotifyFlags(raw string) (int, error) {
+	flags := 0
+	for _, ch := range strings.Trim(raw, `"`) {
+		flag, ok := notifyFlagTable[ch]
+		if !ok {
+			return 0, errors.New("invalid notify-keyspace-events config: " + raw)
+		}
+		flags |= flag
+	}
+	return flags, nil
+}
+
+// 为每个数据库绑定通知函数，没有开启 K 或 E 时保持默认的空函数
+func (mdb *MultiDB) bindNotify(flags int) {
+	if flags&(notifyKeyspace|notifyKeyevent) == 0 {
+		return
+	}
+	for _, db := range mdb.dbSet {
+		singleDB := db
+		prefix := strconv.Itoa(singleDB.index) + "__:"
+		singleDB.notify = func(class int, event string, key string) {
+			if flags&class == 0 {
+				return
+			}
+			if flags&notifyKeyspace != 0 {
+				pubsub.Publish(mdb.hub, utils.ToCmdLine("__keyspace@"+prefix+key, event))
+			}
+			if flags&notifyKeyevent != 0 {
+				pubsub.Publish(mdb.hub, utils.ToCmdLine("__keyevent@"+prefix+event, key))
+			}
+		}
+	}
+}
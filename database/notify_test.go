@@ -0,0 +1,104 @@
+// 测试键空间通知
+
+package database
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/connection"
+	"ljr-redis/redis/reply"
+)
+
+// 记录收到的消息
+type notifyConn struct {
+	connection.Connection
+	mu       sync.Mutex
+	received []string
+}
+
+func (c *notifyConn) Write(b []byte) error {
+	c.mu.Lock()
+	c.received = append(c.received, string(b))
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *notifyConn) take() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	received := c.received
+	c.received = nil
+	return received
+}
+
+func notifyMsg(channel string, payload string) string {
+	return string(reply.MakeMultiBulkReply(utils.ToCmdLine("message", channel, payload)).ToBytes())
+}
+
+func TestParseNotifyFlags(t *testing.T) {
+	flags, err := parseNotifyFlags("KEA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags&notifyKeyMiss != 0 || flags&notifyExpired == 0 || flags&notifyKeyspace == 0 {
+		t.Errorf("unexpected flags %b", flags)
+	}
+	if flags, err = parseNotifyFlags(`""`); err != nil || flags != 0 {
+		t.Errorf("expected empty flags, actually %b", flags)
+	}
+	if _, err = parseNotifyFlags("Kq"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestKeyspaceNotify(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	flags, _ := parseNotifyFlags("KE$gx")
+	mdb.bindNotify(flags)
+	sub := &notifyConn{}
+	conn := connection.NewFakeConn()
+
+	mdb.Exec(sub, utils.ToCmdLine("subscribe", "__keyspace@0__:a", "__keyevent@0__:del", "__keyevent@0__:expired"))
+	sub.take()
+
+	mdb.Exec(conn, utils.ToCmdLine("set", "a", "1"))
+	mdb.Exec(conn, utils.ToCmdLine("incr", "a"))
+	mdb.Exec(conn, utils.ToCmdLine("del", "a", "none"))
+	expected := []string{
+		notifyMsg("__keyspace@0__:a", "set"),
+		notifyMsg("__keyspace@0__:a", "incrby"),
+		notifyMsg("__keyspace@0__:a", "del"),
+		notifyMsg("__keyevent@0__:del", "a"),
+	}
+	if got := sub.take(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, actually %q", expected, got)
+	}
+
+	// 没有开启 l 时列表指令不产生通知
+	mdb.Exec(conn, utils.ToCmdLine("rpush", "a", "1"))
+	mdb.Exec(conn, utils.ToCmdLine("lpop", "a"))
+	expected = []string{notifyMsg("__keyspace@0__:a", "del"), notifyMsg("__keyevent@0__:del", "a")}
+	if got := sub.take(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, actually %q", expected, got)
+	}
+
+	// 其它数据库的事件发送到对应的 channel
+	mdb.Exec(conn, utils.ToCmdLine("select", "1"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "a", "1"))
+	if got := sub.take(); len(got) != 0 {
+		t.Errorf("unexpected messages %q", got)
+	}
+
+	// 访问时发现过期
+	mdb.Exec(conn, utils.ToCmdLine("select", "0"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "b", "1", "px", "1"))
+	time.Sleep(5 * time.Millisecond)
+	mdb.Exec(conn, utils.ToCmdLine("get", "b"))
+	if got := sub.take(); !reflect.DeepEqual(got, []string{notifyMsg("__keyevent@0__:expired", "b")}) {
+		t.Errorf("unexpected messages %q", got)
+	}
+}
@@ -0,0 +1,48 @@
+// 测试订阅状态下的指令限制
+
+package database
+
+import (
+	"testing"
+
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/connection"
+	"ljr-redis/redis/reply"
+)
+
+func TestSubscribedMode(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	conn := connection.NewFakeConn()
+	publisher := connection.NewFakeConn()
+
+	mdb.Exec(conn, utils.ToCmdLine("subscribe", "ch"))
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")))
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("publish", "ch", "msg")))
+	assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("ping")), "pong", "")
+	assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("ping", "hi")), "pong", "hi")
+	assertInt(t, mdb.Exec(publisher, utils.ToCmdLine("publish", "ch", "msg")), 1)
+	assertMultiBulk(t, mdb.Exec(publisher, utils.ToCmdLine("pubsub", "channels")), "ch")
+
+	// 取消所有订阅后恢复正常
+	mdb.Exec(conn, utils.ToCmdLine("unsubscribe"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), reply.MakeNullBulkReply())
+
+	// 只有模式订阅时同样处于订阅状态
+	mdb.Exec(conn, utils.ToCmdLine("psubscribe", "c*"))
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")))
+	assertInt(t, mdb.Exec(publisher, utils.ToCmdLine("pubsub", "numpat")), 1)
+
+	// 只有分片订阅时同样处于订阅状态
+	mdb.Exec(conn, utils.ToCmdLine("punsubscribe"))
+	mdb.Exec(conn, utils.ToCmdLine("ssubscribe", "sch"))
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")))
+	assertInt(t, mdb.Exec(publisher, utils.ToCmdLine("spublish", "sch", "msg")), 1)
+	mdb.Exec(conn, utils.ToCmdLine("sunsubscribe"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), reply.MakeNullBulkReply())
+
+	// 断开连接时取消订阅
+	mdb.Exec(conn, utils.ToCmdLine("subscribe", "ch"))
+	mdb.AfterClientClose(conn)
+	assertInt(t, mdb.Exec(publisher, utils.ToCmdLine("publish", "ch", "msg")), 0)
+	assertInt(t, mdb.Exec(publisher, utils.ToCmdLine("pubsub", "numpat")), 0)
+}
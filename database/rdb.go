@@ -0,0 +1,378 @@
+// RDB 持久化
+// SAVE BGSAVE LASTSAVE 指令，save 规则自动保存和启动时加载
+
+package database
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ljr-redis/acl"
+	"ljr-redis/config"
+	Hash "ljr-redis/datastruct/hash"
+	List "ljr-redis/datastruct/list"
+	HashSet "ljr-redis/datastruct/set"
+	SortedSet "ljr-redis/datastruct/sortedset"
+	"ljr-redis/interface/database"
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/logger"
+	"ljr-redis/rdb"
+	"ljr-redis/redis/reply"
+)
+
+const (
+	defaultDbFilename = "dump.rdb"
+	// 检查 save 规则的间隔
+	saveCronInterval = time.Second
+)
+
+var errSaveInProgress = errors.New("ERR Background save already in progress")
+
+// save <seconds> <changes> 规则，距离上次保存超过 seconds 秒且至少有 changes 次修改时自动保存
+type saveRule struct {
+	seconds int64
+	changes int64
+}
+
+// 解析 save 配置，格式为 "900 1 300 10"，空字符串表示不自动保存
+func parseSaveRules(raw string) ([]saveRule, error) {
+	fields := strings.Fields(raw)
+	if len(fields)%2 != 0 {
+		return nil, errors.New("invalid save config: " + raw)
+	}
+	rules := make([]saveRule, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err1 := strconv.ParseInt(fields[i], 10, 64)
+		changes, err2 := strconv.ParseInt(fields[i+1], 10, 64)
+		if err1 != nil || err2 != nil || seconds <= 0 || changes <= 0 {
+			return nil, errors.New("invalid save config: " + raw)
+		}
+		rules = append(rules, saveRule{seconds: seconds, changes: changes})
+	}
+	return rules, nil
+}
+
+// RDB 文件路径
+func rdbFilename() string {
+	filename := config.Properties.DbFilename
+	if filename == "" {
+		filename = defaultDbFilename
+	}
+	return filepath.Join(config.Properties.Dir, filename)
+}
+
+/* ---------- 数据实例与 RDB 对象的转换 ---------- */
+
+// 将数据实例转换为 RDB 对象
+func entityToObject(key string, entity *database.DataEntity) *rdb.Object {
+	obj := &rdb.Object{Key: key}
+	switch val := entity.Data.(type) {
+	case []byte:
+		obj.Type = rdb.StringType
+		obj.String = val
+	case List.List:
+		obj.Type = rdb.ListType
+		obj.List = make([][]byte, 0, val.Len())
+		val.ForEach(func(i int, v interface{}) bool {
+			obj.List = append(obj.List, v.([]byte))
+			return true
+		})
+	case *Hash.Hash:
+		obj.Type = rdb.HashType
+		obj.Hash = make([]rdb.HashField, 0, val.Len())
+		val.ForEach(func(field string, value []byte) bool {
+			obj.Hash = append(obj.Hash, rdb.HashField{Field: field, Value: value})
+			return true
+		})
+	case *HashSet.Set:
+		obj.Type = rdb.SetType
+		obj.Set = make([][]byte, 0, val.Len())
+		val.ForEach(func(member string) bool {
+			obj.Set = append(obj.Set, []byte(member))
+			return true
+		})
+	case *SortedSet.SortedSet:
+		obj.Type = rdb.ZSetType
+		obj.ZSet = make([]rdb.ZSetMember, 0, val.Len())
+		val.ForEachByRank(0, val.Len(), false, func(element *SortedSet.Element) bool {
+			obj.ZSet = append(obj.ZSet, rdb.ZSetMember{Member: element.Member, Score: element.Score})
+			return true
+		})
+	default:
+		return nil
+	}
+	return obj
+}
+
+// 将 RDB 对象转换为数据实例
+func objectToEntity(obj *rdb.Object) *database.DataEntity {
+	var data interface{}
+	switch obj.Type {
+	case rdb.StringType:
+		data = obj.String
+	case rdb.ListType:
+		list := List.NewQuickList()
+		for _, val := range obj.List {
+			list.Add(val)
+		}
+		data = list
+	case rdb.HashType:
+		hash := Hash.Make()
+		for _, field := range obj.Hash {
+			hash.Set(field.Field, field.Value)
+		}
+		data = hash
+	case rdb.SetType:
+		set := HashSet.Make()
+		for _, member := range obj.Set {
+			set.Add(string(member))
+		}
+		data = set
+	case rdb.ZSetType:
+		sortedSet := SortedSet.Make()
+		for _, member := range obj.ZSet {
+			if math.IsNaN(member.Score) {
+				continue
+			}
+			sortedSet.Add(member.Member, member.Score)
+		}
+		data = sortedSet
+	default:
+		return nil
+	}
+	return &database.DataEntity{Data: data}
+}
+
+/* ---------- 保存 ---------- */
+
+// 冻结所有数据库，将数据转换为 RDB 对象
+// 按数据库编号顺序对所有 key 上读锁，与跨数据库指令的上锁顺序一致
+// 修改数据时总是复制 []byte，对象在解锁后仍然是上锁时的快照
+func (mdb *MultiDB) snapshot() [][]*rdb.Object {
+	for _, db := range mdb.dbSet {
+		db.RLockAll()
+	}
+	defer func() {
+		for i := len(mdb.dbSet) - 1; i >= 0; i-- {
+			mdb.dbSet[i].RUnLockAll()
+		}
+	}()
+
+	result := make([][]*rdb.Object, len(mdb.dbSet))
+	for i, db := range mdb.dbSet {
+		objs := make([]*rdb.Object, 0, db.data.Len())
+		db.ForEach(func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+			if obj := entityToObject(key, entity); obj != nil {
+				obj.Expiration = expiration
+				objs = append(objs, obj)
+			}
+			return true
+		})
+		result[i] = objs
+	}
+	return result
+}
+
+// 将所有数据库的数据以 RDB 格式写入 writer，aofPreamble 表示作为 AOF 的前导部分
+// 只在复制数据时冻结数据库，编码和写入不持有锁
+func (mdb *MultiDB) dumpRDB(writer io.Writer, aofPreamble bool) error {
+	snapshot := mdb.snapshot()
+
+	enc := rdb.NewEncoder(writer)
+	if err := enc.WriteHeader(); err != nil {
+		return err
+	}
+	if aofPreamble {
+		if err := enc.WriteAux("aof-preamble", "1"); err != nil {
+			return err
+		}
+	}
+	for i, objs := range snapshot {
+		if len(objs) == 0 {
+			continue
+		}
+		expires := 0
+		for _, obj := range objs {
+			if obj.Expiration != nil {
+				expires++
+			}
+		}
+		if err := enc.WriteDBHeader(i, len(objs), expires); err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			if err := enc.WriteObject(obj); err != nil {
+				return err
+			}
+		}
+	}
+	return enc.WriteEnd()
+}
+
+// 写入临时文件后替换 RDB 文件，调用者需要保证同一时间只有一个保存在进行
+func (mdb *MultiDB) saveRDB() error {
+	filename := rdbFilename()
+	dirty := atomic.LoadInt64(&mdb.dirty)
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), "temp-*.rdb")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// 替换成功后临时文件已经不存在
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+	}()
+
+	writer := bufio.NewWriter(tmpFile)
+	if err := mdb.dumpRDB(writer, false); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile.Name(), filename); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&mdb.dirty, -dirty)
+	atomic.StoreInt64(&mdb.lastSave, time.Now().Unix())
+	return nil
+}
+
+// 同步保存
+func (mdb *MultiDB) save() error {
+	if !atomic.CompareAndSwapInt32(&mdb.saving, 0, 1) {
+		return errSaveInProgress
+	}
+	defer atomic.StoreInt32(&mdb.saving, 0)
+	return mdb.saveRDB()
+}
+
+// 在后台保存
+func (mdb *MultiDB) bgSave() error {
+	if !atomic.CompareAndSwapInt32(&mdb.saving, 0, 1) {
+		return errSaveInProgress
+	}
+	mdb.saveWg.Add(1)
+	go func() {
+		defer mdb.saveWg.Done()
+		defer atomic.StoreInt32(&mdb.saving, 0)
+		if err := mdb.saveRDB(); err != nil {
+			logger.Error("background saving failed: " + err.Error())
+			return
+		}
+		logger.Info("background saving terminated with success")
+	}()
+	return nil
+}
+
+// 定时检查 save 规则
+func (mdb *MultiDB) saveCron() {
+	defer mdb.saveWg.Done()
+	ticker := time.NewTicker(saveCronInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			dirty := atomic.LoadInt64(&mdb.dirty)
+			elapsed := time.Now().Unix() - atomic.LoadInt64(&mdb.lastSave)
+			for _, rule := range mdb.saveRules {
+				if dirty >= rule.changes && elapsed >= rule.seconds {
+					logger.Info(strconv.FormatInt(rule.changes, 10) + " changes in " +
+						strconv.FormatInt(rule.seconds, 10) + " seconds. Saving...")
+					_ = mdb.bgSave()
+					break
+				}
+			}
+		case <-mdb.closed:
+			return
+		}
+	}
+}
+
+/* ---------- 加载 ---------- */
+
+// 启动时加载 RDB 文件，文件不存在时不做任何事
+func (mdb *MultiDB) loadRDB() error {
+	file, err := os.Open(rdbFilename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	return mdb.loadRDBFrom(bufio.NewReader(file))
+}
+
+// 从 reader 中读取 RDB 数据，跳过已经过期的 key
+func (mdb *MultiDB) loadRDBFrom(reader io.Reader) error {
+	now := time.Now()
+	dec := rdb.NewDecoder(reader)
+	return dec.Parse(func(dbIndex int, obj *rdb.Object) bool {
+		if dbIndex >= len(mdb.dbSet) {
+			logger.Warn("rdb db index out of range: " + strconv.Itoa(dbIndex))
+			return true
+		}
+		if obj.Expiration != nil && obj.Expiration.Before(now) {
+			return true
+		}
+		entity := objectToEntity(obj)
+		if entity == nil {
+			return true
+		}
+		db := mdb.dbSet[dbIndex]
+		db.PutEntity(obj.Key, entity)
+		if obj.Expiration != nil {
+			db.Expire(obj.Key, *obj.Expiration)
+		}
+		return true
+	})
+}
+
+/* ---------- 指令 ---------- */
+
+// 同步保存 RDB
+func Save(mdb *MultiDB, args [][]byte) redis.Reply {
+	if err := mdb.save(); err != nil {
+		if err == errSaveInProgress {
+			return reply.MakeErrReply(err.Error())
+		}
+		return reply.MakeErrReply("ERR " + err.Error())
+	}
+	return reply.MakeOkReply()
+}
+
+// 后台保存 RDB
+func BGSave(mdb *MultiDB, args [][]byte) redis.Reply {
+	if err := mdb.bgSave(); err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+	return reply.MakeStatusReply("Background saving started")
+}
+
+// 上次成功保存的时间
+func LastSave(mdb *MultiDB, args [][]byte) redis.Reply {
+	return reply.MakeIntReply(atomic.LoadInt64(&mdb.lastSave))
+}
+
+func init() {
+	registerSpecialCommand("save", 1, flagAdmin|flagNoScript, 0, 0, 0, acl.CatAdmin|acl.CatSlow|acl.CatDangerous)
+	registerSpecialCommand("bgsave", 1, flagAdmin|flagNoScript, 0, 0, 0, acl.CatAdmin|acl.CatSlow|acl.CatDangerous)
+	registerSpecialCommand("lastsave", 1, flagLoading|flagStale|flagFast, 0, 0, 0, acl.CatAdmin|acl.CatFast|acl.CatDangerous)
+}
@@ -0,0 +1,182 @@
+// 测试 RDB 持久化
+
+package database
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ljr-redis/config"
+	"ljr-redis/lib/utils"
+	"ljr-redis/rdb"
+	"ljr-redis/redis/connection"
+	"ljr-redis/redis/reply"
+)
+
+// 设置 RDB 文件所在目录和 save 规则，返回 RDB 文件路径
+func setupRDBConfig(t *testing.T, save string) string {
+	old := config.Properties
+	config.Properties = &config.ServerProperties{
+		Dir:        t.TempDir(),
+		DbFilename: "dump.rdb",
+		Save:       save,
+	}
+	t.Cleanup(func() {
+		config.Properties = old
+	})
+	return filepath.Join(config.Properties.Dir, config.Properties.DbFilename)
+}
+
+func TestParseSaveRules(t *testing.T) {
+	rules, err := parseSaveRules("900 1  300 10")
+	if err != nil || len(rules) != 2 || rules[1].seconds != 300 || rules[1].changes != 10 {
+		t.Errorf("unexpected rules %v, err %v", rules, err)
+	}
+	if rules, err := parseSaveRules(""); err != nil || len(rules) != 0 {
+		t.Errorf("expected no rules, actually %v", rules)
+	}
+	for _, raw := range []string{"900", "900 a", "0 1"} {
+		if _, err := parseSaveRules(raw); err == nil {
+			t.Errorf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestRDBSaveAndLoad(t *testing.T) {
+	filename := setupRDBConfig(t, "")
+
+	mdb := NewStandaloneServer()
+	conn := connection.NewFakeConn()
+	mdb.Exec(conn, utils.ToCmdLine("set", "str", "v"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "ttl", "v", "EX", "1000"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "expired", "v", "PX", "10"))
+	mdb.Exec(conn, utils.ToCmdLine("rpush", "list", "a", "b", "c"))
+	mdb.Exec(conn, utils.ToCmdLine("hset", "hash", "f1", "v1", "f2", "v2"))
+	mdb.Exec(conn, utils.ToCmdLine("sadd", "set", "a", "b"))
+	mdb.Exec(conn, utils.ToCmdLine("select", "3"))
+	mdb.Exec(conn, utils.ToCmdLine("zadd", "zset", "1.5", "a", "-inf", "b"))
+	time.Sleep(20 * time.Millisecond)
+
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("save")), reply.MakeOkReply())
+	if r, ok := mdb.Exec(conn, utils.ToCmdLine("lastsave")).(*reply.IntReply); !ok || r.Code < time.Now().Unix()-1 {
+		t.Error("expected lastsave to be updated")
+	}
+	if _, err := os.Stat(filename); err != nil {
+		t.Fatal(err)
+	}
+	mdb.Close()
+
+	mdb = NewStandaloneServer()
+	conn = connection.NewFakeConn()
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "str")), "v")
+	if r, ok := mdb.Exec(conn, utils.ToCmdLine("ttl", "ttl")).(*reply.IntReply); !ok || r.Code <= 0 {
+		t.Error("expected ttl to be kept")
+	}
+	assertInt(t, mdb.Exec(conn, utils.ToCmdLine("exists", "expired", "zset")), 0)
+	assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("lrange", "list", "0", "-1")), "a", "b", "c")
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("hget", "hash", "f2")), "v2")
+	assertMembers(t, mdb.Exec(conn, utils.ToCmdLine("smembers", "set")), "a", "b")
+	mdb.Exec(conn, utils.ToCmdLine("select", "3"))
+	assertMultiBulk(t, mdb.Exec(conn, utils.ToCmdLine("zrange", "zset", "0", "-1", "WITHSCORES")), "b", "-inf", "a", "1.5")
+	mdb.Close()
+}
+
+func TestBGSave(t *testing.T) {
+	filename := setupRDBConfig(t, "")
+
+	mdb := NewStandaloneServer()
+	conn := connection.NewFakeConn()
+	mdb.Exec(conn, utils.ToCmdLine("set", "a", "1"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("bgsave")), reply.MakeStatusReply("Background saving started"))
+	mdb.saveWg.Wait()
+	if atomic.LoadInt64(&mdb.dirty) != 0 {
+		t.Error("expected dirty to be reset after saving")
+	}
+	if _, err := os.Stat(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	// 保存进行中时拒绝新的保存
+	atomic.StoreInt32(&mdb.saving, 1)
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("bgsave")))
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("save")))
+	atomic.StoreInt32(&mdb.saving, 0)
+	mdb.Close()
+}
+
+func TestAutoSave(t *testing.T) {
+	filename := setupRDBConfig(t, "1 1")
+
+	mdb := NewStandaloneServer()
+	conn := connection.NewFakeConn()
+	mdb.Exec(conn, utils.ToCmdLine("set", "a", "1"))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(filename); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected rdb to be saved automatically")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	mdb.Exec(conn, utils.ToCmdLine("set", "b", "1"))
+	// 配置了 save 规则时关闭前保存一次
+	mdb.Close()
+
+	mdb = NewStandaloneServer()
+	conn = connection.NewFakeConn()
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "b")), "1")
+	mdb.Close()
+}
+
+func TestDumpRDBSnapshot(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	conn0 := connection.NewFakeConn()
+	conn1 := connection.NewFakeConn()
+	conn1.SelectDB(1)
+	mdb.Exec(conn0, utils.ToCmdLine("set", "a", "v"))
+
+	// 不断在两个数据库之间移动 key，快照中 key 只能出现一次
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			mdb.Exec(conn0, utils.ToCmdLine("move", "a", "1"))
+			mdb.Exec(conn1, utils.ToCmdLine("move", "a", "0"))
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	// 每次快照都要遍历全部数据库的 shard，耗时较长，移动 key 的协程在一次快照期间会执行很多次
+	for i := 0; i < 5; i++ {
+		buf := &bytes.Buffer{}
+		if err := mdb.dumpRDB(buf, false); err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		err := rdb.NewDecoder(buf).Parse(func(dbIndex int, obj *rdb.Object) bool {
+			count++
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Fatalf("expected 1 key in snapshot, actually %d", count)
+		}
+	}
+}
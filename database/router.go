@@ -3,30 +3,123 @@
 
 package database
 
-import "strings"
+import (
+	"strings"
+
+	"ljr-redis/acl"
+)
 
 // 指令列表
 var cmdTable = make(map[string]*command)
 
+// 指令标志，与 redis COMMAND 返回的 flags 一致
+const (
+	flagWrite = 1 << iota
+	flagReadOnly
+	flagDenyOOM
+	flagAdmin
+	flagPubSub
+	flagNoScript
+	flagLoading
+	flagStale
+	flagFast
+	flagBlocking
+	// 不能在事务中执行
+	flagNoMulti
+	// key 的位置由参数决定，例如 numkeys，需要调用 prepare 获取 key
+	flagMovableKeys
+)
+
+var flagNames = []struct {
+	flag int
+	name string
+}{
+	{flagWrite, "write"},
+	{flagReadOnly, "readonly"},
+	{flagDenyOOM, "denyoom"},
+	{flagAdmin, "admin"},
+	{flagPubSub, "pubsub"},
+	{flagNoScript, "noscript"},
+	{flagLoading, "loading"},
+	{flagStale, "stale"},
+	{flagFast, "fast"},
+	{flagBlocking, "blocking"},
+	{flagNoMulti, "no_multi"},
+	{flagMovableKeys, "movablekeys"},
+}
+
 // 抽象指令
 type command struct {
+	name     string
 	executor ExecFunc
 	prepare  PreFunc
 	undo     UndoFunc
 	arity    int
-	// flags    int
+	flags    int
+
+	// key 的位置，从 1 开始，lastKey 为负数时从末尾计算，没有 key 时都为 0
+	firstKey int
+	lastKey  int
+	keyStep  int
+
+	// ACL 类别
+	categories acl.Category
 }
 
 // 注册指令
-func RegisterCommand(name string, executor ExecFunc, prepare PreFunc, rollback UndoFunc, arity int) {
+func RegisterCommand(name string, executor ExecFunc, prepare PreFunc, rollback UndoFunc, arity int, flags int,
+	firstKey int, lastKey int, keyStep int, categories acl.Category) {
 	// arity 代表参数个数
 	// arity < 0 表示 len(args) >= -arity
 	// 例如: get.arity=2  mget.arity=-2
 	name = strings.ToLower(name)
 	cmdTable[name] = &command{
-		executor: executor,
-		prepare:  prepare,
-		undo:     rollback,
-		arity:    arity,
+		name:       name,
+		executor:   executor,
+		prepare:    prepare,
+		undo:       rollback,
+		arity:      arity,
+		flags:      flags,
+		firstKey:   firstKey,
+		lastKey:    lastKey,
+		keyStep:    keyStep,
+		categories: categories,
+	}
+}
+
+// 注册由 MultiDB.Exec 或 DB.Exec 单独处理的指令，只记录元数据
+// 没有 executor 和 prepare，不能作为普通指令执行，除了 txSpecialCommands 中的指令都不能在事务中执行
+func registerSpecialCommand(name string, arity int, flags int, firstKey int, lastKey int, keyStep int, categories acl.Category) {
+	RegisterCommand(name, nil, nil, nil, arity, flags, firstKey, lastKey, keyStep, categories)
+}
+
+// 标志的名称列表
+func (cmd *command) flagNames() []string {
+	names := make([]string, 0)
+	for _, f := range flagNames {
+		if cmd.flags&f.flag != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// 根据 key 的位置从指令中取出 key，cmdLine 包含指令名
+func (cmd *command) getKeys(cmdLine [][]byte) []string {
+	if cmd.flags&flagMovableKeys != 0 {
+		write, read := cmd.prepare(cmdLine[1:])
+		return append(write, read...)
+	}
+	if cmd.firstKey <= 0 {
+		return nil
+	}
+	last := cmd.lastKey
+	if last < 0 {
+		last = len(cmdLine) + last
+	}
+	keys := make([]string, 0)
+	for i := cmd.firstKey; i <= last && i < len(cmdLine); i += cmd.keyStep {
+		keys = append(keys, string(cmdLine[i]))
 	}
+	return keys
 }
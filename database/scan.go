@@ -0,0 +1,80 @@
+// SCAN 系列指令的通用参数
+
+package database
+
+import (
+	"strconv"
+	"strings"
+
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/wildcard"
+	"ljr-redis/redis/reply"
+)
+
+// scan 参数
+type scanOptions struct {
+	pattern  *wildcard.Pattern // MATCH，为 nil 表示匹配全部
+	count    int               // COUNT
+	typeName string            // TYPE，只有 SCAN 支持，为空表示全部类型
+}
+
+// 解析游标
+func parseCursor(raw []byte) (int, redis.Reply) {
+	cursor, err := strconv.ParseUint(string(raw), 10, 63)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR invalid cursor")
+	}
+	return int(cursor), nil
+}
+
+// 解析 [MATCH pattern] [COUNT count] [TYPE type]，allowType 为 false 时不支持 TYPE
+func parseScanOptions(args [][]byte, allowType bool) (*scanOptions, redis.Reply) {
+	opts := &scanOptions{count: 10}
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			opts.pattern = compileMatchPattern(string(args[i+1]))
+		case "COUNT":
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.count = int(count)
+		case "TYPE":
+			if !allowType {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.typeName = strings.ToLower(string(args[i+1]))
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+// 编译匹配模式，* 匹配全部时返回 nil
+func compileMatchPattern(pattern string) *wildcard.Pattern {
+	if pattern == "*" {
+		return nil
+	}
+	return wildcard.CompilePattern(pattern)
+}
+
+// 是否匹配 MATCH 参数
+func (opts *scanOptions) match(str string) bool {
+	return opts.pattern == nil || opts.pattern.IsMatch(str)
+}
+
+// scan 的回复，第一个元素为下一次的游标
+func makeScanReply(cursor int, result [][]byte) redis.Reply {
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkReply([]byte(strconv.Itoa(cursor))),
+		reply.MakeMultiBulkReply(result),
+	})
+}
@@ -2,18 +2,46 @@ package database
 
 import (
 	"fmt"
+	"os"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"ljr-redis/acl"
+	"ljr-redis/aof"
+	"ljr-redis/config"
+	"ljr-redis/datastruct/dict"
+	"ljr-redis/interface/database"
 	"ljr-redis/interface/redis"
 	"ljr-redis/lib/logger"
+	"ljr-redis/lib/utils"
+	"ljr-redis/pubsub"
 	"ljr-redis/redis/reply"
 )
 
 // MultiDB is a set of multiple database set
 type MultiDB struct {
 	dbSet []*DB
+
+	// 发布订阅
+	hub *pubsub.Hub
+
+	// 用户和权限
+	acl *acl.Registry
+
+	// AOF 持久化，未开启时为 nil
+	aofHandler *aof.Handler
+
+	// RDB 持久化
+	saveRules []saveRule
+	dirty     int64          // 上次保存后的修改次数
+	lastSave  int64          // 上次成功保存的时间
+	saving    int32          // 是否正在保存
+	saveWg    sync.WaitGroup // 关闭时等待后台保存和定时检查结束
+	closed    chan struct{}  // 关闭时停止检查 save 规则
 }
 
 // NewStandaloneServer creates a standalone redis server, with multi database and all other funtions
@@ -28,19 +56,70 @@ func NewStandaloneServer() *MultiDB {
 		singleDB.index = i
 		mdb.dbSet[i] = singleDB
 	}
+	mdb.hub = pubsub.MakeHub()
+
+	mdb.acl = makeACLRegistry()
+	if config.Properties.AclFile != "" {
+		// aclfile 不存在时使用默认用户，ACL SAVE 时创建
+		if err := mdb.acl.Load(config.Properties.AclFile); err != nil && !os.IsNotExist(err) {
+			panic(err)
+		}
+	}
+
+	saveRules, err := parseSaveRules(config.Properties.Save)
+	if err != nil {
+		panic(err)
+	}
+	mdb.saveRules = saveRules
+
+	// 开启 AOF 时只从 AOF 恢复数据，否则加载 RDB
+	// 加载时数据库还没有绑定 addAof，加载的数据不会被重复写入或计入修改次数
+	if config.Properties.AppendOnly {
+		aofHandler, err := aof.NewAOFHandler(config.Properties.AppendFileName, config.Properties.AppendFsync, mdb.loadAof, rewriteAof)
+		if err != nil {
+			panic(err)
+		}
+		mdb.aofHandler = aofHandler
+	} else if err := mdb.loadRDB(); err != nil {
+		panic(err)
+	}
+	for _, db := range mdb.dbSet {
+		singleDB := db
+		singleDB.addAof = func(line CmdLine) {
+			atomic.AddInt64(&mdb.dirty, 1)
+			if mdb.aofHandler != nil {
+				mdb.aofHandler.AddAof(singleDB.index, line)
+			}
+		}
+	}
+	notifyFlags, err := parseNotifyFlags(config.Properties.NotifyKeyspaceEvents)
+	if err != nil {
+		panic(err)
+	}
+	mdb.bindNotify(notifyFlags)
 
+	mdb.lastSave = time.Now().Unix()
+	mdb.closed = make(chan struct{})
+	if len(mdb.saveRules) > 0 {
+		mdb.saveWg.Add(1)
+		go mdb.saveCron()
+	}
 	return mdb
 }
 
 // MakeBasicMultiDB create a MultiDB only with basic abilities for aof rewrite and other usages
-// func MakeBasicMultiDB() *MultiDB {
-// 	mdb := &MultiDB{}
-// 	mdb.dbSet = make([]*DB, 16)
-// 	for i := range mdb.dbSet {
-// 		mdb.dbSet[i] = makeBasicDB()
-// 	}
-// 	return mdb
-// }
+func MakeBasicMultiDB() *MultiDB {
+	mdb := &MultiDB{}
+	mdb.dbSet = make([]*DB, 16)
+	for i := range mdb.dbSet {
+		singleDB := makeBasicDB()
+		singleDB.index = i
+		mdb.dbSet[i] = singleDB
+	}
+	mdb.hub = pubsub.MakeHub()
+	mdb.acl = makeACLRegistry()
+	return mdb
+}
 
 // Exec executes command
 // parameter `cmdLine` contains command and its arguments, for example: "set key value"
@@ -54,47 +133,165 @@ func (mdb *MultiDB) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Rep
 
 	cmdName := strings.ToLower(string(cmdLine[0]))
 	// authenticate
-	// if cmdName == "auth" {
-	// 	return Auth(c, cmdLine[1:])
-	// }
-	// if !isAuthenticated(c) {
-	// 	return reply.MakeErrReply("NOAUTH Authentication required")
-	// }
+	if cmdName == "auth" {
+		return Auth(mdb, c, cmdLine[1:])
+	} else if cmdName == "hello" {
+		return Hello(mdb, c, cmdLine[1:])
+	} else if cmdName == "quit" {
+		// 由 handler 在发送响应后关闭连接
+		return reply.MakeOkReply()
+	}
+	if !isAuthenticated(mdb, c) {
+		return reply.MakeErrReply("NOAUTH Authentication required.")
+	}
+	if errReply := mdb.checkPermission(c, cmdName, cmdLine); errReply != nil {
+		if c.InMultiState() {
+			c.AddTxError(errReply)
+		}
+		return errReply
+	}
+	if c != nil && c.InMultiState() {
+		// 事务中的指令加入队列，EXEC 时执行
+		return mdb.execInMulti(c, cmdName, cmdLine)
+	}
+
+	// 订阅状态下只能执行订阅相关指令和 ping
+	if c != nil && (c.SubsCount() > 0 || c.ShardSubsCount() > 0) {
+		if cmdName == "ping" {
+			return execSubscribedPing(cmdLine[1:])
+		}
+		if !subscribedCommands[cmdName] {
+			return reply.MakeErrReply("ERR Can't execute '" + cmdName +
+				"': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING are allowed in this context")
+		}
+	}
 
 	// special commands
 	if cmdName == "subscribe" {
 		if len(cmdLine) < 2 {
 			return reply.MakeArgNumErrReply("subscribe")
 		}
-		// return pubsub.Subscribe(mdb.hub, c, cmdLine[1:])
+		return pubsub.Subscribe(mdb.hub, c, cmdLine[1:])
+
+	} else if cmdName == "psubscribe" {
+		if len(cmdLine) < 2 {
+			return reply.MakeArgNumErrReply("psubscribe")
+		}
+		return pubsub.PSubscribe(mdb.hub, c, cmdLine[1:])
+
+	} else if cmdName == "punsubscribe" {
+		return pubsub.PUnSubscribe(mdb.hub, c, cmdLine[1:])
+
+	} else if cmdName == "ssubscribe" {
+		if len(cmdLine) < 2 {
+			return reply.MakeArgNumErrReply("ssubscribe")
+		}
+		return pubsub.SSubscribe(mdb.hub, c, cmdLine[1:])
+
+	} else if cmdName == "sunsubscribe" {
+		return pubsub.SUnSubscribe(mdb.hub, c, cmdLine[1:])
+
+	} else if cmdName == "spublish" {
+		if len(cmdLine) != 3 {
+			return reply.MakeArgNumErrReply("spublish")
+		}
+		return pubsub.SPublish(mdb.hub, cmdLine[1:])
 
 	} else if cmdName == "publish" {
-		// return pubsub.Publish(mdb.hub, cmdLine[1:])
+		if len(cmdLine) != 3 {
+			return reply.MakeArgNumErrReply("publish")
+		}
+		return pubsub.Publish(mdb.hub, cmdLine[1:])
 
 	} else if cmdName == "unsubscribe" {
-		// return pubsub.UnSubscribe(mdb.hub, c, cmdLine[1:])
+		return pubsub.UnSubscribe(mdb.hub, c, cmdLine[1:])
+
+	} else if cmdName == "pubsub" {
+		if len(cmdLine) < 2 {
+			return reply.MakeArgNumErrReply("pubsub")
+		}
+		return pubsub.PubSub(mdb.hub, cmdLine[1:])
+
+	} else if cmdName == "acl" {
+		return execACL(mdb, c, cmdLine[1:])
 
 	} else if cmdName == "bgrewriteaof" {
 		// aof.go imports router.go, router.go cannot import BGRewriteAOF from aof.go
-		// return BGRewriteAOF(mdb, cmdLine[1:])
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply("bgrewriteaof")
+		}
+		return BGRewriteAOF(mdb, cmdLine[1:])
 
 	} else if cmdName == "rewriteaof" {
-		// return RewriteAOF(mdb, cmdLine[1:])
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply("rewriteaof")
+		}
+		return RewriteAOF(mdb, cmdLine[1:])
+
+	} else if cmdName == "save" {
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply("save")
+		}
+		return Save(mdb, cmdLine[1:])
+
+	} else if cmdName == "bgsave" {
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply("bgsave")
+		}
+		return BGSave(mdb, cmdLine[1:])
+
+	} else if cmdName == "lastsave" {
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply("lastsave")
+		}
+		return LastSave(mdb, cmdLine[1:])
+
+	} else if cmdName == "multi" {
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return StartMulti(c)
+
+	} else if cmdName == "exec" {
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return mdb.execMulti(c)
+
+	} else if cmdName == "discard" {
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return DiscardMulti(c)
+
+	} else if cmdName == "swapdb" {
+		if len(cmdLine) != 3 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return execSwapDB(mdb, cmdLine[1:])
 
 	} else if cmdName == "flushall" {
 		// return mdb.flushAll()
 
 	} else if cmdName == "select" {
-		if c != nil && c.InMultiState() {
-			return reply.MakeErrReply("cannot select database within multi")
-		}
 		if len(cmdLine) != 2 {
 			return reply.MakeArgNumErrReply("select")
 		}
 		return execSelect(c, mdb, cmdLine[1:])
 
+	} else if cmdName == "move" {
+		if len(cmdLine) != 3 {
+			return reply.MakeArgNumErrReply("move")
+		}
+		return execMove(c, mdb, cmdLine[1:])
+
+	} else if cmdName == "copy" {
+		if len(cmdLine) < 3 {
+			return reply.MakeArgNumErrReply("copy")
+		}
+		return execCopyToDB(c, mdb, cmdLine[1:])
+
 	}
-	// todo: support multi database transaction
 
 	// normal commands
 	dbIndex := c.GetDBIndex()
@@ -107,14 +304,77 @@ func (mdb *MultiDB) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Rep
 
 // AfterClientClose does some clean after client close connection
 func (mdb *MultiDB) AfterClientClose(c redis.Connection) {
-	// pubsub.UnsubscribeAll(mdb.hub, c)
+	pubsub.UnsubscribeAll(mdb.hub, c)
+	for _, db := range mdb.dbSet {
+		db.removeBlockedConn(c)
+	}
 }
 
 // Close graceful shutdown database
 func (mdb *MultiDB) Close() {
-	// if mdb.aofHandler != nil {
-	// 	mdb.aofHandler.Close()
-	// }
+	close(mdb.closed)
+	mdb.saveWg.Wait()
+	// 配置了 save 规则时关闭前保存一次
+	if len(mdb.saveRules) > 0 {
+		if err := mdb.save(); err != nil {
+			logger.Error("saving on shutdown failed: " + err.Error())
+		}
+	}
+	if mdb.aofHandler != nil {
+		mdb.aofHandler.Close()
+	}
+	mdb.hub.Close()
+	// 取消过期定时任务，定时任务持有数据库的引用
+	for _, db := range mdb.dbSet {
+		db.ttlMap.ForEach(func(key string, val interface{}) bool {
+			db.cancelExpireTask(key)
+			return true
+		})
+	}
+}
+
+// 订阅状态下可以执行的指令
+var subscribedCommands = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ssubscribe":   true,
+	"sunsubscribe": true,
+}
+
+// 订阅状态下的 ping 以消息的格式响应
+func execSubscribedPing(args [][]byte) redis.Reply {
+	if len(args) > 1 {
+		return reply.MakeArgNumErrReply("ping")
+	}
+	message := []byte("")
+	if len(args) == 1 {
+		message = args[0]
+	}
+	return reply.MakeMultiBulkReply([][]byte{[]byte("pong"), message})
+}
+
+func init() {
+	registerSpecialCommand("select", 2, flagLoading|flagStale|flagFast, 0, 0, 0, acl.CatFast|acl.CatConnection)
+	registerSpecialCommand("swapdb", 3, flagWrite|flagFast, 0, 0, 0, acl.CatKeyspace|acl.CatWrite|acl.CatFast|acl.CatDangerous)
+	registerSpecialCommand("subscribe", -2, flagPubSub|flagNoScript|flagLoading|flagStale|flagNoMulti, 0, 0, 0, acl.CatPubSub|acl.CatSlow)
+	registerSpecialCommand("psubscribe", -2, flagPubSub|flagNoScript|flagLoading|flagStale|flagNoMulti, 0, 0, 0, acl.CatPubSub|acl.CatSlow)
+	registerSpecialCommand("ssubscribe", -2, flagPubSub|flagNoScript|flagLoading|flagStale|flagNoMulti, 0, 0, 0, acl.CatPubSub|acl.CatSlow)
+	registerSpecialCommand("unsubscribe", -1, flagPubSub|flagNoScript|flagLoading|flagStale|flagNoMulti, 0, 0, 0, acl.CatPubSub|acl.CatSlow)
+	registerSpecialCommand("punsubscribe", -1, flagPubSub|flagNoScript|flagLoading|flagStale|flagNoMulti, 0, 0, 0, acl.CatPubSub|acl.CatSlow)
+	registerSpecialCommand("sunsubscribe", -1, flagPubSub|flagNoScript|flagLoading|flagStale|flagNoMulti, 0, 0, 0, acl.CatPubSub|acl.CatSlow)
+	registerSpecialCommand("publish", 3, flagPubSub|flagLoading|flagStale|flagFast, 0, 0, 0, acl.CatPubSub|acl.CatFast)
+	registerSpecialCommand("spublish", 3, flagPubSub|flagLoading|flagStale|flagFast, 0, 0, 0, acl.CatPubSub|acl.CatFast)
+	registerSpecialCommand("pubsub", -2, flagPubSub|flagLoading|flagStale, 0, 0, 0, acl.CatPubSub|acl.CatSlow)
+}
+
+// 获取指定编号的数据库
+func (mdb *MultiDB) selectDB(dbIndex int) (*DB, reply.ErrorReply) {
+	if dbIndex < 0 || dbIndex >= len(mdb.dbSet) {
+		return nil, reply.MakeErrReply("ERR DB index is out of range")
+	}
+	return mdb.dbSet[dbIndex], nil
 }
 
 func execSelect(c redis.Connection, mdb *MultiDB, args [][]byte) redis.Reply {
@@ -122,13 +382,105 @@ func execSelect(c redis.Connection, mdb *MultiDB, args [][]byte) redis.Reply {
 	if err != nil {
 		return reply.MakeErrReply("ERR invalid DB index")
 	}
-	if dbIndex >= len(mdb.dbSet) {
-		return reply.MakeErrReply("ERR DB index is out of range")
+	if _, errReply := mdb.selectDB(dbIndex); errReply != nil {
+		return errReply
 	}
 	c.SelectDB(dbIndex)
 	return reply.MakeOkReply()
 }
 
+// 解析 SWAPDB index1 index2
+func parseSwapDB(mdb *MultiDB, args [][]byte) (*DB, *DB, reply.ErrorReply) {
+	index1, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, nil, reply.MakeErrReply("ERR invalid first DB index")
+	}
+	index2, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, nil, reply.MakeErrReply("ERR invalid second DB index")
+	}
+	db1, errReply := mdb.selectDB(index1)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	db2, errReply := mdb.selectDB(index2)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	return db1, db2, nil
+}
+
+// 交换两个数据库的数据，SWAPDB index1 index2
+func execSwapDB(mdb *MultiDB, args [][]byte) redis.Reply {
+	db1, db2, errReply := parseSwapDB(mdb, args)
+	if errReply != nil {
+		return errReply
+	}
+	swapDB(db1, db2)
+	// 数据整体改变，挂起的客户端可能等到了数据
+	db1.wakeAllBlockedClients()
+	db2.wakeAllBlockedClients()
+	return reply.MakeOkReply()
+}
+
+// 交换两个数据库的数据和过期时间，按数据库编号顺序对两个数据库的所有 key 上写锁
+func swapDB(db1 *DB, db2 *DB) {
+	if db1 == db2 {
+		return
+	}
+	first, second := db1, db2
+	if first.index > second.index {
+		first, second = second, first
+	}
+	first.LockAll()
+	second.LockAll()
+	defer first.UnLockAll()
+	defer second.UnLockAll()
+	swapDBWithLock(db1, db2)
+}
+
+// 交换两个数据库的数据和过期时间，调用者需要持有两个数据库所有 key 的写锁
+// 锁和阻塞队列属于数据库编号，不交换，两个数据库中的所有 key 都视为被修改
+func swapDBWithLock(db1 *DB, db2 *DB) {
+	if db1 == db2 {
+		return
+	}
+	// 交换字典的内容而不是字段，不上锁读取字段的 KEYS SCAN 等指令不受影响
+	db1.data.(*dict.ConcurrentDict).Swap(db2.data.(*dict.ConcurrentDict))
+	db1.ttlMap.(*dict.ConcurrentDict).Swap(db2.ttlMap.(*dict.ConcurrentDict))
+
+	keys := append(db1.data.Keys(), db2.data.Keys()...)
+	db1.addVersion(keys...)
+	db2.addVersion(keys...)
+
+	// 过期定时任务绑定了数据库，取消交换前数据库中的任务后重新设置
+	if !db1.basic {
+		ttls1, ttls2 := collectTTLs(db1), collectTTLs(db2)
+		for key := range ttls1 {
+			db2.cancelExpireTask(key)
+		}
+		for key := range ttls2 {
+			db1.cancelExpireTask(key)
+		}
+		for key, expireTime := range ttls1 {
+			db1.addExpireTask(key, expireTime)
+		}
+		for key, expireTime := range ttls2 {
+			db2.addExpireTask(key, expireTime)
+		}
+	}
+	db1.addAof(utils.ToCmdLine("swapdb", strconv.Itoa(db1.index), strconv.Itoa(db2.index)))
+}
+
+func collectTTLs(db *DB) map[string]time.Time {
+	ttls := make(map[string]time.Time)
+	db.ttlMap.ForEach(func(key string, val interface{}) bool {
+		ttls[key] = val.(time.Time)
+		return true
+	})
+	return ttls
+}
+
 // func (mdb *MultiDB) flushAll() redis.Reply {
 // 	for _, db := range mdb.dbSet {
 // 		db.Flush()
@@ -140,21 +492,12 @@ func execSelect(c redis.Connection, mdb *MultiDB, args [][]byte) redis.Reply {
 // }
 
 // ForEach traverses all the keys in the given database
-// func (mdb *MultiDB) ForEach(dbIndex int, cb func(key string, data *database.DataEntity, expiration *time.Time) bool) {
-// 	if dbIndex >= len(mdb.dbSet) {
-// 		return
-// 	}
-// 	db := mdb.dbSet[dbIndex]
-// 	db.ForEach(cb)
-// }
-
-// ExecMulti executes multi commands transaction Atomically and Isolated
-func (mdb *MultiDB) ExecMulti(conn redis.Connection, watching map[string]uint32, cmdLines []CmdLine) redis.Reply {
-	if conn.GetDBIndex() >= len(mdb.dbSet) {
-		return reply.MakeErrReply("ERR DB index is out of range")
+func (mdb *MultiDB) ForEach(dbIndex int, cb func(key string, data *database.DataEntity, expiration *time.Time) bool) {
+	if dbIndex >= len(mdb.dbSet) {
+		return
 	}
-	db := mdb.dbSet[conn.GetDBIndex()]
-	return db.ExecMulti(conn, watching, cmdLines)
+	db := mdb.dbSet[dbIndex]
+	db.ForEach(cb)
 }
 
 // RWLocks lock keys for writing and reading
@@ -0,0 +1,555 @@
+// 集合指令
+
+package database
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"ljr-redis/acl"
+	HashSet "ljr-redis/datastruct/set"
+	"ljr-redis/interface/database"
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+// 获取集合数据，key 不存在时返回 nil
+func (db *DB) getAsSet(key string) (*HashSet.Set, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	set, ok := entity.Data.(*HashSet.Set)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return set, nil
+}
+
+// 获取集合数据，key 不存在时创建新集合
+func (db *DB) getOrInitSet(key string) (set *HashSet.Set, inited bool, errReply reply.ErrorReply) {
+	set, errReply = db.getAsSet(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	inited = false
+	if set == nil {
+		set = HashSet.Make()
+		db.PutEntity(key, &database.DataEntity{Data: set})
+		inited = true
+	}
+	return set, inited, nil
+}
+
+// 回滚集合中的指定元素
+func rollbackSetMembers(db *DB, key string, members ...string) []CmdLine {
+	var undoCmdLines []CmdLine
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return nil
+	}
+	if set == nil {
+		undoCmdLines = append(undoCmdLines, utils.ToCmdLine("DEL", key))
+		return undoCmdLines
+	}
+	for _, member := range members {
+		if set.Has(member) {
+			undoCmdLines = append(undoCmdLines, utils.ToCmdLine("SADD", key, member))
+		} else {
+			undoCmdLines = append(undoCmdLines, utils.ToCmdLine("SREM", key, member))
+		}
+	}
+	return appendTTLCmd(db, key, undoCmdLines)
+}
+
+func undoSetChange(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	members := make([]string, len(args)-1)
+	for i, member := range args[1:] {
+		members[i] = string(member)
+	}
+	return rollbackSetMembers(db, key, members...)
+}
+
+// 集合转换为字节数组
+func setToBytes(set *HashSet.Set) [][]byte {
+	result := make([][]byte, 0, set.Len())
+	set.ForEach(func(member string) bool {
+		result = append(result, []byte(member))
+		return true
+	})
+	return result
+}
+
+/* ---------- SADD SREM ------------ */
+
+// 添加元素，返回新增的个数
+func execSAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+
+	set, _, errReply := db.getOrInitSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	counter := 0
+	for _, member := range args[1:] {
+		counter += set.Add(string(member))
+	}
+
+	db.addAof(utils.ToCmdLine3("sadd", args...))
+	if counter > 0 {
+		db.notify(notifySet, "sadd", key)
+	}
+	return reply.MakeIntReply(int64(counter))
+}
+
+// 删除元素，返回删除的个数
+func execSRem(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+	counter := 0
+	for _, member := range args[1:] {
+		counter += set.Remove(string(member))
+	}
+	if counter > 0 {
+		db.addAof(utils.ToCmdLine3("srem", args...))
+		db.notify(notifySet, "srem", key)
+	}
+	if set.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return reply.MakeIntReply(int64(counter))
+}
+
+/* ---------- SISMEMBER SMISMEMBER SMEMBERS SCARD ------------ */
+
+// 是否包含元素
+func execSIsMember(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil || !set.Has(string(args[1])) {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(1)
+}
+
+// 批量判断是否包含元素
+func execSMIsMember(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		if set != nil && set.Has(string(member)) {
+			result[i] = reply.MakeIntReply(1)
+		} else {
+			result[i] = reply.MakeIntReply(0)
+		}
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// 获取所有元素
+func execSMembers(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	return reply.MakeMultiBulkReply(setToBytes(set))
+}
+
+// 元素个数
+func execSCard(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(set.Len()))
+}
+
+/* ---------- SPOP SRANDMEMBER ------------ */
+
+// SPOP key [count] 随机删除并返回元素
+func execSPop(db *DB, args [][]byte) redis.Reply {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	key := string(args[0])
+	withCount := len(args) == 2
+	count := int64(1)
+	if withCount {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive")
+		}
+	}
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		if withCount {
+			return reply.MakeEmptyMultiBulkReply()
+		}
+		return reply.MakeNullBulkReply()
+	}
+
+	members := set.RandomDistinctMembers(int(count))
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		set.Remove(member)
+		result[i] = []byte(member)
+	}
+
+	if len(result) > 0 {
+		// 随机结果不能直接重放，aof 中记录被删除的元素
+		db.addAof(utils.ToCmdLine3("srem", append([][]byte{args[0]}, result...)...))
+		db.notify(notifySet, "spop", key)
+	}
+	if set.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	if !withCount {
+		return reply.MakeBulkReply(result[0])
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// SRANDMEMBER key [count]
+// count > 0 返回不重复的元素，count < 0 返回的元素可能重复
+func execSRandMember(db *DB, args [][]byte) redis.Reply {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	key := string(args[0])
+	withCount := len(args) == 2
+	count := int64(1)
+	if withCount {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if count < -math.MaxInt32 {
+			return reply.MakeErrReply("ERR value is out of range")
+		}
+	}
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		if withCount {
+			return reply.MakeEmptyMultiBulkReply()
+		}
+		return reply.MakeNullBulkReply()
+	}
+
+	var members []string
+	if count >= 0 {
+		members = set.RandomDistinctMembers(int(count))
+	} else {
+		members = set.RandomMembers(int(-count))
+	}
+	if !withCount {
+		return reply.MakeBulkReply([]byte(members[0]))
+	}
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		result[i] = []byte(member)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+/* ---------- SMOVE ------------ */
+
+func prepareSMove(args [][]byte) ([]string, []string) {
+	return []string{string(args[0]), string(args[1])}, nil
+}
+
+func undoSMove(db *DB, args [][]byte) []CmdLine {
+	member := string(args[2])
+	undoCmdLines := rollbackSetMembers(db, string(args[0]), member)
+	return append(undoCmdLines, rollbackSetMembers(db, string(args[1]), member)...)
+}
+
+// SMOVE source destination member
+func execSMove(db *DB, args [][]byte) redis.Reply {
+	srcKey := string(args[0])
+	dstKey := string(args[1])
+	member := string(args[2])
+
+	srcSet, errReply := db.getAsSet(srcKey)
+	if errReply != nil {
+		return errReply
+	}
+	dstSet, errReply := db.getAsSet(dstKey)
+	if errReply != nil {
+		return errReply
+	}
+	if srcSet == nil || !srcSet.Has(member) {
+		return reply.MakeIntReply(0)
+	}
+	if srcKey == dstKey {
+		return reply.MakeIntReply(1)
+	}
+
+	srcSet.Remove(member)
+	db.notify(notifySet, "srem", srcKey)
+	if srcSet.Len() == 0 {
+		db.Remove(srcKey)
+		db.notify(notifyGeneric, "del", srcKey)
+	}
+	if dstSet == nil {
+		dstSet, _, _ = db.getOrInitSet(dstKey)
+	}
+	if dstSet.Add(member) > 0 {
+		db.notify(notifySet, "sadd", dstKey)
+	}
+
+	db.addAof(utils.ToCmdLine3("smove", args...))
+	return reply.MakeIntReply(1)
+}
+
+/* ---------- SINTER SUNION SDIFF ------------ */
+
+// 集合运算
+const (
+	setIntersect = iota
+	setUnion
+	setDiff
+)
+
+// 对 keys 对应的集合进行运算，key 不存在时视为空集合
+func (db *DB) calculateSets(op int, keys [][]byte) (*HashSet.Set, reply.ErrorReply) {
+	var result *HashSet.Set
+	for i, key := range keys {
+		set, errReply := db.getAsSet(string(key))
+		if errReply != nil {
+			return nil, errReply
+		}
+		if set == nil {
+			set = HashSet.Make()
+		}
+		if i == 0 {
+			result = set.Union(HashSet.Make())
+			continue
+		}
+		switch op {
+		case setIntersect:
+			result = result.Intersect(set)
+		case setUnion:
+			result = result.Union(set)
+		case setDiff:
+			result = result.Diff(set)
+		}
+	}
+	return result, nil
+}
+
+func execSetCalculate(db *DB, op int, args [][]byte) redis.Reply {
+	result, errReply := db.calculateSets(op, args)
+	if errReply != nil {
+		return errReply
+	}
+	return reply.MakeMultiBulkReply(setToBytes(result))
+}
+
+// 将运算结果存储到 destination，返回结果集合的元素个数
+func execSetCalculateStore(db *DB, op int, cmdName string, args [][]byte) redis.Reply {
+	dest := string(args[0])
+	result, errReply := db.calculateSets(op, args[1:])
+	if errReply != nil {
+		return errReply
+	}
+
+	if result.Len() == 0 {
+		if db.Removes(dest) > 0 {
+			db.notify(notifyGeneric, "del", dest)
+		}
+	} else {
+		db.PutEntity(dest, &database.DataEntity{Data: result})
+		db.Persist(dest)
+		db.notify(notifySet, cmdName, dest)
+	}
+	db.addAof(utils.ToCmdLine3(cmdName, args...))
+	return reply.MakeIntReply(int64(result.Len()))
+}
+
+// 交集
+func execSInter(db *DB, args [][]byte) redis.Reply {
+	return execSetCalculate(db, setIntersect, args)
+}
+
+// 交集并存储
+func execSInterStore(db *DB, args [][]byte) redis.Reply {
+	return execSetCalculateStore(db, setIntersect, "sinterstore", args)
+}
+
+// 并集
+func execSUnion(db *DB, args [][]byte) redis.Reply {
+	return execSetCalculate(db, setUnion, args)
+}
+
+// 并集并存储
+func execSUnionStore(db *DB, args [][]byte) redis.Reply {
+	return execSetCalculateStore(db, setUnion, "sunionstore", args)
+}
+
+// 差集
+func execSDiff(db *DB, args [][]byte) redis.Reply {
+	return execSetCalculate(db, setDiff, args)
+}
+
+// 差集并存储
+func execSDiffStore(db *DB, args [][]byte) redis.Reply {
+	return execSetCalculateStore(db, setDiff, "sdiffstore", args)
+}
+
+// 第一个参数为写 key，其余为读 key
+func prepareSetCalculateStore(args [][]byte) ([]string, []string) {
+	dest := string(args[0])
+	keys := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		keys[i] = string(arg)
+	}
+	return []string{dest}, keys
+}
+
+/* ---------- SINTERCARD ------------ */
+
+// 解析 numkeys 参数
+func parseNumKeys(args [][]byte) (int, redis.Reply) {
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR numkeys should be greater than 0")
+	}
+	if numKeys <= 0 {
+		return 0, reply.MakeErrReply("ERR numkeys should be greater than 0")
+	}
+	if numKeys > int64(len(args)-1) {
+		return 0, reply.MakeErrReply("ERR Number of keys can't be greater than number of args")
+	}
+	return int(numKeys), nil
+}
+
+// numkeys key [key ...] 形式的读 key
+func prepareNumKeys(args [][]byte) ([]string, []string) {
+	numKeys, errReply := parseNumKeys(args)
+	if errReply != nil {
+		return nil, nil
+	}
+	keys := make([]string, numKeys)
+	for i := 0; i < numKeys; i++ {
+		keys[i] = string(args[i+1])
+	}
+	return nil, keys
+}
+
+// SINTERCARD numkeys key [key ...] [LIMIT limit]
+func execSInterCard(db *DB, args [][]byte) redis.Reply {
+	numKeys, errReply := parseNumKeys(args)
+	if errReply != nil {
+		return errReply
+	}
+	limit := int64(0)
+	rest := args[numKeys+1:]
+	for i := 0; i < len(rest); i += 2 {
+		if strings.ToUpper(string(rest[i])) != "LIMIT" || i+1 >= len(rest) {
+			return reply.MakeSyntaxErrReply()
+		}
+		var err error
+		limit, err = strconv.ParseInt(string(rest[i+1]), 10, 64)
+		if err != nil || limit < 0 {
+			return reply.MakeErrReply("ERR LIMIT can't be negative")
+		}
+	}
+
+	result, err := db.calculateSets(setIntersect, args[1:numKeys+1])
+	if err != nil {
+		return err
+	}
+	card := int64(result.Len())
+	if limit > 0 && card > limit {
+		card = limit
+	}
+	return reply.MakeIntReply(card)
+}
+
+/* ---------- SSCAN ------------ */
+
+// SSCAN key cursor [MATCH pattern] [COUNT count]
+func execSScan(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	cursor, errReply := parseCursor(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+
+	set, err := db.getAsSet(key)
+	if err != nil {
+		return err
+	}
+	if set == nil {
+		return makeScanReply(0, [][]byte{})
+	}
+	members, next := set.Scan(cursor, opts.count)
+	result := make([][]byte, 0, len(members))
+	for _, member := range members {
+		if opts.match(member) {
+			result = append(result, []byte(member))
+		}
+	}
+	return makeScanReply(next, result)
+}
+
+func init() {
+	RegisterCommand("SAdd", execSAdd, writeFirstKey, undoSetChange, -3, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatSet|acl.CatFast)
+	RegisterCommand("SRem", execSRem, writeFirstKey, undoSetChange, -3, flagWrite|flagFast, 1, 1, 1, acl.CatWrite|acl.CatSet|acl.CatFast)
+	RegisterCommand("SIsMember", execSIsMember, readFirstKey, nil, 3, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatSet|acl.CatFast)
+	RegisterCommand("SMIsMember", execSMIsMember, readFirstKey, nil, -3, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatSet|acl.CatFast)
+	RegisterCommand("SMembers", execSMembers, readFirstKey, nil, 2, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatSet|acl.CatSlow)
+	RegisterCommand("SCard", execSCard, readFirstKey, nil, 2, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatSet|acl.CatFast)
+	RegisterCommand("SPop", execSPop, writeFirstKey, rollbackFirstKey, -2, flagWrite|flagFast, 1, 1, 1, acl.CatWrite|acl.CatSet|acl.CatFast)
+	RegisterCommand("SRandMember", execSRandMember, readFirstKey, nil, -2, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatSet|acl.CatSlow)
+	RegisterCommand("SMove", execSMove, prepareSMove, undoSMove, 4, flagWrite|flagFast, 1, 2, 1, acl.CatWrite|acl.CatSet|acl.CatFast)
+	RegisterCommand("SInter", execSInter, readAllKeys, nil, -2, flagReadOnly, 1, -1, 1, acl.CatRead|acl.CatSet|acl.CatSlow)
+	RegisterCommand("SInterStore", execSInterStore, prepareSetCalculateStore, rollbackFirstKey, -3, flagWrite|flagDenyOOM, 1, -1, 1, acl.CatWrite|acl.CatSet|acl.CatSlow)
+	RegisterCommand("SUnion", execSUnion, readAllKeys, nil, -2, flagReadOnly, 1, -1, 1, acl.CatRead|acl.CatSet|acl.CatSlow)
+	RegisterCommand("SUnionStore", execSUnionStore, prepareSetCalculateStore, rollbackFirstKey, -3, flagWrite|flagDenyOOM, 1, -1, 1, acl.CatWrite|acl.CatSet|acl.CatSlow)
+	RegisterCommand("SDiff", execSDiff, readAllKeys, nil, -2, flagReadOnly, 1, -1, 1, acl.CatRead|acl.CatSet|acl.CatSlow)
+	RegisterCommand("SDiffStore", execSDiffStore, prepareSetCalculateStore, rollbackFirstKey, -3, flagWrite|flagDenyOOM, 1, -1, 1, acl.CatWrite|acl.CatSet|acl.CatSlow)
+	RegisterCommand("SInterCard", execSInterCard, prepareNumKeys, nil, -3, flagReadOnly|flagMovableKeys, 0, 0, 0, acl.CatRead|acl.CatSet|acl.CatSlow)
+	RegisterCommand("SScan", execSScan, readFirstKey, nil, -3, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatSet|acl.CatSlow)
+}
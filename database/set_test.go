@@ -0,0 +1,105 @@
+// 测试集合指令
+
+package database
+
+import (
+	"sort"
+	"testing"
+
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+// 排序后比较，集合元素的顺序不固定
+func assertMembers(t *testing.T, actual redis.Reply, expected ...string) {
+	t.Helper()
+	r, ok := actual.(*reply.MultiBulkReply)
+	if !ok {
+		t.Fatalf("expected multi bulk reply, actually %q", actual.ToBytes())
+	}
+	members := make([]string, len(r.Args))
+	for i, arg := range r.Args {
+		members[i] = string(arg)
+	}
+	sort.Strings(members)
+	sort.Strings(expected)
+	if len(members) != len(expected) {
+		t.Fatalf("expected %v, actually %v", expected, members)
+	}
+	for i := range members {
+		if members[i] != expected[i] {
+			t.Fatalf("expected %v, actually %v", expected, members)
+		}
+	}
+}
+
+func TestSAddAndRem(t *testing.T) {
+	db := MakeDB()
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("sadd", "s", "a", "b", "a")), 2)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("sismember", "s", "a")), 1)
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("smismember", "s", "a", "c")),
+		reply.MakeMultiRawReply([]redis.Reply{reply.MakeIntReply(1), reply.MakeIntReply(0)}))
+	assertMembers(t, db.Exec(nil, utils.ToCmdLine("smembers", "s")), "a", "b")
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("srem", "s", "a", "c")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("scard", "s")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("smove", "s", "d", "b")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("scard", "s")), 0)
+	assertMembers(t, db.Exec(nil, utils.ToCmdLine("smembers", "d")), "b")
+}
+
+func TestSPopAndRandMember(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("sadd", "s", "a", "b", "c"))
+	assertMembers(t, db.Exec(nil, utils.ToCmdLine("srandmember", "s", "10")), "a", "b", "c")
+	if r := db.Exec(nil, utils.ToCmdLine("srandmember", "s", "-5")).(*reply.MultiBulkReply); len(r.Args) != 5 {
+		t.Errorf("expected 5 members, actually %d", len(r.Args))
+	}
+	if r := db.Exec(nil, utils.ToCmdLine("spop", "s", "2")).(*reply.MultiBulkReply); len(r.Args) != 2 {
+		t.Errorf("expected 2 members, actually %d", len(r.Args))
+	}
+	db.Exec(nil, utils.ToCmdLine("spop", "s"))
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("scard", "s")), 0)
+}
+
+func TestSetCalculate(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("sadd", "s1", "a", "b", "c"))
+	db.Exec(nil, utils.ToCmdLine("sadd", "s2", "b", "c", "d"))
+	assertMembers(t, db.Exec(nil, utils.ToCmdLine("sinter", "s1", "s2")), "b", "c")
+	assertMembers(t, db.Exec(nil, utils.ToCmdLine("sunion", "s1", "s2")), "a", "b", "c", "d")
+	assertMembers(t, db.Exec(nil, utils.ToCmdLine("sdiff", "s1", "s2")), "a")
+	assertMembers(t, db.Exec(nil, utils.ToCmdLine("sinter", "s1", "none")))
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("sunionstore", "dst", "s1", "s2")), 4)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("sdiffstore", "s1", "s1", "s2")), 1)
+	assertMembers(t, db.Exec(nil, utils.ToCmdLine("smembers", "s1")), "a")
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("sinterstore", "dst", "s1", "s2")), 0)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("scard", "dst")), 0)
+
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("sintercard", "2", "s2", "s2")), 3)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("sintercard", "1", "s2", "LIMIT", "2")), 2)
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("sintercard", "3", "s2", "s2")))
+
+	db.Exec(nil, utils.ToCmdLine("set", "str", "1"))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("sunion", "s1", "str")))
+}
+
+func TestSetUndo(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("sadd", "s", "a", "b"))
+	for _, cmdLine := range []CmdLine{
+		utils.ToCmdLine("sadd", "s", "c", "a"),
+		utils.ToCmdLine("srem", "s", "a", "x"),
+		utils.ToCmdLine("spop", "s"),
+		utils.ToCmdLine("smove", "s", "d", "a"),
+		utils.ToCmdLine("sinterstore", "s", "none"),
+	} {
+		undo := db.GetUndoLogs(cmdLine)
+		db.Exec(nil, cmdLine)
+		for _, undoCmdLine := range undo {
+			db.execWithLock(undoCmdLine)
+		}
+		assertMembers(t, db.Exec(nil, utils.ToCmdLine("smembers", "s")), "a", "b")
+		assertInt(t, db.Exec(nil, utils.ToCmdLine("scard", "d")), 0)
+	}
+}
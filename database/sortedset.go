@@ -0,0 +1,1130 @@
+// 有序集合指令
+
+package database
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"ljr-redis/acl"
+	HashSet "ljr-redis/datastruct/set"
+	SortedSet "ljr-redis/datastruct/sortedset"
+	"ljr-redis/interface/database"
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+// 获取有序集合数据，key 不存在时返回 nil
+func (db *DB) getAsSortedSet(key string) (*SortedSet.SortedSet, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	sortedSet, ok := entity.Data.(*SortedSet.SortedSet)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return sortedSet, nil
+}
+
+// 获取有序集合数据，key 不存在时创建新的有序集合
+func (db *DB) getOrInitSortedSet(key string) (sortedSet *SortedSet.SortedSet, inited bool, errReply reply.ErrorReply) {
+	sortedSet, errReply = db.getAsSortedSet(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	inited = false
+	if sortedSet == nil {
+		sortedSet = SortedSet.Make()
+		db.PutEntity(key, &database.DataEntity{Data: sortedSet})
+		inited = true
+	}
+	return sortedSet, inited, nil
+}
+
+// 回滚有序集合中的指定元素
+func rollbackZSetMembers(db *DB, key string, members ...string) []CmdLine {
+	var undoCmdLines []CmdLine
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return nil
+	}
+	if sortedSet == nil {
+		undoCmdLines = append(undoCmdLines, utils.ToCmdLine("DEL", key))
+		return undoCmdLines
+	}
+	for _, member := range members {
+		element, ok := sortedSet.Get(member)
+		if !ok {
+			undoCmdLines = append(undoCmdLines, utils.ToCmdLine("ZREM", key, member))
+		} else {
+			undoCmdLines = append(undoCmdLines, utils.ToCmdLine("ZADD", key, formatScore(element.Score), member))
+		}
+	}
+	return appendTTLCmd(db, key, undoCmdLines)
+}
+
+// 解析分数，不允许 NaN
+func parseScore(raw []byte) (float64, redis.Reply) {
+	score, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, reply.MakeErrReply("ERR value is not a valid float")
+	}
+	return score, nil
+}
+
+// 格式化分数，与 redis 一致使用 inf 和 -inf 表示无穷
+func formatScore(score float64) string {
+	if math.IsInf(score, 1) {
+		return "inf"
+	} else if math.IsInf(score, -1) {
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// 元素转换为回复，withScores 为 true 时 member 后面跟随 score
+func elementsToReply(elements []*SortedSet.Element, withScores bool) redis.Reply {
+	size := len(elements)
+	if withScores {
+		size *= 2
+	}
+	result := make([][]byte, 0, size)
+	for _, element := range elements {
+		result = append(result, []byte(element.Member))
+		if withScores {
+			result = append(result, []byte(formatScore(element.Score)))
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+/* ---------- ZADD ------------ */
+
+type zAddOptions struct {
+	nx   bool
+	xx   bool
+	gt   bool
+	lt   bool
+	ch   bool
+	incr bool
+}
+
+// 解析 ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func parseZAddArgs(args [][]byte) (*zAddOptions, []*SortedSet.Element, redis.Reply) {
+	opts := &zAddOptions{}
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			opts.nx = true
+			continue
+		case "XX":
+			opts.xx = true
+			continue
+		case "GT":
+			opts.gt = true
+			continue
+		case "LT":
+			opts.lt = true
+			continue
+		case "CH":
+			opts.ch = true
+			continue
+		case "INCR":
+			opts.incr = true
+			continue
+		}
+		break
+	}
+
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return nil, nil, reply.MakeSyntaxErrReply()
+	}
+	if opts.nx && opts.xx {
+		return nil, nil, reply.MakeErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if (opts.gt && opts.lt) || (opts.nx && (opts.gt || opts.lt)) {
+		return nil, nil, reply.MakeErrReply("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if opts.incr && len(pairs) > 2 {
+		return nil, nil, reply.MakeErrReply("ERR INCR option supports a single increment-element pair")
+	}
+
+	elements := make([]*SortedSet.Element, len(pairs)/2)
+	for j := range elements {
+		score, errReply := parseScore(pairs[2*j])
+		if errReply != nil {
+			return nil, nil, errReply
+		}
+		elements[j] = &SortedSet.Element{
+			Member: string(pairs[2*j+1]),
+			Score:  score,
+		}
+	}
+	return opts, elements, nil
+}
+
+func undoZAdd(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	_, elements, errReply := parseZAddArgs(args)
+	if errReply != nil {
+		return nil
+	}
+	members := make([]string, len(elements))
+	for i, element := range elements {
+		members[i] = element.Member
+	}
+	return rollbackZSetMembers(db, key, members...)
+}
+
+// 添加元素，返回新增的个数，CH 时返回新增和更新的个数，INCR 时返回新的分数
+func execZAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	opts, elements, errReply := parseZAddArgs(args)
+	if errReply != nil {
+		return errReply
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		if opts.xx {
+			if opts.incr {
+				return reply.MakeNullBulkReply()
+			}
+			return reply.MakeIntReply(0)
+		}
+		sortedSet, _, _ = db.getOrInitSortedSet(key)
+	}
+
+	var added, changed int64
+	var updated *SortedSet.Element
+	for _, element := range elements {
+		score := element.Score
+		old, exists := sortedSet.Get(element.Member)
+		if opts.incr && exists {
+			score += old.Score
+			if math.IsNaN(score) {
+				return reply.MakeErrReply("ERR resulting score is not a number (NaN)")
+			}
+		}
+		if exists {
+			if opts.nx || (opts.gt && score <= old.Score) || (opts.lt && score >= old.Score) {
+				continue
+			}
+			if score != old.Score {
+				sortedSet.Add(element.Member, score)
+				changed++
+			}
+		} else {
+			if opts.xx {
+				continue
+			}
+			sortedSet.Add(element.Member, score)
+			added++
+		}
+		updated = &SortedSet.Element{Member: element.Member, Score: score}
+	}
+
+	if opts.incr {
+		if updated == nil {
+			return reply.MakeNullBulkReply()
+		}
+		result := formatScore(updated.Score)
+		db.addAof(utils.ToCmdLine("zadd", key, result, updated.Member))
+		db.notify(notifyZSet, "zincr", key)
+		return reply.MakeBulkReply([]byte(result))
+	}
+
+	if added+changed > 0 {
+		db.addAof(utils.ToCmdLine3("zadd", args...))
+		db.notify(notifyZSet, "zadd", key)
+	}
+	if opts.ch {
+		return reply.MakeIntReply(added + changed)
+	}
+	return reply.MakeIntReply(added)
+}
+
+/* ---------- ZREM ZINCRBY ------------ */
+
+func undoZRem(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	members := make([]string, len(args)-1)
+	for i, member := range args[1:] {
+		members[i] = string(member)
+	}
+	return rollbackZSetMembers(db, key, members...)
+}
+
+// 删除元素，返回删除的个数
+func execZRem(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	var counter int64
+	for _, member := range args[1:] {
+		if sortedSet.Remove(string(member)) {
+			counter++
+		}
+	}
+	if counter > 0 {
+		db.addAof(utils.ToCmdLine3("zrem", args...))
+		db.notify(notifyZSet, "zrem", key)
+	}
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return reply.MakeIntReply(counter)
+}
+
+func undoZIncr(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	member := string(args[2])
+	return rollbackZSetMembers(db, key, member)
+}
+
+// 增加元素的分数，返回新的分数
+func execZIncrBy(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	delta, errReply := parseScore(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	member := string(args[2])
+
+	sortedSet, _, errReply := db.getOrInitSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	score := delta
+	if element, exists := sortedSet.Get(member); exists {
+		score += element.Score
+		if math.IsNaN(score) {
+			return reply.MakeErrReply("ERR resulting score is not a number (NaN)")
+		}
+	}
+	sortedSet.Add(member, score)
+
+	result := formatScore(score)
+	db.addAof(utils.ToCmdLine("zadd", key, result, member))
+	db.notify(notifyZSet, "zincr", key)
+	return reply.MakeBulkReply([]byte(result))
+}
+
+/* ---------- ZSCORE ZMSCORE ZCARD ZCOUNT ZLEXCOUNT ------------ */
+
+// 获取元素的分数
+func execZScore(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeNullBulkReply()
+	}
+	element, exists := sortedSet.Get(string(args[1]))
+	if !exists {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply([]byte(formatScore(element.Score)))
+}
+
+// 批量获取元素的分数
+func execZMScore(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		result[i] = reply.MakeNullBulkReply()
+		if sortedSet == nil {
+			continue
+		}
+		if element, exists := sortedSet.Get(string(member)); exists {
+			result[i] = reply.MakeBulkReply([]byte(formatScore(element.Score)))
+		}
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// 元素个数
+func execZCard(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(sortedSet.Len())
+}
+
+// 统计范围内的元素个数
+func execRangeCount(db *DB, args [][]byte, parseBorder func(string) (SortedSet.Border, error)) redis.Reply {
+	key := string(args[0])
+	min, err := parseBorder(string(args[1]))
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+	max, err := parseBorder(string(args[2]))
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(sortedSet.RangeCount(min, max))
+}
+
+// 统计分数范围内的元素个数
+func execZCount(db *DB, args [][]byte) redis.Reply {
+	return execRangeCount(db, args, SortedSet.ParseScoreBorder)
+}
+
+// 统计字典序范围内的元素个数
+func execZLexCount(db *DB, args [][]byte) redis.Reply {
+	return execRangeCount(db, args, SortedSet.ParseLexBorder)
+}
+
+/* ---------- ZRANK ZREVRANK ------------ */
+
+// 获取元素的排名，ZRANK key member [WITHSCORE]
+func execRank(db *DB, args [][]byte, desc bool) redis.Reply {
+	key := string(args[0])
+	withScore := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHSCORE" {
+			return reply.MakeSyntaxErrReply()
+		}
+		withScore = true
+	} else if len(args) > 3 {
+		return reply.MakeSyntaxErrReply()
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	var rank int64 = -1
+	if sortedSet != nil {
+		rank = sortedSet.GetRank(string(args[1]), desc)
+	}
+	if rank < 0 {
+		if withScore {
+			return reply.MakeNullMultiBulkReply()
+		}
+		return reply.MakeNullBulkReply()
+	}
+	if !withScore {
+		return reply.MakeIntReply(rank)
+	}
+	element, _ := sortedSet.Get(string(args[1]))
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeIntReply(rank),
+		reply.MakeBulkReply([]byte(formatScore(element.Score))),
+	})
+}
+
+func execZRank(db *DB, args [][]byte) redis.Reply {
+	return execRank(db, args, false)
+}
+
+func execZRevRank(db *DB, args [][]byte) redis.Reply {
+	return execRank(db, args, true)
+}
+
+/* ---------- ZRANGE ZRANGESTORE ------------ */
+
+// 范围查询的方式
+const (
+	rangeByRank = iota
+	rangeByScore
+	rangeByLex
+)
+
+// 范围查询参数 start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+type zRangeSpec struct {
+	start      []byte
+	stop       []byte
+	by         int
+	rev        bool
+	withScores bool
+	hasLimit   bool
+	offset     int64
+	count      int64
+}
+
+// 解析范围查询参数，allowWithScores 为 false 时不允许 WITHSCORES
+func parseZRangeSpec(args [][]byte, allowWithScores bool) (*zRangeSpec, redis.Reply) {
+	spec := &zRangeSpec{
+		start: args[0],
+		stop:  args[1],
+		by:    rangeByRank,
+		count: -1,
+	}
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "BYSCORE":
+			spec.by = rangeByScore
+		case "BYLEX":
+			spec.by = rangeByLex
+		case "REV":
+			spec.rev = true
+		case "WITHSCORES":
+			if !allowWithScores {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			spec.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			var errReply redis.Reply
+			spec.offset, errReply = parseInt(args[i+1])
+			if errReply != nil {
+				return nil, errReply
+			}
+			spec.count, errReply = parseInt(args[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			spec.hasLimit = true
+			i += 2
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	if spec.hasLimit && spec.by == rangeByRank {
+		return nil, reply.MakeErrReply("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if spec.withScores && spec.by == rangeByLex {
+		return nil, reply.MakeErrReply("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	return spec, nil
+}
+
+// 按查询参数获取有序集合中的元素
+func rangeSortedSet(sortedSet *SortedSet.SortedSet, spec *zRangeSpec) ([]*SortedSet.Element, redis.Reply) {
+	if spec.by == rangeByRank {
+		start, errReply := parseInt(spec.start)
+		if errReply != nil {
+			return nil, errReply
+		}
+		stop, errReply := parseInt(spec.stop)
+		if errReply != nil {
+			return nil, errReply
+		}
+		if sortedSet == nil {
+			return nil, nil
+		}
+		begin, end := convertRange(start, stop, sortedSet.Len())
+		if begin < 0 {
+			return nil, nil
+		}
+		return sortedSet.RangeByRank(int64(begin), int64(end), spec.rev), nil
+	}
+
+	parseBorder := SortedSet.ParseScoreBorder
+	if spec.by == rangeByLex {
+		parseBorder = SortedSet.ParseLexBorder
+	}
+	min, err := parseBorder(string(spec.start))
+	if err != nil {
+		return nil, reply.MakeErrReply(err.Error())
+	}
+	max, err := parseBorder(string(spec.stop))
+	if err != nil {
+		return nil, reply.MakeErrReply(err.Error())
+	}
+	// REV 时参数顺序为 max min
+	if spec.rev {
+		min, max = max, min
+	}
+	if sortedSet == nil || spec.offset < 0 {
+		return nil, nil
+	}
+	return sortedSet.Range(min, max, spec.offset, spec.count, spec.rev), nil
+}
+
+// 范围查询，ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func execZRange(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	spec, errReply := parseZRangeSpec(args[1:], true)
+	if errReply != nil {
+		return errReply
+	}
+	sortedSet, errReply2 := db.getAsSortedSet(key)
+	if errReply2 != nil {
+		return errReply2
+	}
+	elements, errReply := rangeSortedSet(sortedSet, spec)
+	if errReply != nil {
+		return errReply
+	}
+	return elementsToReply(elements, spec.withScores)
+}
+
+// 将旧的范围查询指令改写为 ZRANGE
+func makeZRangeExecutor(options ...string) ExecFunc {
+	return func(db *DB, args [][]byte) redis.Reply {
+		zrangeArgs := make([][]byte, 0, len(args)+len(options))
+		zrangeArgs = append(zrangeArgs, args[:3]...)
+		for _, option := range options {
+			zrangeArgs = append(zrangeArgs, []byte(option))
+		}
+		zrangeArgs = append(zrangeArgs, args[3:]...)
+		return execZRange(db, zrangeArgs)
+	}
+}
+
+// 目标 key 为写 key，源 key 为读 key
+func prepareZRangeStore(args [][]byte) ([]string, []string) {
+	dest := string(args[0])
+	src := string(args[1])
+	return []string{dest}, []string{src}
+}
+
+// 范围查询并保存到目标 key，ZRANGESTORE dst src min max [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+func execZRangeStore(db *DB, args [][]byte) redis.Reply {
+	dest := string(args[0])
+	src := string(args[1])
+	spec, errReply := parseZRangeSpec(args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+	sortedSet, errReply2 := db.getAsSortedSet(src)
+	if errReply2 != nil {
+		return errReply2
+	}
+	elements, errReply := rangeSortedSet(sortedSet, spec)
+	if errReply != nil {
+		return errReply
+	}
+
+	if len(elements) == 0 {
+		if db.Removes(dest) > 0 {
+			db.notify(notifyGeneric, "del", dest)
+		}
+	} else {
+		result := SortedSet.Make()
+		for _, element := range elements {
+			result.Add(element.Member, element.Score)
+		}
+		db.PutEntity(dest, &database.DataEntity{Data: result})
+		db.Persist(dest)
+		db.notify(notifyZSet, "zrangestore", dest)
+	}
+	db.addAof(utils.ToCmdLine3("zrangestore", args...))
+	return reply.MakeIntReply(int64(len(elements)))
+}
+
+/* ---------- ZPOPMIN ZPOPMAX ------------ */
+
+// 弹出分数最小或最大的元素，ZPOPMIN key [count]
+func execZPop(db *DB, args [][]byte, cmdName string, max bool) redis.Reply {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	key := string(args[0])
+	count := int64(1)
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive")
+		}
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil || count == 0 {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	if count > sortedSet.Len() {
+		count = sortedSet.Len()
+	}
+
+	var removed []*SortedSet.Element
+	if max {
+		removed = sortedSet.PopMax(int(count))
+	} else {
+		removed = sortedSet.PopMin(int(count))
+	}
+	db.addAof(utils.ToCmdLine3(cmdName, args...))
+	db.notify(notifyZSet, cmdName, key)
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return elementsToReply(removed, true)
+}
+
+func execZPopMin(db *DB, args [][]byte) redis.Reply {
+	return execZPop(db, args, "zpopmin", false)
+}
+
+func execZPopMax(db *DB, args [][]byte) redis.Reply {
+	return execZPop(db, args, "zpopmax", true)
+}
+
+/* ---------- ZREMRANGEBYRANK ZREMRANGEBYSCORE ZREMRANGEBYLEX ------------ */
+
+// 删除排名范围内的元素
+func execZRemRangeByRank(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	start, errReply := parseInt(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	stop, errReply := parseInt(args[2])
+	if errReply != nil {
+		return errReply
+	}
+
+	sortedSet, errReply2 := db.getAsSortedSet(key)
+	if errReply2 != nil {
+		return errReply2
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+	begin, end := convertRange(start, stop, sortedSet.Len())
+	if begin < 0 {
+		return reply.MakeIntReply(0)
+	}
+	removed := sortedSet.RemoveByRank(int64(begin), int64(end))
+	db.addAof(utils.ToCmdLine3("zremrangebyrank", args...))
+	if removed > 0 {
+		db.notify(notifyZSet, "zremrangebyrank", key)
+	}
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return reply.MakeIntReply(removed)
+}
+
+// 删除范围内的元素
+func execRemRange(db *DB, args [][]byte, cmdName string, parseBorder func(string) (SortedSet.Border, error)) redis.Reply {
+	key := string(args[0])
+	min, err := parseBorder(string(args[1]))
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+	max, err := parseBorder(string(args[2]))
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+	removed := sortedSet.RemoveRange(min, max)
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine3(cmdName, args...))
+		db.notify(notifyZSet, cmdName, key)
+	}
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return reply.MakeIntReply(removed)
+}
+
+func execZRemRangeByScore(db *DB, args [][]byte) redis.Reply {
+	return execRemRange(db, args, "zremrangebyscore", SortedSet.ParseScoreBorder)
+}
+
+func execZRemRangeByLex(db *DB, args [][]byte) redis.Reply {
+	return execRemRange(db, args, "zremrangebylex", SortedSet.ParseLexBorder)
+}
+
+/* ---------- ZUNION ZINTER ZDIFF ------------ */
+
+// 聚合方式
+const (
+	aggregateSum = iota
+	aggregateMin
+	aggregateMax
+)
+
+// 有序集合运算参数 [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+type zSetCalculateOptions struct {
+	keys       [][]byte
+	weights    []float64
+	aggregate  int
+	withScores bool
+}
+
+// 解析 numkeys key [key ...] 以及后面的选项，ZDIFF 不支持 WEIGHTS 和 AGGREGATE
+func parseZSetCalculateOptions(args [][]byte, op int, allowWithScores bool) (*zSetCalculateOptions, redis.Reply) {
+	numKeys, errReply := parseNumKeys(args)
+	if errReply != nil {
+		return nil, errReply
+	}
+	opts := &zSetCalculateOptions{
+		keys:      args[1 : numKeys+1],
+		aggregate: aggregateSum,
+	}
+	rest := args[numKeys+1:]
+	for i := 0; i < len(rest); i++ {
+		option := strings.ToUpper(string(rest[i]))
+		switch {
+		case option == "WEIGHTS" && op != setDiff:
+			if i+numKeys >= len(rest) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.weights = make([]float64, numKeys)
+			for j := range opts.weights {
+				weight, err := strconv.ParseFloat(string(rest[i+1+j]), 64)
+				if err != nil || math.IsNaN(weight) {
+					return nil, reply.MakeErrReply("ERR weight value is not a float")
+				}
+				opts.weights[j] = weight
+			}
+			i += numKeys
+		case option == "AGGREGATE" && op != setDiff:
+			if i+1 >= len(rest) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			switch strings.ToUpper(string(rest[i+1])) {
+			case "SUM":
+				opts.aggregate = aggregateSum
+			case "MIN":
+				opts.aggregate = aggregateMin
+			case "MAX":
+				opts.aggregate = aggregateMax
+			default:
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			i++
+		case option == "WITHSCORES" && allowWithScores:
+			opts.withScores = true
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+// 获取参与运算的有序集合，普通集合中元素的分数视为 1，key 不存在时为 nil
+func (db *DB) getZSetSources(keys [][]byte) ([]*SortedSet.SortedSet, reply.ErrorReply) {
+	sources := make([]*SortedSet.SortedSet, len(keys))
+	for i, key := range keys {
+		entity, exists := db.GetEntity(string(key))
+		if !exists {
+			continue
+		}
+		switch val := entity.Data.(type) {
+		case *SortedSet.SortedSet:
+			sources[i] = val
+		case *HashSet.Set:
+			sortedSet := SortedSet.Make()
+			val.ForEach(func(member string) bool {
+				sortedSet.Add(member, 1)
+				return true
+			})
+			sources[i] = sortedSet
+		default:
+			return nil, &reply.WrongTypeErrReply{}
+		}
+	}
+	return sources, nil
+}
+
+// 计算加权后的分数，inf * 0 的结果视为 0
+func weightedScore(score float64, weight float64) float64 {
+	result := score * weight
+	if math.IsNaN(result) {
+		return 0
+	}
+	return result
+}
+
+// 按聚合方式合并两个分数，inf + -inf 的结果视为 0
+func aggregateScore(aggregate int, a float64, b float64) float64 {
+	switch aggregate {
+	case aggregateMin:
+		return math.Min(a, b)
+	case aggregateMax:
+		return math.Max(a, b)
+	}
+	result := a + b
+	if math.IsNaN(result) {
+		return 0
+	}
+	return result
+}
+
+// 遍历有序集合的所有元素
+func forEachElement(sortedSet *SortedSet.SortedSet, consumer SortedSet.Consumer) {
+	sortedSet.ForEachByRank(0, sortedSet.Len(), false, consumer)
+}
+
+// 对有序集合进行运算
+func calculateZSets(op int, sources []*SortedSet.SortedSet, opts *zSetCalculateOptions) *SortedSet.SortedSet {
+	weight := func(i int) float64 {
+		if opts.weights == nil {
+			return 1
+		}
+		return opts.weights[i]
+	}
+
+	result := SortedSet.Make()
+	switch op {
+	case setUnion:
+		for i, src := range sources {
+			if src == nil {
+				continue
+			}
+			forEachElement(src, func(element *SortedSet.Element) bool {
+				score := weightedScore(element.Score, weight(i))
+				if old, exists := result.Get(element.Member); exists {
+					score = aggregateScore(opts.aggregate, old.Score, score)
+				}
+				result.Add(element.Member, score)
+				return true
+			})
+		}
+	case setIntersect:
+		for _, src := range sources {
+			if src == nil {
+				return result
+			}
+		}
+		forEachElement(sources[0], func(element *SortedSet.Element) bool {
+			score := weightedScore(element.Score, weight(0))
+			for i, src := range sources[1:] {
+				other, exists := src.Get(element.Member)
+				if !exists {
+					return true
+				}
+				score = aggregateScore(opts.aggregate, score, weightedScore(other.Score, weight(i+1)))
+			}
+			result.Add(element.Member, score)
+			return true
+		})
+	case setDiff:
+		if sources[0] == nil {
+			return result
+		}
+		forEachElement(sources[0], func(element *SortedSet.Element) bool {
+			for _, src := range sources[1:] {
+				if src == nil {
+					continue
+				}
+				if _, exists := src.Get(element.Member); exists {
+					return true
+				}
+			}
+			result.Add(element.Member, element.Score)
+			return true
+		})
+	}
+	return result
+}
+
+func execZSetCalculate(db *DB, op int, args [][]byte) redis.Reply {
+	opts, errReply := parseZSetCalculateOptions(args, op, true)
+	if errReply != nil {
+		return errReply
+	}
+	sources, errReply2 := db.getZSetSources(opts.keys)
+	if errReply2 != nil {
+		return errReply2
+	}
+	result := calculateZSets(op, sources, opts)
+	return elementsToReply(result.RangeByRank(0, result.Len(), false), opts.withScores)
+}
+
+// 将运算结果存储到 destination，返回结果的元素个数
+func execZSetCalculateStore(db *DB, op int, cmdName string, args [][]byte) redis.Reply {
+	dest := string(args[0])
+	opts, errReply := parseZSetCalculateOptions(args[1:], op, false)
+	if errReply != nil {
+		return errReply
+	}
+	sources, errReply2 := db.getZSetSources(opts.keys)
+	if errReply2 != nil {
+		return errReply2
+	}
+	result := calculateZSets(op, sources, opts)
+
+	if result.Len() == 0 {
+		if db.Removes(dest) > 0 {
+			db.notify(notifyGeneric, "del", dest)
+		}
+	} else {
+		db.PutEntity(dest, &database.DataEntity{Data: result})
+		db.Persist(dest)
+		db.notify(notifyZSet, cmdName, dest)
+	}
+	db.addAof(utils.ToCmdLine3(cmdName, args...))
+	return reply.MakeIntReply(result.Len())
+}
+
+// 并集，ZUNION numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func execZUnion(db *DB, args [][]byte) redis.Reply {
+	return execZSetCalculate(db, setUnion, args)
+}
+
+// 并集并存储
+func execZUnionStore(db *DB, args [][]byte) redis.Reply {
+	return execZSetCalculateStore(db, setUnion, "zunionstore", args)
+}
+
+// 交集，ZINTER numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func execZInter(db *DB, args [][]byte) redis.Reply {
+	return execZSetCalculate(db, setIntersect, args)
+}
+
+// 交集并存储
+func execZInterStore(db *DB, args [][]byte) redis.Reply {
+	return execZSetCalculateStore(db, setIntersect, "zinterstore", args)
+}
+
+// 差集，ZDIFF numkeys key [key ...] [WITHSCORES]
+func execZDiff(db *DB, args [][]byte) redis.Reply {
+	return execZSetCalculate(db, setDiff, args)
+}
+
+// 差集并存储
+func execZDiffStore(db *DB, args [][]byte) redis.Reply {
+	return execZSetCalculateStore(db, setDiff, "zdiffstore", args)
+}
+
+// destination numkeys key [key ...] 形式，第一个参数为写 key，其余 key 为读 key
+func prepareZSetCalculateStore(args [][]byte) ([]string, []string) {
+	dest := string(args[0])
+	_, keys := prepareNumKeys(args[1:])
+	return []string{dest}, keys
+}
+
+/* ---------- ZINTERCARD ------------ */
+
+// ZINTERCARD numkeys key [key ...] [LIMIT limit]
+func execZInterCard(db *DB, args [][]byte) redis.Reply {
+	numKeys, errReply := parseNumKeys(args)
+	if errReply != nil {
+		return errReply
+	}
+	limit := int64(0)
+	rest := args[numKeys+1:]
+	for i := 0; i < len(rest); i += 2 {
+		if strings.ToUpper(string(rest[i])) != "LIMIT" || i+1 >= len(rest) {
+			return reply.MakeSyntaxErrReply()
+		}
+		var err error
+		limit, err = strconv.ParseInt(string(rest[i+1]), 10, 64)
+		if err != nil || limit < 0 {
+			return reply.MakeErrReply("ERR LIMIT can't be negative")
+		}
+	}
+
+	sources, errReply2 := db.getZSetSources(args[1 : numKeys+1])
+	if errReply2 != nil {
+		return errReply2
+	}
+	result := calculateZSets(setIntersect, sources, &zSetCalculateOptions{aggregate: aggregateSum})
+	card := result.Len()
+	if limit > 0 && card > limit {
+		card = limit
+	}
+	return reply.MakeIntReply(card)
+}
+
+/* ---------- ZSCAN ------------ */
+
+// ZSCAN key cursor [MATCH pattern] [COUNT count]
+func execZScan(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	cursor, errReply := parseCursor(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+
+	sortedSet, err := db.getAsSortedSet(key)
+	if err != nil {
+		return err
+	}
+	if sortedSet == nil {
+		return makeScanReply(0, [][]byte{})
+	}
+	members, next := sortedSet.Scan(cursor, opts.count)
+	result := make([][]byte, 0, len(members)*2)
+	for _, member := range members {
+		if !opts.match(member) {
+			continue
+		}
+		if element, exists := sortedSet.Get(member); exists {
+			result = append(result, []byte(member), []byte(formatScore(element.Score)))
+		}
+	}
+	return makeScanReply(next, result)
+}
+
+func init() {
+	RegisterCommand("ZAdd", execZAdd, writeFirstKey, undoZAdd, -4, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatSortedSet|acl.CatFast)
+	RegisterCommand("ZRem", execZRem, writeFirstKey, undoZRem, -3, flagWrite|flagFast, 1, 1, 1, acl.CatWrite|acl.CatSortedSet|acl.CatFast)
+	RegisterCommand("ZIncrBy", execZIncrBy, writeFirstKey, undoZIncr, 4, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatSortedSet|acl.CatFast)
+	RegisterCommand("ZScore", execZScore, readFirstKey, nil, 3, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatSortedSet|acl.CatFast)
+	RegisterCommand("ZMScore", execZMScore, readFirstKey, nil, -3, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatSortedSet|acl.CatFast)
+	RegisterCommand("ZCard", execZCard, readFirstKey, nil, 2, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatSortedSet|acl.CatFast)
+	RegisterCommand("ZCount", execZCount, readFirstKey, nil, 4, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatSortedSet|acl.CatFast)
+	RegisterCommand("ZLexCount", execZLexCount, readFirstKey, nil, 4, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatSortedSet|acl.CatFast)
+	RegisterCommand("ZRank", execZRank, readFirstKey, nil, -3, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatSortedSet|acl.CatFast)
+	RegisterCommand("ZRevRank", execZRevRank, readFirstKey, nil, -3, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatSortedSet|acl.CatFast)
+	RegisterCommand("ZRange", execZRange, readFirstKey, nil, -4, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZRevRange", makeZRangeExecutor("REV"), readFirstKey, nil, -4, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZRangeByScore", makeZRangeExecutor("BYSCORE"), readFirstKey, nil, -4, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZRevRangeByScore", makeZRangeExecutor("BYSCORE", "REV"), readFirstKey, nil, -4, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZRangeByLex", makeZRangeExecutor("BYLEX"), readFirstKey, nil, -4, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZRevRangeByLex", makeZRangeExecutor("BYLEX", "REV"), readFirstKey, nil, -4, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZRangeStore", execZRangeStore, prepareZRangeStore, rollbackFirstKey, -5, flagWrite|flagDenyOOM, 1, 2, 1, acl.CatWrite|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZPopMin", execZPopMin, writeFirstKey, rollbackFirstKey, -2, flagWrite|flagFast, 1, 1, 1, acl.CatWrite|acl.CatSortedSet|acl.CatFast)
+	RegisterCommand("ZPopMax", execZPopMax, writeFirstKey, rollbackFirstKey, -2, flagWrite|flagFast, 1, 1, 1, acl.CatWrite|acl.CatSortedSet|acl.CatFast)
+	RegisterCommand("ZRemRangeByRank", execZRemRangeByRank, writeFirstKey, rollbackFirstKey, 4, flagWrite, 1, 1, 1, acl.CatWrite|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZRemRangeByScore", execZRemRangeByScore, writeFirstKey, rollbackFirstKey, 4, flagWrite, 1, 1, 1, acl.CatWrite|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZRemRangeByLex", execZRemRangeByLex, writeFirstKey, rollbackFirstKey, 4, flagWrite, 1, 1, 1, acl.CatWrite|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZUnion", execZUnion, prepareNumKeys, nil, -3, flagReadOnly|flagMovableKeys, 0, 0, 0, acl.CatRead|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZUnionStore", execZUnionStore, prepareZSetCalculateStore, rollbackFirstKey, -4, flagWrite|flagDenyOOM|flagMovableKeys, 1, 1, 1, acl.CatWrite|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZInter", execZInter, prepareNumKeys, nil, -3, flagReadOnly|flagMovableKeys, 0, 0, 0, acl.CatRead|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZInterStore", execZInterStore, prepareZSetCalculateStore, rollbackFirstKey, -4, flagWrite|flagDenyOOM|flagMovableKeys, 1, 1, 1, acl.CatWrite|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZDiff", execZDiff, prepareNumKeys, nil, -3, flagReadOnly|flagMovableKeys, 0, 0, 0, acl.CatRead|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZDiffStore", execZDiffStore, prepareZSetCalculateStore, rollbackFirstKey, -4, flagWrite|flagDenyOOM|flagMovableKeys, 1, 1, 1, acl.CatWrite|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZInterCard", execZInterCard, prepareNumKeys, nil, -3, flagReadOnly|flagMovableKeys, 0, 0, 0, acl.CatRead|acl.CatSortedSet|acl.CatSlow)
+	RegisterCommand("ZScan", execZScan, readFirstKey, nil, -3, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatSortedSet|acl.CatSlow)
+}
@@ -0,0 +1,155 @@
+// 测试有序集合指令
+
+package database
+
+import (
+	"testing"
+
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+func TestZAdd(t *testing.T) {
+	db := MakeDB()
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zadd", "z", "1", "a", "2", "b")), 2)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zadd", "z", "CH", "3", "a", "3", "c")), 2)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zadd", "z", "NX", "10", "a", "4", "d")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zadd", "z", "XX", "CH", "5", "d", "5", "e")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zadd", "z", "GT", "CH", "1", "a", "6", "b")), 1)
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("zadd", "z", "INCR", "1.5", "a")), "4.5")
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("zadd", "z", "LT", "INCR", "1", "a")), reply.MakeNullBulkReply())
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("zadd", "z", "NX", "XX", "1", "a")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("zadd", "z", "NX", "GT", "1", "a")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("zadd", "z", "INCR", "1", "a", "2", "b")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("zadd", "z", "nan", "a")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("zadd", "z", "1", "a", "2")))
+
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zcard", "z")), 4)
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("zscore", "z", "b")), "6")
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("zmscore", "z", "d", "none")),
+		reply.MakeMultiRawReply([]redis.Reply{reply.MakeBulkReply([]byte("5")), reply.MakeNullBulkReply()}))
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("zincrby", "z", "-10", "c")), "-7")
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zrem", "z", "c", "none")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zadd", "none", "XX", "1", "a")), 0)
+	if _, exists := db.GetEntity("none"); exists {
+		t.Error("key should not be created")
+	}
+}
+
+func TestZRankAndCount(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("zadd", "z", "1", "a", "2", "b", "3", "c", "+inf", "d"))
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zrank", "z", "b")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zrevrank", "z", "b")), 2)
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("zrank", "z", "none")), reply.MakeNullBulkReply())
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("zrank", "z", "d", "WITHSCORE")),
+		reply.MakeMultiRawReply([]redis.Reply{reply.MakeIntReply(3), reply.MakeBulkReply([]byte("inf"))}))
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zcount", "z", "(1", "3")), 2)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zcount", "z", "-inf", "+inf")), 4)
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("zcount", "z", "a", "3")))
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zlexcount", "z", "-", "+")), 4)
+}
+
+func TestZRange(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("zadd", "z", "1", "a", "2", "b", "3", "c", "4", "d"))
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zrange", "z", "1", "-1")), "b", "c", "d")
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zrange", "z", "0", "1", "REV", "WITHSCORES")), "d", "4", "c", "3")
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zrange", "z", "(1", "3", "BYSCORE")), "b", "c")
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zrange", "z", "+inf", "-inf", "BYSCORE", "REV", "LIMIT", "1", "2")), "c", "b")
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zrevrangebyscore", "z", "3", "2")), "c", "b")
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zrevrange", "z", "0", "0")), "d")
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("zrange", "z", "0", "1", "LIMIT", "0", "1")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("zrange", "z", "-", "+", "BYLEX", "WITHSCORES")))
+
+	db.Exec(nil, utils.ToCmdLine("zadd", "lex", "0", "a", "0", "b", "0", "c", "0", "d"))
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zrange", "lex", "[b", "(d", "BYLEX")), "b", "c")
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zrange", "lex", "+", "-", "BYLEX", "REV", "LIMIT", "0", "2")), "d", "c")
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zrangebylex", "lex", "-", "[a")), "a")
+
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zrangestore", "dst", "z", "2", "4", "BYSCORE")), 3)
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zrange", "dst", "0", "-1", "WITHSCORES")), "b", "2", "c", "3", "d", "4")
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zrangestore", "dst", "z", "10", "20", "BYSCORE")), 0)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zcard", "dst")), 0)
+}
+
+func TestZPopAndRemRange(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("zadd", "z", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e", "6", "f"))
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zpopmin", "z")), "a", "1")
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zpopmax", "z", "2")), "f", "6", "e", "5")
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zremrangebyrank", "z", "0", "0")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zremrangebyscore", "z", "(3", "+inf")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zremrangebylex", "z", "-", "+")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zcard", "z")), 0)
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("zpopmin", "z")), reply.MakeEmptyMultiBulkReply())
+}
+
+func TestZSetUndo(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("zadd", "z", "1", "a", "2", "b"))
+	for _, cmdLine := range []CmdLine{
+		utils.ToCmdLine("zadd", "z", "CH", "5", "a", "3", "c"),
+		utils.ToCmdLine("zadd", "z", "INCR", "1", "b"),
+		utils.ToCmdLine("zincrby", "z", "1", "c"),
+		utils.ToCmdLine("zrem", "z", "a", "b"),
+		utils.ToCmdLine("zpopmax", "z", "5"),
+		utils.ToCmdLine("zremrangebyscore", "z", "-inf", "1"),
+		utils.ToCmdLine("zrangestore", "z", "none", "0", "-1"),
+	} {
+		undo := db.GetUndoLogs(cmdLine)
+		db.Exec(nil, cmdLine)
+		for _, undoCmdLine := range undo {
+			db.execWithLock(undoCmdLine)
+		}
+		assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zrange", "z", "0", "-1", "WITHSCORES")), "a", "1", "b", "2")
+	}
+}
+
+func TestZSetCalculate(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("zadd", "z1", "1", "a", "2", "b", "3", "c"))
+	db.Exec(nil, utils.ToCmdLine("zadd", "z2", "10", "b", "20", "c", "30", "d"))
+	db.Exec(nil, utils.ToCmdLine("sadd", "s", "c", "d"))
+
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zunion", "2", "z1", "z2", "WITHSCORES")),
+		"a", "1", "b", "12", "c", "23", "d", "30")
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zunion", "2", "z1", "z2", "WEIGHTS", "2", "0.5", "AGGREGATE", "MAX", "WITHSCORES")),
+		"a", "2", "b", "5", "c", "10", "d", "15")
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zinter", "3", "z1", "z2", "s", "AGGREGATE", "MIN", "WITHSCORES")),
+		"c", "1")
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zinter", "2", "z1", "none")))
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zdiff", "3", "z1", "none", "s", "WITHSCORES")), "a", "1", "b", "2")
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("zdiff", "2", "z1", "z2", "WEIGHTS", "1", "1")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("zunion", "2", "z1", "z2", "WEIGHTS", "1")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("zunion", "2", "z1", "z2", "AGGREGATE", "AVG")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("zunion", "3", "z1", "z2")))
+
+	db.Exec(nil, utils.ToCmdLine("set", "str", "v"))
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("zunion", "2", "z1", "str")), &reply.WrongTypeErrReply{})
+
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zunionstore", "dst", "2", "z1", "z2")), 4)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zinterstore", "dst", "2", "dst", "z1", "WEIGHTS", "1", "-1")), 3)
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zrange", "dst", "0", "-1", "WITHSCORES")), "a", "0", "b", "10", "c", "20")
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("zinterstore", "dst", "1", "z1", "WITHSCORES")))
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zdiffstore", "dst", "2", "z1", "z1")), 0)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zcard", "dst")), 0)
+
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zintercard", "2", "z1", "z2")), 2)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("zintercard", "2", "z1", "z2", "LIMIT", "1")), 1)
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("zintercard", "2", "z1", "z2", "LIMIT", "-1")))
+}
+
+func TestZSetCalculateStoreUndo(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("zadd", "z", "1", "a", "2", "b"))
+	db.Exec(nil, utils.ToCmdLine("zadd", "other", "5", "c"))
+	cmdLine := utils.ToCmdLine("zunionstore", "z", "2", "z", "other", "AGGREGATE", "MAX")
+	undo := db.GetUndoLogs(cmdLine)
+	assertInt(t, db.Exec(nil, cmdLine), 3)
+	for _, undoCmdLine := range undo {
+		db.execWithLock(undoCmdLine)
+	}
+	assertMultiBulk(t, db.Exec(nil, utils.ToCmdLine("zrange", "z", "0", "-1", "WITHSCORES")), "a", "1", "b", "2")
+}
@@ -0,0 +1,629 @@
+// 字符串指令
+
+package database
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"ljr-redis/acl"
+	"ljr-redis/interface/database"
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+// 字符串最大长度 512MB
+const maxStringLen = 512 * 1024 * 1024
+
+// 获取字符串数据，key 不存在时返回 nil
+func (db *DB) getAsString(key string) ([]byte, reply.ErrorReply) {
+	entity, ok := db.GetEntity(key)
+	if !ok {
+		return nil, nil
+	}
+	bytes, ok := entity.Data.([]byte)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return bytes, nil
+}
+
+// 生成带过期时间的 set 指令，用于 aof
+func makeSetWithTTLCmd(key string, value []byte, expireAt time.Time) CmdLine {
+	return utils.ToCmdLine3("set", []byte(key), value,
+		[]byte("PXAT"), []byte(strconv.FormatInt(expireAt.UnixMilli(), 10)))
+}
+
+// 解析过期时间参数 EX PX EXAT PXAT
+func parseExpireTime(cmdName string, unit string, raw []byte) (time.Time, redis.Reply) {
+	n, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return time.Time{}, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if n <= 0 {
+		return time.Time{}, reply.MakeErrReply("ERR invalid expire time in '" + cmdName + "' command")
+	}
+	switch unit {
+	case "EX":
+		if n > math.MaxInt64/int64(time.Second) {
+			return time.Time{}, reply.MakeErrReply("ERR invalid expire time in '" + cmdName + "' command")
+		}
+		return time.Now().Add(time.Duration(n) * time.Second), nil
+	case "PX":
+		if n > math.MaxInt64/int64(time.Millisecond) {
+			return time.Time{}, reply.MakeErrReply("ERR invalid expire time in '" + cmdName + "' command")
+		}
+		return time.Now().Add(time.Duration(n) * time.Millisecond), nil
+	case "EXAT":
+		return time.Unix(n, 0), nil
+	default: // PXAT
+		return time.UnixMilli(n), nil
+	}
+}
+
+/* ---------- GET ------------ */
+
+// 获取字符串
+func execGet(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	bytes, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	if bytes == nil {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply(bytes)
+}
+
+/* ---------- SET ------------ */
+
+const (
+	upsertPolicy = iota // 默认，存在则更新，不存在则插入
+	insertPolicy        // NX
+	updatePolicy        // XX
+)
+
+// SET key value [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT timestamp|PXAT milliseconds-timestamp|KEEPTTL]
+func execSet(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	value := args[1]
+	policy := upsertPolicy
+	returnOld := false
+	keepTTL := false
+	hasTTL := false
+	var expireAt time.Time
+
+	// 解析参数
+	for i := 2; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		switch arg {
+		case "NX":
+			if policy == updatePolicy {
+				return reply.MakeSyntaxErrReply()
+			}
+			policy = insertPolicy
+		case "XX":
+			if policy == insertPolicy {
+				return reply.MakeSyntaxErrReply()
+			}
+			policy = updatePolicy
+		case "GET":
+			returnOld = true
+		case "KEEPTTL":
+			if hasTTL {
+				return reply.MakeSyntaxErrReply()
+			}
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasTTL || keepTTL || i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			var errReply redis.Reply
+			expireAt, errReply = parseExpireTime("set", arg, args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			hasTTL = true
+			i++
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	var old []byte
+	if returnOld {
+		var errReply reply.ErrorReply
+		old, errReply = db.getAsString(key)
+		if errReply != nil {
+			return errReply
+		}
+	}
+
+	// 检查 NX XX 条件，GetEntity 会顺便清理已过期的 key
+	ok := true
+	if policy != upsertPolicy {
+		_, exists := db.GetEntity(key)
+		ok = (policy == insertPolicy) != exists
+	}
+
+	if ok {
+		db.PutEntity(key, &database.DataEntity{Data: value})
+		if hasTTL {
+			db.Expire(key, expireAt)
+			db.addAof(makeSetWithTTLCmd(key, value, expireAt))
+		} else if keepTTL {
+			db.addAof(utils.ToCmdLine3("set", args[0], value, []byte("KEEPTTL")))
+		} else {
+			db.Persist(key)
+			db.addAof(utils.ToCmdLine3("set", args[0], value))
+		}
+		db.notify(notifyString, "set", key)
+		if hasTTL {
+			db.notify(notifyGeneric, "expire", key)
+		}
+	}
+
+	if returnOld {
+		if old == nil {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply(old)
+	}
+	if !ok {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeOkReply()
+}
+
+// key 不存在时设置
+func execSetNX(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	value := args[1]
+	if _, exists := db.GetEntity(key); exists {
+		return reply.MakeIntReply(0)
+	}
+	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.addAof(utils.ToCmdLine3("setnx", args...))
+	db.notify(notifyString, "set", key)
+	return reply.MakeIntReply(1)
+}
+
+// 设置字符串和过期时间 SETEX key seconds value
+func execSetEX(db *DB, args [][]byte) redis.Reply {
+	return setWithTTL(db, "setex", "EX", args)
+}
+
+// 设置字符串和过期时间 PSETEX key milliseconds value
+func execPSetEX(db *DB, args [][]byte) redis.Reply {
+	return setWithTTL(db, "psetex", "PX", args)
+}
+
+func setWithTTL(db *DB, cmdName string, unit string, args [][]byte) redis.Reply {
+	key := string(args[0])
+	value := args[2]
+	expireAt, errReply := parseExpireTime(cmdName, unit, args[1])
+	if errReply != nil {
+		return errReply
+	}
+
+	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.Expire(key, expireAt)
+	db.addAof(makeSetWithTTLCmd(key, value, expireAt))
+	db.notify(notifyString, "set", key)
+	db.notify(notifyGeneric, "expire", key)
+	return reply.MakeOkReply()
+}
+
+/* ---------- MSET MGET ------------ */
+
+func prepareMSet(args [][]byte) ([]string, []string) {
+	size := len(args) / 2
+	keys := make([]string, size)
+	for i := 0; i < size; i++ {
+		keys[i] = string(args[2*i])
+	}
+	return keys, nil
+}
+
+func undoMSet(db *DB, args [][]byte) []CmdLine {
+	writeKeys, _ := prepareMSet(args)
+	return rollbackGivenKeys(db, writeKeys...)
+}
+
+// 批量设置 MSET key value [key value ...]
+func execMSet(db *DB, args [][]byte) redis.Reply {
+	if len(args)%2 != 0 {
+		return reply.MakeArgNumErrReply("mset")
+	}
+
+	size := len(args) / 2
+	for i := 0; i < size; i++ {
+		key := string(args[2*i])
+		value := args[2*i+1]
+		db.PutEntity(key, &database.DataEntity{Data: value})
+		db.Persist(key)
+	}
+	db.addAof(utils.ToCmdLine3("mset", args...))
+	for i := 0; i < size; i++ {
+		db.notify(notifyString, "set", string(args[2*i]))
+	}
+	return reply.MakeOkReply()
+}
+
+// 所有 key 都不存在时批量设置
+func execMSetNX(db *DB, args [][]byte) redis.Reply {
+	if len(args)%2 != 0 {
+		return reply.MakeArgNumErrReply("msetnx")
+	}
+
+	size := len(args) / 2
+	for i := 0; i < size; i++ {
+		key := string(args[2*i])
+		if _, exists := db.GetEntity(key); exists {
+			return reply.MakeIntReply(0)
+		}
+	}
+
+	for i := 0; i < size; i++ {
+		key := string(args[2*i])
+		value := args[2*i+1]
+		db.PutEntity(key, &database.DataEntity{Data: value})
+	}
+	db.addAof(utils.ToCmdLine3("msetnx", args...))
+	for i := 0; i < size; i++ {
+		db.notify(notifyString, "set", string(args[2*i]))
+	}
+	return reply.MakeIntReply(1)
+}
+
+// 批量获取，不存在或类型错误的 key 返回 nil
+func execMGet(db *DB, args [][]byte) redis.Reply {
+	result := make([][]byte, len(args))
+	for i, k := range args {
+		bytes, err := db.getAsString(string(k))
+		if err != nil {
+			result[i] = nil
+			continue
+		}
+		result[i] = bytes
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+/* ---------- GETSET GETDEL GETEX ------------ */
+
+// 设置新值并返回旧值
+func execGetSet(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	value := args[1]
+
+	old, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+
+	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.Persist(key)
+	db.addAof(utils.ToCmdLine3("set", args...))
+	db.notify(notifyString, "set", key)
+	if old == nil {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply(old)
+}
+
+// 获取并删除
+func execGetDel(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+
+	old, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return reply.MakeNullBulkReply()
+	}
+
+	db.Remove(key)
+	db.addAof(utils.ToCmdLine3("del", args[0]))
+	db.notify(notifyGeneric, "del", key)
+	return reply.MakeBulkReply(old)
+}
+
+// GETEX key [EX seconds|PX milliseconds|EXAT timestamp|PXAT milliseconds-timestamp|PERSIST]
+func execGetEX(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	hasTTL := false
+	persist := false
+	var expireAt time.Time
+
+	for i := 1; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		switch arg {
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasTTL || persist || i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			var errReply redis.Reply
+			expireAt, errReply = parseExpireTime("getex", arg, args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			hasTTL = true
+			i++
+		case "PERSIST":
+			if hasTTL {
+				return reply.MakeSyntaxErrReply()
+			}
+			persist = true
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	bytes, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	if bytes == nil {
+		return reply.MakeNullBulkReply()
+	}
+
+	if hasTTL {
+		db.Expire(key, expireAt)
+		db.addAof(makeSetWithTTLCmd(key, bytes, expireAt))
+		db.notify(notifyGeneric, "expire", key)
+	} else if persist {
+		_, hadTTL := db.ttlMap.Get(key)
+		db.Persist(key)
+		db.addAof(utils.ToCmdLine3("set", args[0], bytes))
+		if hadTTL {
+			db.notify(notifyGeneric, "persist", key)
+		}
+	}
+	return reply.MakeBulkReply(bytes)
+}
+
+/* ---------- APPEND STRLEN SETRANGE GETRANGE ------------ */
+
+// 追加字符串，返回追加后的长度
+func execAppend(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	bytes, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	if len(bytes)+len(args[1]) > maxStringLen {
+		return reply.MakeErrReply("ERR string exceeds maximum allowed size (512MB)")
+	}
+
+	// 复制一份，避免修改回滚日志引用的旧数据
+	value := make([]byte, 0, len(bytes)+len(args[1]))
+	value = append(value, bytes...)
+	value = append(value, args[1]...)
+	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.addAof(utils.ToCmdLine3("append", args...))
+	db.notify(notifyString, "append", key)
+	return reply.MakeIntReply(int64(len(value)))
+}
+
+// 字符串长度
+func execStrLen(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	bytes, err := db.getAsString(key)
+	if err != nil {
+		return err
+	}
+	return reply.MakeIntReply(int64(len(bytes)))
+}
+
+// SETRANGE key offset value 从 offset 开始覆盖，不足部分补 0
+func execSetRange(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	offset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if offset < 0 {
+		return reply.MakeErrReply("ERR offset is out of range")
+	}
+	value := args[2]
+
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	if len(value) == 0 {
+		// 不修改数据，也不创建 key
+		return reply.MakeIntReply(int64(len(bytes)))
+	}
+	if offset+int64(len(value)) > maxStringLen {
+		return reply.MakeErrReply("ERR string exceeds maximum allowed size (512MB)")
+	}
+
+	size := len(bytes)
+	if end := int(offset) + len(value); end > size {
+		size = end
+	}
+	result := make([]byte, size)
+	copy(result, bytes)
+	copy(result[offset:], value)
+
+	db.PutEntity(key, &database.DataEntity{Data: result})
+	db.addAof(utils.ToCmdLine3("setrange", args...))
+	db.notify(notifyString, "setrange", key)
+	return reply.MakeIntReply(int64(len(result)))
+}
+
+// GETRANGE key start end 支持负数索引
+func execGetRange(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	end, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	size := int64(len(bytes))
+	if start < 0 && end < 0 && start > end {
+		return reply.MakeBulkReply([]byte{})
+	}
+	if start < 0 {
+		start = size + start
+	}
+	if end < 0 {
+		end = size + end
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if start > end || size == 0 {
+		return reply.MakeBulkReply([]byte{})
+	}
+	return reply.MakeBulkReply(bytes[start : end+1])
+}
+
+/* ---------- INCR DECR ------------ */
+
+// 在原值上增加 delta，key 不存在时视为 0
+func incrBy(db *DB, key string, delta int64) redis.Reply {
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	var val int64
+	if bytes != nil {
+		var err error
+		val, err = strconv.ParseInt(string(bytes), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+	}
+	if (delta > 0 && val > math.MaxInt64-delta) || (delta < 0 && val < math.MinInt64-delta) {
+		return reply.MakeErrReply("ERR increment or decrement would overflow")
+	}
+
+	val += delta
+	db.PutEntity(key, &database.DataEntity{
+		Data: []byte(strconv.FormatInt(val, 10)),
+	})
+	db.addAof(utils.ToCmdLine2("incrby", key, strconv.FormatInt(delta, 10)))
+	db.notify(notifyString, "incrby", key)
+	return reply.MakeIntReply(val)
+}
+
+// 解析增量参数
+func parseDelta(raw []byte) (int64, redis.Reply) {
+	delta, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	return delta, nil
+}
+
+// 加一
+func execIncr(db *DB, args [][]byte) redis.Reply {
+	return incrBy(db, string(args[0]), 1)
+}
+
+// 减一
+func execDecr(db *DB, args [][]byte) redis.Reply {
+	return incrBy(db, string(args[0]), -1)
+}
+
+// 增加 delta
+func execIncrBy(db *DB, args [][]byte) redis.Reply {
+	delta, errReply := parseDelta(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	return incrBy(db, string(args[0]), delta)
+}
+
+// 减少 delta
+func execDecrBy(db *DB, args [][]byte) redis.Reply {
+	delta, errReply := parseDelta(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if delta == math.MinInt64 {
+		return reply.MakeErrReply("ERR decrement would overflow")
+	}
+	return incrBy(db, string(args[0]), -delta)
+}
+
+// 增加浮点数 delta
+func execIncrByFloat(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	delta, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return reply.MakeErrReply("ERR value is not a valid float")
+	}
+
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	var val float64
+	if bytes != nil {
+		val, err = strconv.ParseFloat(string(bytes), 64)
+		if err != nil || math.IsNaN(val) || math.IsInf(val, 0) {
+			return reply.MakeErrReply("ERR value is not a valid float")
+		}
+	}
+
+	val += delta
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return reply.MakeErrReply("ERR increment would produce NaN or Infinity")
+	}
+
+	result := []byte(strconv.FormatFloat(val, 'f', -1, 64))
+	db.PutEntity(key, &database.DataEntity{Data: result})
+	// 浮点数运算结果与平台相关，aof 中直接记录结果
+	db.addAof(utils.ToCmdLine3("set", args[0], result, []byte("KEEPTTL")))
+	db.notify(notifyString, "incrbyfloat", key)
+	return reply.MakeBulkReply(result)
+}
+
+func init() {
+	RegisterCommand("Set", execSet, writeFirstKey, rollbackFirstKey, -3, flagWrite|flagDenyOOM, 1, 1, 1, acl.CatWrite|acl.CatString|acl.CatSlow)
+	RegisterCommand("SetNx", execSetNX, writeFirstKey, rollbackFirstKey, 3, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatString|acl.CatFast)
+	RegisterCommand("SetEX", execSetEX, writeFirstKey, rollbackFirstKey, 4, flagWrite|flagDenyOOM, 1, 1, 1, acl.CatWrite|acl.CatString|acl.CatSlow)
+	RegisterCommand("PSetEX", execPSetEX, writeFirstKey, rollbackFirstKey, 4, flagWrite|flagDenyOOM, 1, 1, 1, acl.CatWrite|acl.CatString|acl.CatSlow)
+	RegisterCommand("MSet", execMSet, prepareMSet, undoMSet, -3, flagWrite|flagDenyOOM, 1, -1, 2, acl.CatWrite|acl.CatString|acl.CatSlow)
+	RegisterCommand("MSetNX", execMSetNX, prepareMSet, undoMSet, -3, flagWrite|flagDenyOOM, 1, -1, 2, acl.CatWrite|acl.CatString|acl.CatSlow)
+	RegisterCommand("MGet", execMGet, readAllKeys, nil, -2, flagReadOnly|flagFast, 1, -1, 1, acl.CatRead|acl.CatString|acl.CatFast)
+	RegisterCommand("Get", execGet, readFirstKey, nil, 2, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatString|acl.CatFast)
+	RegisterCommand("GetSet", execGetSet, writeFirstKey, rollbackFirstKey, 3, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatString|acl.CatFast)
+	RegisterCommand("GetDel", execGetDel, writeFirstKey, rollbackFirstKey, 2, flagWrite|flagFast, 1, 1, 1, acl.CatWrite|acl.CatString|acl.CatFast)
+	RegisterCommand("GetEX", execGetEX, writeFirstKey, rollbackFirstKey, -2, flagWrite|flagFast, 1, 1, 1, acl.CatWrite|acl.CatString|acl.CatFast)
+	RegisterCommand("Append", execAppend, writeFirstKey, rollbackFirstKey, 3, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatString|acl.CatFast)
+	RegisterCommand("StrLen", execStrLen, readFirstKey, nil, 2, flagReadOnly|flagFast, 1, 1, 1, acl.CatRead|acl.CatString|acl.CatFast)
+	RegisterCommand("SetRange", execSetRange, writeFirstKey, rollbackFirstKey, 4, flagWrite|flagDenyOOM, 1, 1, 1, acl.CatWrite|acl.CatString|acl.CatSlow)
+	RegisterCommand("GetRange", execGetRange, readFirstKey, nil, 4, flagReadOnly, 1, 1, 1, acl.CatRead|acl.CatString|acl.CatSlow)
+	RegisterCommand("Incr", execIncr, writeFirstKey, rollbackFirstKey, 2, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatString|acl.CatFast)
+	RegisterCommand("IncrBy", execIncrBy, writeFirstKey, rollbackFirstKey, 3, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatString|acl.CatFast)
+	RegisterCommand("IncrByFloat", execIncrByFloat, writeFirstKey, rollbackFirstKey, 3, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatString|acl.CatFast)
+	RegisterCommand("Decr", execDecr, writeFirstKey, rollbackFirstKey, 2, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatString|acl.CatFast)
+	RegisterCommand("DecrBy", execDecrBy, writeFirstKey, rollbackFirstKey, 3, flagWrite|flagDenyOOM|flagFast, 1, 1, 1, acl.CatWrite|acl.CatString|acl.CatFast)
+}
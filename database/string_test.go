@@ -0,0 +1,144 @@
+// 测试字符串指令
+
+package database
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/reply"
+)
+
+// 断言响应的 RESP 编码
+func assertReply(t *testing.T, actual redis.Reply, expected redis.Reply) {
+	t.Helper()
+	if string(actual.ToBytes()) != string(expected.ToBytes()) {
+		t.Errorf("expected %q, actually %q", expected.ToBytes(), actual.ToBytes())
+	}
+}
+
+func assertBulk(t *testing.T, actual redis.Reply, expected string) {
+	t.Helper()
+	assertReply(t, actual, reply.MakeBulkReply([]byte(expected)))
+}
+
+func assertInt(t *testing.T, actual redis.Reply, expected int64) {
+	t.Helper()
+	assertReply(t, actual, reply.MakeIntReply(expected))
+}
+
+func assertErr(t *testing.T, actual redis.Reply) {
+	t.Helper()
+	if !reply.IsErrorReply(actual) {
+		t.Errorf("expected error, actually %q", actual.ToBytes())
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	db := MakeDB()
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("set", "a", "1")), reply.MakeOkReply())
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("get", "a")), "1")
+
+	// NX XX
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("set", "a", "2", "NX")), reply.MakeNullBulkReply())
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("set", "b", "2", "XX")), reply.MakeNullBulkReply())
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("set", "a", "2", "XX")), reply.MakeOkReply())
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("set", "a", "3", "GET")), "2")
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("set", "a", "3", "NX", "XX")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("set", "a", "3", "EX", "0")))
+
+	// 空字符串
+	db.Exec(nil, utils.ToCmdLine("set", "empty", ""))
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("get", "empty")), "")
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("get", "none")), reply.MakeNullBulkReply())
+}
+
+func TestSetTTL(t *testing.T) {
+	db := MakeDB()
+	past := strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10)
+	db.Exec(nil, utils.ToCmdLine("set", "a", "1", "PXAT", past))
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("get", "a")), reply.MakeNullBulkReply())
+
+	db.Exec(nil, utils.ToCmdLine("setex", "b", "100", "1"))
+	db.Exec(nil, utils.ToCmdLine("set", "b", "2", "KEEPTTL"))
+	if _, ok := db.ttlMap.Get("b"); !ok {
+		t.Error("KEEPTTL lost ttl")
+	}
+	db.Exec(nil, utils.ToCmdLine("set", "b", "3"))
+	if _, ok := db.ttlMap.Get("b"); ok {
+		t.Error("SET should clear ttl")
+	}
+}
+
+func TestMSetMGet(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("mset", "a", "1", "b", "2"))
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("mget", "a", "b", "c")),
+		reply.MakeMultiBulkReply([][]byte{[]byte("1"), []byte("2"), nil}))
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("msetnx", "c", "3", "a", "1")), 0)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("msetnx", "c", "3", "d", "4")), 1)
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("mset", "a", "1", "b")))
+}
+
+func TestGetRangeAndSetRange(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("set", "a", "Hello World"))
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("getrange", "a", "0", "4")), "Hello")
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("getrange", "a", "-5", "-1")), "World")
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("getrange", "a", "5", "2")), "")
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("getrange", "a", "0", "100")), "Hello World")
+
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("setrange", "a", "6", "Redis")), 11)
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("get", "a")), "Hello Redis")
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("setrange", "b", "2", "x")), 3)
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("get", "b")), "\x00\x00x")
+
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("append", "a", "!")), 12)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("strlen", "a")), 12)
+}
+
+func TestGetSetGetDel(t *testing.T) {
+	db := MakeDB()
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("getset", "a", "1")), reply.MakeNullBulkReply())
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("getset", "a", "2")), "1")
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("getdel", "a")), "2")
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("get", "a")), reply.MakeNullBulkReply())
+}
+
+func TestStringUndo(t *testing.T) {
+	db := MakeDB()
+	db.Exec(nil, utils.ToCmdLine("set", "a", "1"))
+	undo := db.GetUndoLogs(utils.ToCmdLine("set", "a", "2"))
+	db.Exec(nil, utils.ToCmdLine("set", "a", "2"))
+	for _, cmdLine := range undo {
+		db.execWithLock(cmdLine)
+	}
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("get", "a")), "1")
+
+	undo = db.GetUndoLogs(utils.ToCmdLine("set", "b", "2"))
+	db.Exec(nil, utils.ToCmdLine("set", "b", "2"))
+	for _, cmdLine := range undo {
+		db.execWithLock(cmdLine)
+	}
+	assertReply(t, db.Exec(nil, utils.ToCmdLine("get", "b")), reply.MakeNullBulkReply())
+}
+
+func TestIncr(t *testing.T) {
+	db := MakeDB()
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("incr", "a")), 1)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("incrby", "a", "10")), 11)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("decr", "a")), 10)
+	assertInt(t, db.Exec(nil, utils.ToCmdLine("decrby", "a", "20")), -10)
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("incrbyfloat", "a", "0.5")), "-9.5")
+
+	db.Exec(nil, utils.ToCmdLine("set", "max", "9223372036854775807"))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("incr", "max")))
+	assertBulk(t, db.Exec(nil, utils.ToCmdLine("get", "max")), "9223372036854775807")
+	db.Exec(nil, utils.ToCmdLine("set", "s", "abc"))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("incr", "s")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("incrbyfloat", "s", "1")))
+	assertErr(t, db.Exec(nil, utils.ToCmdLine("incrby", "a", "1.5")))
+}
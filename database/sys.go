@@ -4,11 +4,18 @@
 package database
 
 import (
-	"ljr-redis/config"
+	"strconv"
+	"strings"
+
+	"ljr-redis/acl"
 	"ljr-redis/interface/redis"
+	"ljr-redis/redis/connection"
 	"ljr-redis/redis/reply"
 )
 
+// HELLO 返回的服务器版本
+const serverVersion = "7.0.0"
+
 // Ping
 func Ping(db *DB, args [][]byte) redis.Reply {
 	if len(args) == 0 {
@@ -20,29 +27,103 @@ func Ping(db *DB, args [][]byte) redis.Reply {
 	}
 }
 
-// 认证
-func Auth(c redis.Connection, args [][]byte) redis.Reply {
-	if len(args) != 1 {
-		return reply.MakeErrReply("指令 auth 的参数个数错误")
+// 认证 AUTH [username] password
+func Auth(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) != 1 && len(args) != 2 {
+		return reply.MakeArgNumErrReply("auth")
 	}
-	if config.Properties.RequirePass == "" {
-		return reply.MakeErrReply("还没有设置密码")
+	username := acl.DefaultUser
+	passwd := string(args[len(args)-1])
+	if len(args) == 2 {
+		username = string(args[0])
+	} else if user := mdb.acl.Get(acl.DefaultUser); user != nil && user.NoPass() {
+		return reply.MakeErrReply("ERR AUTH <password> called without any password configured for the default user. " +
+			"Are you sure your configuration is correct?")
 	}
-	passwd := string(args[0])
-	c.SetPassword(passwd)
-	if config.Properties.RequirePass != passwd {
-		return reply.MakeErrReply("密码错误")
+	if !mdb.acl.Authenticate(username, passwd) {
+		mdb.acl.Log.Add(acl.ReasonAuth, aclContext(c), "AUTH", username, aclClientInfo(c))
+		return reply.MakeErrReply("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	c.SetUser(username)
+	return reply.MakeOkReply()
+}
+
+// 重放 AOF 等使用的内部连接，不需要认证和权限检查
+func isInternalConn(c redis.Connection) bool {
+	if c == nil {
+		return true
 	}
-	return &reply.OkReply{}
+	_, ok := c.(*connection.FakeConn)
+	return ok
 }
 
 // 是否认证
-// func isAuthenticated(c redis.Connection) bool {
-// 	if config.Properties.RequirePass == "" {
-// 		return true
-// 	}
-// 	return c.GetPassword() == config.Properties.RequirePass
-// }
+// default 用户不需要密码时，没有认证的连接自动以 default 用户认证
+func isAuthenticated(mdb *MultiDB, c redis.Connection) bool {
+	if isInternalConn(c) {
+		return true
+	}
+	if c.GetUser() == "" {
+		user := mdb.acl.Get(acl.DefaultUser)
+		if user == nil || !user.Enabled() || !user.NoPass() {
+			return false
+		}
+		c.SetUser(acl.DefaultUser)
+	}
+	return mdb.currentUser(c) != nil
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+// 只支持 RESP2，没有记录客户端名称，SETNAME 会被忽略
+func Hello(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) > 0 {
+		protover, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			return reply.MakeErrReply("ERR Protocol version is not an integer or out of range")
+		}
+		if protover != 2 {
+			return reply.MakeErrReply("NOPROTO unsupported protocol version")
+		}
+	}
+
+	var authArgs [][]byte
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				return reply.MakeErrReply("ERR Syntax error in HELLO option 'auth'")
+			}
+			authArgs = args[i+1 : i+3]
+			i += 2
+		case "SETNAME":
+			if i+1 >= len(args) {
+				return reply.MakeErrReply("ERR Syntax error in HELLO option 'setname'")
+			}
+			i++
+		default:
+			return reply.MakeErrReply("ERR Syntax error in HELLO option '" + string(args[i]) + "'")
+		}
+	}
+
+	if authArgs != nil {
+		if result := Auth(mdb, c, authArgs); reply.IsErrorReply(result) {
+			return result
+		}
+	} else if !isAuthenticated(mdb, c) {
+		return reply.MakeErrReply("NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client " +
+			"and select the RESP protocol version at the same time")
+	}
+
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkReply([]byte("server")), reply.MakeBulkReply([]byte("redis")),
+		reply.MakeBulkReply([]byte("version")), reply.MakeBulkReply([]byte(serverVersion)),
+		reply.MakeBulkReply([]byte("proto")), reply.MakeIntReply(2),
+		reply.MakeBulkReply([]byte("mode")), reply.MakeBulkReply([]byte("standalone")),
+		reply.MakeBulkReply([]byte("role")), reply.MakeBulkReply([]byte("master")),
+		reply.MakeBulkReply([]byte("modules")), reply.MakeEmptyMultiBulkReply(),
+	})
+}
 
 func noPrepare(args [][]byte) ([]string, []string) {
 	return nil, nil
@@ -50,5 +131,8 @@ func noPrepare(args [][]byte) ([]string, []string) {
 
 func init() {
 	// ping 参数个数大于 1
-	RegisterCommand("ping", Ping, noPrepare, nil, -1)
+	RegisterCommand("ping", Ping, noPrepare, nil, -1, flagFast, 0, 0, 0, acl.CatFast|acl.CatConnection)
+	registerSpecialCommand("auth", -2, flagNoScript|flagLoading|flagStale|flagFast, 0, 0, 0, acl.CatFast|acl.CatConnection)
+	registerSpecialCommand("hello", -1, flagNoScript|flagLoading|flagStale|flagFast, 0, 0, 0, acl.CatFast|acl.CatConnection)
+	registerSpecialCommand("quit", -1, flagNoScript|flagLoading|flagStale|flagFast, 0, 0, 0, acl.CatFast|acl.CatConnection)
 }
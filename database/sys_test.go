@@ -0,0 +1,66 @@
+// 测试认证
+
+package database
+
+import (
+	"testing"
+
+	"ljr-redis/config"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/connection"
+	"ljr-redis/redis/reply"
+)
+
+func TestAuth(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	conn := &connection.Connection{}
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("auth", "secret")))
+
+	config.Properties.RequirePass = "secret"
+	defer func() {
+		config.Properties.RequirePass = ""
+	}()
+	mdb = MakeBasicMultiDB()
+	conn = &connection.Connection{}
+
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), reply.MakeErrReply("NOAUTH Authentication required."))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("quit")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("auth", "wrong")),
+		reply.MakeErrReply("WRONGPASS invalid username-password pair or user is disabled."))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("auth", "admin", "secret")),
+		reply.MakeErrReply("WRONGPASS invalid username-password pair or user is disabled."))
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")))
+
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("auth", "default", "secret")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), reply.MakeNullBulkReply())
+
+	// 用户被删除后需要重新认证
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("acl", "setuser", "app", "on", ">pw", "allkeys", "+@all")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("auth", "app", "pw")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(connection.NewFakeConn(), utils.ToCmdLine("acl", "deluser", "app")), reply.MakeIntReply(1))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), reply.MakeErrReply("NOAUTH Authentication required."))
+
+	// 内部连接不需要认证
+	assertReply(t, mdb.Exec(connection.NewFakeConn(), utils.ToCmdLine("get", "a")), reply.MakeNullBulkReply())
+}
+
+func TestHello(t *testing.T) {
+	config.Properties.RequirePass = "secret"
+	defer func() {
+		config.Properties.RequirePass = ""
+	}()
+	mdb := MakeBasicMultiDB()
+	conn := &connection.Connection{}
+
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("hello")))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("hello", "3")), reply.MakeErrReply("NOPROTO unsupported protocol version"))
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("hello", "2", "auth", "default")))
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("hello", "2", "auth", "default", "wrong")))
+
+	result := mdb.Exec(conn, utils.ToCmdLine("hello", "2", "auth", "default", "secret", "setname", "app"))
+	raw, ok := result.(*reply.MultiRawReply)
+	if !ok || len(raw.Replies)%2 != 0 {
+		t.Fatalf("unexpected reply %q", result.ToBytes())
+	}
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), reply.MakeNullBulkReply())
+}
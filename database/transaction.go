@@ -1,12 +1,17 @@
 // 2021.12.11
-// 单机事务
+// 事务
+// 加入队列的指令记录执行时的数据库，EXEC 时按数据库编号的顺序对所有 key 上锁，可以在多个数据库中执行
 
 package database
 
 import (
+	"sort"
+	"strconv"
 	"strings"
 
+	"ljr-redis/acl"
 	"ljr-redis/interface/redis"
+	"ljr-redis/pubsub"
 	"ljr-redis/redis/reply"
 )
 
@@ -48,111 +53,388 @@ func (db *DB) GetUndoLogs(cmdLine [][]byte) []CmdLine {
 	return undo(db, cmdLine[1:])
 }
 
-// 执行复杂指令
-func execMulti(db *DB, conn redis.Connection) redis.Reply {
-	if !conn.InMultiState() {
-		return reply.MakeErrReply("ERR EXEC without MULTI")
-	}
-	defer conn.SetMultiState(false)
-	cmdLines := conn.GetQueuedCmdLine()
-	return db.ExecMulti(conn, conn.GetWatching(), cmdLines)
-}
-
 // Watch 设置 watching keys
 func Watch(db *DB, conn redis.Connection, args [][]byte) redis.Reply {
 	// 获取 watching 列表
 	watching := conn.GetWatching()
+	keys, ok := watching[db.index]
+	if !ok {
+		keys = make(map[string]uint32)
+		watching[db.index] = keys
+	}
 	// 获取参数
 	for _, bkey := range args {
 		// []byte 转成 string
 		key := string(bkey)
-		watching[key] = db.GetVersion(key)
+		keys[key] = db.GetVersion(key)
 	}
 	return reply.MakeOkReply()
 }
 
 // 判断 watching keys 是否改变
-func isWatchingChanged(db *DB, watching map[string]uint32) bool {
-	for key, ver := range watching {
-		currentVersion := db.GetVersion(key)
-		if ver != currentVersion {
-			// 改变了
-			return true
+func (mdb *MultiDB) isWatchingChanged(watching map[int]map[string]uint32) bool {
+	for dbIndex, keys := range watching {
+		db := mdb.dbSet[dbIndex]
+		for key, ver := range keys {
+			if ver != db.GetVersion(key) {
+				// 改变了
+				return true
+			}
 		}
 	}
 	// 没改变
 	return false
 }
 
-// 将指令加入待执行的复杂指令队列
-func EnqueueCmd(conn redis.Connection, cmdLine [][]byte) redis.Reply {
+// 可以在事务中执行的特殊指令，没有 executor，EXEC 时由 MultiDB 执行
+var txSpecialCommands = map[string]func(mdb *MultiDB, args [][]byte) redis.Reply{
+	"publish": func(mdb *MultiDB, args [][]byte) redis.Reply {
+		return pubsub.Publish(mdb.hub, args)
+	},
+	"spublish": func(mdb *MultiDB, args [][]byte) redis.Reply {
+		return pubsub.SPublish(mdb.hub, args)
+	},
+	"pubsub": func(mdb *MultiDB, args [][]byte) redis.Reply {
+		return pubsub.PubSub(mdb.hub, args)
+	},
+	"lastsave": LastSave,
+}
+
+// 是否不能在事务中执行
+// 订阅、WATCH 等标记了 no_multi 的指令以及管理指令不能加入队列
+// 阻塞指令可以加入队列，执行时不会阻塞
+func forbiddenInMulti(cmd *command) bool {
+	if cmd.flags&(flagNoMulti|flagAdmin) != 0 {
+		return true
+	}
+	_, special := txSpecialCommands[cmd.name]
+	return cmd.executor == nil && !special
+}
+
+// 将指令加入待执行的复杂指令队列，dbIndex 为执行指令的数据库
+// 被拒绝的指令会记录在连接中，EXEC 时放弃整个事务
+func EnqueueCmd(conn redis.Connection, dbIndex int, cmdLine [][]byte) redis.Reply {
 	cmdName := strings.ToLower(string(cmdLine[0]))
 	// 取指令
 	cmd, ok := cmdTable[cmdName]
+	var errReply reply.ErrorReply
 	if !ok {
 		// 指令列表中没有，未知指令
-		return reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
-	}
-	// if forbiddenInMulti.Has(cmdName) {
-	// 	return reply.MakeErrReply("ERR command '" + cmdName + "' cannot be used in MULTI")
-	// }
-	if cmd.prepare == nil {
-		// 不是复杂指令
-		return reply.MakeErrReply("ERR command '" + cmdName + "' cannot be used in MULTI")
+		errReply = reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
+	} else if forbiddenInMulti(cmd) {
+		errReply = reply.MakeErrReply("ERR Command not allowed inside a transaction")
+	} else if !validateArity(cmd.arity, cmdLine) {
+		errReply = reply.MakeArgNumErrReply(cmdName)
 	}
-	if !validateArity(cmd.arity, cmdLine) {
-		// 和 redis 不同，不执行参数个数错误的指令
-		return reply.MakeArgNumErrReply(cmdName)
+	if errReply != nil {
+		conn.AddTxError(errReply)
+		return errReply
 	}
 	// 插入指令到队列
-	conn.EnqueueCmd(cmdLine)
+	conn.EnqueueCmd(dbIndex, cmdLine)
 	return reply.MakeQueuedReply()
 }
 
-// 原子隔离 执行复杂指令
-func (db *DB) ExecMulti(conn redis.Connection, watching map[string]uint32, cmdLines []CmdLine) redis.Reply {
-	// prepare 准备
-	writeKeys := make([]string, 0)
-	readKeys := make([]string, 0)
+// 事务中当前选择的数据库，即最后一个加入队列的指令的数据库
+func txDBIndex(conn redis.Connection) int {
+	queued := conn.GetQueuedCmds()
+	if len(queued) == 0 {
+		return conn.GetDBIndex()
+	}
+	return queued[len(queued)-1].DBIndex
+}
 
-	for _, cmdLine := range cmdLines {
-		cmdName := strings.ToLower(string(cmdLine[0]))
-		cmd := cmdTable[cmdName]
-		prepare := cmd.prepare
-		write, read := prepare(cmdLine[1:])
-		writeKeys = append(writeKeys, write...)
-		readKeys = append(readKeys, read...)
+// 在事务中执行指令，除了 EXEC DISCARD 和 MULTI 都加入队列
+func (mdb *MultiDB) execInMulti(c redis.Connection, cmdName string, cmdLine [][]byte) redis.Reply {
+	switch cmdName {
+	case "multi":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return StartMulti(c)
+	case "discard":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return DiscardMulti(c)
+	case "exec":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return mdb.execMulti(c)
+	case "select", "swapdb":
+		// 由 MultiDB 执行的指令没有 executor，单独检查后加入队列
+		errReply := mdb.checkDBCommand(cmdName, cmdLine)
+		if errReply != nil {
+			c.AddTxError(errReply)
+			return errReply
+		}
+		dbIndex := txDBIndex(c)
+		if cmdName == "select" {
+			// 之后的指令在新的数据库中执行
+			dbIndex, _ = strconv.Atoi(string(cmdLine[1]))
+		}
+		c.EnqueueCmd(dbIndex, cmdLine)
+		return reply.MakeQueuedReply()
 	}
+	return EnqueueCmd(c, txDBIndex(c), cmdLine)
+}
 
+// 检查 SELECT 和 SWAPDB 的参数
+func (mdb *MultiDB) checkDBCommand(cmdName string, cmdLine [][]byte) reply.ErrorReply {
+	if !validateArity(cmdTable[cmdName].arity, cmdLine) {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	if cmdName == "swapdb" {
+		_, _, errReply := parseSwapDB(mdb, cmdLine[1:])
+		return errReply
+	}
+	for _, arg := range cmdLine[1:] {
+		dbIndex, err := strconv.Atoi(string(arg))
+		if err != nil {
+			return reply.MakeErrReply("ERR invalid DB index")
+		}
+		if _, errReply := mdb.selectDB(dbIndex); errReply != nil {
+			return errReply
+		}
+	}
+	return nil
+}
+
+// 执行复杂指令
+func (mdb *MultiDB) execMulti(conn redis.Connection) redis.Reply {
+	if !conn.InMultiState() {
+		return reply.MakeErrReply("ERR EXEC without MULTI")
+	}
+	defer conn.SetMultiState(false)
+	if len(conn.GetTxErrors()) > 0 {
+		// 有指令加入队列时被拒绝，放弃整个事务
+		return reply.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	return mdb.ExecMulti(conn, conn.GetWatching(), conn.GetQueuedCmds())
+}
+
+// 一个数据库中需要上锁的 keys
+type txKeys struct {
+	write []string
+	read  []string
+	all   bool // 对所有 key 上写锁
+}
+
+// 每个数据库中需要上锁的 keys
+type txLocks map[int]*txKeys
+
+func (locks txLocks) add(dbIndex int, write []string, read []string) {
+	k, ok := locks[dbIndex]
+	if !ok {
+		k = &txKeys{}
+		locks[dbIndex] = k
+	}
+	k.write = append(k.write, write...)
+	k.read = append(k.read, read...)
+}
+
+// 对数据库中所有 key 上写锁，不再需要单独锁 key
+func (locks txLocks) lockAll(dbIndex int) {
+	locks.add(dbIndex, nil, nil)
+	locks[dbIndex].all = true
+}
+
+func (k *txKeys) lock(db *DB) {
+	if k.all {
+		db.LockAll()
+		return
+	}
+	db.RWLocks(k.write, k.read)
+}
+
+func (k *txKeys) unlock(db *DB) {
+	if k.all {
+		db.UnLockAll()
+		return
+	}
+	db.RWUnLocks(k.write, k.read)
+}
+
+// 回滚日志，在 dbIndex 数据库中执行
+type undoLog struct {
+	dbIndex  int
+	cmdLines []CmdLine
+}
+
+// 指令需要上锁的 keys，可能属于多个数据库
+func (mdb *MultiDB) txLockKeys(dbIndex int, cmdLine [][]byte, locks txLocks) {
+	add := func(index int, write []string, read []string) {
+		if index < 0 || index >= len(mdb.dbSet) {
+			// 执行时会返回错误
+			return
+		}
+		locks.add(index, write, read)
+	}
+
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	args := cmdLine[1:]
+	switch cmdName {
+	case "select":
+		// 不访问 key
+		return
+	case "swapdb":
+		// 交换整个数据库，对两个数据库的所有 key 上写锁
+		for _, arg := range args {
+			if index, err := strconv.Atoi(string(arg)); err == nil && index >= 0 && index < len(mdb.dbSet) {
+				locks.lockAll(index)
+			}
+		}
+		return
+	case "move":
+		key := string(args[0])
+		destIndex, _ := strconv.Atoi(string(args[1]))
+		add(dbIndex, []string{key}, nil)
+		add(destIndex, []string{key}, nil)
+		return
+	case "copy":
+		if destIndex, _, errReply := parseCopyArgs(args); errReply == nil && destIndex >= 0 {
+			add(dbIndex, nil, []string{string(args[0])})
+			add(destIndex, []string{string(args[1])}, nil)
+			return
+		}
+	}
+	prepare := cmdTable[cmdName].prepare
+	if prepare == nil {
+		// 特殊指令不访问 key
+		return
+	}
+	write, read := prepare(args)
+	add(dbIndex, write, read)
+}
+
+// 获取跨数据库指令的回滚日志
+func (mdb *MultiDB) txUndoLogs(dbIndex int, cmdLine [][]byte) []undoLog {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	args := cmdLine[1:]
+	switch cmdName {
+	case "select":
+		// 放弃事务时恢复连接选择的数据库
+		return nil
+	case "swapdb":
+		// 再交换一次
+		return []undoLog{{dbIndex, []CmdLine{cmdLine}}}
+	case "move":
+		key := string(args[0])
+		destIndex, err := strconv.Atoi(string(args[1]))
+		if err != nil || destIndex < 0 || destIndex >= len(mdb.dbSet) {
+			return nil
+		}
+		return []undoLog{
+			{dbIndex, rollbackGivenKeys(mdb.dbSet[dbIndex], key)},
+			{destIndex, rollbackGivenKeys(mdb.dbSet[destIndex], key)},
+		}
+	case "copy":
+		destIndex, _, errReply := parseCopyArgs(args)
+		if errReply != nil || destIndex >= len(mdb.dbSet) {
+			return nil
+		}
+		if destIndex >= 0 {
+			return []undoLog{{destIndex, rollbackGivenKeys(mdb.dbSet[destIndex], string(args[1]))}}
+		}
+	}
+	return []undoLog{{dbIndex, mdb.dbSet[dbIndex].GetUndoLogs(cmdLine)}}
+}
+
+// 在持有锁的情况下执行指令，跨数据库的指令由 MultiDB 执行
+func (mdb *MultiDB) execQueuedWithLock(conn redis.Connection, dbIndex int, cmdLine [][]byte) redis.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	args := cmdLine[1:]
+	db := mdb.dbSet[dbIndex]
+	if exec, ok := txSpecialCommands[cmdName]; ok {
+		return exec(mdb, args)
+	}
+	switch cmdName {
+	case "select":
+		return execSelect(conn, mdb, args)
+	case "swapdb":
+		// 挂起的客户端在解锁后唤醒
+		db1, db2, errReply := parseSwapDB(mdb, args)
+		if errReply != nil {
+			return errReply
+		}
+		swapDBWithLock(db1, db2)
+		return reply.MakeOkReply()
+	case "move":
+		return execMoveWithLock(mdb, db, args)
+	case "copy":
+		if destIndex, _, errReply := parseCopyArgs(args); errReply == nil && destIndex >= 0 {
+			return execCopyToDBWithLock(mdb, db, args)
+		}
+	}
+	return db.execWithLock(cmdLine)
+}
+
+// 原子隔离 执行复杂指令
+// 所有数据库的 key 按数据库编号从小到大上锁，避免与其它事务死锁
+func (mdb *MultiDB) ExecMulti(conn redis.Connection, watching map[int]map[string]uint32, cmds []redis.QueuedCmd) redis.Reply {
+	// prepare 准备
+	keys := make(txLocks)
+	for _, cmd := range cmds {
+		mdb.txLockKeys(cmd.DBIndex, cmd.CmdLine, keys)
+	}
 	// 设置 watching
-	watchingKeys := make([]string, 0, len(watching))
-	for key := range watching {
-		watchingKeys = append(watchingKeys, key)
+	for dbIndex, watchingKeys := range watching {
+		read := make([]string, 0, len(watchingKeys))
+		for key := range watchingKeys {
+			read = append(read, key)
+		}
+		keys.add(dbIndex, nil, read)
+	}
+
+	dbIndexes := make([]int, 0, len(keys))
+	for dbIndex := range keys {
+		dbIndexes = append(dbIndexes, dbIndex)
 	}
-	readKeys = append(readKeys, watchingKeys...)
-	db.RWLocks(writeKeys, readKeys)
-	defer db.RWUnLocks(writeKeys, readKeys)
+	sort.Ints(dbIndexes)
+	for _, dbIndex := range dbIndexes {
+		keys[dbIndex].lock(mdb.dbSet[dbIndex])
+	}
+	defer func() {
+		for _, dbIndex := range dbIndexes {
+			keys[dbIndex].unlock(mdb.dbSet[dbIndex])
+		}
+		// 解锁后唤醒等待这些 key 的阻塞指令
+		for _, dbIndex := range dbIndexes {
+			mdb.dbSet[dbIndex].wakeBlockedClients(keys[dbIndex].write...)
+		}
+		for _, cmd := range cmds {
+			if strings.ToLower(string(cmd.CmdLine[0])) != "swapdb" {
+				continue
+			}
+			if db1, db2, errReply := parseSwapDB(mdb, cmd.CmdLine[1:]); errReply == nil {
+				db1.wakeAllBlockedClients()
+				db2.wakeAllBlockedClients()
+			}
+		}
+	}()
 
-	if isWatchingChanged(db, watching) {
+	if mdb.isWatchingChanged(watching) {
 		// watching keys 改变了 abort 终止
 		return reply.MakeEmptyMultiBulkReply()
 	}
 
 	// 执行指令
-	results := make([]redis.Reply, 0, len(cmdLines))
+	originDBIndex := conn.GetDBIndex()
+	results := make([]redis.Reply, 0, len(cmds))
 	aborted := false
-	undoCmdLines := make([][]CmdLine, 0, len(cmdLines))
+	undoLogs := make([][]undoLog, 0, len(cmds))
 
-	for _, cmdLine := range cmdLines {
+	for _, cmd := range cmds {
 		// 回滚日志
-		undoCmdLines = append(undoCmdLines, db.GetUndoLogs(cmdLine))
+		undoLogs = append(undoLogs, mdb.txUndoLogs(cmd.DBIndex, cmd.CmdLine))
 		// 上锁执行 返回响应
-		result := db.execWithLock(cmdLine)
+		result := mdb.execQueuedWithLock(conn, cmd.DBIndex, cmd.CmdLine)
 		// 如果是失败的操作 头部: '-'
 		if reply.IsErrorReply(result) {
 			aborted = true
 			// 不滚回失败的指令
-			undoCmdLines = undoCmdLines[:len(undoCmdLines)-1]
+			undoLogs = undoLogs[:len(undoLogs)-1]
 			break
 		}
 		// 加入结果响应集合
@@ -161,22 +443,22 @@ func (db *DB) ExecMulti(conn redis.Connection, watching map[string]uint32, cmdLi
 
 	if !aborted {
 		// 成功
-		db.addVersion(writeKeys...)
+		for _, dbIndex := range dbIndexes {
+			mdb.dbSet[dbIndex].addVersion(keys[dbIndex].write...)
+		}
 		return reply.MakeMultiRawReply(results)
 	}
 
 	// 如果 abort 就 undo 回滚
-	size := len(undoCmdLines)
-	for i := size - 1; i >= 0; i-- {
+	for i := len(undoLogs) - 1; i >= 0; i-- {
 		// 逆向回滚
-		curCmdLines := undoCmdLines[i]
-		if len(curCmdLines) == 0 {
-			continue
-		}
-		for _, cmdLine := range curCmdLines {
-			db.execWithLock(cmdLine)
+		for _, log := range undoLogs[i] {
+			for _, cmdLine := range log.cmdLines {
+				mdb.execQueuedWithLock(conn, log.dbIndex, cmdLine)
+			}
 		}
 	}
+	conn.SelectDB(originDBIndex)
 
 	return reply.MakeErrReply("Exec abort transaction discaded because of previous errors.")
 }
@@ -187,7 +469,7 @@ func (db *DB) execWithLock(cmdLine [][]byte) redis.Reply {
 	// 取指令
 	cmd, ok := cmdTable[cmdName]
 
-	if !ok {
+	if !ok || cmd.executor == nil {
 		return reply.MakeErrReply("ERR unknow command '" + cmdName + "'")
 	}
 	if !validateArity(cmd.arity, cmdLine) {
@@ -198,3 +480,10 @@ func (db *DB) execWithLock(cmdLine [][]byte) redis.Reply {
 	fun := cmd.executor
 	return fun(db, cmdLine[1:])
 }
+
+func init() {
+	registerSpecialCommand("multi", 1, flagNoScript|flagLoading|flagStale|flagFast, 0, 0, 0, acl.CatFast|acl.CatTransaction)
+	registerSpecialCommand("exec", 1, flagNoScript|flagLoading|flagStale, 0, 0, 0, acl.CatSlow|acl.CatTransaction)
+	registerSpecialCommand("discard", 1, flagNoScript|flagLoading|flagStale|flagFast, 0, 0, 0, acl.CatFast|acl.CatTransaction)
+	registerSpecialCommand("watch", -2, flagNoScript|flagLoading|flagStale|flagFast|flagNoMulti, 1, -1, 1, acl.CatFast|acl.CatTransaction)
+}
@@ -0,0 +1,313 @@
+// 测试事务
+
+package database
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/connection"
+	"ljr-redis/redis/reply"
+)
+
+// 记录收到的消息的客户端连接
+type recordConn struct {
+	connection.Connection
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (c *recordConn) Write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = append(c.msgs, string(b))
+	return nil
+}
+
+func (c *recordConn) take() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	msgs := c.msgs
+	c.msgs = nil
+	return msgs
+}
+
+var execAbortReply = reply.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
+
+func TestMultiExec(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	conn := &connection.Connection{}
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeErrReply("ERR MULTI calls can not be nested"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("set", "a", "1")), reply.MakeQueuedReply())
+	// 阻塞指令在事务中不会阻塞
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("blpop", "list", "0")), reply.MakeQueuedReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("exec")), reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeOkReply(), reply.MakeNullMultiBulkReply(),
+	}))
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), "1")
+}
+
+func TestMultiForbidden(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	conn := &connection.Connection{}
+	notAllowed := reply.MakeErrReply("ERR Command not allowed inside a transaction")
+	for _, cmdLine := range []CmdLine{
+		utils.ToCmdLine("subscribe", "ch"),
+		utils.ToCmdLine("psubscribe", "ch*"),
+		utils.ToCmdLine("watch", "a"),
+		utils.ToCmdLine("save"),
+		utils.ToCmdLine("acl", "whoami"),
+	} {
+		assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+		assertReply(t, mdb.Exec(conn, utils.ToCmdLine("set", "a", "1")), reply.MakeQueuedReply())
+		assertReply(t, mdb.Exec(conn, cmdLine), notAllowed)
+		assertReply(t, mdb.Exec(conn, utils.ToCmdLine("exec")), execAbortReply)
+		assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), reply.MakeNullBulkReply())
+	}
+	if conn.SubsCount() != 0 {
+		t.Error("subscribe should not be executed in multi")
+	}
+
+	// 未知指令和参数个数错误
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("nothing")))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("exec")), execAbortReply)
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get")), reply.MakeArgNumErrReply("get"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("exec")), execAbortReply)
+
+	// DISCARD 后重新开始的事务不受影响
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("watch", "a")), notAllowed)
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("discard")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("set", "a", "1")), reply.MakeQueuedReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("exec")), reply.MakeMultiRawReply([]redis.Reply{reply.MakeOkReply()}))
+}
+
+func TestMultiSelect(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	conn := &connection.Connection{}
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("set", "a", "0")), reply.MakeQueuedReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("move", "a", "1")), reply.MakeQueuedReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("select", "1")), reply.MakeQueuedReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("append", "a", "1")), reply.MakeQueuedReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("exec")), reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeOkReply(), reply.MakeIntReply(1), reply.MakeOkReply(), reply.MakeIntReply(2),
+	}))
+	if conn.GetDBIndex() != 1 {
+		t.Errorf("expected db 1, actually %d", conn.GetDBIndex())
+	}
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), "01")
+	mdb.Exec(conn, utils.ToCmdLine("select", "0"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), reply.MakeNullBulkReply())
+
+	// 非法的数据库编号在加入队列时被拒绝
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("select", "16")), reply.MakeErrReply("ERR DB index is out of range"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("exec")), execAbortReply)
+}
+
+func TestMultiRollbackAcrossDB(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	conn := &connection.Connection{}
+	mdb.Exec(conn, utils.ToCmdLine("set", "a", "0"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("move", "a", "1")), reply.MakeQueuedReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("select", "1")), reply.MakeQueuedReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("set", "b", "1")), reply.MakeQueuedReply())
+	// 类型错误，执行时失败
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("lpush", "a", "1")), reply.MakeQueuedReply())
+	assertErr(t, mdb.Exec(conn, utils.ToCmdLine("exec")))
+
+	if conn.GetDBIndex() != 0 {
+		t.Errorf("expected db 0, actually %d", conn.GetDBIndex())
+	}
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), "0")
+	mdb.Exec(conn, utils.ToCmdLine("select", "1"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), reply.MakeNullBulkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "b")), reply.MakeNullBulkReply())
+}
+
+func TestMultiRollbackTTL(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	conn := &connection.Connection{}
+	mdb.Exec(conn, utils.ToCmdLine("set", "str", "a"))
+	// 每条指令都会删除变空的 key，回滚后需要恢复过期时间
+	for _, cmds := range [][]CmdLine{
+		{utils.ToCmdLine("rpush", "k", "a"), utils.ToCmdLine("lpop", "k")},
+		{utils.ToCmdLine("rpush", "k", "a"), utils.ToCmdLine("rpop", "k")},
+		{utils.ToCmdLine("hset", "k", "f", "v"), utils.ToCmdLine("hdel", "k", "f")},
+		{utils.ToCmdLine("sadd", "k", "a"), utils.ToCmdLine("srem", "k", "a")},
+		{utils.ToCmdLine("sadd", "k", "a"), utils.ToCmdLine("smove", "k", "dst", "a")},
+		{utils.ToCmdLine("zadd", "k", "1", "a"), utils.ToCmdLine("zrem", "k", "a")},
+	} {
+		mdb.Exec(conn, utils.ToCmdLine("del", "k", "dst"))
+		mdb.Exec(conn, cmds[0])
+		mdb.Exec(conn, utils.ToCmdLine("expire", "k", "1000"))
+		expireTime := mdb.Exec(conn, utils.ToCmdLine("pexpiretime", "k"))
+
+		assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+		assertReply(t, mdb.Exec(conn, cmds[1]), reply.MakeQueuedReply())
+		// 类型错误，执行时失败
+		assertReply(t, mdb.Exec(conn, utils.ToCmdLine("incr", "str")), reply.MakeQueuedReply())
+		assertErr(t, mdb.Exec(conn, utils.ToCmdLine("exec")))
+
+		assertInt(t, mdb.Exec(conn, utils.ToCmdLine("exists", "k")), 1)
+		assertReply(t, mdb.Exec(conn, utils.ToCmdLine("pexpiretime", "k")), expireTime)
+	}
+}
+
+func TestMultiWatchOtherDB(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	conn := &connection.Connection{}
+	other := &connection.Connection{}
+	other.SelectDB(1)
+	mdb.Exec(conn, utils.ToCmdLine("select", "1"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("watch", "a")), reply.MakeOkReply())
+	mdb.Exec(conn, utils.ToCmdLine("select", "0"))
+	// 修改当前数据库中的同名 key 不影响事务
+	mdb.Exec(other, utils.ToCmdLine("select", "0"))
+	mdb.Exec(other, utils.ToCmdLine("set", "a", "0"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("set", "b", "1")), reply.MakeQueuedReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("exec")), reply.MakeMultiRawReply([]redis.Reply{reply.MakeOkReply()}))
+
+	mdb.Exec(conn, utils.ToCmdLine("select", "1"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("watch", "a")), reply.MakeOkReply())
+	mdb.Exec(conn, utils.ToCmdLine("select", "0"))
+	mdb.Exec(other, utils.ToCmdLine("select", "1"))
+	mdb.Exec(other, utils.ToCmdLine("set", "a", "1"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("set", "b", "2")), reply.MakeQueuedReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("exec")), reply.MakeEmptyMultiBulkReply())
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "b")), "1")
+}
+
+func TestSwapDB(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	conn := &connection.Connection{}
+	mdb.Exec(conn, utils.ToCmdLine("set", "a", "0"))
+	mdb.Exec(conn, utils.ToCmdLine("select", "1"))
+	mdb.Exec(conn, utils.ToCmdLine("set", "b", "1", "ex", "1000"))
+	expireTime := mdb.Exec(conn, utils.ToCmdLine("pexpiretime", "b"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("swapdb", "0", "1")), reply.MakeOkReply())
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), "0")
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "b")), reply.MakeNullBulkReply())
+	mdb.Exec(conn, utils.ToCmdLine("select", "0"))
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "b")), "1")
+	// 过期时间随 key 一起交换
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("pexpiretime", "b")), expireTime)
+
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("swapdb", "0", "x")), reply.MakeErrReply("ERR invalid second DB index"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("swapdb", "0", "16")), reply.MakeErrReply("ERR DB index is out of range"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("select", "-1")), reply.MakeErrReply("ERR DB index is out of range"))
+	assertBulk(t, mdb.Exec(conn, utils.ToCmdLine("get", "b")), "1")
+
+	// 事务中交换，之后的指令看到交换后的数据
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("swapdb", "0", "1")), reply.MakeQueuedReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("get", "a")), reply.MakeQueuedReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("exec")), reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeOkReply(), reply.MakeBulkReply([]byte("0")),
+	}))
+}
+
+func TestSwapDBExpire(t *testing.T) {
+	mdb := NewStandaloneServer()
+	conn, _ := makeTestConn(t)
+	mdb.Exec(conn, utils.ToCmdLine("set", "k", "v", "PX", "1500"))
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("swapdb", "0", "1")), reply.MakeOkReply())
+
+	// 定时任务随 key 转移到新的数据库
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := mdb.dbSet[1].data.Get("k"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("key should be expired actively")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestMultiPublish(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	conn := &connection.Connection{}
+	subscriber := &recordConn{}
+	mdb.Exec(subscriber, utils.ToCmdLine("subscribe", "ch"))
+	subscriber.take()
+
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("multi")), reply.MakeOkReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("publish", "ch", "hello")), reply.MakeQueuedReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("pubsub", "numsub", "ch")), reply.MakeQueuedReply())
+	assertReply(t, mdb.Exec(conn, utils.ToCmdLine("lastsave")), reply.MakeQueuedReply())
+	// EXEC 之前不发送消息
+	if msgs := subscriber.take(); len(msgs) != 0 {
+		t.Fatalf("unexpected messages before exec %q", msgs)
+	}
+
+	result, ok := mdb.Exec(conn, utils.ToCmdLine("exec")).(*reply.MultiRawReply)
+	if !ok || len(result.Replies) != 3 {
+		t.Fatalf("unexpected exec result %v", result)
+	}
+	assertInt(t, result.Replies[0], 1)
+	message := string(reply.MakeMultiBulkReply(utils.ToCmdLine("message", "ch", "hello")).ToBytes())
+	if msgs := subscriber.take(); len(msgs) != 1 || msgs[0] != message {
+		t.Errorf("expected %q, actually %q", message, msgs)
+	}
+}
+
+func TestSwapDBConcurrent(t *testing.T) {
+	mdb := MakeBasicMultiDB()
+	const n = 200
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		conn := connection.NewFakeConn()
+		conn.SelectDB(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				mdb.Exec(conn, utils.ToCmdLine("incr", "counter"))
+				if j%20 == 0 {
+					mdb.Exec(conn, utils.ToCmdLine("keys", "*"))
+				}
+			}
+		}()
+	}
+	// 交换期间不会丢失 INCR 的结果
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		conn := &connection.Connection{}
+		for j := 0; j < n/20; j++ {
+			mdb.Exec(conn, utils.ToCmdLine("swapdb", "0", "1"))
+			mdb.Exec(conn, utils.ToCmdLine("multi"))
+			mdb.Exec(conn, utils.ToCmdLine("swapdb", "1", "0"))
+			mdb.Exec(conn, utils.ToCmdLine("incr", "counter"))
+			mdb.Exec(conn, utils.ToCmdLine("exec"))
+		}
+	}()
+	wg.Wait()
+
+	conn := connection.NewFakeConn()
+	total := 0
+	for i := 0; i < 2; i++ {
+		conn.SelectDB(i)
+		if r, ok := mdb.Exec(conn, utils.ToCmdLine("get", "counter")).(*reply.BulkReply); ok {
+			value, _ := strconv.Atoi(string(r.Arg))
+			total += value
+		}
+	}
+	if total != 2*n+n/20 {
+		t.Errorf("expected %d, actually %d", 2*n+n/20, total)
+	}
+}
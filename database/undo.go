@@ -0,0 +1,75 @@
+// 事务 prepare 与 undo 回滚的通用实现
+
+package database
+
+import (
+	"ljr-redis/lib/utils"
+)
+
+/* ---------- prepare 获取需要上锁的 keys ------------ */
+
+// 第一个参数为读 key
+func readFirstKey(args [][]byte) ([]string, []string) {
+	key := string(args[0])
+	return nil, []string{key}
+}
+
+// 第一个参数为写 key
+func writeFirstKey(args [][]byte) ([]string, []string) {
+	key := string(args[0])
+	return []string{key}, nil
+}
+
+// 所有参数都是写 key
+func writeAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return keys, nil
+}
+
+// 所有参数都是读 key
+func readAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return nil, keys
+}
+
+/* ---------- undo 生成回滚指令 ------------ */
+
+// 回滚第一个参数对应的 key
+func rollbackFirstKey(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	return rollbackGivenKeys(db, key)
+}
+
+// 回滚给定的 keys：先删除，再按原数据和过期时间重建
+func rollbackGivenKeys(db *DB, keys ...string) []CmdLine {
+	var undoCmdLines []CmdLine
+	for _, key := range keys {
+		entity, ok := db.GetEntity(key)
+		if !ok {
+			// 原本不存在，直接删除
+			undoCmdLines = append(undoCmdLines, utils.ToCmdLine("DEL", key))
+			continue
+		}
+		undoCmdLines = append(undoCmdLines, utils.ToCmdLine("DEL", key))
+		if cmdLine := entityToCmd(key, entity); cmdLine != nil {
+			undoCmdLines = append(undoCmdLines, cmdLine)
+		}
+		undoCmdLines = appendTTLCmd(db, key, undoCmdLines)
+	}
+	return undoCmdLines
+}
+
+// 追加恢复过期时间的指令
+// 只回滚部分元素时，指令可能删除了变空的 key，重建后需要恢复过期时间
+func appendTTLCmd(db *DB, key string, undoCmdLines []CmdLine) []CmdLine {
+	if ttlCmdLine := toTTLCmd(db, key); ttlCmdLine != nil {
+		undoCmdLines = append(undoCmdLines, ttlCmdLine)
+	}
+	return undoCmdLines
+}
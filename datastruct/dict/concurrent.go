@@ -21,6 +21,9 @@ type ConcurrentDict struct {
 type Shard struct {
 	m     map[string]interface{}
 	mutex sync.RWMutex
+
+	// 游标遍历的有序索引，遍历时建立，不再遍历时丢弃
+	index *scanIndex
 }
 
 // 计算 shard 个数
@@ -171,6 +174,7 @@ func (dict *ConcurrentDict) Put(key string, val interface{}) (result int) {
 
 	// key 不存在，新增
 	shard.m[key] = val
+	shard.index = shard.index.afterPut(key)
 	dict.addCount()
 	return 1
 }
@@ -197,6 +201,7 @@ func (dict *ConcurrentDict) PutIfAbsent(key string, val interface{}) (result int
 	}
 	// key 不存在，新增
 	shard.m[key] = val
+	shard.index = shard.index.afterPut(key)
 	dict.addCount()
 	return 1
 }
@@ -245,6 +250,7 @@ func (dict *ConcurrentDict) Remove(key string) (result int) {
 	if _, ok := shard.m[key]; ok {
 		// 有数据 删除
 		delete(shard.m, key)
+		shard.index = shard.index.afterRemove(key)
 		// 数据总数减一
 		dict.decreaseCount()
 		return 1
@@ -262,7 +268,7 @@ func (dict *ConcurrentDict) ForEach(consumer Consumer) {
 	for _, shard := range dict.table {
 		shard.mutex.RLock()
 		func() {
-			defer shard.mutex.Unlock()
+			defer shard.mutex.RUnlock()
 
 			for key, value := range shard.m {
 				continues := consumer(key, value)
@@ -352,6 +358,25 @@ func (dict *ConcurrentDict) RandomDistinctKeys(limit int) []string {
 	return arr
 }
 
+// 与另一个 shard 个数相同的字典交换数据
+// 逐个 shard 上锁交换，不修改字典的字段，交换期间的读写仍然是并发安全的
+func (dict *ConcurrentDict) Swap(other *ConcurrentDict) {
+	if len(dict.table) != len(other.table) {
+		panic("shard count mismatch")
+	}
+	for i, shard := range dict.table {
+		otherShard := other.table[i]
+		shard.mutex.Lock()
+		otherShard.mutex.Lock()
+		shard.m, otherShard.m = otherShard.m, shard.m
+		shard.index, otherShard.index = otherShard.index, shard.index
+		otherShard.mutex.Unlock()
+		shard.mutex.Unlock()
+	}
+	count := atomic.LoadInt32(&dict.count)
+	atomic.StoreInt32(&dict.count, atomic.SwapInt32(&other.count, count))
+}
+
 // 清空数据
 func (dict *ConcurrentDict) Clear() {
 	*dict = *MakeConcurrent(dict.shardCount)
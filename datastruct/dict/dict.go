@@ -19,5 +19,7 @@ type Dict interface {
 	Keys() []string
 	RandomKeys(limit int) []string
 	RandomDistinctKeys(limit int) []string
+	// 游标遍历，返回本次遍历的 keys 和下一次的游标，游标为 0 表示遍历结束
+	Scan(cursor int, count int) (keys []string, nextCursor int)
 	Clear()
 }
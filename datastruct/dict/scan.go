@@ -0,0 +1,238 @@
+// 基于哈希值的游标遍历
+// map 的遍历顺序不固定，按 key 的哈希值从小到大遍历，游标记录下一次开始的哈希值
+// 遍历时建立按哈希值排序的跳表索引，之后随 Put 和 Remove 更新，每次遍历不需要重新排序
+// 索引只在遍历期间保留：遍历到结尾时丢弃，两次遍历之间的写入次数超过 key 的个数时也丢弃
+// 游标只依赖哈希值，丢弃后重建索引不影响正在进行的遍历
+
+package dict
+
+import (
+	"math"
+	"math/rand"
+)
+
+const maxIndexLevel = 32
+
+// 跳表节点，按 (哈希值, key) 排序
+type indexNode struct {
+	hash uint32
+	key  string
+	next []*indexNode
+}
+
+// 游标遍历的有序索引
+type scanIndex struct {
+	header *indexNode
+	level  int
+	writes int // 上一次遍历之后的写入次数
+	limit  int // 写入次数的上限，为上一次遍历时 key 的个数
+}
+
+func makeScanIndex() *scanIndex {
+	return &scanIndex{
+		header: &indexNode{next: make([]*indexNode, maxIndexLevel)},
+		level:  1,
+	}
+}
+
+// 根据 map 中已有的 key 建立索引
+func buildScanIndex(m map[string]interface{}) *scanIndex {
+	index := makeScanIndex()
+	for key := range m {
+		index.insert(key)
+	}
+	return index
+}
+
+func randomIndexLevel() int {
+	level := 1
+	for level < maxIndexLevel && rand.Intn(4) == 0 {
+		level++
+	}
+	return level
+}
+
+// node 排在 (hash, key) 之前
+func (node *indexNode) before(hash uint32, key string) bool {
+	if node.hash == hash {
+		return node.key < key
+	}
+	return node.hash < hash
+}
+
+// 每一层中最后一个排在 (hash, key) 之前的节点
+func (index *scanIndex) findPrev(hash uint32, key string) []*indexNode {
+	prev := make([]*indexNode, maxIndexLevel)
+	node := index.header
+	for i := index.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && node.next[i].before(hash, key) {
+			node = node.next[i]
+		}
+		prev[i] = node
+	}
+	return prev
+}
+
+// 加入新的 key，调用者保证 key 不在索引中
+func (index *scanIndex) insert(key string) {
+	hash := fnv32(key)
+	prev := index.findPrev(hash, key)
+	level := randomIndexLevel()
+	if level > index.level {
+		for i := index.level; i < level; i++ {
+			prev[i] = index.header
+		}
+		index.level = level
+	}
+	node := &indexNode{hash: hash, key: key, next: make([]*indexNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = prev[i].next[i]
+		prev[i].next[i] = node
+	}
+}
+
+func (index *scanIndex) remove(key string) {
+	hash := fnv32(key)
+	prev := index.findPrev(hash, key)
+	node := prev[0].next[0]
+	if node == nil || node.hash != hash || node.key != key {
+		return
+	}
+	for i := 0; i < index.level && prev[i].next[i] == node; i++ {
+		prev[i].next[i] = node.next[i]
+	}
+	for index.level > 1 && index.header.next[index.level-1] == nil {
+		index.level--
+	}
+}
+
+// 写入 key 之后同步索引，返回索引被丢弃时为 nil
+// 写入次数超过上一次遍历时 key 的个数，维护索引的代价已经超过重建索引，说明没有在遍历，丢弃索引
+func (index *scanIndex) afterPut(key string) *scanIndex {
+	if index == nil || index.expire() {
+		return nil
+	}
+	index.insert(key)
+	return index
+}
+
+func (index *scanIndex) afterRemove(key string) *scanIndex {
+	if index == nil || index.expire() {
+		return nil
+	}
+	index.remove(key)
+	return index
+}
+
+func (index *scanIndex) expire() bool {
+	index.writes++
+	return index.writes > index.limit
+}
+
+// 每次遍历后重新计算写入次数，size 为当前 key 的个数
+func (index *scanIndex) touch(size int) {
+	index.writes = 0
+	index.limit = size
+}
+
+// 按哈希值顺序取出至少 count 个 key，从哈希值 from 开始
+// 返回下一次开始的哈希值，finished 为 true 表示已经遍历完
+// 哈希值相同的 key 总是在同一批返回，所以遍历期间一直存在的 key 不会因为并发修改被遗漏
+func (index *scanIndex) scan(from uint32, count int) (keys []string, next uint32, finished bool) {
+	node := index.header
+	for i := index.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && node.next[i].hash < from {
+			node = node.next[i]
+		}
+	}
+	node = node.next[0]
+
+	// count 由客户端指定，不能用来预分配
+	for node != nil {
+		hash := node.hash
+		for ; node != nil && node.hash == hash; node = node.next[0] {
+			keys = append(keys, node.key)
+		}
+		if len(keys) >= count && node != nil {
+			// 后面还有哈希值更大的 key，hash + 1 不会溢出
+			return keys, hash + 1, false
+		}
+	}
+	return keys, 0, true
+}
+
+// 游标遍历，游标为下一次开始的哈希值，遍历结束时返回 0
+// 多个只读指令可能同时遍历，建立索引时需要上锁
+func (dict *SimpleDict) Scan(cursor int, count int) ([]string, int) {
+	if cursor < 0 || cursor > math.MaxUint32 {
+		return nil, 0
+	}
+	dict.indexMu.Lock()
+	defer dict.indexMu.Unlock()
+	if dict.index == nil {
+		dict.index = buildScanIndex(dict.m)
+	}
+	keys, next, finished := dict.index.scan(uint32(cursor), count)
+	dict.index.touch(len(dict.m))
+	if finished {
+		dict.index = nil
+		return keys, 0
+	}
+	return keys, int(next)
+}
+
+// 在 shard 内遍历，需要上写锁建立或丢弃索引
+func (shard *Shard) scan(from uint32, count int) ([]string, uint32, bool) {
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	if len(shard.m) == 0 {
+		// 空的 shard 不建立索引
+		shard.index = nil
+		return nil, 0, true
+	}
+	if shard.index == nil {
+		shard.index = buildScanIndex(shard.m)
+	}
+	keys, next, finished := shard.index.scan(from, count)
+	shard.index.touch(len(shard.m))
+	if finished {
+		shard.index = nil
+	}
+	return keys, next, finished
+}
+
+// 游标遍历，游标的高 32 位为 shard 下标，低 32 位为 shard 内下一次开始的哈希值，遍历结束时返回 0
+func (dict *ConcurrentDict) Scan(cursor int, count int) ([]string, int) {
+	if dict == nil {
+		panic("dict is nil")
+	}
+	if cursor < 0 {
+		return nil, 0
+	}
+	shardIndex := cursor >> 32
+	from := uint32(cursor & math.MaxUint32)
+
+	// count 由客户端指定，预分配的容量不超过 key 的总数
+	capacity := count
+	if size := dict.Len(); capacity > size {
+		capacity = size
+	}
+	keys := make([]string, 0, capacity)
+	for shardIndex < len(dict.table) {
+		batch, next, finished := dict.table[shardIndex].scan(from, count-len(keys))
+
+		keys = append(keys, batch...)
+		if !finished {
+			return keys, shardIndex<<32 | int(next)
+		}
+		shardIndex++
+		from = 0
+		if len(keys) >= count {
+			break
+		}
+	}
+	if shardIndex >= len(dict.table) {
+		return keys, 0
+	}
+	return keys, shardIndex << 32
+}
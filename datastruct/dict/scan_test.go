@@ -0,0 +1,164 @@
+// 测试游标遍历
+
+package dict
+
+import (
+	"strconv"
+	"testing"
+)
+
+// 遍历全部 key，每一批之后执行 afterBatch
+func scanAll(d Dict, count int, afterBatch func()) map[string]int {
+	result := make(map[string]int)
+	cursor := 0
+	for {
+		keys, next := d.Scan(cursor, count)
+		for _, key := range keys {
+			result[key]++
+		}
+		if next == 0 {
+			return result
+		}
+		cursor = next
+		if afterBatch != nil {
+			afterBatch()
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	for _, d := range []Dict{MakeConcurrent(16), MakeSimple()} {
+		size := 1000
+		for i := 0; i < size; i++ {
+			d.Put(strconv.Itoa(i), i)
+		}
+		result := scanAll(d, 10, nil)
+		if len(result) != size {
+			t.Fatalf("expected %d keys, actually %d", size, len(result))
+		}
+		for key, n := range result {
+			if n != 1 {
+				t.Fatalf("key %s returned %d times", key, n)
+			}
+		}
+	}
+}
+
+func TestScanWithConcurrentWrites(t *testing.T) {
+	for _, d := range []Dict{MakeConcurrent(16), MakeSimple()} {
+		size := 1000
+		for i := 0; i < size; i++ {
+			d.Put(strconv.Itoa(i), i)
+		}
+		// 遍历期间不断新增和删除其他 key
+		i := 0
+		result := scanAll(d, 7, func() {
+			d.Put("new"+strconv.Itoa(i), i)
+			d.Remove("new" + strconv.Itoa(i-5))
+			i++
+		})
+		for j := 0; j < size; j++ {
+			if result[strconv.Itoa(j)] != 1 {
+				t.Fatalf("key %d returned %d times", j, result[strconv.Itoa(j)])
+			}
+		}
+	}
+}
+
+func TestScanEmpty(t *testing.T) {
+	keys, next := MakeConcurrent(16).Scan(0, 10)
+	if len(keys) != 0 || next != 0 {
+		t.Errorf("expected empty result, actually %v %d", keys, next)
+	}
+}
+
+func TestScanIndexAfterWrites(t *testing.T) {
+	for _, d := range []Dict{MakeConcurrent(16), MakeSimple()} {
+		for i := 0; i < 100; i++ {
+			d.Put(strconv.Itoa(i), i)
+		}
+		// 第一次遍历建立索引，之后的修改需要同步到索引
+		scanAll(d, 10, nil)
+		for i := 0; i < 100; i += 2 {
+			d.Remove(strconv.Itoa(i))
+		}
+		d.PutIfAbsent("a", 0)
+		d.Put("b", 0)
+		d.Put("1", 1)
+		result := scanAll(d, 10, nil)
+		if len(result) != 52 || result["a"] != 1 || result["b"] != 1 || result["1"] != 1 || result["0"] != 0 {
+			t.Fatalf("unexpected scan result %v", result)
+		}
+
+		d.Clear()
+		d.Put("c", 0)
+		result = scanAll(d, 10, nil)
+		if len(result) != 1 || result["c"] != 1 {
+			t.Fatalf("unexpected scan result after clear %v", result)
+		}
+	}
+}
+
+func TestScanHugeCount(t *testing.T) {
+	for _, d := range []Dict{MakeConcurrent(16), MakeSimple()} {
+		for i := 0; i < 10; i++ {
+			d.Put(strconv.Itoa(i), i)
+		}
+		// count 不能用来预分配内存
+		keys, next := d.Scan(0, 1<<40)
+		if len(keys) != 10 || next != 0 {
+			t.Fatalf("unexpected scan result %v %d", keys, next)
+		}
+	}
+}
+
+func TestScanIndexDropped(t *testing.T) {
+	d := MakeSimple()
+	for i := 0; i < 100; i++ {
+		d.Put(strconv.Itoa(i), i)
+	}
+	// 遍历到结尾时丢弃索引
+	scanAll(d, 10, nil)
+	if d.index != nil {
+		t.Fatal("expected index to be dropped after a full scan")
+	}
+
+	// 遍历中途停止写入，写入次数超过 key 的个数后丢弃索引
+	result := make(map[string]int)
+	keys, cursor := d.Scan(0, 10)
+	for _, key := range keys {
+		result[key]++
+	}
+	if d.index == nil {
+		t.Fatal("expected index to be kept during a scan")
+	}
+	for i := 0; i < 101; i++ {
+		d.Put("new"+strconv.Itoa(i), i)
+	}
+	if d.index != nil {
+		t.Fatal("expected index to be dropped after writes without scan")
+	}
+	// 丢弃索引后游标仍然有效，原有的 key 不会遗漏
+	for cursor != 0 {
+		keys, cursor = d.Scan(cursor, 10)
+		for _, key := range keys {
+			result[key]++
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if result[strconv.Itoa(i)] != 1 {
+			t.Fatalf("key %d returned %d times", i, result[strconv.Itoa(i)])
+		}
+	}
+
+	c := MakeConcurrent(16)
+	for i := 0; i < 100; i++ {
+		c.Put(strconv.Itoa(i), i)
+	}
+	scanAll(c, 3, nil)
+	for _, shard := range c.table {
+		if shard.index != nil {
+			t.Fatal("expected shard index to be dropped after a full scan")
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// 非并发安全的 map 实现的字典
+// 用于 hash set 等数据类型内部，由数据库的 key 锁保证并发安全
+
+package dict
+
+import "sync"
+
+// 简单字典
+type SimpleDict struct {
+	m map[string]interface{}
+
+	// 游标遍历的有序索引，遍历时建立，不再遍历时丢弃
+	index   *scanIndex
+	indexMu sync.Mutex
+}
+
+// 创建简单字典
+func MakeSimple() *SimpleDict {
+	return &SimpleDict{
+		m: make(map[string]interface{}),
+	}
+}
+
+/* ------------------ 安排 datastruct/dict 接口  ------------------ */
+
+// Get 方法
+func (dict *SimpleDict) Get(key string) (val interface{}, exists bool) {
+	val, exists = dict.m[key]
+	return
+}
+
+// Len 方法
+func (dict *SimpleDict) Len() int {
+	if dict.m == nil {
+		panic("m is nil")
+	}
+	return len(dict.m)
+}
+
+// Put 方法
+func (dict *SimpleDict) Put(key string, val interface{}) (result int) {
+	_, existed := dict.m[key]
+	dict.m[key] = val
+	if existed {
+		return 0
+	}
+	dict.index = dict.index.afterPut(key)
+	return 1
+}
+
+// PutIfAbsent key 不存在
+func (dict *SimpleDict) PutIfAbsent(key string, val interface{}) (result int) {
+	if _, existed := dict.m[key]; existed {
+		return 0
+	}
+	dict.m[key] = val
+	dict.index = dict.index.afterPut(key)
+	return 1
+}
+
+// PutIfExists key 存在
+func (dict *SimpleDict) PutIfExists(key string, val interface{}) (result int) {
+	if _, existed := dict.m[key]; existed {
+		dict.m[key] = val
+		return 1
+	}
+	return 0
+}
+
+// Remove 删除数据
+func (dict *SimpleDict) Remove(key string) (result int) {
+	if _, existed := dict.m[key]; existed {
+		delete(dict.m, key)
+		dict.index = dict.index.afterRemove(key)
+		return 1
+	}
+	return 0
+}
+
+// 循环遍历
+func (dict *SimpleDict) ForEach(consumer Consumer) {
+	for k, v := range dict.m {
+		if !consumer(k, v) {
+			break
+		}
+	}
+}
+
+// 获取所有 keys
+func (dict *SimpleDict) Keys() []string {
+	result := make([]string, len(dict.m))
+	i := 0
+	for k := range dict.m {
+		result[i] = k
+		i++
+	}
+	return result
+}
+
+// 获取随机 limit 个 key 可能包含重复的
+func (dict *SimpleDict) RandomKeys(limit int) []string {
+	result := make([]string, limit)
+	for i := 0; i < limit; i++ {
+		// map 的遍历顺序是随机的
+		for k := range dict.m {
+			result[i] = k
+			break
+		}
+	}
+	return result
+}
+
+// 获取随机 limit 个 key 不包含重复的
+func (dict *SimpleDict) RandomDistinctKeys(limit int) []string {
+	size := limit
+	if size > len(dict.m) {
+		size = len(dict.m)
+	}
+	result := make([]string, size)
+	i := 0
+	for k := range dict.m {
+		if i == size {
+			break
+		}
+		result[i] = k
+		i++
+	}
+	return result
+}
+
+// 清空数据
+func (dict *SimpleDict) Clear() {
+	dict.m = make(map[string]interface{})
+	dict.index = nil
+}
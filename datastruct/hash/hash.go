@@ -0,0 +1,193 @@
+// 哈希数据类型
+// 元素较少时使用紧凑的 listpack 编码，超过阈值后转换为 dict 编码
+
+package hash
+
+import (
+	"math/rand"
+
+	"ljr-redis/datastruct/dict"
+)
+
+const (
+	// listpack 编码的最大元素个数，对应 hash-max-listpack-entries
+	maxListpackEntries = 128
+	// listpack 编码的最大 field/value 长度，对应 hash-max-listpack-value
+	maxListpackValue = 64
+)
+
+// 编码类型
+const (
+	EncodingListpack  = "listpack"
+	EncodingHashtable = "hashtable"
+)
+
+// field/value 对
+type entry struct {
+	field string
+	value []byte
+}
+
+// 哈希
+type Hash struct {
+	listpack []entry   // listpack 编码，转换后为 nil
+	dict     dict.Dict // dict 编码，转换前为 nil
+}
+
+// 用于遍历 hash 如果返回 false 则 break 遍历
+type Consumer func(field string, value []byte) bool
+
+// 创建哈希
+func Make() *Hash {
+	return &Hash{
+		listpack: make([]entry, 0),
+	}
+}
+
+// 编码类型
+func (h *Hash) Encoding() string {
+	if h.dict != nil {
+		return EncodingHashtable
+	}
+	return EncodingListpack
+}
+
+// 在 listpack 中查找 field 的下标，不存在时返回 -1
+func (h *Hash) indexOf(field string) int {
+	for i, e := range h.listpack {
+		if e.field == field {
+			return i
+		}
+	}
+	return -1
+}
+
+// 转换为 dict 编码
+func (h *Hash) convert() {
+	d := dict.MakeSimple()
+	for _, e := range h.listpack {
+		d.Put(e.field, e.value)
+	}
+	h.dict = d
+	h.listpack = nil
+}
+
+// 获取 field 对应的 value
+func (h *Hash) Get(field string) ([]byte, bool) {
+	if h.dict != nil {
+		val, ok := h.dict.Get(field)
+		if !ok {
+			return nil, false
+		}
+		return val.([]byte), true
+	}
+	i := h.indexOf(field)
+	if i < 0 {
+		return nil, false
+	}
+	return h.listpack[i].value, true
+}
+
+// 设置 field 的 value，新增时返回 1，更新时返回 0
+func (h *Hash) Set(field string, value []byte) int {
+	if h.dict != nil {
+		return h.dict.Put(field, value)
+	}
+
+	if i := h.indexOf(field); i >= 0 {
+		h.listpack[i].value = value
+		if len(value) > maxListpackValue {
+			h.convert()
+		}
+		return 0
+	}
+	h.listpack = append(h.listpack, entry{field: field, value: value})
+	if len(h.listpack) > maxListpackEntries || len(field) > maxListpackValue || len(value) > maxListpackValue {
+		h.convert()
+	}
+	return 1
+}
+
+// 删除 field，返回删除的个数
+func (h *Hash) Remove(field string) int {
+	if h.dict != nil {
+		return h.dict.Remove(field)
+	}
+	i := h.indexOf(field)
+	if i < 0 {
+		return 0
+	}
+	h.listpack = append(h.listpack[:i], h.listpack[i+1:]...)
+	return 1
+}
+
+// field 个数
+func (h *Hash) Len() int {
+	if h.dict != nil {
+		return h.dict.Len()
+	}
+	return len(h.listpack)
+}
+
+// 遍历所有 field/value
+func (h *Hash) ForEach(consumer Consumer) {
+	if h.dict != nil {
+		h.dict.ForEach(func(key string, val interface{}) bool {
+			return consumer(key, val.([]byte))
+		})
+		return
+	}
+	for _, e := range h.listpack {
+		if !consumer(e.field, e.value) {
+			break
+		}
+	}
+}
+
+// 获取所有 field
+func (h *Hash) Fields() []string {
+	fields := make([]string, 0, h.Len())
+	h.ForEach(func(field string, value []byte) bool {
+		fields = append(fields, field)
+		return true
+	})
+	return fields
+}
+
+// 游标遍历 field，listpack 编码时一次返回全部 field，游标为 0 表示遍历结束
+func (h *Hash) Scan(cursor int, count int) ([]string, int) {
+	if h.dict != nil {
+		return h.dict.Scan(cursor, count)
+	}
+	return h.Fields(), 0
+}
+
+// 获取随机 limit 个 field 可能包含重复的
+func (h *Hash) RandomFields(limit int) []string {
+	if h.dict != nil {
+		return h.dict.RandomKeys(limit)
+	}
+	if len(h.listpack) == 0 {
+		return nil
+	}
+	result := make([]string, limit)
+	for i := range result {
+		result[i] = h.listpack[rand.Intn(len(h.listpack))].field
+	}
+	return result
+}
+
+// 获取随机 limit 个 field 不包含重复的
+func (h *Hash) RandomDistinctFields(limit int) []string {
+	if h.dict != nil {
+		return h.dict.RandomDistinctKeys(limit)
+	}
+	if limit > len(h.listpack) {
+		limit = len(h.listpack)
+	}
+	result := make([]string, limit)
+	for i, j := range rand.Perm(len(h.listpack))[:limit] {
+		result[i] = h.listpack[j].field
+	}
+	return result
+}
@@ -0,0 +1,27 @@
+// 列表数据类型
+
+package list
+
+// 判断元素是否为期望值
+type Expected func(a interface{}) bool
+
+// 用于遍历 list 如果返回 false 则 break 遍历
+type Consumer func(i int, v interface{}) bool
+
+// 抽象 list 类型
+type List interface {
+	Add(val interface{})
+	Get(index int) (val interface{})
+	Set(index int, val interface{})
+	Insert(index int, val interface{})
+	Remove(index int) (val interface{})
+	RemoveLast() (val interface{})
+	RemoveAllByVal(expected Expected) int
+	RemoveByVal(expected Expected, count int) int
+	ReverseRemoveByVal(expected Expected, count int) int
+	Len() int
+	ForEach(consumer Consumer)
+	ReverseForEach(consumer Consumer)
+	Contains(expected Expected) bool
+	Range(start int, stop int) []interface{}
+}
@@ -0,0 +1,414 @@
+// 快速列表 QuickList
+// 由若干固定容量的 page 组成的双向链表，定位元素时按 page 跳跃，避免逐节点遍历
+
+package list
+
+import "container/list"
+
+// 每个 page 的容量，必须为偶数
+const pageSize = 1024
+
+// 快速列表
+type QuickList struct {
+	data *list.List // []interface{} 组成的链表
+	size int        // 元素总数
+}
+
+// 迭代器，指向某个 page 中的某个位置
+type iterator struct {
+	node   *list.Element
+	offset int
+	ql     *QuickList
+}
+
+// 创建快速列表
+func NewQuickList() *QuickList {
+	return &QuickList{
+		data: list.New(),
+	}
+}
+
+/* ------------------ 迭代器 ------------------ */
+
+// 根据下标找到元素所在的位置，从较近的一端开始查找
+func (ql *QuickList) find(index int) *iterator {
+	if ql == nil {
+		panic("list is nil")
+	}
+	if index < 0 || index >= ql.size {
+		panic("index out of bound")
+	}
+
+	var n *list.Element
+	var page []interface{}
+	var pageBeg int
+	if index < ql.size/2 {
+		// 从头部开始查找
+		n = ql.data.Front()
+		pageBeg = 0
+		for {
+			page = n.Value.([]interface{})
+			if pageBeg+len(page) > index {
+				break
+			}
+			pageBeg += len(page)
+			n = n.Next()
+		}
+	} else {
+		// 从尾部开始查找
+		n = ql.data.Back()
+		pageBeg = ql.size
+		for {
+			page = n.Value.([]interface{})
+			pageBeg -= len(page)
+			if pageBeg <= index {
+				break
+			}
+			n = n.Prev()
+		}
+	}
+
+	return &iterator{
+		node:   n,
+		offset: index - pageBeg,
+		ql:     ql,
+	}
+}
+
+func (iter *iterator) page() []interface{} {
+	return iter.node.Value.([]interface{})
+}
+
+func (iter *iterator) get() interface{} {
+	return iter.page()[iter.offset]
+}
+
+func (iter *iterator) set(val interface{}) {
+	page := iter.page()
+	page[iter.offset] = val
+}
+
+// 移动到下一个元素，已经是最后一个元素时返回 false
+func (iter *iterator) next() bool {
+	page := iter.page()
+	if iter.offset < len(page)-1 {
+		iter.offset++
+		return true
+	}
+	if iter.node == iter.ql.data.Back() {
+		// 已经到达末尾
+		iter.offset = len(page)
+		return false
+	}
+	iter.offset = 0
+	iter.node = iter.node.Next()
+	return true
+}
+
+// 移动到上一个元素，已经是第一个元素时返回 false
+func (iter *iterator) prev() bool {
+	if iter.offset > 0 {
+		iter.offset--
+		return true
+	}
+	if iter.node == iter.ql.data.Front() {
+		// 已经到达开头
+		iter.offset = -1
+		return false
+	}
+	iter.node = iter.node.Prev()
+	prevPage := iter.node.Value.([]interface{})
+	iter.offset = len(prevPage) - 1
+	return true
+}
+
+func (iter *iterator) atEnd() bool {
+	if iter.ql.data.Len() == 0 || iter.node == nil {
+		return true
+	}
+	if iter.node != iter.ql.data.Back() {
+		return false
+	}
+	return iter.offset == len(iter.page())
+}
+
+func (iter *iterator) atBegin() bool {
+	if iter.ql.data.Len() == 0 || iter.node == nil {
+		return true
+	}
+	if iter.node != iter.ql.data.Front() {
+		return false
+	}
+	return iter.offset == -1
+}
+
+// 删除当前元素，迭代器指向被删除元素的下一个元素
+func (iter *iterator) remove() interface{} {
+	page := iter.page()
+	val := page[iter.offset]
+	page = append(page[:iter.offset], page[iter.offset+1:]...)
+
+	if len(page) > 0 {
+		iter.node.Value = page
+		if iter.offset == len(page) && iter.node != iter.ql.data.Back() {
+			// 删除的是 page 的最后一个元素，移动到下一个 page
+			iter.node = iter.node.Next()
+			iter.offset = 0
+		}
+	} else if iter.node == iter.ql.data.Back() {
+		// page 为空并且是最后一个 page
+		prevNode := iter.node.Prev()
+		iter.ql.data.Remove(iter.node)
+		if prevNode != nil {
+			iter.node = prevNode
+			iter.offset = len(prevNode.Value.([]interface{}))
+		} else {
+			// 列表已经为空
+			iter.node = nil
+			iter.offset = 0
+		}
+	} else {
+		// page 为空，移除 page
+		nextNode := iter.node.Next()
+		iter.ql.data.Remove(iter.node)
+		iter.node = nextNode
+		iter.offset = 0
+	}
+
+	iter.ql.size--
+	return val
+}
+
+/* ------------------ 安排 datastruct/list 接口 ------------------ */
+
+// 在尾部添加元素
+func (ql *QuickList) Add(val interface{}) {
+	ql.size++
+	if ql.data.Len() == 0 {
+		page := make([]interface{}, 0, pageSize)
+		page = append(page, val)
+		ql.data.PushBack(page)
+		return
+	}
+
+	backNode := ql.data.Back()
+	backPage := backNode.Value.([]interface{})
+	if len(backPage) >= pageSize {
+		// page 已满，新建 page
+		page := make([]interface{}, 0, pageSize)
+		page = append(page, val)
+		ql.data.PushBack(page)
+		return
+	}
+	backNode.Value = append(backPage, val)
+}
+
+// 获取下标对应的元素
+func (ql *QuickList) Get(index int) (val interface{}) {
+	iter := ql.find(index)
+	return iter.get()
+}
+
+// 修改下标对应的元素
+func (ql *QuickList) Set(index int, val interface{}) {
+	iter := ql.find(index)
+	iter.set(val)
+}
+
+// 在下标位置插入元素，index == Len() 时在尾部添加
+func (ql *QuickList) Insert(index int, val interface{}) {
+	if index == ql.size {
+		ql.Add(val)
+		return
+	}
+	if index == 0 && ql.data.Len() > 0 {
+		frontNode := ql.data.Front()
+		frontPage := frontNode.Value.([]interface{})
+		if len(frontPage) >= pageSize {
+			// 头部 page 已满，直接在头部新建 page
+			page := make([]interface{}, 0, pageSize)
+			page = append(page, val)
+			ql.data.PushFront(page)
+			ql.size++
+			return
+		}
+	}
+
+	iter := ql.find(index)
+	page := iter.page()
+	if len(page) < pageSize {
+		// page 未满，直接插入
+		page = append(page[:iter.offset+1], page[iter.offset:]...)
+		page[iter.offset] = val
+		iter.node.Value = page
+		ql.size++
+		return
+	}
+
+	// page 已满，分裂为两个 page
+	var nextPage []interface{}
+	nextPage = append(nextPage, page[pageSize/2:]...)
+	page = page[:pageSize/2]
+	if iter.offset < len(page) {
+		page = append(page[:iter.offset+1], page[iter.offset:]...)
+		page[iter.offset] = val
+	} else {
+		i := iter.offset - pageSize/2
+		nextPage = append(nextPage[:i+1], nextPage[i:]...)
+		nextPage[i] = val
+	}
+	iter.node.Value = page
+	ql.data.InsertAfter(nextPage, iter.node)
+	ql.size++
+}
+
+// 删除下标对应的元素
+func (ql *QuickList) Remove(index int) interface{} {
+	iter := ql.find(index)
+	return iter.remove()
+}
+
+// 删除最后一个元素
+func (ql *QuickList) RemoveLast() interface{} {
+	if ql.Len() == 0 {
+		return nil
+	}
+	ql.size--
+	lastNode := ql.data.Back()
+	lastPage := lastNode.Value.([]interface{})
+	if len(lastPage) == 1 {
+		ql.data.Remove(lastNode)
+		return lastPage[0]
+	}
+	val := lastPage[len(lastPage)-1]
+	lastNode.Value = lastPage[:len(lastPage)-1]
+	return val
+}
+
+// 删除所有期望的元素，返回删除的个数
+func (ql *QuickList) RemoveAllByVal(expected Expected) int {
+	return ql.RemoveByVal(expected, 0)
+}
+
+// 从头部开始删除 count 个期望的元素，count <= 0 时删除全部
+func (ql *QuickList) RemoveByVal(expected Expected, count int) int {
+	if ql.size == 0 {
+		return 0
+	}
+	iter := ql.find(0)
+	removed := 0
+	for !iter.atEnd() {
+		if expected(iter.get()) {
+			iter.remove()
+			removed++
+			if removed == count {
+				break
+			}
+		} else {
+			iter.next()
+		}
+	}
+	return removed
+}
+
+// 从尾部开始删除 count 个期望的元素，count <= 0 时删除全部
+func (ql *QuickList) ReverseRemoveByVal(expected Expected, count int) int {
+	if ql.size == 0 {
+		return 0
+	}
+	iter := ql.find(ql.size - 1)
+	removed := 0
+	for !iter.atBegin() {
+		if expected(iter.get()) {
+			iter.remove()
+			removed++
+			if removed == count || ql.size == 0 {
+				break
+			}
+		}
+		iter.prev()
+	}
+	return removed
+}
+
+// 元素个数
+func (ql *QuickList) Len() int {
+	return ql.size
+}
+
+// 从头部开始遍历
+func (ql *QuickList) ForEach(consumer Consumer) {
+	if ql == nil {
+		panic("list is nil")
+	}
+	if ql.Len() == 0 {
+		return
+	}
+	iter := ql.find(0)
+	i := 0
+	for {
+		goNext := consumer(i, iter.get())
+		if !goNext {
+			break
+		}
+		i++
+		if !iter.next() {
+			break
+		}
+	}
+}
+
+// 从尾部开始遍历，下标仍然是正向下标
+func (ql *QuickList) ReverseForEach(consumer Consumer) {
+	if ql == nil {
+		panic("list is nil")
+	}
+	if ql.Len() == 0 {
+		return
+	}
+	iter := ql.find(ql.size - 1)
+	i := ql.size - 1
+	for {
+		goNext := consumer(i, iter.get())
+		if !goNext {
+			break
+		}
+		i--
+		if !iter.prev() {
+			break
+		}
+	}
+}
+
+// 是否包含期望的元素
+func (ql *QuickList) Contains(expected Expected) bool {
+	contains := false
+	ql.ForEach(func(i int, actual interface{}) bool {
+		if expected(actual) {
+			contains = true
+			return false
+		}
+		return true
+	})
+	return contains
+}
+
+// 获取 [start, stop) 范围内的元素
+func (ql *QuickList) Range(start int, stop int) []interface{} {
+	if start < 0 || start >= ql.Len() {
+		panic("`start` out of range")
+	}
+	if stop < start || stop > ql.Len() {
+		panic("`stop` out of range")
+	}
+	sliceSize := stop - start
+	slice := make([]interface{}, 0, sliceSize)
+	iter := ql.find(start)
+	i := 0
+	for i < sliceSize {
+		slice = append(slice, iter.get())
+		iter.next()
+		i++
+	}
+	return slice
+}
@@ -0,0 +1,109 @@
+// 测试快速列表
+
+package list
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// 与切片逐个比较
+func assertSlice(t *testing.T, ql *QuickList, expected []int) {
+	t.Helper()
+	if ql.Len() != len(expected) {
+		t.Fatalf("expected len %d, actually %d", len(expected), ql.Len())
+	}
+	ql.ForEach(func(i int, v interface{}) bool {
+		if v.(int) != expected[i] {
+			t.Fatalf("index %d: expected %d, actually %d", i, expected[i], v.(int))
+		}
+		return true
+	})
+	for i := range expected {
+		if ql.Get(i).(int) != expected[i] {
+			t.Fatalf("get %d: expected %d, actually %d", i, expected[i], ql.Get(i).(int))
+		}
+	}
+}
+
+func TestQuickListAddAndInsert(t *testing.T) {
+	ql := NewQuickList()
+	var expected []int
+	for i := 0; i < pageSize*3; i++ {
+		ql.Add(i)
+		expected = append(expected, i)
+	}
+	// 头部插入
+	for i := 0; i < pageSize+10; i++ {
+		ql.Insert(0, -i)
+		expected = append([]int{-i}, expected...)
+	}
+	// 随机位置插入，触发 page 分裂
+	for i := 0; i < pageSize; i++ {
+		index := rand.Intn(ql.Len())
+		ql.Insert(index, i)
+		expected = append(expected[:index+1], expected[index:]...)
+		expected[index] = i
+	}
+	assertSlice(t, ql, expected)
+
+	start, stop := 10, pageSize*2+7
+	for i, v := range ql.Range(start, stop) {
+		if v.(int) != expected[start+i] {
+			t.Fatalf("range %d: expected %d, actually %d", i, expected[start+i], v.(int))
+		}
+	}
+}
+
+func TestQuickListRemove(t *testing.T) {
+	ql := NewQuickList()
+	var expected []int
+	for i := 0; i < pageSize*2; i++ {
+		ql.Add(i % 3)
+		expected = append(expected, i%3)
+	}
+	for i := 0; i < 100; i++ {
+		index := rand.Intn(ql.Len())
+		ql.Remove(index)
+		expected = append(expected[:index], expected[index+1:]...)
+	}
+	assertSlice(t, ql, expected)
+
+	removed := ql.RemoveAllByVal(func(a interface{}) bool { return a.(int) == 0 })
+	var rest []int
+	for _, v := range expected {
+		if v != 0 {
+			rest = append(rest, v)
+		}
+	}
+	if removed != len(expected)-len(rest) {
+		t.Fatalf("expected removed %d, actually %d", len(expected)-len(rest), removed)
+	}
+	assertSlice(t, ql, rest)
+
+	for ql.Len() > 0 {
+		ql.RemoveLast()
+	}
+	assertSlice(t, ql, nil)
+}
+
+func TestQuickListRemoveByVal(t *testing.T) {
+	ql := NewQuickList()
+	for _, v := range []int{1, 2, 1, 3, 1, 2} {
+		ql.Add(v)
+	}
+	isOne := func(a interface{}) bool { return a.(int) == 1 }
+	if n := ql.RemoveByVal(isOne, 1); n != 1 {
+		t.Fatalf("expected 1, actually %d", n)
+	}
+	assertSlice(t, ql, []int{2, 1, 3, 1, 2})
+	if n := ql.ReverseRemoveByVal(isOne, 1); n != 1 {
+		t.Fatalf("expected 1, actually %d", n)
+	}
+	assertSlice(t, ql, []int{2, 1, 3, 2})
+	isTwo := func(a interface{}) bool { return a.(int) == 2 }
+	if n := ql.ReverseRemoveByVal(isTwo, 0); n != 2 {
+		t.Fatalf("expected 2, actually %d", n)
+	}
+	assertSlice(t, ql, []int{1, 3})
+}
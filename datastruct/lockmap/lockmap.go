@@ -193,3 +193,31 @@ func (locks *Locks) RWUnLocks(writeKeys []string, readKeys []string) {
 		}
 	}
 }
+
+// 对所有 key 上写锁，按下标顺序上锁，与 Locks 的顺序一致
+func (locks *Locks) LockAll() {
+	for _, mu := range locks.table {
+		mu.Lock()
+	}
+}
+
+// 开所有 key 的写锁
+func (locks *Locks) UnLockAll() {
+	for i := len(locks.table) - 1; i >= 0; i-- {
+		locks.table[i].Unlock()
+	}
+}
+
+// 对所有 key 上读锁
+func (locks *Locks) RLockAll() {
+	for _, mu := range locks.table {
+		mu.RLock()
+	}
+}
+
+// 开所有 key 的读锁
+func (locks *Locks) RUnLockAll() {
+	for i := len(locks.table) - 1; i >= 0; i-- {
+		locks.table[i].RUnlock()
+	}
+}
@@ -0,0 +1,124 @@
+// 集合数据类型，基于 dict.Dict 实现
+
+package set
+
+import "ljr-redis/datastruct/dict"
+
+// 集合
+type Set struct {
+	dict dict.Dict
+}
+
+// 创建集合
+func Make(members ...string) *Set {
+	set := &Set{
+		dict: dict.MakeSimple(),
+	}
+	for _, member := range members {
+		set.Add(member)
+	}
+	return set
+}
+
+// 添加元素，新增时返回 1
+func (set *Set) Add(val string) int {
+	return set.dict.Put(val, nil)
+}
+
+// 删除元素，删除成功返回 1
+func (set *Set) Remove(val string) int {
+	return set.dict.Remove(val)
+}
+
+// 是否包含元素
+func (set *Set) Has(val string) bool {
+	_, exists := set.dict.Get(val)
+	return exists
+}
+
+// 元素个数
+func (set *Set) Len() int {
+	return set.dict.Len()
+}
+
+// 转换为切片
+func (set *Set) ToSlice() []string {
+	return set.dict.Keys()
+}
+
+// 遍历元素，consumer 返回 false 时 break
+func (set *Set) ForEach(consumer func(member string) bool) {
+	set.dict.ForEach(func(key string, val interface{}) bool {
+		return consumer(key)
+	})
+}
+
+// 游标遍历元素，游标为 0 表示遍历结束
+func (set *Set) Scan(cursor int, count int) ([]string, int) {
+	return set.dict.Scan(cursor, count)
+}
+
+// 交集
+func (set *Set) Intersect(another *Set) *Set {
+	if set == nil {
+		panic("set is nil")
+	}
+	// 遍历较小的集合
+	small, big := set, another
+	if small.Len() > big.Len() {
+		small, big = big, small
+	}
+	result := Make()
+	small.ForEach(func(member string) bool {
+		if big.Has(member) {
+			result.Add(member)
+		}
+		return true
+	})
+	return result
+}
+
+// 并集
+func (set *Set) Union(another *Set) *Set {
+	if set == nil {
+		panic("set is nil")
+	}
+	result := Make()
+	set.ForEach(func(member string) bool {
+		result.Add(member)
+		return true
+	})
+	another.ForEach(func(member string) bool {
+		result.Add(member)
+		return true
+	})
+	return result
+}
+
+// 差集
+func (set *Set) Diff(another *Set) *Set {
+	if set == nil {
+		panic("set is nil")
+	}
+	result := Make()
+	set.ForEach(func(member string) bool {
+		if !another.Has(member) {
+			result.Add(member)
+		}
+		return true
+	})
+	return result
+}
+
+// 获取随机 limit 个元素 可能包含重复的
+func (set *Set) RandomMembers(limit int) []string {
+	if set.Len() == 0 {
+		return nil
+	}
+	return set.dict.RandomKeys(limit)
+}
+
+// 获取随机 limit 个元素 不包含重复的
+func (set *Set) RandomDistinctMembers(limit int) []string {
+	return set.dict.RandomDistinctKeys(limit)
+}
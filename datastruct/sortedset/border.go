@@ -0,0 +1,163 @@
+// 范围查询的边界，支持按分数和按字典序
+
+package sortedset
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	negativeInf int8 = -1
+	positiveInf int8 = 1
+)
+
+// 范围边界
+type Border interface {
+	// 作为下界时 element 是否在范围内
+	less(element *Element) bool
+	// 作为上界时 element 是否在范围内
+	greater(element *Element) bool
+	// 作为下界时，与上界 max 组成的范围是否为空
+	isEmpty(max Border) bool
+}
+
+/* ---------- 分数边界 ------------ */
+
+// 分数边界，例如 1 (1 -inf +inf
+type ScoreBorder struct {
+	Inf     int8
+	Value   float64
+	Exclude bool
+}
+
+func (border *ScoreBorder) less(element *Element) bool {
+	if border.Inf == negativeInf {
+		return true
+	} else if border.Inf == positiveInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value < element.Score
+	}
+	return border.Value <= element.Score
+}
+
+func (border *ScoreBorder) greater(element *Element) bool {
+	if border.Inf == positiveInf {
+		return true
+	} else if border.Inf == negativeInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value > element.Score
+	}
+	return border.Value >= element.Score
+}
+
+func (border *ScoreBorder) isEmpty(max Border) bool {
+	maxBorder, ok := max.(*ScoreBorder)
+	if !ok {
+		return true
+	}
+	if border.Inf == positiveInf || maxBorder.Inf == negativeInf {
+		return true
+	}
+	if border.Inf == negativeInf || maxBorder.Inf == positiveInf {
+		return false
+	}
+	if border.Value > maxBorder.Value {
+		return true
+	}
+	return border.Value == maxBorder.Value && (border.Exclude || maxBorder.Exclude)
+}
+
+// 解析分数边界
+func ParseScoreBorder(s string) (Border, error) {
+	switch s {
+	case "inf", "+inf":
+		return &ScoreBorder{Inf: positiveInf}, nil
+	case "-inf":
+		return &ScoreBorder{Inf: negativeInf}, nil
+	}
+	exclude := false
+	if len(s) > 0 && s[0] == '(' {
+		exclude = true
+		s = s[1:]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value != value {
+		return nil, errors.New("ERR min or max is not a float")
+	}
+	return &ScoreBorder{
+		Value:   value,
+		Exclude: exclude,
+	}, nil
+}
+
+/* ---------- 字典序边界 ------------ */
+
+// 字典序边界，例如 [a (a - +
+type LexBorder struct {
+	Inf     int8
+	Value   string
+	Exclude bool
+}
+
+func (border *LexBorder) less(element *Element) bool {
+	if border.Inf == negativeInf {
+		return true
+	} else if border.Inf == positiveInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value < element.Member
+	}
+	return border.Value <= element.Member
+}
+
+func (border *LexBorder) greater(element *Element) bool {
+	if border.Inf == positiveInf {
+		return true
+	} else if border.Inf == negativeInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value > element.Member
+	}
+	return border.Value >= element.Member
+}
+
+func (border *LexBorder) isEmpty(max Border) bool {
+	maxBorder, ok := max.(*LexBorder)
+	if !ok {
+		return true
+	}
+	if border.Inf == positiveInf || maxBorder.Inf == negativeInf {
+		return true
+	}
+	if border.Inf == negativeInf || maxBorder.Inf == positiveInf {
+		return false
+	}
+	if border.Value > maxBorder.Value {
+		return true
+	}
+	return border.Value == maxBorder.Value && (border.Exclude || maxBorder.Exclude)
+}
+
+// 解析字典序边界
+func ParseLexBorder(s string) (Border, error) {
+	switch s {
+	case "+":
+		return &LexBorder{Inf: positiveInf}, nil
+	case "-":
+		return &LexBorder{Inf: negativeInf}, nil
+	}
+	if len(s) == 0 || (s[0] != '(' && s[0] != '[') {
+		return nil, errors.New("ERR min or max not valid string range item")
+	}
+	return &LexBorder{
+		Value:   s[1:],
+		Exclude: s[0] == '(',
+	}, nil
+}
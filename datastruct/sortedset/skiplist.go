@@ -0,0 +1,306 @@
+// 跳表，按 (score, member) 升序排列，每层记录跨度用于计算排名
+
+package sortedset
+
+import "math/rand"
+
+const (
+	maxLevel = 16
+	// 每一层晋升的概率
+	levelP = 0.25
+)
+
+// 有序集合中的元素
+type Element struct {
+	Member string
+	Score  float64
+}
+
+// 跳表中的一层
+type Level struct {
+	forward *node // 指向同一层的下一个节点
+	span    int64 // 到下一个节点跨越的节点数
+}
+
+// 跳表节点
+type node struct {
+	Element
+	backward *node
+	level    []*Level // level[0] 是最底层
+}
+
+type skiplist struct {
+	header *node
+	tail   *node
+	length int64
+	level  int16
+}
+
+func makeNode(level int16, score float64, member string) *node {
+	n := &node{
+		Element: Element{
+			Score:  score,
+			Member: member,
+		},
+		level: make([]*Level, level),
+	}
+	for i := range n.level {
+		n.level[i] = new(Level)
+	}
+	return n
+}
+
+func makeSkiplist() *skiplist {
+	return &skiplist{
+		level:  1,
+		header: makeNode(maxLevel, 0, ""),
+	}
+}
+
+func randomLevel() int16 {
+	level := int16(1)
+	for float32(rand.Int31()&0xFFFF) < levelP*0xFFFF {
+		level++
+	}
+	if level < maxLevel {
+		return level
+	}
+	return maxLevel
+}
+
+// 元素 (score, member) 是否排在 n 之后
+func (n *node) before(score float64, member string) bool {
+	return n.Score < score || (n.Score == score && n.Member < member)
+}
+
+func (sl *skiplist) insert(member string, score float64) *node {
+	update := make([]*node, maxLevel) // 每一层中插入位置的前一个节点
+	rank := make([]int64, maxLevel)   // update[i] 的排名
+
+	n := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		if i == sl.level-1 {
+			rank[i] = 0
+		} else {
+			rank[i] = rank[i+1]
+		}
+		for n.level[i].forward != nil && n.level[i].forward.before(score, member) {
+			rank[i] += n.level[i].span
+			n = n.level[i].forward
+		}
+		update[i] = n
+	}
+
+	level := randomLevel()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = sl.header
+			update[i].level[i].span = sl.length
+		}
+		sl.level = level
+	}
+
+	n = makeNode(level, score, member)
+	for i := int16(0); i < level; i++ {
+		n.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = n
+
+		n.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = (rank[0] - rank[i]) + 1
+	}
+	// 更高的层跨越了新节点
+	for i := level; i < sl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] == sl.header {
+		n.backward = nil
+	} else {
+		n.backward = update[0]
+	}
+	if n.level[0].forward != nil {
+		n.level[0].forward.backward = n
+	} else {
+		sl.tail = n
+	}
+	sl.length++
+	return n
+}
+
+// 删除节点，update 为每一层中 n 的前一个节点
+func (sl *skiplist) removeNode(n *node, update []*node) {
+	for i := int16(0); i < sl.level; i++ {
+		if update[i].level[i].forward == n {
+			update[i].level[i].span += n.level[i].span - 1
+			update[i].level[i].forward = n.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if n.level[0].forward != nil {
+		n.level[0].forward.backward = n.backward
+	} else {
+		sl.tail = n.backward
+	}
+	for sl.level > 1 && sl.header.level[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+}
+
+func (sl *skiplist) remove(member string, score float64) bool {
+	update := make([]*node, maxLevel)
+	n := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for n.level[i].forward != nil && n.level[i].forward.before(score, member) {
+			n = n.level[i].forward
+		}
+		update[i] = n
+	}
+	n = n.level[0].forward
+	if n != nil && n.Score == score && n.Member == member {
+		sl.removeNode(n, update)
+		return true
+	}
+	return false
+}
+
+// 获取元素的排名，从 1 开始，不存在时返回 0
+func (sl *skiplist) getRank(member string, score float64) int64 {
+	var rank int64 = 0
+	n := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for n.level[i].forward != nil &&
+			(n.level[i].forward.before(score, member) ||
+				(n.level[i].forward.Score == score && n.level[i].forward.Member == member)) {
+			rank += n.level[i].span
+			n = n.level[i].forward
+		}
+		if n != sl.header && n.Member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// 根据排名获取节点，排名从 1 开始
+func (sl *skiplist) getByRank(rank int64) *node {
+	var i int64 = 0
+	n := sl.header
+	for level := sl.level - 1; level >= 0; level-- {
+		for n.level[level].forward != nil && i+n.level[level].span <= rank {
+			i += n.level[level].span
+			n = n.level[level].forward
+		}
+		if i == rank {
+			return n
+		}
+	}
+	return nil
+}
+
+// 跳表中是否有元素在 [min, max] 范围内
+func (sl *skiplist) hasInRange(min, max Border) bool {
+	if min.isEmpty(max) {
+		return false
+	}
+	n := sl.tail
+	if n == nil || !min.less(&n.Element) {
+		return false
+	}
+	n = sl.header.level[0].forward
+	if n == nil || !max.greater(&n.Element) {
+		return false
+	}
+	return true
+}
+
+// 范围内的第一个节点
+func (sl *skiplist) getFirstInRange(min, max Border) *node {
+	if !sl.hasInRange(min, max) {
+		return nil
+	}
+	n := sl.header
+	for level := sl.level - 1; level >= 0; level-- {
+		for n.level[level].forward != nil && !min.less(&n.level[level].forward.Element) {
+			n = n.level[level].forward
+		}
+	}
+	n = n.level[0].forward
+	if n == nil || !max.greater(&n.Element) {
+		return nil
+	}
+	return n
+}
+
+// 范围内的最后一个节点
+func (sl *skiplist) getLastInRange(min, max Border) *node {
+	if !sl.hasInRange(min, max) {
+		return nil
+	}
+	n := sl.header
+	for level := sl.level - 1; level >= 0; level-- {
+		for n.level[level].forward != nil && max.greater(&n.level[level].forward.Element) {
+			n = n.level[level].forward
+		}
+	}
+	if n == sl.header || !min.less(&n.Element) {
+		return nil
+	}
+	return n
+}
+
+// 删除范围内的元素，limit <= 0 时不限制个数
+func (sl *skiplist) removeRange(min, max Border, limit int) []*Element {
+	update := make([]*node, maxLevel)
+	removed := make([]*Element, 0)
+	n := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for n.level[i].forward != nil && !min.less(&n.level[i].forward.Element) {
+			n = n.level[i].forward
+		}
+		update[i] = n
+	}
+
+	n = n.level[0].forward
+	for n != nil && max.greater(&n.Element) {
+		next := n.level[0].forward
+		element := n.Element
+		removed = append(removed, &element)
+		sl.removeNode(n, update)
+		if limit > 0 && len(removed) == limit {
+			break
+		}
+		n = next
+	}
+	return removed
+}
+
+// 删除排名在 [start, stop) 内的元素，排名从 1 开始
+func (sl *skiplist) removeRangeByRank(start, stop int64) []*Element {
+	var i int64 = 0
+	update := make([]*node, maxLevel)
+	removed := make([]*Element, 0)
+
+	n := sl.header
+	for level := sl.level - 1; level >= 0; level-- {
+		for n.level[level].forward != nil && i+n.level[level].span < start {
+			i += n.level[level].span
+			n = n.level[level].forward
+		}
+		update[level] = n
+	}
+
+	i++
+	n = n.level[0].forward
+	for n != nil && i < stop {
+		next := n.level[0].forward
+		element := n.Element
+		removed = append(removed, &element)
+		sl.removeNode(n, update)
+		n = next
+		i++
+	}
+	return removed
+}
@@ -0,0 +1,220 @@
+// 有序集合，使用 dict 保存 member 到 score 的映射，使用跳表维护顺序
+
+package sortedset
+
+import (
+	"strconv"
+
+	"ljr-redis/datastruct/dict"
+)
+
+// 有序集合
+type SortedSet struct {
+	dict     dict.Dict // member -> *Element
+	skiplist *skiplist
+}
+
+// 用于遍历有序集合 如果返回 false 则 break 遍历
+type Consumer func(element *Element) bool
+
+// 创建有序集合
+func Make() *SortedSet {
+	return &SortedSet{
+		dict:     dict.MakeSimple(),
+		skiplist: makeSkiplist(),
+	}
+}
+
+// 添加或更新元素，新增时返回 true
+func (ss *SortedSet) Add(member string, score float64) bool {
+	element, ok := ss.Get(member)
+	ss.dict.Put(member, &Element{
+		Member: member,
+		Score:  score,
+	})
+	if ok {
+		if score != element.Score {
+			ss.skiplist.remove(member, element.Score)
+			ss.skiplist.insert(member, score)
+		}
+		return false
+	}
+	ss.skiplist.insert(member, score)
+	return true
+}
+
+// 元素个数
+func (ss *SortedSet) Len() int64 {
+	return int64(ss.dict.Len())
+}
+
+// 获取元素
+func (ss *SortedSet) Get(member string) (*Element, bool) {
+	raw, ok := ss.dict.Get(member)
+	if !ok {
+		return nil, false
+	}
+	return raw.(*Element), true
+}
+
+// 删除元素，成功时返回 true
+func (ss *SortedSet) Remove(member string) bool {
+	element, ok := ss.Get(member)
+	if !ok {
+		return false
+	}
+	ss.skiplist.remove(member, element.Score)
+	ss.dict.Remove(member)
+	return true
+}
+
+// 获取元素的排名，从 0 开始，desc 为 true 时按分数从大到小，不存在时返回 -1
+func (ss *SortedSet) GetRank(member string, desc bool) int64 {
+	element, ok := ss.Get(member)
+	if !ok {
+		return -1
+	}
+	rank := ss.skiplist.getRank(member, element.Score)
+	if desc {
+		return ss.skiplist.length - rank
+	}
+	return rank - 1
+}
+
+// 遍历排名在 [start, stop) 内的元素，排名从 0 开始
+func (ss *SortedSet) ForEachByRank(start, stop int64, desc bool, consumer Consumer) {
+	size := ss.Len()
+	if start < 0 || start > size {
+		panic("illegal start " + strconv.FormatInt(start, 10))
+	}
+	if stop < start || stop > size {
+		panic("illegal end " + strconv.FormatInt(stop, 10))
+	}
+	if start == stop {
+		return
+	}
+
+	var n *node
+	if desc {
+		n = ss.skiplist.getByRank(size - start)
+	} else {
+		n = ss.skiplist.getByRank(start + 1)
+	}
+	for i := start; i < stop && n != nil; i++ {
+		if !consumer(&n.Element) {
+			break
+		}
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+	}
+}
+
+// 获取排名在 [start, stop) 内的元素，排名从 0 开始
+func (ss *SortedSet) RangeByRank(start, stop int64, desc bool) []*Element {
+	result := make([]*Element, 0, stop-start)
+	ss.ForEachByRank(start, stop, desc, func(element *Element) bool {
+		result = append(result, element)
+		return true
+	})
+	return result
+}
+
+// 统计范围内的元素个数
+func (ss *SortedSet) RangeCount(min, max Border) int64 {
+	first := ss.skiplist.getFirstInRange(min, max)
+	if first == nil {
+		return 0
+	}
+	last := ss.skiplist.getLastInRange(min, max)
+	return ss.skiplist.getRank(last.Member, last.Score) - ss.skiplist.getRank(first.Member, first.Score) + 1
+}
+
+// 遍历范围内的元素，跳过前 offset 个，limit < 0 时不限制个数
+func (ss *SortedSet) ForEach(min, max Border, offset, limit int64, desc bool, consumer Consumer) {
+	var n *node
+	if desc {
+		n = ss.skiplist.getLastInRange(min, max)
+	} else {
+		n = ss.skiplist.getFirstInRange(min, max)
+	}
+	next := func() {
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+		if n != nil && (!min.less(&n.Element) || !max.greater(&n.Element)) {
+			n = nil
+		}
+	}
+	for ; n != nil && offset > 0; offset-- {
+		next()
+	}
+	for i := int64(0); n != nil && (limit < 0 || i < limit); i++ {
+		if !consumer(&n.Element) {
+			break
+		}
+		next()
+	}
+}
+
+// 获取范围内的元素，跳过前 offset 个，limit < 0 时不限制个数
+func (ss *SortedSet) Range(min, max Border, offset, limit int64, desc bool) []*Element {
+	result := make([]*Element, 0)
+	ss.ForEach(min, max, offset, limit, desc, func(element *Element) bool {
+		result = append(result, element)
+		return true
+	})
+	return result
+}
+
+// 删除范围内的元素，返回删除的个数
+func (ss *SortedSet) RemoveRange(min, max Border) int64 {
+	removed := ss.skiplist.removeRange(min, max, 0)
+	for _, element := range removed {
+		ss.dict.Remove(element.Member)
+	}
+	return int64(len(removed))
+}
+
+// 删除排名在 [start, stop) 内的元素，排名从 0 开始，返回删除的个数
+func (ss *SortedSet) RemoveByRank(start, stop int64) int64 {
+	removed := ss.skiplist.removeRangeByRank(start+1, stop+1)
+	for _, element := range removed {
+		ss.dict.Remove(element.Member)
+	}
+	return int64(len(removed))
+}
+
+// 弹出分数最小的 count 个元素
+func (ss *SortedSet) PopMin(count int) []*Element {
+	removed := ss.skiplist.removeRangeByRank(1, int64(count)+1)
+	for _, element := range removed {
+		ss.dict.Remove(element.Member)
+	}
+	return removed
+}
+
+// 弹出分数最大的 count 个元素，按分数从大到小返回
+func (ss *SortedSet) PopMax(count int) []*Element {
+	start := ss.Len() - int64(count)
+	if start < 0 {
+		start = 0
+	}
+	removed := ss.skiplist.removeRangeByRank(start+1, ss.Len()+1)
+	for i, j := 0, len(removed)-1; i < j; i, j = i+1, j-1 {
+		removed[i], removed[j] = removed[j], removed[i]
+	}
+	for _, element := range removed {
+		ss.dict.Remove(element.Member)
+	}
+	return removed
+}
+
+// 游标遍历 member，游标为 0 表示遍历结束
+func (ss *SortedSet) Scan(cursor int, count int) ([]string, int) {
+	return ss.dict.Scan(cursor, count)
+}
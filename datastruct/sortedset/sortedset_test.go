@@ -0,0 +1,137 @@
+// 测试有序集合
+
+package sortedset
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func members(elements []*Element) []string {
+	result := make([]string, len(elements))
+	for i, element := range elements {
+		result[i] = element.Member
+	}
+	return result
+}
+
+func assertMembers(t *testing.T, actual []*Element, expected ...string) {
+	t.Helper()
+	got := members(actual)
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, actually %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %v, actually %v", expected, got)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	ss := Make()
+	size := 200
+	for i := 0; i < size; i++ {
+		ss.Add(strconv.Itoa(i), float64(rand.Intn(50)))
+	}
+	// 更新分数
+	for i := 0; i < size; i += 3 {
+		ss.Add(strconv.Itoa(i), float64(rand.Intn(50)))
+	}
+
+	expected := make([]*Element, 0, size)
+	ss.dict.ForEach(func(key string, val interface{}) bool {
+		expected = append(expected, val.(*Element))
+		return true
+	})
+	sort.Slice(expected, func(i, j int) bool {
+		if expected[i].Score == expected[j].Score {
+			return expected[i].Member < expected[j].Member
+		}
+		return expected[i].Score < expected[j].Score
+	})
+	for i, element := range expected {
+		if rank := ss.GetRank(element.Member, false); rank != int64(i) {
+			t.Fatalf("%s: expected rank %d, actually %d", element.Member, i, rank)
+		}
+		if rank := ss.GetRank(element.Member, true); rank != int64(size-1-i) {
+			t.Fatalf("%s: expected rev rank %d, actually %d", element.Member, size-1-i, rank)
+		}
+	}
+	assertMembers(t, ss.RangeByRank(10, 13, false), members(expected[10:13])...)
+	assertMembers(t, ss.RangeByRank(0, 2, true), expected[size-1].Member, expected[size-2].Member)
+	if ss.GetRank("none", false) != -1 {
+		t.Error("rank of missing member should be -1")
+	}
+}
+
+func TestRangeByScore(t *testing.T) {
+	ss := Make()
+	for i := 0; i < 10; i++ {
+		ss.Add(strconv.Itoa(i), float64(i))
+	}
+	min, _ := ParseScoreBorder("(2")
+	max, _ := ParseScoreBorder("5")
+	assertMembers(t, ss.Range(min, max, 0, -1, false), "3", "4", "5")
+	assertMembers(t, ss.Range(min, max, 1, 1, true), "4")
+	if n := ss.RangeCount(min, max); n != 3 {
+		t.Errorf("expected 3, actually %d", n)
+	}
+
+	negInf, _ := ParseScoreBorder("-inf")
+	posInf, _ := ParseScoreBorder("+inf")
+	if n := ss.RangeCount(negInf, posInf); n != 10 {
+		t.Errorf("expected 10, actually %d", n)
+	}
+	// 空范围
+	if n := ss.RangeCount(max, min); n != 0 {
+		t.Errorf("expected 0, actually %d", n)
+	}
+
+	if n := ss.RemoveRange(min, max); n != 3 {
+		t.Errorf("expected 3, actually %d", n)
+	}
+	assertMembers(t, ss.Range(negInf, posInf, 0, -1, false), "0", "1", "2", "6", "7", "8", "9")
+	if _, ok := ss.Get("4"); ok {
+		t.Error("member should be removed")
+	}
+}
+
+func TestRangeByLex(t *testing.T) {
+	ss := Make()
+	for _, member := range []string{"a", "b", "c", "d", "e"} {
+		ss.Add(member, 0)
+	}
+	min, _ := ParseLexBorder("[b")
+	max, _ := ParseLexBorder("(e")
+	assertMembers(t, ss.Range(min, max, 0, -1, false), "b", "c", "d")
+	assertMembers(t, ss.Range(min, max, 0, 2, true), "d", "c")
+
+	minInf, _ := ParseLexBorder("-")
+	maxInf, _ := ParseLexBorder("+")
+	if n := ss.RangeCount(minInf, maxInf); n != 5 {
+		t.Errorf("expected 5, actually %d", n)
+	}
+	if _, err := ParseLexBorder("b"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestPopAndRemoveByRank(t *testing.T) {
+	ss := Make()
+	for i := 0; i < 10; i++ {
+		ss.Add(strconv.Itoa(i), float64(i))
+	}
+	assertMembers(t, ss.PopMin(2), "0", "1")
+	assertMembers(t, ss.PopMax(2), "9", "8")
+	if n := ss.RemoveByRank(1, 3); n != 2 {
+		t.Errorf("expected 2, actually %d", n)
+	}
+	assertMembers(t, ss.RangeByRank(0, ss.Len(), false), "2", "5", "6", "7")
+	assertMembers(t, ss.PopMax(10), "7", "6", "5", "2")
+	if ss.Len() != 0 || ss.skiplist.length != 0 {
+		t.Error("sorted set should be empty")
+	}
+}
@@ -7,20 +7,34 @@ package redis
 type Connection interface {
 	// 传递响应到客户端
 	Write([]byte) error
-	// 设置 Auth 密码
-	SetPassword(string)
-	// 获取 Auth 密码
-	GetPassword() string
+	// 设置认证的用户
+	SetUser(string)
+	// 获取认证的用户，没有认证时为空
+	GetUser() string
 
 	/* client 客户端订阅 channels */
 	// 订阅
 	Subscribe(channel string)
 	// 取消订阅
 	UnSubscribe(channel string)
-	// 订阅个数
+	// 按模式订阅
+	PSubscribe(pattern string)
+	// 取消按模式订阅
+	PUnSubscribe(pattern string)
+	// 订阅分片 channel
+	SSubscribe(channel string)
+	// 取消订阅分片 channel
+	SUnSubscribe(channel string)
+	// 订阅个数，包括 channel 和模式
 	SubsCount() int
+	// 订阅的分片 channel 个数
+	ShardSubsCount() int
 	// 获取所有订阅
 	GetChannels() []string
+	// 获取所有订阅的模式
+	GetPatterns() []string
+	// 获取所有订阅的分片 channel
+	GetShardChannels() []string
 
 	/* 复杂指令 */
 	// 是否在执行复杂指令
@@ -28,13 +42,23 @@ type Connection interface {
 	// 设置是否在执行复杂指令
 	SetMultiState(bool)
 	// 获取指令队列
-	GetQueuedCmdLine() [][][]byte
-	// 插入指令到队列
-	EnqueueCmd([][]byte)
+	GetQueuedCmds() []QueuedCmd
+	// 插入指令到队列，dbIndex 为执行指令的数据库
+	EnqueueCmd(dbIndex int, cmdLine [][]byte)
 	// 清空指令队列
 	ClearQueuedCmds()
-	// 获取 watching 列表
-	GetWatching() map[string]uint32
+	// 记录加入队列时被拒绝的指令，EXEC 时放弃整个事务
+	AddTxError(err error)
+	// 获取加入队列时的错误
+	GetTxErrors() []error
+	// 获取 watching 列表，数据库索引 -> key -> version
+	GetWatching() map[int]map[string]uint32
+
+	/* 阻塞指令 */
+	// 设置是否被阻塞指令挂起
+	SetBlocked(bool)
+	// 是否被阻塞指令挂起
+	IsBlocked() bool
 
 	/* 多数据库 */
 	// 获取当前数据库索引
@@ -42,3 +66,9 @@ type Connection interface {
 	// 选择数据库
 	SelectDB(int)
 }
+
+// 事务中加入队列的指令
+type QueuedCmd struct {
+	DBIndex int // 执行指令的数据库，事务中的 SELECT 会改变之后的指令的数据库
+	CmdLine [][]byte
+}
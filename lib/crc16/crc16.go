@@ -0,0 +1,46 @@
+// CRC16 校验和与集群槽位
+// 与 redis 集群一致，使用 CRC16-CCITT (XMODEM) 计算 key 所在的槽位
+
+package crc16
+
+import "strings"
+
+// 集群槽位数量
+const SlotCount = 16384
+
+var table [256]uint16
+
+func init() {
+	const poly = 0x1021
+	for i := 0; i < 256; i++ {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+}
+
+// 计算校验和
+func Checksum(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc<<8 ^ table[byte(crc>>8)^b]
+	}
+	return crc
+}
+
+// 计算 key 所在的槽位
+// key 中包含非空的 {tag} 时只对第一个 tag 计算，使相关的 key 落在同一个槽位
+func KeySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(Checksum([]byte(key)) & (SlotCount - 1))
+}
@@ -0,0 +1,27 @@
+// 测试 CRC16 与集群槽位
+
+package crc16
+
+import "testing"
+
+func TestChecksum(t *testing.T) {
+	if crc := Checksum([]byte("123456789")); crc != 0x31c3 {
+		t.Errorf("unexpected crc16 %x", crc)
+	}
+}
+
+func TestKeySlot(t *testing.T) {
+	// redis 集群文档中的例子
+	if slot := KeySlot("foo"); slot != 12182 {
+		t.Errorf("expected slot 12182, actually %d", slot)
+	}
+	if KeySlot("{user1000}.following") != KeySlot("{user1000}.followers") {
+		t.Error("keys with the same tag should be in the same slot")
+	}
+	if KeySlot("foo{}{bar}") != int(Checksum([]byte("foo{}{bar}"))&(SlotCount-1)) {
+		t.Error("empty tag should be ignored")
+	}
+	if KeySlot("foo{{bar}}zap") != KeySlot("{bar") {
+		t.Error("expected first tag to be used")
+	}
+}
@@ -15,8 +15,7 @@ func Delay(duration time.Duration, key string, job func()) {
 
 // At executes job at given time
 func At(at time.Time, key string, job func()) {
-	// tw.AddJob(at.Sub(time.Now()), key, job)
-	tw.AddJob(time.Until(time.Now()), key, job)
+	tw.AddJob(time.Until(at), key, job)
 }
 
 // Cancel stops a pending job
@@ -0,0 +1,32 @@
+// 指令工具包
+
+package utils
+
+// 字符串转换为指令
+func ToCmdLine(cmd ...string) [][]byte {
+	args := make([][]byte, len(cmd))
+	for i, s := range cmd {
+		args[i] = []byte(s)
+	}
+	return args
+}
+
+// 指令名 + 字符串参数转换为指令
+func ToCmdLine2(commandName string, args ...string) [][]byte {
+	result := make([][]byte, len(args)+1)
+	result[0] = []byte(commandName)
+	for i, s := range args {
+		result[i+1] = []byte(s)
+	}
+	return result
+}
+
+// 指令名 + 字节数组参数转换为指令
+func ToCmdLine3(commandName string, args ...[]byte) [][]byte {
+	result := make([][]byte, len(args)+1)
+	result[0] = []byte(commandName)
+	for i, s := range args {
+		result[i+1] = s
+	}
+	return result
+}
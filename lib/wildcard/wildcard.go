@@ -0,0 +1,130 @@
+// glob 风格的通配符匹配，与 redis 的 stringmatchlen 语义一致
+// 支持 * ? [abc] [^a-z] 以及 \ 转义，模式编译一次后可以重复使用
+
+package wildcard
+
+// 模式中的元素类型
+const (
+	normal   = iota // 普通字符
+	star            // *
+	question        // ?
+	charSet         // [abc]
+)
+
+type item struct {
+	typ       int
+	character byte
+	set       *[256]bool // [] 中可以匹配的字符，已经处理了 ^ 取反
+}
+
+// 编译后的模式
+type Pattern struct {
+	items []*item
+}
+
+// 编译模式
+func CompilePattern(src string) *Pattern {
+	items := make([]*item, 0)
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch c {
+		case '*':
+			// 连续的 * 等价于一个
+			if len(items) > 0 && items[len(items)-1].typ == star {
+				continue
+			}
+			items = append(items, &item{typ: star})
+		case '?':
+			items = append(items, &item{typ: question})
+		case '[':
+			var set *[256]bool
+			set, i = compileSet(src, i+1)
+			items = append(items, &item{typ: charSet, set: set})
+		case '\\':
+			// 末尾的 \ 视为普通字符
+			if i+1 < len(src) {
+				i++
+			}
+			items = append(items, &item{typ: normal, character: src[i]})
+		default:
+			items = append(items, &item{typ: normal, character: c})
+		}
+	}
+	return &Pattern{items: items}
+}
+
+// 编译 [] 中的内容，start 为 [ 之后的位置，返回字符集合以及 ] 的位置
+// 缺少 ] 时一直到模式结尾
+func compileSet(src string, start int) (*[256]bool, int) {
+	set := new([256]bool)
+	i := start
+	not := i < len(src) && src[i] == '^'
+	if not {
+		i++
+	}
+	for ; i < len(src) && src[i] != ']'; i++ {
+		if src[i] == '\\' && i+1 < len(src) {
+			i++
+			set[src[i]] = true
+		} else if i+2 < len(src) && src[i+1] == '-' {
+			begin, end := src[i], src[i+2]
+			if begin > end {
+				begin, end = end, begin
+			}
+			for c := int(begin); c <= int(end); c++ {
+				set[c] = true
+			}
+			i += 2
+		} else {
+			set[src[i]] = true
+		}
+	}
+	if not {
+		for c := range set {
+			set[c] = !set[c]
+		}
+	}
+	return set, i
+}
+
+// 单个非 * 元素是否匹配字符 c
+func (it *item) match(c byte) bool {
+	switch it.typ {
+	case question:
+		return true
+	case charSet:
+		return it.set[c]
+	}
+	return it.character == c
+}
+
+// 字符串是否匹配模式
+func (p *Pattern) IsMatch(s string) bool {
+	items := p.items
+	// 与 redis 一致，空字符串只匹配空模式，调用者需要自行处理 * 匹配全部的情况
+	if len(s) == 0 {
+		return len(items) == 0
+	}
+	// 除了 * 以外每个元素恰好匹配一个字符，回溯时只需要记录最后一个 * 的位置
+	i, j := 0, 0
+	starItem, starStr := -1, 0
+	for j < len(s) {
+		if i < len(items) && items[i].typ == star {
+			starItem, starStr = i, j
+			i++
+		} else if i < len(items) && items[i].match(s[j]) {
+			i++
+			j++
+		} else if starItem >= 0 {
+			// 让最后一个 * 多匹配一个字符
+			starStr++
+			i, j = starItem+1, starStr
+		} else {
+			return false
+		}
+	}
+	for i < len(items) && items[i].typ == star {
+		i++
+	}
+	return i == len(items)
+}
@@ -0,0 +1,158 @@
+// 测试通配符匹配
+
+package wildcard
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestIsMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		str     string
+		matched bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", false},
+		{"*", "anything", true},
+		{"**", "a", true},
+		{"a*", "abc", true},
+		{"a*", "bac", false},
+		{"*c", "abc", true},
+		{"a*b*c", "aXXbYYc", true},
+		{"a*b*c", "aXXbYY", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hallo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"[\\]]", "]", true},
+		{"[\\-]", "-", true},
+		{"[a-]", "]", true},
+		{"\\", "\\", true},
+		{"[]", "a", false},
+		{"[^]", "a", true},
+		{"[", "a", false},
+		{"[^", "a", true},
+		// 缺少 ] 时一直到模式结尾
+		{"[abc", "b", true},
+		{"[abc", "bc", false},
+		{"a[", "a", false},
+		{"*[a-c]", "xxb", true},
+		{"user:*:name", "user:1000:name", true},
+		{"user:*:name", "user:1000:age", false},
+	}
+	for _, c := range cases {
+		if actual := CompilePattern(c.pattern).IsMatch(c.str); actual != c.matched {
+			t.Errorf("pattern %q, str %q: expected %v, actually %v", c.pattern, c.str, c.matched, actual)
+		}
+	}
+}
+
+// 逐行移植的 redis stringmatchlen，用于对照测试
+func stringMatchLen(pattern string, str string) bool {
+	p, s := 0, 0
+	for p < len(pattern) && s < len(str) {
+		switch pattern[p] {
+		case '*':
+			for p+1 < len(pattern) && pattern[p+1] == '*' {
+				p++
+			}
+			if p+1 == len(pattern) {
+				return true
+			}
+			for ; s < len(str); s++ {
+				if stringMatchLen(pattern[p+1:], str[s:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			s++
+		case '[':
+			p++
+			not := p < len(pattern) && pattern[p] == '^'
+			if not {
+				p++
+			}
+			match := false
+			for {
+				if p < len(pattern) && pattern[p] == '\\' && len(pattern)-p >= 2 {
+					p++
+					if pattern[p] == str[s] {
+						match = true
+					}
+				} else if p < len(pattern) && pattern[p] == ']' {
+					break
+				} else if p >= len(pattern) {
+					p--
+					break
+				} else if len(pattern)-p >= 3 && pattern[p+1] == '-' {
+					start, end := pattern[p], pattern[p+2]
+					if start > end {
+						start, end = end, start
+					}
+					p += 2
+					if str[s] >= start && str[s] <= end {
+						match = true
+					}
+				} else if pattern[p] == str[s] {
+					match = true
+				}
+				p++
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			s++
+		case '\\':
+			if len(pattern)-p >= 2 {
+				p++
+			}
+			fallthrough
+		default:
+			if pattern[p] != str[s] {
+				return false
+			}
+			s++
+		}
+		p++
+		if s == len(str) {
+			for p < len(pattern) && pattern[p] == '*' {
+				p++
+			}
+			break
+		}
+	}
+	return p >= len(pattern) && s == len(str)
+}
+
+func randomString(alphabet string, maxLen int) string {
+	b := make([]byte, rand.Intn(maxLen+1))
+	for i := range b {
+		b[i] = alphabet[rand.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+func TestCompareWithRedis(t *testing.T) {
+	for i := 0; i < 100000; i++ {
+		pattern := randomString("ab*?[]^-\\", 8)
+		str := randomString("ab]-^\\", 6)
+		expected := stringMatchLen(pattern, str)
+		if actual := CompilePattern(pattern).IsMatch(str); actual != expected {
+			t.Fatalf("pattern %q, str %q: expected %v, actually %v", pattern, str, expected, actual)
+		}
+	}
+}
@@ -22,11 +22,16 @@ var banner = `
 `
 
 var defaultProperties = &config.ServerProperties{
-	Bind:           "0.0.0.0",
-	Port:           6399,
-	AppendOnly:     false,
-	AppendFileName: "",
-	MaxClients:     1000,
+	Bind:              "0.0.0.0",
+	Port:              6399,
+	AppendOnly:        false,
+	AppendFileName:    "appendonly.aof",
+	AppendFsync:       "everysec",
+	AofUseRdbPreamble: true,
+	DbFilename:        "dump.rdb",
+	Dir:               ".",
+	Save:              "3600 1 300 100 60 10000",
+	MaxClients:        1000,
 }
 
 func fileExists(filename string) bool {
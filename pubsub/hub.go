@@ -0,0 +1,146 @@
+// 发布订阅中心
+
+package pubsub
+
+import (
+	"sync"
+
+	"ljr-redis/config"
+	"ljr-redis/datastruct/dict"
+	List "ljr-redis/datastruct/list"
+	"ljr-redis/datastruct/lockmap"
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/wildcard"
+)
+
+const (
+	subsDictSize = 1 << 4
+	lockerSize   = 1 << 4
+)
+
+// 发布订阅中心，保存每个 channel 的订阅者
+type Hub struct {
+	// channel -> List.List(redis.Connection)
+	subs dict.Dict
+	// 分片 channel -> List.List(redis.Connection)
+	shardSubs dict.Dict
+	// 对同一个 channel 的订阅者列表的操作需要加锁
+	subsLocker *lockmap.Locks
+
+	// pattern -> *patternSubs
+	// 发布消息时需要遍历所有模式，使用一把读写锁保护
+	patterns   map[string]*patternSubs
+	patternsMu sync.RWMutex
+
+	// 分片 channel 所在的节点
+	shard *shardRouter
+}
+
+// 订阅同一个模式的客户端
+type patternSubs struct {
+	matcher     *wildcard.Pattern // 为 nil 表示匹配所有 channel
+	subscribers List.List         // redis.Connection
+}
+
+// 创建发布订阅中心
+func MakeHub() *Hub {
+	return &Hub{
+		subs:       dict.MakeConcurrent(subsDictSize),
+		shardSubs:  dict.MakeConcurrent(subsDictSize),
+		subsLocker: lockmap.Make(lockerSize),
+		patterns:   make(map[string]*patternSubs),
+		shard:      makeShardRouter(config.Properties.Self, config.Properties.Peers),
+	}
+}
+
+// 关闭转发消息使用的连接
+func (hub *Hub) Close() {
+	hub.shard.close()
+}
+
+// 添加订阅者，调用者需要持有 channel 的锁，返回是否为新的订阅
+// subs 为 hub.subs 或 hub.shardSubs
+func subscribe(subs dict.Dict, channel string, client redis.Connection) bool {
+	raw, ok := subs.Get(channel)
+	var subscribers List.List
+	if ok {
+		subscribers = raw.(List.List)
+	} else {
+		subscribers = List.NewQuickList()
+		subs.Put(channel, subscribers)
+	}
+	if subscribers.Contains(func(a interface{}) bool {
+		return a == client
+	}) {
+		return false
+	}
+	subscribers.Add(client)
+	return true
+}
+
+// 移除订阅者，调用者需要持有 channel 的锁，返回是否取消了订阅
+// 没有订阅者的 channel 会被删除
+func unsubscribe(subs dict.Dict, channel string, client redis.Connection) bool {
+	raw, ok := subs.Get(channel)
+	if !ok {
+		return false
+	}
+	subscribers := raw.(List.List)
+	removed := subscribers.RemoveAllByVal(func(a interface{}) bool {
+		return a == client
+	})
+	if subscribers.Len() == 0 {
+		subs.Remove(channel)
+	}
+	return removed > 0
+}
+
+// 获取 channel 的订阅者，调用者需要持有 channel 的锁
+func getSubscribers(subs dict.Dict, channel string) List.List {
+	raw, ok := subs.Get(channel)
+	if !ok {
+		return nil
+	}
+	return raw.(List.List)
+}
+
+// 添加模式订阅者，调用者需要持有 patternsMu 的写锁，返回是否为新的订阅
+func (hub *Hub) psubscribe(pattern string, client redis.Connection) bool {
+	subs, ok := hub.patterns[pattern]
+	if !ok {
+		subs = &patternSubs{subscribers: List.NewQuickList()}
+		// 编译后的 * 也能匹配所有 channel，单独处理可以省去匹配
+		if pattern != "*" {
+			subs.matcher = wildcard.CompilePattern(pattern)
+		}
+		hub.patterns[pattern] = subs
+	}
+	if subs.subscribers.Contains(func(a interface{}) bool {
+		return a == client
+	}) {
+		return false
+	}
+	subs.subscribers.Add(client)
+	return true
+}
+
+// 移除模式订阅者，调用者需要持有 patternsMu 的写锁，返回是否取消了订阅
+// 没有订阅者的模式会被删除
+func (hub *Hub) punsubscribe(pattern string, client redis.Connection) bool {
+	subs, ok := hub.patterns[pattern]
+	if !ok {
+		return false
+	}
+	removed := subs.subscribers.RemoveAllByVal(func(a interface{}) bool {
+		return a == client
+	})
+	if subs.subscribers.Len() == 0 {
+		delete(hub.patterns, pattern)
+	}
+	return removed > 0
+}
+
+// 模式是否匹配 channel
+func (subs *patternSubs) match(channel string) bool {
+	return subs.matcher == nil || subs.matcher.IsMatch(channel)
+}
@@ -0,0 +1,269 @@
+// 发布订阅指令
+// SUBSCRIBE UNSUBSCRIBE PSUBSCRIBE PUNSUBSCRIBE PUBLISH PUBSUB
+
+package pubsub
+
+import (
+	"strings"
+
+	"ljr-redis/datastruct/dict"
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/wildcard"
+	"ljr-redis/redis/reply"
+)
+
+const (
+	msgSubscribe    = "subscribe"
+	msgUnsubscribe  = "unsubscribe"
+	msgPSubscribe   = "psubscribe"
+	msgPUnsubscribe = "punsubscribe"
+	msgMessage      = "message"
+	msgPMessage     = "pmessage"
+)
+
+// 订阅状态变化的消息 [类型, channel, 当前订阅数]，channel 为 nil 时表示没有订阅
+func makeMsg(msgType string, channel []byte, count int) []byte {
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkReply([]byte(msgType)),
+		reply.MakeBulkReply(channel),
+		reply.MakeIntReply(int64(count)),
+	}).ToBytes()
+}
+
+// 订阅 channel，每个 channel 向客户端发送一条确认消息
+func Subscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	channels := make([]string, len(args))
+	for i, b := range args {
+		channels[i] = string(b)
+	}
+
+	hub.subsLocker.Locks(channels...)
+	defer hub.subsLocker.UnLocks(channels...)
+
+	for _, channel := range channels {
+		if subscribe(hub.subs, channel, c) {
+			c.Subscribe(channel)
+		}
+		_ = c.Write(makeMsg(msgSubscribe, []byte(channel), c.SubsCount()))
+	}
+	return reply.MakeNoReply()
+}
+
+// 取消订阅，没有参数时取消所有订阅
+func UnSubscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	var channels []string
+	if len(args) > 0 {
+		channels = make([]string, len(args))
+		for i, b := range args {
+			channels[i] = string(b)
+		}
+	} else {
+		channels = c.GetChannels()
+	}
+
+	if len(channels) == 0 {
+		_ = c.Write(makeMsg(msgUnsubscribe, nil, c.SubsCount()))
+		return reply.MakeNoReply()
+	}
+
+	hub.subsLocker.Locks(channels...)
+	defer hub.subsLocker.UnLocks(channels...)
+
+	for _, channel := range channels {
+		if unsubscribe(hub.subs, channel, c) {
+			c.UnSubscribe(channel)
+		}
+		_ = c.Write(makeMsg(msgUnsubscribe, []byte(channel), c.SubsCount()))
+	}
+	return reply.MakeNoReply()
+}
+
+// 按模式订阅，每个模式向客户端发送一条确认消息
+func PSubscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	hub.patternsMu.Lock()
+	defer hub.patternsMu.Unlock()
+
+	for _, arg := range args {
+		pattern := string(arg)
+		if hub.psubscribe(pattern, c) {
+			c.PSubscribe(pattern)
+		}
+		_ = c.Write(makeMsg(msgPSubscribe, arg, c.SubsCount()))
+	}
+	return reply.MakeNoReply()
+}
+
+// 取消按模式订阅，没有参数时取消所有模式订阅
+func PUnSubscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	var patterns []string
+	if len(args) > 0 {
+		patterns = make([]string, len(args))
+		for i, b := range args {
+			patterns[i] = string(b)
+		}
+	} else {
+		patterns = c.GetPatterns()
+	}
+
+	if len(patterns) == 0 {
+		_ = c.Write(makeMsg(msgPUnsubscribe, nil, c.SubsCount()))
+		return reply.MakeNoReply()
+	}
+
+	hub.patternsMu.Lock()
+	defer hub.patternsMu.Unlock()
+
+	for _, pattern := range patterns {
+		if hub.punsubscribe(pattern, c) {
+			c.PUnSubscribe(pattern)
+		}
+		_ = c.Write(makeMsg(msgPUnsubscribe, []byte(pattern), c.SubsCount()))
+	}
+	return reply.MakeNoReply()
+}
+
+// 客户端断开连接时取消所有订阅
+func UnsubscribeAll(hub *Hub, c redis.Connection) {
+	channels := c.GetChannels()
+	hub.subsLocker.Locks(channels...)
+	for _, channel := range channels {
+		unsubscribe(hub.subs, channel, c)
+		c.UnSubscribe(channel)
+	}
+	hub.subsLocker.UnLocks(channels...)
+
+	shardChannels := c.GetShardChannels()
+	hub.subsLocker.Locks(shardChannels...)
+	for _, channel := range shardChannels {
+		unsubscribe(hub.shardSubs, channel, c)
+		c.SUnSubscribe(channel)
+	}
+	hub.subsLocker.UnLocks(shardChannels...)
+
+	patterns := c.GetPatterns()
+	if len(patterns) == 0 {
+		return
+	}
+	hub.patternsMu.Lock()
+	defer hub.patternsMu.Unlock()
+	for _, pattern := range patterns {
+		hub.punsubscribe(pattern, c)
+		c.PUnSubscribe(pattern)
+	}
+}
+
+// 发布消息，返回收到消息的客户端数量
+// 订阅了 channel 的客户端收到 message，模式匹配的客户端每个模式收到一条 pmessage
+func Publish(hub *Hub, args [][]byte) redis.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply("publish")
+	}
+	channel := string(args[0])
+	message := args[1]
+	receivers := 0
+
+	hub.subsLocker.RLock(channel)
+	if subscribers := getSubscribers(hub.subs, channel); subscribers != nil {
+		msg := reply.MakeMultiBulkReply([][]byte{
+			[]byte(msgMessage),
+			[]byte(channel),
+			message,
+		}).ToBytes()
+		subscribers.ForEach(func(i int, v interface{}) bool {
+			_ = v.(redis.Connection).Write(msg)
+			return true
+		})
+		receivers += subscribers.Len()
+	}
+	hub.subsLocker.RUnLock(channel)
+
+	hub.patternsMu.RLock()
+	defer hub.patternsMu.RUnlock()
+	for pattern, subs := range hub.patterns {
+		if !subs.match(channel) {
+			continue
+		}
+		msg := reply.MakeMultiBulkReply([][]byte{
+			[]byte(msgPMessage),
+			[]byte(pattern),
+			[]byte(channel),
+			message,
+		}).ToBytes()
+		subs.subscribers.ForEach(func(i int, v interface{}) bool {
+			_ = v.(redis.Connection).Write(msg)
+			return true
+		})
+		receivers += subs.subscribers.Len()
+	}
+	return reply.MakeIntReply(int64(receivers))
+}
+
+// PUBSUB CHANNELS [pattern] / PUBSUB NUMSUB [channel ...] / PUBSUB NUMPAT
+// PUBSUB SHARDCHANNELS [pattern] / PUBSUB SHARDNUMSUB [channel ...]
+func PubSub(hub *Hub, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("pubsub")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "channels":
+		if len(args) > 2 {
+			return reply.MakeErrReply("ERR Unknown subcommand or wrong number of arguments for 'channels'")
+		}
+		return channelsReply(hub.subs, args[1:])
+	case "numsub":
+		return numSubReply(hub, hub.subs, args[1:])
+	case "shardchannels":
+		if len(args) > 2 {
+			return reply.MakeErrReply("ERR Unknown subcommand or wrong number of arguments for 'shardchannels'")
+		}
+		return channelsReply(hub.shardSubs, args[1:])
+	case "shardnumsub":
+		return numSubReply(hub, hub.shardSubs, args[1:])
+	case "numpat":
+		if len(args) != 1 {
+			return reply.MakeErrReply("ERR Unknown subcommand or wrong number of arguments for 'numpat'")
+		}
+		return numPatReply(hub)
+	}
+	return reply.MakeErrReply("ERR Unknown subcommand or wrong number of arguments for '" + subCmd + "'")
+}
+
+// 至少有一个订阅者的 channel，可以按模式过滤
+func channelsReply(subs dict.Dict, args [][]byte) redis.Reply {
+	var pattern *wildcard.Pattern
+	if len(args) == 1 && string(args[0]) != "*" {
+		pattern = wildcard.CompilePattern(string(args[0]))
+	}
+	channels := make([][]byte, 0)
+	subs.ForEach(func(channel string, val interface{}) bool {
+		if pattern == nil || pattern.IsMatch(channel) {
+			channels = append(channels, []byte(channel))
+		}
+		return true
+	})
+	return reply.MakeMultiBulkReply(channels)
+}
+
+// 每个 channel 的订阅者数量
+func numSubReply(hub *Hub, subs dict.Dict, args [][]byte) redis.Reply {
+	result := make([]redis.Reply, 0, len(args)*2)
+	for _, arg := range args {
+		channel := string(arg)
+		count := 0
+		hub.subsLocker.RLock(channel)
+		if subscribers := getSubscribers(subs, channel); subscribers != nil {
+			count = subscribers.Len()
+		}
+		hub.subsLocker.RUnLock(channel)
+		result = append(result, reply.MakeBulkReply(arg), reply.MakeIntReply(int64(count)))
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// 被订阅的模式数量，多个客户端订阅同一个模式只计算一次
+func numPatReply(hub *Hub) redis.Reply {
+	hub.patternsMu.RLock()
+	defer hub.patternsMu.RUnlock()
+	return reply.MakeIntReply(int64(len(hub.patterns)))
+}
@@ -0,0 +1,212 @@
+// 测试发布订阅
+
+package pubsub
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/connection"
+	"ljr-redis/redis/reply"
+)
+
+// 记录收到的消息的客户端连接
+type recordConn struct {
+	connection.Connection
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (c *recordConn) Write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = append(c.msgs, string(b))
+	return nil
+}
+
+func (c *recordConn) take() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	msgs := c.msgs
+	c.msgs = nil
+	return msgs
+}
+
+func msg(t string, channel string, count int) string {
+	return string(makeMsg(t, []byte(channel), count))
+}
+
+func message(channel string, payload string) string {
+	return string(reply.MakeMultiBulkReply(utils.ToCmdLine("message", channel, payload)).ToBytes())
+}
+
+func TestSubscribeAndPublish(t *testing.T) {
+	hub := MakeHub()
+	c1 := &recordConn{}
+	c2 := &recordConn{}
+
+	Subscribe(hub, c1, utils.ToCmdLine("a", "b", "a"))
+	expected := []string{msg("subscribe", "a", 1), msg("subscribe", "b", 2), msg("subscribe", "a", 2)}
+	if got := c1.take(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, actually %q", expected, got)
+	}
+	Subscribe(hub, c2, utils.ToCmdLine("a"))
+	c2.take()
+
+	if r := Publish(hub, utils.ToCmdLine("a", "hello")).(*reply.IntReply); r.Code != 2 {
+		t.Errorf("expected 2 receivers, actually %d", r.Code)
+	}
+	if r := Publish(hub, utils.ToCmdLine("none", "hello")).(*reply.IntReply); r.Code != 0 {
+		t.Errorf("expected 0 receivers, actually %d", r.Code)
+	}
+	for _, c := range []*recordConn{c1, c2} {
+		if got := c.take(); !reflect.DeepEqual(got, []string{message("a", "hello")}) {
+			t.Errorf("unexpected messages %q", got)
+		}
+	}
+
+	// 取消订阅后不再收到消息
+	UnSubscribe(hub, c1, utils.ToCmdLine("a", "none"))
+	expected = []string{msg("unsubscribe", "a", 1), msg("unsubscribe", "none", 1)}
+	if got := c1.take(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, actually %q", expected, got)
+	}
+	Publish(hub, utils.ToCmdLine("a", "world"))
+	if got := c1.take(); len(got) != 0 {
+		t.Errorf("expected no messages, actually %q", got)
+	}
+
+	// 没有参数时取消所有订阅
+	UnSubscribe(hub, c1, nil)
+	if got := c1.take(); !reflect.DeepEqual(got, []string{msg("unsubscribe", "b", 0)}) {
+		t.Errorf("unexpected messages %q", got)
+	}
+	UnSubscribe(hub, c1, nil)
+	if got := c1.take(); !reflect.DeepEqual(got, []string{string(makeMsg("unsubscribe", nil, 0))}) {
+		t.Errorf("unexpected messages %q", got)
+	}
+}
+
+func TestPubSubIntrospection(t *testing.T) {
+	hub := MakeHub()
+	c1 := &recordConn{}
+	c2 := &recordConn{}
+	Subscribe(hub, c1, utils.ToCmdLine("news.tech", "news.art", "chat"))
+	Subscribe(hub, c2, utils.ToCmdLine("news.tech"))
+
+	channels := func(args ...string) []string {
+		r := PubSub(hub, utils.ToCmdLine(args...)).(*reply.MultiBulkReply)
+		result := make([]string, len(r.Args))
+		for i, arg := range r.Args {
+			result[i] = string(arg)
+		}
+		sort.Strings(result)
+		return result
+	}
+	if got := channels("channels"); !reflect.DeepEqual(got, []string{"chat", "news.art", "news.tech"}) {
+		t.Errorf("unexpected channels %v", got)
+	}
+	if got := channels("CHANNELS", "news.*"); !reflect.DeepEqual(got, []string{"news.art", "news.tech"}) {
+		t.Errorf("unexpected channels %v", got)
+	}
+
+	r := PubSub(hub, utils.ToCmdLine("numsub", "news.tech", "chat", "none"))
+	expected := reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkReply([]byte("news.tech")), reply.MakeIntReply(2),
+		reply.MakeBulkReply([]byte("chat")), reply.MakeIntReply(1),
+		reply.MakeBulkReply([]byte("none")), reply.MakeIntReply(0),
+	})
+	if string(r.ToBytes()) != string(expected.ToBytes()) {
+		t.Errorf("unexpected numsub reply %q", r.ToBytes())
+	}
+
+	// 断开连接后没有订阅者的 channel 被删除
+	UnsubscribeAll(hub, c1)
+	if got := channels("channels"); !reflect.DeepEqual(got, []string{"news.tech"}) {
+		t.Errorf("unexpected channels %v", got)
+	}
+	if c1.SubsCount() != 0 {
+		t.Errorf("expected no subscriptions, actually %d", c1.SubsCount())
+	}
+	if !reply.IsErrorReply(PubSub(hub, utils.ToCmdLine("unknown"))) {
+		t.Error("expected error for unknown subcommand")
+	}
+}
+
+func pmessage(pattern string, channel string, payload string) string {
+	return string(reply.MakeMultiBulkReply(utils.ToCmdLine("pmessage", pattern, channel, payload)).ToBytes())
+}
+
+func TestPatternSubscribe(t *testing.T) {
+	hub := MakeHub()
+	c1 := &recordConn{}
+	c2 := &recordConn{}
+
+	Subscribe(hub, c1, utils.ToCmdLine("orders.new"))
+	PSubscribe(hub, c1, utils.ToCmdLine("orders.*", "*"))
+	expected := []string{msg("subscribe", "orders.new", 1), msg("psubscribe", "orders.*", 2), msg("psubscribe", "*", 3)}
+	if got := c1.take(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, actually %q", expected, got)
+	}
+	PSubscribe(hub, c2, utils.ToCmdLine("orders.*", "orders.*"))
+	c2.take()
+
+	if r := Publish(hub, utils.ToCmdLine("orders.new", "1")).(*reply.IntReply); r.Code != 4 {
+		t.Errorf("expected 4 receivers, actually %d", r.Code)
+	}
+	got := c1.take()
+	sort.Strings(got[1:])
+	expected = []string{message("orders.new", "1"), pmessage("*", "orders.new", "1"), pmessage("orders.*", "orders.new", "1")}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, actually %q", expected, got)
+	}
+	if got := c2.take(); !reflect.DeepEqual(got, []string{pmessage("orders.*", "orders.new", "1")}) {
+		t.Errorf("unexpected messages %q", got)
+	}
+	if r := Publish(hub, utils.ToCmdLine("users", "1")).(*reply.IntReply); r.Code != 1 {
+		t.Errorf("expected 1 receiver, actually %d", r.Code)
+	}
+	c1.take()
+
+	if r := PubSub(hub, utils.ToCmdLine("numpat")).(*reply.IntReply); r.Code != 2 {
+		t.Errorf("expected 2 patterns, actually %d", r.Code)
+	}
+	// channel 订阅不受取消模式订阅影响
+	PUnSubscribe(hub, c1, utils.ToCmdLine("orders.*"))
+	PUnSubscribe(hub, c1, nil)
+	PUnSubscribe(hub, c1, nil)
+	expected = []string{msg("punsubscribe", "orders.*", 2), msg("punsubscribe", "*", 1), string(makeMsg("punsubscribe", nil, 1))}
+	if got := c1.take(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, actually %q", expected, got)
+	}
+	if r := PubSub(hub, utils.ToCmdLine("numpat")).(*reply.IntReply); r.Code != 1 {
+		t.Errorf("expected 1 pattern, actually %d", r.Code)
+	}
+	UnsubscribeAll(hub, c2)
+	if r := PubSub(hub, utils.ToCmdLine("numpat")).(*reply.IntReply); r.Code != 0 {
+		t.Errorf("expected no patterns, actually %d", r.Code)
+	}
+	if r := Publish(hub, utils.ToCmdLine("orders.new", "2")).(*reply.IntReply); r.Code != 1 {
+		t.Errorf("expected 1 receiver, actually %d", r.Code)
+	}
+}
+
+func TestUnsubscribeKeepsPatternCount(t *testing.T) {
+	hub := MakeHub()
+	c := &recordConn{}
+	PSubscribe(hub, c, utils.ToCmdLine("orders.*"))
+	Subscribe(hub, c, utils.ToCmdLine("users"))
+	c.take()
+
+	// 模式订阅仍然计入订阅个数
+	UnSubscribe(hub, c, nil)
+	UnSubscribe(hub, c, nil)
+	expected := []string{msg("unsubscribe", "users", 1), string(makeMsg("unsubscribe", nil, 1))}
+	if got := c.take(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, actually %q", expected, got)
+	}
+}
@@ -0,0 +1,192 @@
+// 分片发布订阅
+// SSUBSCRIBE SUNSUBSCRIBE SPUBLISH，channel 按 CRC16 槽位分配给 self 和 peers 中的节点
+
+package pubsub
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/crc16"
+	"ljr-redis/lib/logger"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/client"
+	"ljr-redis/redis/reply"
+)
+
+const (
+	msgSSubscribe   = "ssubscribe"
+	msgSUnsubscribe = "sunsubscribe"
+	msgSMessage     = "smessage"
+)
+
+// 分片 channel 的路由
+type shardRouter struct {
+	self  string
+	nodes []string // 所有节点按地址排序，每个节点负责一段连续的槽位
+
+	// 转发消息到其它节点的客户端，按需创建
+	clients map[string]*client.Client
+	mu      sync.Mutex
+}
+
+// 创建路由，没有设置 self 时为单机模式，负责所有槽位
+func makeShardRouter(self string, peers []string) *shardRouter {
+	router := &shardRouter{
+		self:    self,
+		clients: make(map[string]*client.Client),
+	}
+	if self == "" {
+		return router
+	}
+	nodeSet := map[string]bool{self: true}
+	for _, peer := range peers {
+		peer = strings.TrimSpace(peer)
+		if peer != "" {
+			nodeSet[peer] = true
+		}
+	}
+	for node := range nodeSet {
+		router.nodes = append(router.nodes, node)
+	}
+	sort.Strings(router.nodes)
+	return router
+}
+
+// 负责槽位的节点
+func (router *shardRouter) owner(slot int) string {
+	if len(router.nodes) <= 1 {
+		return router.self
+	}
+	return router.nodes[slot*len(router.nodes)/crc16.SlotCount]
+}
+
+// 将指令转发到其它节点执行
+func (router *shardRouter) forward(node string, cmdLine [][]byte) redis.Reply {
+	router.mu.Lock()
+	peer, ok := router.clients[node]
+	if !ok {
+		var err error
+		peer, err = client.MakeClient(node)
+		if err != nil {
+			router.mu.Unlock()
+			logger.Error("connect to peer " + node + " failed: " + err.Error())
+			return reply.MakeErrReply("ERR connect to peer " + node + " failed")
+		}
+		peer.Start()
+		router.clients[node] = peer
+	}
+	router.mu.Unlock()
+	return peer.Send(cmdLine)
+}
+
+// 关闭所有转发客户端
+func (router *shardRouter) close() {
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	for node, peer := range router.clients {
+		peer.Close()
+		delete(router.clients, node)
+	}
+}
+
+// 检查 channel 都在同一个槽位，返回槽位和负责的节点
+func (router *shardRouter) route(channels []string) (int, string, redis.Reply) {
+	slot := crc16.KeySlot(channels[0])
+	for _, channel := range channels[1:] {
+		if crc16.KeySlot(channel) != slot {
+			return 0, "", reply.MakeErrReply("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+	return slot, router.owner(slot), nil
+}
+
+// 订阅分片 channel，所有 channel 必须在同一个槽位
+// 槽位不属于当前节点时返回 MOVED 重定向
+func SSubscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	channels := make([]string, len(args))
+	for i, b := range args {
+		channels[i] = string(b)
+	}
+	slot, node, errReply := hub.shard.route(channels)
+	if errReply != nil {
+		return errReply
+	}
+	if node != hub.shard.self {
+		return reply.MakeErrReply("MOVED " + strconv.Itoa(slot) + " " + node)
+	}
+
+	hub.subsLocker.Locks(channels...)
+	defer hub.subsLocker.UnLocks(channels...)
+
+	for _, channel := range channels {
+		if subscribe(hub.shardSubs, channel, c) {
+			c.SSubscribe(channel)
+		}
+		_ = c.Write(makeMsg(msgSSubscribe, []byte(channel), c.ShardSubsCount()))
+	}
+	return reply.MakeNoReply()
+}
+
+// 取消订阅分片 channel，没有参数时取消所有分片订阅
+func SUnSubscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	var channels []string
+	if len(args) > 0 {
+		channels = make([]string, len(args))
+		for i, b := range args {
+			channels[i] = string(b)
+		}
+	} else {
+		channels = c.GetShardChannels()
+	}
+
+	if len(channels) == 0 {
+		_ = c.Write(makeMsg(msgSUnsubscribe, nil, 0))
+		return reply.MakeNoReply()
+	}
+
+	hub.subsLocker.Locks(channels...)
+	defer hub.subsLocker.UnLocks(channels...)
+
+	for _, channel := range channels {
+		if unsubscribe(hub.shardSubs, channel, c) {
+			c.SUnSubscribe(channel)
+		}
+		_ = c.Write(makeMsg(msgSUnsubscribe, []byte(channel), c.ShardSubsCount()))
+	}
+	return reply.MakeNoReply()
+}
+
+// 发布分片消息，只投递给负责该槽位的节点上的订阅者
+// 槽位不属于当前节点时转发到负责的节点，返回该节点的响应
+func SPublish(hub *Hub, args [][]byte) redis.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply("spublish")
+	}
+	channel := string(args[0])
+	_, node, _ := hub.shard.route([]string{channel})
+	if node != hub.shard.self {
+		return hub.shard.forward(node, utils.ToCmdLine3("spublish", args...))
+	}
+
+	hub.subsLocker.RLock(channel)
+	defer hub.subsLocker.RUnLock(channel)
+
+	subscribers := getSubscribers(hub.shardSubs, channel)
+	if subscribers == nil {
+		return reply.MakeIntReply(0)
+	}
+	msg := reply.MakeMultiBulkReply([][]byte{
+		[]byte(msgSMessage),
+		[]byte(channel),
+		args[1],
+	}).ToBytes()
+	subscribers.ForEach(func(i int, v interface{}) bool {
+		_ = v.(redis.Connection).Write(msg)
+		return true
+	})
+	return reply.MakeIntReply(int64(subscribers.Len()))
+}
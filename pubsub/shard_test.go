@@ -0,0 +1,136 @@
+// 测试分片发布订阅
+
+package pubsub
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"ljr-redis/interface/redis"
+	"ljr-redis/lib/crc16"
+	"ljr-redis/lib/utils"
+	"ljr-redis/redis/parser"
+	"ljr-redis/redis/reply"
+)
+
+// 找到由 node 负责的 channel
+func channelOwnedBy(router *shardRouter, node string) string {
+	for i := 0; ; i++ {
+		channel := "ch" + strconv.Itoa(i)
+		if router.owner(crc16.KeySlot(channel)) == node {
+			return channel
+		}
+	}
+}
+
+func smessage(channel string, payload string) string {
+	return string(reply.MakeMultiBulkReply(utils.ToCmdLine("smessage", channel, payload)).ToBytes())
+}
+
+func TestShardSubscribe(t *testing.T) {
+	hub := MakeHub()
+	c1 := &recordConn{}
+	c2 := &recordConn{}
+
+	SSubscribe(hub, c1, utils.ToCmdLine("{orders}.new", "{orders}.paid"))
+	expected := []string{msg("ssubscribe", "{orders}.new", 1), msg("ssubscribe", "{orders}.paid", 2)}
+	if got := c1.take(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, actually %q", expected, got)
+	}
+	// 分片订阅不计入普通订阅数
+	Subscribe(hub, c1, utils.ToCmdLine("{orders}.new"))
+	if got := c1.take(); !reflect.DeepEqual(got, []string{msg("subscribe", "{orders}.new", 1)}) {
+		t.Errorf("unexpected messages %q", got)
+	}
+	if !reply.IsErrorReply(SSubscribe(hub, c2, utils.ToCmdLine("a", "b"))) {
+		t.Error("expected CROSSSLOT error")
+	}
+
+	// 分片消息只投递给分片订阅者
+	if r := SPublish(hub, utils.ToCmdLine("{orders}.new", "1")).(*reply.IntReply); r.Code != 1 {
+		t.Errorf("expected 1 receiver, actually %d", r.Code)
+	}
+	if got := c1.take(); !reflect.DeepEqual(got, []string{smessage("{orders}.new", "1")}) {
+		t.Errorf("unexpected messages %q", got)
+	}
+
+	r := PubSub(hub, utils.ToCmdLine("shardnumsub", "{orders}.new", "none"))
+	numsub := reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkReply([]byte("{orders}.new")), reply.MakeIntReply(1),
+		reply.MakeBulkReply([]byte("none")), reply.MakeIntReply(0),
+	})
+	if string(r.ToBytes()) != string(numsub.ToBytes()) {
+		t.Errorf("unexpected shardnumsub reply %q", r.ToBytes())
+	}
+	if r := PubSub(hub, utils.ToCmdLine("shardchannels", "*.paid")).(*reply.MultiBulkReply); len(r.Args) != 1 ||
+		string(r.Args[0]) != "{orders}.paid" {
+		t.Errorf("unexpected shardchannels reply %q", r.Args)
+	}
+
+	SUnSubscribe(hub, c1, nil)
+	if got := c1.take(); len(got) != 2 || c1.ShardSubsCount() != 0 || c1.SubsCount() != 1 {
+		t.Errorf("unexpected messages %q", got)
+	}
+	SUnSubscribe(hub, c1, nil)
+	if got := c1.take(); !reflect.DeepEqual(got, []string{string(makeMsg("sunsubscribe", nil, 0))}) {
+		t.Errorf("unexpected messages %q", got)
+	}
+}
+
+func TestShardRouting(t *testing.T) {
+	// 模拟负责其它槽位的节点，记录收到的指令并回复 3
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan [][]byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for payload := range parser.ParseStream(conn) {
+			if payload.Err != nil {
+				return
+			}
+			received <- payload.Data.(*reply.MultiBulkReply).Args
+			_, _ = conn.Write(reply.MakeIntReply(3).ToBytes())
+		}
+	}()
+
+	self := "127.0.0.1:1"
+	peer := listener.Addr().String()
+	hub := MakeHub()
+	hub.shard = makeShardRouter(self, []string{peer, self, ""})
+	defer hub.Close()
+	if len(hub.shard.nodes) != 2 {
+		t.Fatalf("unexpected nodes %v", hub.shard.nodes)
+	}
+	local := channelOwnedBy(hub.shard, self)
+	remote := channelOwnedBy(hub.shard, peer)
+
+	c := &recordConn{}
+	SSubscribe(hub, c, utils.ToCmdLine(local))
+	if c.ShardSubsCount() != 1 {
+		t.Error("expected subscription on local slot")
+	}
+	moved := "MOVED " + strconv.Itoa(crc16.KeySlot(remote)) + " " + peer
+	if r, ok := SSubscribe(hub, c, utils.ToCmdLine(remote)).(*reply.StandardErrReply); !ok || r.Status != moved {
+		t.Errorf("expected %q", moved)
+	}
+
+	// 槽位不属于当前节点时转发
+	if r, ok := SPublish(hub, utils.ToCmdLine(remote, "msg")).(*reply.IntReply); !ok || r.Code != 3 {
+		t.Errorf("expected forwarded reply, actually %v", r)
+	}
+	if args := <-received; !reflect.DeepEqual(args, utils.ToCmdLine("spublish", remote, "msg")) {
+		t.Errorf("unexpected forwarded command %q", args)
+	}
+	if r := SPublish(hub, utils.ToCmdLine(local, "msg")).(*reply.IntReply); r.Code != 1 {
+		t.Errorf("expected 1 receiver, actually %d", r.Code)
+	}
+}
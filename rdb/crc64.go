@@ -0,0 +1,33 @@
+// RDB 校验和
+// redis 使用 Jones 多项式的 crc64，输入输出反转，初始值和结果异或值都为 0
+
+package rdb
+
+// Jones 多项式 0xad93d23594c935a9 的反转形式
+const crc64Poly = 0x95ac9329ac4bc9b5
+
+var crc64Table = makeCRC64Table()
+
+func makeCRC64Table() *[256]uint64 {
+	table := new([256]uint64)
+	for i := range table {
+		crc := uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ crc64Poly
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+// 累加计算 crc64
+func crc64Update(crc uint64, p []byte) uint64 {
+	for _, b := range p {
+		crc = crc64Table[byte(crc)^b] ^ crc>>8
+	}
+	return crc
+}
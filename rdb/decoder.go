@@ -0,0 +1,540 @@
+// RDB 解码
+
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	// 字符串的最大长度，与 redis 的 proto-max-bulk-len 默认值一致
+	maxStringLen = 512 << 20
+	// 根据文件中的元素个数预分配的最大容量，避免错误的文件导致分配过多内存
+	maxPrealloc = 1024
+)
+
+// RDB 解码器
+type Decoder struct {
+	reader  *bufio.Reader
+	crc     uint64
+	version int
+}
+
+// 创建解码器，reader 为 *bufio.Reader 时直接使用它，解码结束后可以继续读取 RDB 之后的内容
+func NewDecoder(reader io.Reader) *Decoder {
+	return &Decoder{reader: bufio.NewReader(reader)}
+}
+
+// 读取整个 RDB，对每个 key 调用 cb，cb 返回 false 时停止读取
+func (dec *Decoder) Parse(cb func(dbIndex int, obj *Object) bool) error {
+	if err := dec.readHeader(); err != nil {
+		return err
+	}
+
+	dbIndex := 0
+	var expiration *time.Time
+	for {
+		opCode, err := dec.readByte()
+		if err != nil {
+			return err
+		}
+		switch opCode {
+		case opCodeEOF:
+			return dec.readChecksum()
+		case opCodeSelectDB:
+			index, err := dec.readPlainLength()
+			if err != nil {
+				return err
+			}
+			dbIndex = int(index)
+		case opCodeResizeDB:
+			if _, err := dec.readPlainLength(); err != nil {
+				return err
+			}
+			if _, err := dec.readPlainLength(); err != nil {
+				return err
+			}
+		case opCodeAux:
+			if _, err := dec.readString(); err != nil {
+				return err
+			}
+			if _, err := dec.readString(); err != nil {
+				return err
+			}
+		case opCodeExpireTimeMs:
+			buf, err := dec.readFull(8)
+			if err != nil {
+				return err
+			}
+			expireAt := time.UnixMilli(int64(binary.LittleEndian.Uint64(buf)))
+			expiration = &expireAt
+		case opCodeExpireTime:
+			buf, err := dec.readFull(4)
+			if err != nil {
+				return err
+			}
+			expireAt := time.Unix(int64(binary.LittleEndian.Uint32(buf)), 0)
+			expiration = &expireAt
+		case opCodeIdle:
+			if _, err := dec.readPlainLength(); err != nil {
+				return err
+			}
+		case opCodeFreq:
+			if _, err := dec.readByte(); err != nil {
+				return err
+			}
+		case opCodeSlotInfo:
+			// slot id, slot size, expires slot size
+			for i := 0; i < 3; i++ {
+				if _, err := dec.readPlainLength(); err != nil {
+					return err
+				}
+			}
+		case opCodeFunction2:
+			if _, err := dec.readString(); err != nil {
+				return err
+			}
+		case opCodeModuleAux, opCodeFunctionPre:
+			return fmt.Errorf("unsupported rdb opcode: %d", opCode)
+		default:
+			key, err := dec.readString()
+			if err != nil {
+				return err
+			}
+			obj := &Object{
+				Key:        string(key),
+				Expiration: expiration,
+			}
+			expiration = nil
+			if err := dec.readObject(opCode, obj); err != nil {
+				return err
+			}
+			if !cb(dbIndex, obj) {
+				return nil
+			}
+		}
+	}
+}
+
+// 读取文件头
+func (dec *Decoder) readHeader() error {
+	header, err := dec.readFull(len(magic) + 4)
+	if err != nil {
+		return err
+	}
+	if string(header[:len(magic)]) != magic {
+		return errInvalidFormat
+	}
+	dec.version, err = strconv.Atoi(string(header[len(magic):]))
+	if err != nil || dec.version < 1 || dec.version > maxVersion {
+		return fmt.Errorf("unsupported rdb version: %s", header[len(magic):])
+	}
+	return nil
+}
+
+// 读取并检查校验和，版本 5 以前没有校验和，校验和为 0 表示写入时没有计算
+func (dec *Decoder) readChecksum() error {
+	if dec.version < 5 {
+		return nil
+	}
+	expected := dec.crc
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(dec.reader, buf); err != nil {
+		return err
+	}
+	checksum := binary.LittleEndian.Uint64(buf)
+	if checksum != 0 && checksum != expected {
+		return errChecksum
+	}
+	return nil
+}
+
+// 按对象类型读取值
+func (dec *Decoder) readObject(objType byte, obj *Object) error {
+	var err error
+	switch objType {
+	case typeString:
+		obj.Type = StringType
+		obj.String, err = dec.readString()
+	case typeList:
+		obj.Type = ListType
+		obj.List, err = dec.readStrings()
+	case typeListZiplist:
+		obj.Type = ListType
+		obj.List, err = dec.readPacked(decodeZiplist)
+	case typeListQuicklist:
+		obj.Type = ListType
+		obj.List, err = dec.readQuicklist()
+	case typeListQuicklist2:
+		obj.Type = ListType
+		obj.List, err = dec.readQuicklist2()
+	case typeSet:
+		obj.Type = SetType
+		obj.Set, err = dec.readStrings()
+	case typeSetIntset:
+		obj.Type = SetType
+		obj.Set, err = dec.readPacked(decodeIntset)
+	case typeSetListpack:
+		obj.Type = SetType
+		obj.Set, err = dec.readPacked(decodeListpack)
+	case typeZSet, typeZSet2:
+		obj.Type = ZSetType
+		obj.ZSet, err = dec.readZSet(objType == typeZSet2)
+	case typeZSetZiplist:
+		obj.Type = ZSetType
+		obj.ZSet, err = dec.readPackedZSet(decodeZiplist)
+	case typeZSetListpack:
+		obj.Type = ZSetType
+		obj.ZSet, err = dec.readPackedZSet(decodeListpack)
+	case typeHash:
+		obj.Type = HashType
+		obj.Hash, err = dec.readHash()
+	case typeHashZiplist:
+		obj.Type = HashType
+		obj.Hash, err = dec.readPackedHash(decodeZiplist)
+	case typeHashListpack:
+		obj.Type = HashType
+		obj.Hash, err = dec.readPackedHash(decodeListpack)
+	default:
+		return fmt.Errorf("unsupported rdb object type: %d", objType)
+	}
+	return err
+}
+
+/* ---------- 基础类型 ---------- */
+
+func (dec *Decoder) readByte() (byte, error) {
+	b, err := dec.reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	dec.crc = crc64Update(dec.crc, []byte{b})
+	return b, nil
+}
+
+func (dec *Decoder) readFull(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(dec.reader, buf); err != nil {
+		return nil, err
+	}
+	dec.crc = crc64Update(dec.crc, buf)
+	return buf, nil
+}
+
+// 读取长度，special 为 true 时 length 表示字符串的特殊编码
+func (dec *Decoder) readLength() (length uint64, special bool, err error) {
+	b, err := dec.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case len6Bit:
+		return uint64(b & 0x3f), false, nil
+	case len14Bit:
+		next, err := dec.readByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(b&0x3f)<<8 | uint64(next), false, nil
+	case lenEncVal:
+		return uint64(b & 0x3f), true, nil
+	}
+	switch b {
+	case len32Bit:
+		buf, err := dec.readFull(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(buf)), false, nil
+	case len64Bit:
+		buf, err := dec.readFull(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(buf), false, nil
+	}
+	return 0, false, errInvalidFormat
+}
+
+// 读取不能是特殊编码的长度
+func (dec *Decoder) readPlainLength() (uint64, error) {
+	length, special, err := dec.readLength()
+	if err != nil {
+		return 0, err
+	}
+	if special {
+		return 0, errInvalidFormat
+	}
+	return length, nil
+}
+
+// 读取集合元素个数，限制预分配的容量
+func (dec *Decoder) readCount() (int, int, error) {
+	length, err := dec.readPlainLength()
+	if err != nil {
+		return 0, 0, err
+	}
+	if length > math.MaxInt32 {
+		return 0, 0, errInvalidFormat
+	}
+	capacity := int(length)
+	if capacity > maxPrealloc {
+		capacity = maxPrealloc
+	}
+	return int(length), capacity, nil
+}
+
+// 读取字符串，包括整数编码和 LZF 压缩的字符串
+func (dec *Decoder) readString() ([]byte, error) {
+	length, special, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if !special {
+		if length > maxStringLen {
+			return nil, errInvalidFormat
+		}
+		return dec.readFull(int(length))
+	}
+
+	switch length {
+	case encInt8:
+		buf, err := dec.readFull(1)
+		if err != nil {
+			return nil, err
+		}
+		return formatInt(int64(int8(buf[0]))), nil
+	case encInt16:
+		buf, err := dec.readFull(2)
+		if err != nil {
+			return nil, err
+		}
+		return formatInt(int64(int16(binary.LittleEndian.Uint16(buf)))), nil
+	case encInt32:
+		buf, err := dec.readFull(4)
+		if err != nil {
+			return nil, err
+		}
+		return formatInt(int64(int32(binary.LittleEndian.Uint32(buf)))), nil
+	case encLZF:
+		compressedLen, err := dec.readPlainLength()
+		if err != nil {
+			return nil, err
+		}
+		rawLen, err := dec.readPlainLength()
+		if err != nil {
+			return nil, err
+		}
+		if compressedLen > maxStringLen || rawLen > maxStringLen {
+			return nil, errInvalidFormat
+		}
+		compressed, err := dec.readFull(int(compressedLen))
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, int(rawLen))
+	}
+	return nil, errInvalidFormat
+}
+
+// 读取字符串列表
+func (dec *Decoder) readStrings() ([][]byte, error) {
+	n, capacity, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	list := make([][]byte, 0, capacity)
+	for i := 0; i < n; i++ {
+		s, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// 读取 ZSET 类型中以字符串保存的分数
+func (dec *Decoder) readDouble() (float64, error) {
+	n, err := dec.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	buf, err := dec.readFull(int(n))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(buf), 64)
+}
+
+// 读取 ZSET_2 类型中以二进制保存的分数
+func (dec *Decoder) readBinaryDouble() (float64, error) {
+	buf, err := dec.readFull(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf)), nil
+}
+
+/* ---------- 集合类型 ---------- */
+
+// 读取一个紧凑编码的字符串并解析
+func (dec *Decoder) readPacked(decode func([]byte) ([][]byte, error)) ([][]byte, error) {
+	buf, err := dec.readString()
+	if err != nil {
+		return nil, err
+	}
+	return decode(buf)
+}
+
+// 读取节点为 ziplist 的 quicklist
+func (dec *Decoder) readQuicklist() ([][]byte, error) {
+	n, _, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	var list [][]byte
+	for i := 0; i < n; i++ {
+		entries, err := dec.readPacked(decodeZiplist)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, entries...)
+	}
+	return list, nil
+}
+
+// 读取节点为 listpack 或单个大元素的 quicklist
+func (dec *Decoder) readQuicklist2() ([][]byte, error) {
+	n, _, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	var list [][]byte
+	for i := 0; i < n; i++ {
+		container, err := dec.readPlainLength()
+		if err != nil {
+			return nil, err
+		}
+		switch container {
+		case quicklistNodePlain:
+			s, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, s)
+		case quicklistNodePacked:
+			entries, err := dec.readPacked(decodeListpack)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, entries...)
+		default:
+			return nil, errInvalidFormat
+		}
+	}
+	return list, nil
+}
+
+// 读取有序集合
+func (dec *Decoder) readZSet(binaryScore bool) ([]ZSetMember, error) {
+	n, capacity, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]ZSetMember, 0, capacity)
+	for i := 0; i < n; i++ {
+		member, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if binaryScore {
+			score, err = dec.readBinaryDouble()
+		} else {
+			score, err = dec.readDouble()
+		}
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, ZSetMember{Member: string(member), Score: score})
+	}
+	return members, nil
+}
+
+// 读取紧凑编码的有序集合，成员和分数交替保存
+func (dec *Decoder) readPackedZSet(decode func([]byte) ([][]byte, error)) ([]ZSetMember, error) {
+	entries, err := dec.readPacked(decode)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries)%2 != 0 {
+		return nil, errInvalidFormat
+	}
+	members := make([]ZSetMember, 0, len(entries)/2)
+	for i := 0; i < len(entries); i += 2 {
+		score, err := strconv.ParseFloat(string(entries[i+1]), 64)
+		if err != nil {
+			return nil, errInvalidFormat
+		}
+		members = append(members, ZSetMember{Member: string(entries[i]), Score: score})
+	}
+	return members, nil
+}
+
+// 读取哈希
+func (dec *Decoder) readHash() ([]HashField, error) {
+	n, capacity, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]HashField, 0, capacity)
+	for i := 0; i < n; i++ {
+		field, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, HashField{Field: string(field), Value: value})
+	}
+	return fields, nil
+}
+
+// 读取紧凑编码的哈希，field 和 value 交替保存
+func (dec *Decoder) readPackedHash(decode func([]byte) ([][]byte, error)) ([]HashField, error) {
+	entries, err := dec.readPacked(decode)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries)%2 != 0 {
+		return nil, errInvalidFormat
+	}
+	fields := make([]HashField, 0, len(entries)/2)
+	for i := 0; i < len(entries); i += 2 {
+		fields = append(fields, HashField{Field: string(entries[i]), Value: entries[i+1]})
+	}
+	return fields, nil
+}
+
+// 判断 reader 是否以 RDB 文件头开始，不会消耗 reader 中的数据
+func HasPreamble(reader *bufio.Reader) bool {
+	header, err := reader.Peek(len(magic))
+	return err == nil && string(header) == magic
+}
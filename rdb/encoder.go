@@ -0,0 +1,197 @@
+// RDB 编码
+
+package rdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// RDB 编码器，写入的同时计算校验和
+type Encoder struct {
+	writer io.Writer
+	crc    uint64
+}
+
+// 创建编码器
+func NewEncoder(writer io.Writer) *Encoder {
+	return &Encoder{writer: writer}
+}
+
+func (enc *Encoder) write(p []byte) error {
+	enc.crc = crc64Update(enc.crc, p)
+	_, err := enc.writer.Write(p)
+	return err
+}
+
+// 写入文件头和辅助字段
+func (enc *Encoder) WriteHeader() error {
+	if err := enc.write([]byte(fmt.Sprintf("%s%04d", magic, version))); err != nil {
+		return err
+	}
+	aux := [][2]string{
+		{"redis-ver", redisVersion},
+		{"redis-bits", strconv.Itoa(strconv.IntSize)},
+		{"ctime", strconv.FormatInt(time.Now().Unix(), 10)},
+	}
+	for _, kv := range aux {
+		if err := enc.WriteAux(kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 写入辅助字段
+func (enc *Encoder) WriteAux(key string, value string) error {
+	if err := enc.write([]byte{opCodeAux}); err != nil {
+		return err
+	}
+	if err := enc.writeString([]byte(key)); err != nil {
+		return err
+	}
+	return enc.writeString([]byte(value))
+}
+
+// 写入数据库编号和 key 个数，之后写入的 key 都属于这个数据库
+func (enc *Encoder) WriteDBHeader(dbIndex int, keyCount int, ttlCount int) error {
+	if err := enc.write([]byte{opCodeSelectDB}); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(dbIndex)); err != nil {
+		return err
+	}
+	if err := enc.write([]byte{opCodeResizeDB}); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(keyCount)); err != nil {
+		return err
+	}
+	return enc.writeLength(uint64(ttlCount))
+}
+
+// 写入一个 key
+func (enc *Encoder) WriteObject(obj *Object) error {
+	if obj.Expiration != nil {
+		buf := make([]byte, 9)
+		buf[0] = opCodeExpireTimeMs
+		binary.LittleEndian.PutUint64(buf[1:], uint64(obj.Expiration.UnixMilli()))
+		if err := enc.write(buf); err != nil {
+			return err
+		}
+	}
+
+	var objType byte
+	switch obj.Type {
+	case StringType:
+		objType = typeString
+	case ListType:
+		objType = typeList
+	case SetType:
+		objType = typeSet
+	case ZSetType:
+		objType = typeZSet2
+	case HashType:
+		objType = typeHash
+	default:
+		return fmt.Errorf("unknown object type: %s", obj.Type)
+	}
+	if err := enc.write([]byte{objType}); err != nil {
+		return err
+	}
+	if err := enc.writeString([]byte(obj.Key)); err != nil {
+		return err
+	}
+
+	switch obj.Type {
+	case StringType:
+		return enc.writeString(obj.String)
+	case ListType:
+		return enc.writeStrings(obj.List)
+	case SetType:
+		return enc.writeStrings(obj.Set)
+	case ZSetType:
+		if err := enc.writeLength(uint64(len(obj.ZSet))); err != nil {
+			return err
+		}
+		buf := make([]byte, 8)
+		for _, member := range obj.ZSet {
+			if err := enc.writeString([]byte(member.Member)); err != nil {
+				return err
+			}
+			binary.LittleEndian.PutUint64(buf, math.Float64bits(member.Score))
+			if err := enc.write(buf); err != nil {
+				return err
+			}
+		}
+	case HashType:
+		if err := enc.writeLength(uint64(len(obj.Hash))); err != nil {
+			return err
+		}
+		for _, field := range obj.Hash {
+			if err := enc.writeString([]byte(field.Field)); err != nil {
+				return err
+			}
+			if err := enc.writeString(field.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 写入结束标记和校验和
+func (enc *Encoder) WriteEnd() error {
+	if err := enc.write([]byte{opCodeEOF}); err != nil {
+		return err
+	}
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, enc.crc)
+	_, err := enc.writer.Write(buf)
+	return err
+}
+
+// 写入长度
+func (enc *Encoder) writeLength(length uint64) error {
+	var buf []byte
+	switch {
+	case length <= maxLen6Bit:
+		buf = []byte{byte(length)}
+	case length < 1<<14:
+		buf = []byte{byte(length>>8) | len14Bit<<6, byte(length)}
+	case length <= math.MaxUint32:
+		buf = make([]byte, 5)
+		buf[0] = len32Bit
+		binary.BigEndian.PutUint32(buf[1:], uint32(length))
+	default:
+		buf = make([]byte, 9)
+		buf[0] = len64Bit
+		binary.BigEndian.PutUint64(buf[1:], length)
+	}
+	return enc.write(buf)
+}
+
+// 写入字符串
+func (enc *Encoder) writeString(s []byte) error {
+	if err := enc.writeLength(uint64(len(s))); err != nil {
+		return err
+	}
+	return enc.write(s)
+}
+
+// 写入字符串列表
+func (enc *Encoder) writeStrings(list [][]byte) error {
+	if err := enc.writeLength(uint64(len(list))); err != nil {
+		return err
+	}
+	for _, s := range list {
+		if err := enc.writeString(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+// LZF 解压，redis 用它压缩较长的字符串
+
+package rdb
+
+// 解压 in 到长度为 outLen 的结果中
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	out := make([]byte, 0, outLen)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 1<<5 {
+			// 字面量，长度为 ctrl + 1
+			n := ctrl + 1
+			if i+n > len(in) || len(out)+n > outLen {
+				return nil, errInvalidFormat
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		// 回溯引用
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errInvalidFormat
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errInvalidFormat
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		n += 2
+		if ref < 0 || len(out)+n > outLen {
+			return nil, errInvalidFormat
+		}
+		// 引用区域可能与输出重叠，需要逐字节复制
+		for j := 0; j < n; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != outLen {
+		return nil, errInvalidFormat
+	}
+	return out, nil
+}
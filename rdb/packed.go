@@ -0,0 +1,187 @@
+// 解析 redis 的紧凑编码：ziplist、listpack 和 intset
+// 整数元素统一转换为十进制字符串
+
+package rdb
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+// 读取紧凑编码的游标，越界时 err 不为 nil
+type packedReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+// 读取 n 个字节
+func (r *packedReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.buf) {
+		r.err = errInvalidFormat
+		return nil
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// 读取一个字节
+func (r *packedReader) byte() byte {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+// 读取 n 个字节的小端有符号整数
+func (r *packedReader) int(n int) int64 {
+	b := r.next(n)
+	if b == nil {
+		return 0
+	}
+	var v uint64
+	for i := n - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	// 符号扩展
+	shift := uint(64 - 8*n)
+	return int64(v<<shift) >> shift
+}
+
+func formatInt(v int64) []byte {
+	return []byte(strconv.FormatInt(v, 10))
+}
+
+// 解析 ziplist
+func decodeZiplist(buf []byte) ([][]byte, error) {
+	r := &packedReader{buf: buf}
+	// zlbytes zltail zllen
+	r.next(10)
+	var entries [][]byte
+	for r.err == nil {
+		if r.pos < len(buf) && buf[r.pos] == 0xFF {
+			return entries, nil
+		}
+		// prevlen
+		if r.byte() == 254 {
+			r.next(4)
+		}
+		enc := r.byte()
+		switch {
+		case enc>>6 == 0:
+			entries = append(entries, r.next(int(enc&0x3f)))
+		case enc>>6 == 1:
+			n := int(enc&0x3f)<<8 | int(r.byte())
+			entries = append(entries, r.next(n))
+		case enc>>6 == 2:
+			n := r.next(4)
+			if n != nil {
+				entries = append(entries, r.next(int(binary.BigEndian.Uint32(n))))
+			}
+		case enc == 0xC0:
+			entries = append(entries, formatInt(r.int(2)))
+		case enc == 0xD0:
+			entries = append(entries, formatInt(r.int(4)))
+		case enc == 0xE0:
+			entries = append(entries, formatInt(r.int(8)))
+		case enc == 0xF0:
+			entries = append(entries, formatInt(r.int(3)))
+		case enc == 0xFE:
+			entries = append(entries, formatInt(r.int(1)))
+		case enc >= 0xF1 && enc <= 0xFD:
+			// 4 位立即数，取值 0 到 12
+			entries = append(entries, formatInt(int64(enc&0x0f)-1))
+		default:
+			return nil, errInvalidFormat
+		}
+	}
+	return nil, r.err
+}
+
+// listpack 元素末尾 backlen 的长度
+func listpackBacklenSize(entryLen int) int {
+	switch {
+	case entryLen <= 127:
+		return 1
+	case entryLen < 16383:
+		return 2
+	case entryLen < 2097151:
+		return 3
+	case entryLen < 268435455:
+		return 4
+	}
+	return 5
+}
+
+// 解析 listpack
+func decodeListpack(buf []byte) ([][]byte, error) {
+	r := &packedReader{buf: buf}
+	// total bytes, num elements
+	r.next(6)
+	var entries [][]byte
+	for r.err == nil {
+		start := r.pos
+		enc := r.byte()
+		switch {
+		case enc == 0xFF:
+			if r.err != nil {
+				return nil, r.err
+			}
+			return entries, nil
+		case enc&0x80 == 0:
+			entries = append(entries, formatInt(int64(enc)))
+		case enc&0xC0 == 0x80:
+			entries = append(entries, r.next(int(enc&0x3f)))
+		case enc&0xE0 == 0xC0:
+			// 13 位有符号整数
+			v := int64(enc&0x1f)<<8 | int64(r.byte())
+			if v >= 1<<12 {
+				v -= 1 << 13
+			}
+			entries = append(entries, formatInt(v))
+		case enc&0xF0 == 0xE0:
+			n := int(enc&0x0f)<<8 | int(r.byte())
+			entries = append(entries, r.next(n))
+		case enc == 0xF0:
+			n := r.next(4)
+			if n != nil {
+				entries = append(entries, r.next(int(binary.LittleEndian.Uint32(n))))
+			}
+		case enc == 0xF1:
+			entries = append(entries, formatInt(r.int(2)))
+		case enc == 0xF2:
+			entries = append(entries, formatInt(r.int(3)))
+		case enc == 0xF3:
+			entries = append(entries, formatInt(r.int(4)))
+		case enc == 0xF4:
+			entries = append(entries, formatInt(r.int(8)))
+		default:
+			return nil, errInvalidFormat
+		}
+		r.next(listpackBacklenSize(r.pos - start))
+	}
+	return nil, r.err
+}
+
+// 解析 intset
+func decodeIntset(buf []byte) ([][]byte, error) {
+	r := &packedReader{buf: buf}
+	width := int(r.int(4))
+	length := int(r.int(4))
+	if r.err != nil || (width != 2 && width != 4 && width != 8) {
+		return nil, errInvalidFormat
+	}
+	entries := make([][]byte, 0, length)
+	for i := 0; i < length && r.err == nil; i++ {
+		entries = append(entries, formatInt(r.int(width)))
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return entries, nil
+}
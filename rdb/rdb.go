@@ -0,0 +1,113 @@
+// RDB 快照格式
+// 与 redis 的 RDB 文件格式兼容，写入版本 9，能够读取版本 12 以内 redis 生成的文件
+
+package rdb
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	magic = "REDIS"
+	// 写入的版本
+	version = 9
+	// 能够读取的最高版本
+	maxVersion = 12
+	// 写入 redis-ver 辅助字段的版本号，加载时 redis 只用它打印日志
+	redisVersion = "7.0.0"
+)
+
+// 操作码
+const (
+	opCodeSlotInfo     = 0xF4
+	opCodeFunction2    = 0xF5
+	opCodeFunctionPre  = 0xF6
+	opCodeModuleAux    = 0xF7
+	opCodeIdle         = 0xF8
+	opCodeFreq         = 0xF9
+	opCodeAux          = 0xFA
+	opCodeResizeDB     = 0xFB
+	opCodeExpireTimeMs = 0xFC
+	opCodeExpireTime   = 0xFD
+	opCodeSelectDB     = 0xFE
+	opCodeEOF          = 0xFF
+)
+
+// 对象编码类型
+const (
+	typeString         = 0
+	typeList           = 1
+	typeSet            = 2
+	typeZSet           = 3
+	typeHash           = 4
+	typeZSet2          = 5
+	typeListZiplist    = 10
+	typeSetIntset      = 11
+	typeZSetZiplist    = 12
+	typeHashZiplist    = 13
+	typeListQuicklist  = 14
+	typeHashListpack   = 16
+	typeZSetListpack   = 17
+	typeListQuicklist2 = 18
+	typeSetListpack    = 20
+)
+
+// quicklist 2 的节点类型
+const (
+	quicklistNodePlain  = 1
+	quicklistNodePacked = 2
+)
+
+// 长度编码
+const (
+	len6Bit    = 0
+	len14Bit   = 1
+	lenEncVal  = 3
+	len32Bit   = 0x80
+	len64Bit   = 0x81
+	encInt8    = 0
+	encInt16   = 1
+	encInt32   = 2
+	encLZF     = 3
+	maxLen6Bit = 1<<6 - 1
+)
+
+// 对象类型，与 TYPE 指令的返回值一致
+const (
+	StringType = "string"
+	ListType   = "list"
+	SetType    = "set"
+	ZSetType   = "zset"
+	HashType   = "hash"
+)
+
+// 哈希的 field/value 对
+type HashField struct {
+	Field string
+	Value []byte
+}
+
+// 有序集合的成员
+type ZSetMember struct {
+	Member string
+	Score  float64
+}
+
+// RDB 中的一个 key，Type 决定使用哪个值字段
+type Object struct {
+	Key        string
+	Type       string
+	Expiration *time.Time
+
+	String []byte
+	List   [][]byte
+	Set    [][]byte
+	Hash   []HashField
+	ZSet   []ZSetMember
+}
+
+var (
+	errInvalidFormat = errors.New("invalid rdb format")
+	errChecksum      = errors.New("rdb checksum mismatch")
+)
@@ -0,0 +1,199 @@
+// 测试 RDB 编解码
+
+package rdb
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func toStrings(entries [][]byte) []string {
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = string(entry)
+	}
+	return result
+}
+
+func TestCRC64(t *testing.T) {
+	// redis 源码 crc64.c 中的测试用例
+	if crc := crc64Update(0, []byte("123456789")); crc != 0xe9c6d914c4b8d9ca {
+		t.Errorf("unexpected crc64 %x", crc)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	expireAt := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+	objects := []*Object{
+		{Key: "str", Type: StringType, String: []byte("hello")},
+		{Key: "empty", Type: StringType, String: []byte{}},
+		{Key: "big", Type: StringType, String: bytes.Repeat([]byte("x"), 20000), Expiration: &expireAt},
+		{Key: "list", Type: ListType, List: [][]byte{[]byte("a"), []byte("b")}},
+		{Key: "set", Type: SetType, Set: [][]byte{[]byte("a")}},
+		{Key: "hash", Type: HashType, Hash: []HashField{{Field: "f", Value: []byte("v")}}},
+		{Key: "zset", Type: ZSetType, ZSet: []ZSetMember{{Member: "a", Score: 1.5}, {Member: "b", Score: math.Inf(1)}}},
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.WriteDBHeader(0, 3, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range objects[:3] {
+		if err := enc.WriteObject(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.WriteDBHeader(15, len(objects)-3, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range objects[3:] {
+		if err := enc.WriteObject(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.WriteEnd(); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("tail")
+
+	var decoded []*Object
+	var dbIndexes []int
+	reader := bytes.NewReader(buf.Bytes())
+	dec := NewDecoder(reader)
+	err := dec.Parse(func(dbIndex int, obj *Object) bool {
+		decoded = append(decoded, obj)
+		dbIndexes = append(dbIndexes, dbIndex)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, objects) {
+		t.Errorf("decoded objects mismatch")
+	}
+	if !reflect.DeepEqual(dbIndexes, []int{0, 0, 0, 15, 15, 15, 15}) {
+		t.Errorf("unexpected db indexes %v", dbIndexes)
+	}
+	// RDB 之后的内容仍然可以从解码器的 reader 中读取
+	if tail, _ := dec.reader.ReadString(0); tail != "tail" {
+		t.Errorf("expected tail, actually %q", tail)
+	}
+
+	// 校验和错误
+	data := buf.Bytes()
+	data[len(data)-len("tail")-1] ^= 0xff
+	err = NewDecoder(bytes.NewReader(data)).Parse(func(int, *Object) bool { return true })
+	if err != errChecksum {
+		t.Errorf("expected checksum error, actually %v", err)
+	}
+}
+
+func TestDecodePacked(t *testing.T) {
+	header := make([]byte, 10)
+	ziplist := append(header, 0x00, 0x01, 'a', 0x03, 0xF2, 0x02, 0xFE, 0xFB, 0x03, 0xC0, 0xE8, 0x03, 0xFF)
+	entries, err := decodeZiplist(ziplist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := toStrings(entries); !reflect.DeepEqual(got, []string{"a", "1", "-5", "1000"}) {
+		t.Errorf("unexpected ziplist entries %v", got)
+	}
+
+	listpack := []byte{0, 0, 0, 0, 0, 0,
+		0x81, 'a', 0x02,
+		0x05, 0x01,
+		0xDF, 0x9C, 0x02,
+		0xF1, 0xE8, 0x03, 0x03,
+		0xFF}
+	entries, err = decodeListpack(listpack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := toStrings(entries); !reflect.DeepEqual(got, []string{"a", "5", "-100", "1000"}) {
+		t.Errorf("unexpected listpack entries %v", got)
+	}
+
+	intset := []byte{2, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0xFE, 0xFF}
+	entries, err = decodeIntset(intset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := toStrings(entries); !reflect.DeepEqual(got, []string{"1", "-2"}) {
+		t.Errorf("unexpected intset entries %v", got)
+	}
+
+	if _, err := decodeListpack(listpack[:10]); err == nil {
+		t.Error("expected error for truncated listpack")
+	}
+}
+
+func TestLZF(t *testing.T) {
+	out, err := lzfDecompress([]byte{0x00, 'a', 0xE0, 0x00, 0x00}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "aaaaaaaaaa" {
+		t.Errorf("unexpected lzf output %q", out)
+	}
+	if _, err := lzfDecompress([]byte{0x00, 'a', 0xE0, 0x00, 0x05}, 10); err == nil {
+		t.Error("expected error for invalid back reference")
+	}
+}
+
+// 按 redis 7 的编码构造的文件
+func TestDecodeRedisEncodings(t *testing.T) {
+	listpack := []byte{0, 0, 0, 0, 0, 0, 0x81, 'a', 0x02, 0x05, 0x01, 0xFF}
+	data := []byte("REDIS0011")
+	data = append(data, opCodeAux, 0x02, 'k', 'v', 0xC0, 0x40)
+	data = append(data, opCodeSelectDB, 0x01, opCodeResizeDB, 0x03, 0x00)
+	// 整数编码的字符串
+	data = append(data, typeString, 0x01, 'n', 0xC1, 0x39, 0x30)
+	// LZF 压缩的字符串
+	data = append(data, opCodeExpireTime, 0x00, 0x00, 0x00, 0x70)
+	data = append(data, typeString, 0x01, 'z', 0xC3, 0x05, 0x0A, 0x00, 'a', 0xE0, 0x00, 0x00)
+	// quicklist 2
+	data = append(data, opCodeIdle, 0x05, typeListQuicklist2, 0x01, 'l', 0x02, quicklistNodePacked, byte(len(listpack)))
+	data = append(data, listpack...)
+	data = append(data, quicklistNodePlain, 0x01, 'b')
+	// listpack 编码的哈希和有序集合
+	data = append(data, opCodeFreq, 0x01, typeHashListpack, 0x01, 'h', byte(len(listpack)))
+	data = append(data, listpack...)
+	data = append(data, typeZSetListpack, 0x01, 's', byte(len(listpack)))
+	data = append(data, listpack...)
+	data = append(data, opCodeEOF, 0, 0, 0, 0, 0, 0, 0, 0)
+
+	objects := make(map[string]*Object)
+	err := NewDecoder(bytes.NewReader(data)).Parse(func(dbIndex int, obj *Object) bool {
+		if dbIndex != 1 {
+			t.Errorf("expected db 1, actually %d", dbIndex)
+		}
+		objects[obj.Key] = obj
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(objects["n"].String) != "12345" || objects["n"].Expiration != nil {
+		t.Errorf("unexpected int string %q", objects["n"].String)
+	}
+	if string(objects["z"].String) != "aaaaaaaaaa" || objects["z"].Expiration == nil ||
+		objects["z"].Expiration.Unix() != 0x70000000 {
+		t.Errorf("unexpected lzf string %q", objects["z"].String)
+	}
+	if got := toStrings(objects["l"].List); !reflect.DeepEqual(got, []string{"a", "5", "b"}) {
+		t.Errorf("unexpected list %v", got)
+	}
+	if h := objects["h"].Hash; len(h) != 1 || h[0].Field != "a" || string(h[0].Value) != "5" {
+		t.Errorf("unexpected hash %v", h)
+	}
+	if z := objects["s"].ZSet; len(z) != 1 || z[0].Member != "a" || z[0].Score != 5 {
+		t.Errorf("unexpected zset %v", z)
+	}
+}
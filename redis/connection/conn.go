@@ -8,19 +8,25 @@ import (
 	"sync"
 	"time"
 
+	"ljr-redis/interface/redis"
 	"ljr-redis/lib/sync/wait"
 )
 
 type Connection struct {
-	conn         net.Conn          // tcp 连接
-	waitingReply wait.Wait         // 等待直到服务器响应
-	mu           sync.Mutex        // 服务器响应时上锁
-	subs         map[string]bool   // 订阅
-	password     string            // 密码
-	multiState   bool              // 是否在执行复杂指令
-	queue        [][][]byte        // 复杂指令队列
-	watching     map[string]uint32 // watching
-	selectedDB   int               // 选择的数据库
+	conn         net.Conn                  // tcp 连接
+	waitingReply wait.Wait                 // 等待直到服务器响应
+	mu           sync.Mutex                // 服务器响应时上锁
+	subs         map[string]bool           // 订阅
+	psubs        map[string]bool           // 按模式订阅
+	ssubs        map[string]bool           // 订阅分片 channel
+	user         string                    // 认证的用户
+	multiState   bool                      // 是否在执行复杂指令
+	queue        []redis.QueuedCmd         // 复杂指令队列
+	txErrors     []error                   // 加入队列时被拒绝的指令
+	watching     map[int]map[string]uint32 // watching
+	selectedDB   int                       // 选择的数据库
+	blocked      chan struct{}             // 被阻塞指令挂起时不为 nil，解除挂起时关闭
+	blockMu      sync.Mutex                // 保护 blocked
 }
 
 // 创建新连接
@@ -61,14 +67,14 @@ func (c *Connection) Write(b []byte) error {
 	return err
 }
 
-// 设置 Auth 密码
-func (c *Connection) SetPassword(password string) {
-	c.password = password
+// 设置认证的用户
+func (c *Connection) SetUser(user string) {
+	c.user = user
 }
 
-// 获取 Auth 密码
-func (c *Connection) GetPassword() string {
-	return c.password
+// 获取认证的用户
+func (c *Connection) GetUser() string {
+	return c.user
 }
 
 /* ----------- 客户端订阅 ----------- */
@@ -94,9 +100,58 @@ func (c *Connection) UnSubscribe(channel string) {
 	delete(c.subs, channel)
 }
 
-// 订阅个数
+// 按模式订阅
+func (c *Connection) PSubscribe(pattern string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.psubs == nil {
+		c.psubs = make(map[string]bool, 0)
+	}
+	c.psubs[pattern] = true
+}
+
+// 取消按模式订阅
+func (c *Connection) PUnSubscribe(pattern string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.psubs) == 0 {
+		return
+	}
+	delete(c.psubs, pattern)
+}
+
+// 订阅分片 channel
+func (c *Connection) SSubscribe(channel string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ssubs == nil {
+		c.ssubs = make(map[string]bool, 0)
+	}
+	c.ssubs[channel] = true
+}
+
+// 取消订阅分片 channel
+func (c *Connection) SUnSubscribe(channel string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.ssubs) == 0 {
+		return
+	}
+	delete(c.ssubs, channel)
+}
+
+// 订阅个数，包括 channel 和模式
 func (c *Connection) SubsCount() int {
-	return len(c.subs)
+	return len(c.subs) + len(c.psubs)
+}
+
+// 订阅的分片 channel 个数
+func (c *Connection) ShardSubsCount() int {
+	return len(c.ssubs)
 }
 
 // 获取所有订阅
@@ -114,6 +169,24 @@ func (c *Connection) GetChannels() []string {
 	return channels
 }
 
+// 获取所有订阅的模式
+func (c *Connection) GetPatterns() []string {
+	patterns := make([]string, 0, len(c.psubs))
+	for pattern := range c.psubs {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// 获取所有订阅的分片 channel
+func (c *Connection) GetShardChannels() []string {
+	channels := make([]string, 0, len(c.ssubs))
+	for channel := range c.ssubs {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
 /* ----------- 复杂指令 ----------- */
 
 // 是否在执行复杂指令
@@ -127,18 +200,19 @@ func (c *Connection) SetMultiState(state bool) {
 		// 取消执行复杂指令需要清空数据
 		c.watching = nil
 		c.queue = nil
+		c.txErrors = nil
 	}
 	c.multiState = state
 }
 
 // 获取指令队列
-func (c *Connection) GetQueuedCmdLine() [][][]byte {
+func (c *Connection) GetQueuedCmds() []redis.QueuedCmd {
 	return c.queue
 }
 
 // 插入指令到队列
-func (c *Connection) EnqueueCmd(cmdLine [][]byte) {
-	c.queue = append(c.queue, cmdLine)
+func (c *Connection) EnqueueCmd(dbIndex int, cmdLine [][]byte) {
+	c.queue = append(c.queue, redis.QueuedCmd{DBIndex: dbIndex, CmdLine: cmdLine})
 }
 
 // 清空指令队列
@@ -146,14 +220,63 @@ func (c *Connection) ClearQueuedCmds() {
 	c.queue = nil
 }
 
+// 记录加入队列时的错误
+func (c *Connection) AddTxError(err error) {
+	c.txErrors = append(c.txErrors, err)
+}
+
+// 获取加入队列时的错误
+func (c *Connection) GetTxErrors() []error {
+	return c.txErrors
+}
+
 // 获取 watching 列表
-func (c *Connection) GetWatching() map[string]uint32 {
+func (c *Connection) GetWatching() map[int]map[string]uint32 {
 	if c.watching == nil {
-		c.watching = make(map[string]uint32, 0)
+		c.watching = make(map[int]map[string]uint32)
 	}
 	return c.watching
 }
 
+/* ----------- 阻塞指令 ----------- */
+
+// 设置是否被阻塞指令挂起
+func (c *Connection) SetBlocked(blocked bool) {
+	c.blockMu.Lock()
+	defer c.blockMu.Unlock()
+
+	if blocked {
+		if c.blocked == nil {
+			c.blocked = make(chan struct{})
+		}
+		return
+	}
+	if c.blocked != nil {
+		close(c.blocked)
+		c.blocked = nil
+	}
+}
+
+// 是否被阻塞指令挂起
+func (c *Connection) IsBlocked() bool {
+	c.blockMu.Lock()
+	defer c.blockMu.Unlock()
+	return c.blocked != nil
+}
+
+// 解除挂起时关闭的 channel，没有挂起时返回已关闭的 channel
+func (c *Connection) Unblocked() <-chan struct{} {
+	c.blockMu.Lock()
+	defer c.blockMu.Unlock()
+
+	if c.blocked == nil {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}
+	return c.blocked
+}
+
 /* ----------- 多数据库 ----------- */
 
 // 获取当前数据库索引
@@ -0,0 +1,19 @@
+// 伪造的客户端连接
+// 用于重放 AOF 等不需要向客户端发送响应的场景
+
+package connection
+
+// 伪造的客户端连接，丢弃所有响应
+type FakeConn struct {
+	Connection
+}
+
+// 创建伪造连接
+func NewFakeConn() *FakeConn {
+	return &FakeConn{}
+}
+
+// 丢弃响应
+func (c *FakeConn) Write(b []byte) error {
+	return nil
+}
@@ -20,6 +20,9 @@ import (
 type Payload struct {
 	Data redis.Reply
 	Err  error
+
+	// 解析完这条数据时从 reader 读取的总字节数，读取错误时为已解析部分的字节数
+	Offset int64
 }
 
 // 流式处理的接口适合提供给客户端 / 服务端使用
@@ -59,6 +62,15 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 	bufReader := bufio.NewReader(reader)
 	var err error
 	var msg []byte
+	// 已读取的完整行的字节数
+	var offset int64
+	// 最后一条完整数据结束时的字节数
+	var parsed int64
+	send := func(payload *Payload) {
+		parsed = offset
+		payload.Offset = parsed
+		ch <- payload
+	}
 
 	for {
 		// 读取一行
@@ -68,21 +80,24 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 		if err != nil {
 			// 处理错误
 			if ioErr {
-				// 读取错误
+				// 读取错误，不完整的数据不计入
 				ch <- &Payload{
-					Err: err,
+					Err:    err,
+					Offset: parsed,
 				}
 				close(ch)
 				return
 			}
 
 			// 协议错误
-			ch <- &Payload{
+			offset += int64(len(msg))
+			send(&Payload{
 				Err: err,
-			}
+			})
 			state = readState{}
 			continue
 		}
+		offset += int64(len(msg))
 
 		// 单行： Status Int Error
 		// 多行： BulkString MultiBulkStrings
@@ -93,9 +108,9 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 				// 多行参数 MultiBulkStrings
 				err = parseMultiBulkHeader(msg, &state)
 				if err != nil {
-					ch <- &Payload{
+					send(&Payload{
 						Err: errors.New("protocol error: " + string(msg)),
-					}
+					})
 					// 重置读取状态
 					state = readState{}
 					continue
@@ -103,9 +118,9 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 
 				if state.expectedArgsCount == 0 {
 					// 多行参数为空
-					ch <- &Payload{
+					send(&Payload{
 						Data: &reply.EmptyMultiBulkReply{},
-					}
+					})
 					// 重置读取状态
 					state = readState{}
 					continue
@@ -115,17 +130,17 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 				// 单行参数
 				err = parseBulkHeader(msg, &state)
 				if err != nil {
-					ch <- &Payload{
+					send(&Payload{
 						Err: errors.New("protocol error: " + string(msg)),
-					}
+					})
 					state = readState{}
 					continue
 				}
 				if state.bulkLen == -1 {
 					// 单行参数为空
-					ch <- &Payload{
+					send(&Payload{
 						Data: &reply.NullBulkReply{},
-					}
+					})
 					state = readState{}
 					continue
 				}
@@ -133,10 +148,10 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 			} else {
 				// 读取单行 Status Int Error
 				result, err := parseSingleLineReply(msg)
-				ch <- &Payload{
+				send(&Payload{
 					Data: result,
 					Err:  err,
-				}
+				})
 				state = readState{}
 				continue
 			}
@@ -146,9 +161,9 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 			// BulkString MultiBulkStrings 除头部外的数据
 			err = readBody(msg, &state)
 			if err != nil {
-				ch <- &Payload{
+				send(&Payload{
 					Err: errors.New("protocol error: " + string(msg)),
-				}
+				})
 				state = readState{}
 				continue
 			}
@@ -162,10 +177,10 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 					result = reply.MakeBulkReply(state.args[0])
 				}
 
-				ch <- &Payload{
+				send(&Payload{
 					Data: result,
 					Err:  err,
-				}
+				})
 				state = readState{}
 			}
 
@@ -205,7 +220,7 @@ func readLine(bufReader *bufio.Reader, state *readState) ([]byte, bool, error) {
 			return nil, true, err
 		}
 		if len(msg) == 0 || msg[len(msg)-2] != '\r' {
-			return nil, false, errors.New("protocol error: " + string(msg))
+			return msg, false, errors.New("protocol error: " + string(msg))
 		}
 	} else {
 		// 读取 Bulk String (Multi Bulk Strings)
@@ -215,7 +230,7 @@ func readLine(bufReader *bufio.Reader, state *readState) ([]byte, bool, error) {
 			return nil, true, err
 		}
 		if len(msg) == 0 || msg[len(msg)-2] != '\r' || msg[len(msg)-1] != '\n' {
-			return nil, false, errors.New("protocol error: " + string(msg))
+			return msg, false, errors.New("protocol error: " + string(msg))
 		}
 
 		state.bulkLen = 0
@@ -68,3 +68,25 @@ func TestParseStream(t *testing.T) {
 		}
 	}
 }
+
+func TestParseOffset(t *testing.T) {
+	first := reply.MakeMultiBulkReply([][]byte{[]byte("set"), []byte("a"), []byte("1")}).ToBytes()
+	second := reply.MakeMultiBulkReply([][]byte{[]byte("get"), []byte("a")}).ToBytes()
+	data := append(append([]byte{}, first...), second...)
+	// 末尾不完整的数据不计入
+	data = append(data, []byte("*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$5\r\nva")...)
+
+	var offsets []int64
+	for payload := range ParseStream(bytes.NewReader(data)) {
+		offsets = append(offsets, payload.Offset)
+	}
+	expected := []int64{int64(len(first)), int64(len(first) + len(second)), int64(len(first) + len(second))}
+	if len(offsets) != len(expected) {
+		t.Fatalf("expected offsets %v, actually %v", expected, offsets)
+	}
+	for i := range expected {
+		if offsets[i] != expected[i] {
+			t.Fatalf("expected offsets %v, actually %v", expected, offsets)
+		}
+	}
+}
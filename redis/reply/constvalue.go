@@ -17,6 +17,20 @@ func MakeEmptyMultiBulkReply() *EmptyMultiBulkReply {
 	return &EmptyMultiBulkReply{}
 }
 
+/* ------------ Multi Bulk Strings 为 nil *-1 ------------ */
+var nullMultiBulkBytes = []byte("*-1\r\n")
+
+type NullMultiBulkReply struct{}
+
+// marshal 安排 redis.Reply ToBytes
+func (r *NullMultiBulkReply) ToBytes() []byte {
+	return nullMultiBulkBytes
+}
+
+func MakeNullMultiBulkReply() *NullMultiBulkReply {
+	return &NullMultiBulkReply{}
+}
+
 /* ------------ Bulk String 为空 $0 ------------ */
 var nullBulkBytes = []byte("$-1\r\n")
 
@@ -31,6 +45,22 @@ func MakeNullBulkReply() *NullBulkReply {
 	return &NullBulkReply{}
 }
 
+/* ------------ NoReply 不立即响应，例如被阻塞指令挂起 ------------ */
+type NoReply struct{}
+
+var noBytes = []byte("")
+
+// marshal 安排 redis.Reply ToBytes
+func (r *NoReply) ToBytes() []byte {
+	return noBytes
+}
+
+var theNoReply = new(NoReply)
+
+func MakeNoReply() *NoReply {
+	return theNoReply
+}
+
 /* ------------ QueuedReply is +QUEUED ------------ */
 type QueuedReply struct{}
 
@@ -36,3 +36,36 @@ func MakeArgNumErrReply(cmd string) *ArgNumErrReply {
 		Cmd: cmd,
 	}
 }
+
+/* --------- 语法错误 --------- */
+type SyntaxErrReply struct{}
+
+var syntaxErrBytes = []byte("-ERR syntax error\r\n")
+var theSyntaxErrReply = &SyntaxErrReply{}
+
+// marshals 安排 redis.Reply ToBytes
+func (r *SyntaxErrReply) ToBytes() []byte {
+	return syntaxErrBytes
+}
+
+func (r *SyntaxErrReply) Error() string {
+	return "ERR syntax error"
+}
+
+func MakeSyntaxErrReply() *SyntaxErrReply {
+	return theSyntaxErrReply
+}
+
+/* --------- 数据类型错误 --------- */
+type WrongTypeErrReply struct{}
+
+var wrongTypeErrBytes = []byte("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+
+// marshals 安排 redis.Reply ToBytes
+func (r *WrongTypeErrReply) ToBytes() []byte {
+	return wrongTypeErrBytes
+}
+
+func (r *WrongTypeErrReply) Error() string {
+	return "WRONGTYPE Operation against a key holding the wrong kind of value"
+}
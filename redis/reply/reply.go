@@ -11,7 +11,7 @@ import (
 )
 
 var (
-	nullBulkReplyBytes = []byte("$-1")
+	nullBulkReplyBytes = []byte("$-1\r\n")
 
 	CRLF = "\r\n"
 )
@@ -52,7 +52,8 @@ func MakeErrReply(status string) *StandardErrReply {
 
 func IsErrorReply(reply redis.Reply) bool {
 	// 如果是错误 '-' 返回 true
-	return reply.ToBytes()[0] == '-'
+	b := reply.ToBytes()
+	return len(b) > 0 && b[0] == '-'
 }
 
 // marshal ToBytes 安排 redis.Reply
@@ -126,7 +127,7 @@ func MakeBulkReply(arg []byte) *BulkReply {
 func (r *BulkReply) ToBytes() []byte {
 	// $3/r/n
 	// foo/r/n
-	if len(r.Arg) == 0 {
+	if r.Arg == nil {
 		return nullBulkReplyBytes
 	}
 	return []byte("$" + strconv.Itoa(len(r.Arg)) + CRLF + string(r.Arg) + CRLF)
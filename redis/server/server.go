@@ -53,49 +53,107 @@ func (h *RedisHandler) Handle(ctx context.Context, conn net.Conn) {
 
 	// 开始解析请求
 	ch := parser.ParseStream(conn)
-	for payload := range ch {
-		if payload.Err != nil {
-			// 读取错误
-			if payload.Err == io.EOF ||
-				payload.Err == io.ErrUnexpectedEOF ||
-				strings.Contains(payload.Err.Error(), "use of closed network connection") {
-				// 关闭连接
-				h.closeClient(client)
-				logger.Info("connection closed: " + client.RemoteAddr().String())
+	// 阻塞指令挂起期间收到的请求
+	var pending []*parser.Payload
+	for {
+		var payload *parser.Payload
+		if len(pending) > 0 {
+			payload, pending = pending[0], pending[1:]
+		} else {
+			var ok bool
+			payload, ok = <-ch
+			if !ok {
 				return
 			}
+		}
 
-			// 协议错误
-			errReply := reply.MakeErrReply(payload.Err.Error())
-			err := client.Write(errReply.ToBytes())
-			if err != nil {
+		if !h.handlePayload(client, payload) {
+			return
+		}
+
+		if client.IsBlocked() {
+			// 等待阻塞指令返回后再处理后续请求，保证响应顺序
+			more, alive := h.waitUnblocked(client, ch)
+			pending = append(pending, more...)
+			if !alive {
 				h.closeClient(client)
 				logger.Info("connection closed: " + client.RemoteAddr().String())
 				return
 			}
-
-			continue
 		}
+	}
+}
 
-		if payload.Data == nil {
-			logger.Error("empty payload")
-			continue
-		}
+// 判断是否为连接关闭错误
+func isClosedErr(err error) bool {
+	return err == io.EOF ||
+		err == io.ErrUnexpectedEOF ||
+		strings.Contains(err.Error(), "use of closed network connection")
+}
 
-		r, ok := payload.Data.(*reply.MultiBulkReply)
-		if !ok {
-			logger.Error("require multi bulk reply")
-			continue
+// 处理一个请求，连接关闭时返回 false
+func (h *RedisHandler) handlePayload(client *connection.Connection, payload *parser.Payload) bool {
+	if payload.Err != nil {
+		// 读取错误
+		if isClosedErr(payload.Err) {
+			// 关闭连接
+			h.closeClient(client)
+			logger.Info("connection closed: " + client.RemoteAddr().String())
+			return false
 		}
 
-		// 执行指令
-		result := h.db.Exec(client, r.Args)
-		if result != nil {
-			_ = client.Write(result.ToBytes())
-		} else {
-			_ = client.Write(unknowErrReplyBytes)
+		// 协议错误
+		errReply := reply.MakeErrReply(payload.Err.Error())
+		err := client.Write(errReply.ToBytes())
+		if err != nil {
+			h.closeClient(client)
+			logger.Info("connection closed: " + client.RemoteAddr().String())
+			return false
 		}
+		return true
+	}
 
+	if payload.Data == nil {
+		logger.Error("empty payload")
+		return true
+	}
+
+	r, ok := payload.Data.(*reply.MultiBulkReply)
+	if !ok {
+		logger.Error("require multi bulk reply")
+		return true
+	}
+
+	// 执行指令
+	result := h.db.Exec(client, r.Args)
+	if result != nil {
+		_ = client.Write(result.ToBytes())
+	} else {
+		_ = client.Write(unknowErrReplyBytes)
+	}
+
+	if strings.ToLower(string(r.Args[0])) == "quit" {
+		h.closeClient(client)
+		logger.Info("connection closed: " + client.RemoteAddr().String())
+		return false
+	}
+	return true
+}
+
+// 等待阻塞指令返回，期间继续读取请求以便发现客户端断开连接
+// 返回挂起期间收到的请求，以及连接是否仍然存活
+func (h *RedisHandler) waitUnblocked(client *connection.Connection, ch <-chan *parser.Payload) ([]*parser.Payload, bool) {
+	var pending []*parser.Payload
+	for {
+		select {
+		case <-client.Unblocked():
+			return pending, true
+		case payload, ok := <-ch:
+			if !ok || (payload.Err != nil && isClosedErr(payload.Err)) {
+				return pending, false
+			}
+			pending = append(pending, payload)
+		}
 	}
 }
 